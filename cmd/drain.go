@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/allocator"
+)
+
+// drainer stops accepting miners and moves the connected ones to the sibling router before the app exits
+type drainer struct {
+	host    string
+	port    int
+	timeout time.Duration
+	started atomic.Bool
+
+	ctx     context.Context
+	servers []*transport.TCPServer
+	alloc   *allocator.Allocator
+	onDone  func()
+	log     interfaces.ILogger
+}
+
+// newDrainer creates drainer, empty target means that miners reconnect to the same address
+func newDrainer(ctx context.Context, target string, timeout time.Duration, alloc *allocator.Allocator, servers []*transport.TCPServer, onDone func(), log interfaces.ILogger) (*drainer, error) {
+	d := &drainer{
+		timeout: timeout,
+		ctx:     ctx,
+		servers: servers,
+		alloc:   alloc,
+		onDone:  onDone,
+		log:     log,
+	}
+	if target != "" {
+		host, portStr, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, err
+		}
+		d.host, d.port = host, port
+	}
+	return d, nil
+}
+
+// Start starts the drain in background, returns false if it is already started
+func (d *drainer) Start() bool {
+	if !d.started.CompareAndSwap(false, true) {
+		return false
+	}
+	go d.run()
+	return true
+}
+
+func (d *drainer) IsDraining() bool {
+	return d.started.Load()
+}
+
+func (d *drainer) run() {
+	target := "the same address"
+	if d.host != "" {
+		target = net.JoinHostPort(d.host, strconv.Itoa(d.port))
+	}
+	d.log.Warnf("drain started, miners are asked to reconnect to %s, timeout %s", target, d.timeout)
+
+	for _, server := range d.servers {
+		server.StopAccepting()
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+
+	err := d.alloc.Drain(ctx, d.host, d.port)
+	if err != nil {
+		d.log.Warnf("drain timed out: %s", err)
+	}
+
+	d.log.Warnf("drain finished, exiting")
+	d.onDone()
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// drainSignals start the drain mode
+var drainSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// drainSignals is empty, drain mode is only available via http on windows
+var drainSignals = []os.Signal{}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,8 +25,12 @@ import (
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/allocator"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/contract"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/failover"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_noise"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/recorder"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/system"
 	"golang.org/x/sync/errgroup"
@@ -187,14 +193,80 @@ func start() error {
 		)
 	}
 
+	poolTLSConfig, err := lib.NewClientTLSConfig(cfg.Pool.TLSCAFile)
+	if err != nil {
+		return err
+	}
+
 	destFactory := func(ctx context.Context, url *url.URL, srcWorker string, srcAddr string) (*proxy.ConnDest, error) {
 		validator := validator.NewValidator(cfg.Pool.CleanJobTimeout)
-		return proxy.ConnectDest(ctx, url, validator, IDLE_READ_CLOSE_TIMEOUT, cfg.Pool.IdleWriteTimeout, connLog.With("SrcWorker", srcWorker, "SrcAddr", srcAddr))
+		return proxy.ConnectDest(ctx, url, poolTLSConfig, validator, IDLE_READ_CLOSE_TIMEOUT, cfg.Pool.IdleWriteTimeout, connLog.With("SrcWorker", srcWorker, "SrcAddr", srcAddr))
+	}
+
+	if cfg.Proxy.Aggregation {
+		aggregator := proxy.NewAggregator(
+			destFactory,
+			cfg.Proxy.AggregationPrefixSize, cfg.Proxy.AggregationMaxMiners,
+			cfg.Pool.CleanJobTimeout, IDLE_READ_CLOSE_TIMEOUT, cfg.Pool.IdleWriteTimeout,
+			connLog,
+		)
+		destFactory = aggregator.ConnectDest
+		appLog.Infof("pool connection aggregation enabled, extranonce2 prefix size %d", cfg.Proxy.AggregationPrefixSize)
 	}
 
 	globalHashrate := hashrate.NewGlobalHashrate(hashrateFactory)
+	blockCandidates := proxy.NewBlockCandidates()
 	alloc := allocator.NewAllocator(lib.NewCollection[*allocator.Scheduler](), log.Named("ALC"))
 
+	poolURLs := []*url.URL{destUrl}
+	for _, addr := range strings.Split(cfg.Pool.FailoverAddresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		poolURL, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("invalid failover pool address %s: %w", addr, err)
+		}
+		poolURLs = append(poolURLs, poolURL)
+	}
+
+	poolFailover := failover.NewFailover(
+		poolURLs,
+		func(ctx context.Context, poolURL *url.URL) error {
+			return proxy.ProbeDest(ctx, poolURL, poolTLSConfig, connLog.Named("PROBE"))
+		},
+		cfg.Pool.HealthCheckInterval, cfg.Pool.HealthCheckTimeout,
+		log.Named("FLV"),
+	)
+	poolFailover.OnChange(alloc.SwitchPrimaryPool)
+
+	var routingRules []routing.Rule
+	if cfg.Proxy.RoutingRulesFile != "" {
+		routingRules, err = routing.LoadRulesFile(cfg.Proxy.RoutingRulesFile)
+		if err != nil {
+			return err
+		}
+		appLog.Infof("loaded %d routing rules", len(routingRules))
+	}
+	router, err := routing.NewRouter(routingRules)
+	if err != nil {
+		return err
+	}
+
+	var sessionRecorder *recorder.Recorder
+	if cfg.Proxy.RecordDir != "" {
+		sessionRecorder, err = recorder.NewRecorder(recorder.Config{
+			Dir:       cfg.Proxy.RecordDir,
+			Workers:   lib.SplitList(cfg.Proxy.RecordWorkers),
+			Contracts: lib.SplitList(cfg.Proxy.RecordContracts),
+		}, connLog.Named("REC"))
+		if err != nil {
+			return err
+		}
+		appLog.Infof("session recording enabled, writing to %s", cfg.Proxy.RecordDir)
+	}
+
 	ethClient, err := ethclient.DialContext(ctx, cfg.Blockchain.EthNodeAddress)
 	if err != nil {
 		return lib.WrapError(ErrConnectToEthNode, err)
@@ -209,6 +281,11 @@ func start() error {
 
 	store.SetLegacyTx(cfg.Blockchain.EthLegacyTx)
 
+	contractDestParams, err := contract.ParseContractDestParams(cfg.Hashrate.ContractDestParams)
+	if err != nil {
+		return err
+	}
+
 	hrContractFactory, err := contract.NewContractFactory(
 		alloc,
 		hashrateFactory,
@@ -224,6 +301,7 @@ func start() error {
 		cfg.Hashrate.ValidatorFlatness,
 		appStartTime.Add(cfg.Hashrate.ValidationTimeoutAppStart),
 		destUrl,
+		contractDestParams,
 	)
 	if err != nil {
 		return err
@@ -247,20 +325,110 @@ func start() error {
 
 	cm := contractmanager.NewContractManager(common.HexToAddress(cfg.Marketplace.CloneFactoryAddress), walletAddr, hrContractFactory.CreateContract, store, log.Named("MNG"))
 
+	proxyProtocolTrusted, err := lib.ParseCIDRList(cfg.Proxy.ProxyProtocolTrusted)
+	if err != nil {
+		return fmt.Errorf("invalid proxy protocol trusted networks: %w", err)
+	}
+	// the header sent by an untrusted client would bypass the per IP limits
+	if cfg.Proxy.ProxyProtocol && len(proxyProtocolTrusted) == 0 {
+		return fmt.Errorf("proxy protocol requires the list of trusted networks")
+	}
+	// load balancers are exempt from the limits, miner addresses are taken from the proxy protocol header
+	var admissionExempt []*net.IPNet
+	if cfg.Proxy.ProxyProtocol {
+		admissionExempt = proxyProtocolTrusted
+	}
+	admission := transport.NewAdmission(transport.AdmissionConfig{
+		MaxConns:              cfg.Proxy.MaxConns,
+		MaxConnsPerIP:         cfg.Proxy.MaxConnsPerIP,
+		HandshakesPerMinPerIP: cfg.Proxy.HandshakeRate,
+		BanThreshold:          cfg.Proxy.BanThreshold,
+		BanWindow:             cfg.Proxy.BanWindow,
+		BanDuration:           cfg.Proxy.BanDuration,
+		Exempt:                admissionExempt,
+	}, connLog.Named("ADM"))
+
+	setupMinerServer := func(server *transport.TCPServer) {
+		if cfg.Proxy.ProxyProtocol {
+			server.SetProxyProtocol(proxyProtocolTrusted)
+		}
+		server.SetAdmission(admission)
+	}
+
 	tcpServer := transport.NewTCPServer(cfg.Proxy.Address, connLog.Named("TCP"))
+	setupMinerServer(tcpServer)
 	tcpHandler := tcphandlers.NewTCPHandler(
 		log, connLog, proxyLog, schedulerLogFactory,
 		cfg.Miner.NotPropagateWorkerName, cfg.Miner.IdleReadTimeout, IDLE_WRITE_CLOSE_TIMEOUT,
 		cfg.Miner.VettingShares, cfg.Proxy.MaxCachedDests,
-		destUrl,
+		proxy.VardiffConfig{
+			TargetSharesPerMin: cfg.Miner.VardiffTarget,
+			MinDiff:            cfg.Miner.VardiffMinDiff,
+			MaxDiff:            cfg.Miner.VardiffMaxDiff,
+			RetargetInterval:   cfg.Miner.VardiffRetarget,
+		},
+		poolFailover.GetActive,
+		router,
 		destFactory, hashrateFactory,
 		globalHashrate, HashrateCounterDefault,
 		alloc,
+		admission,
+		sessionRecorder,
+		blockCandidates,
 		cm.GetContract,
 	)
 	tcpServer.SetConnectionHandler(tcpHandler)
 
-	handl := httphandlers.NewHTTPHandler(alloc, cm, globalHashrate, sysConfig, publicUrl, HashrateCounterDefault, cfg.Hashrate.CycleDuration, &cfg, derived, appStartTime, contractLogStorage, log)
+	var tlsServer *transport.TCPServer
+	if cfg.Proxy.TLSAddress != "" {
+		tlsConfig, err := lib.NewServerTLSConfig(cfg.Proxy.TLSCertFile, cfg.Proxy.TLSKeyFile, cfg.Proxy.TLSClientCAFile)
+		if err != nil {
+			return err
+		}
+		tlsServer = transport.NewTCPServer(cfg.Proxy.TLSAddress, connLog.Named("TLS"))
+		tlsServer.SetTLSConfig(tlsConfig)
+		setupMinerServer(tlsServer)
+		tlsServer.SetConnectionHandler(tcpHandler)
+	}
+
+	var sv2Server *transport.TCPServer
+	if cfg.Proxy.SV2Address != "" {
+		var noiseCfg *stratumv2_noise.ResponderConfig
+		if !cfg.Proxy.SV2NoEncryption {
+			noiseCfg, err = newNoiseConfig(cfg.Proxy.SV2AuthorityKey, cfg.Proxy.SV2CertValidity, appLog)
+			if err != nil {
+				return err
+			}
+		} else {
+			appLog.Warnf("stratum v2 encryption is disabled")
+		}
+
+		sv2Server = transport.NewTCPServer(cfg.Proxy.SV2Address, connLog.Named("SV2"))
+		setupMinerServer(sv2Server)
+		sv2Server.SetConnectionHandler(tcphandlers.NewSV2Handler(tcpHandler, noiseCfg, connLog))
+	}
+
+	minerServers := []*transport.TCPServer{tcpServer}
+	for _, server := range []*transport.TCPServer{tlsServer, sv2Server} {
+		if server != nil {
+			minerServers = append(minerServers, server)
+		}
+	}
+	drain, err := newDrainer(ctx, cfg.Proxy.DrainTarget, cfg.Proxy.DrainTimeout, alloc, minerServers, cancel, appLog)
+	if err != nil {
+		return err
+	}
+	if len(drainSignals) > 0 {
+		drainChan := make(chan os.Signal, 1)
+		signal.Notify(drainChan, drainSignals...)
+		go func() {
+			s := <-drainChan
+			appLog.Warnf("Received signal: %s", s)
+			drain.Start()
+		}()
+	}
+
+	handl := httphandlers.NewHTTPHandler(alloc, poolFailover, router, admission, cm, globalHashrate, sysConfig, drain, blockCandidates, publicUrl, HashrateCounterDefault, cfg.Hashrate.CycleDuration, &cfg, derived, appStartTime, contractLogStorage, log)
 	httpServer := transport.NewServer(cfg.Web.Address, handl, log.Named("HTP"))
 
 	ctx, cancel = context.WithCancel(ctx)
@@ -269,10 +437,30 @@ func start() error {
 		return tcpServer.Run(errCtx)
 	})
 
+	if tlsServer != nil {
+		g.Go(func() error {
+			return tlsServer.Run(errCtx)
+		})
+	}
+
+	if sv2Server != nil {
+		g.Go(func() error {
+			return sv2Server.Run(errCtx)
+		})
+	}
+
 	g.Go(func() error {
 		return cm.Run(errCtx)
 	})
 
+	g.Go(func() error {
+		return poolFailover.Run(errCtx)
+	})
+
+	g.Go(func() error {
+		return admission.Run(errCtx)
+	})
+
 	g.Go(func() error {
 		for {
 			select {
@@ -311,3 +499,27 @@ func start() error {
 	logFn("App exited due to %s", err)
 	return err
 }
+
+// newNoiseConfig creates stratum v2 noise static key signed by the authority key. If authority key
+// is not provided it is generated, so miners have to be reconfigured after each restart
+func newNoiseConfig(authorityKeyHex string, certValidity time.Duration, log interfaces.ILogger) (*stratumv2_noise.ResponderConfig, error) {
+	var authority *stratumv2_noise.Keypair
+	var err error
+
+	if authorityKeyHex == "" {
+		authority, err = stratumv2_noise.GenerateKeypair()
+		if err != nil {
+			return nil, err
+		}
+		log.Warnf("stratum v2 authority key is not set, generated a new one, set PROXY_SV2_AUTHORITY_KEY to persist it")
+	} else {
+		authority, err = stratumv2_noise.KeypairFromHex(authorityKeyHex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("stratum v2 authority public key: %s", stratumv2_noise.EncodeAuthorityPublicKey(authority.PublicKey()))
+
+	return stratumv2_noise.NewResponderConfig(authority, certValidity)
+}
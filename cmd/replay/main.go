@@ -0,0 +1,69 @@
+// Replay runs the proxy against the stratum session recorded with PROXY_RECORD_DIR and reports
+// the messages the proxy wrote differently from the recording.
+//
+//	go run ./cmd/replay -timeout 5s logs/records/20240101t120000.000_acc1.rig1_10.0.0.1_5000.jsonl
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/recorder"
+)
+
+func main() {
+	ok, err := start()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func start() (bool, error) {
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for each message expected from the proxy")
+	notPropagateWorkerName := flag.Bool("not-propagate-worker-name", false, "should match MINER_NOT_PROPAGATE_WORKER_NAME of the recorded proxy")
+	logLevel := flag.String("log-level", "warn", "log level of the replayed proxy")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		return false, fmt.Errorf("usage: replay [flags] <recording.jsonl>")
+	}
+
+	log, err := lib.NewLogger(*logLevel, true, false, false, "")
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = log.Sync() }()
+
+	records, err := recorder.ReadFile(flag.Arg(0))
+	if err != nil {
+		return false, err
+	}
+
+	report, err := proxy.Replay(context.Background(), records, proxy.ReplayConfig{
+		NotPropagateWorkerName: *notPropagateWorkerName,
+		Timeout:                *timeout,
+	}, log)
+	if report != nil {
+		fmt.Printf("records: %d, sent: %d, matched: %d, skipped: %d\n", len(records), report.Sent, report.Matched, report.Skipped)
+		for _, m := range report.Mismatches {
+			fmt.Printf("\nmismatch at record %d (%s)\n  expected: %s\n  actual:   %s\n", m.Record, m.Side, m.Expected, m.Actual)
+		}
+		for _, msg := range report.Unexpected {
+			fmt.Printf("\nunexpected: %s\n", msg)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	return report.OK(), nil
+}
@@ -24,6 +24,7 @@ type Config struct {
 		ShareTimeout              time.Duration `env:"HASHRATE_SHARE_TIMEOUT"                flag:"hashrate-share-timeout"                validate:"omitempty,duration"  desc:"time to wait for the share to arrive, otherwise close contract, applies for buyer"`
 		ValidatorFlatness         time.Duration `env:"HASHRATE_VALIDATION_FLATNESS"          flag:"hashrate-validation-flatness"          validate:"omitempty,duration"  desc:"artificial parameter of validation function, applies for buyer"`
 		ValidationTimeoutAppStart time.Duration `env:"HASHRATE_VALIDATION_TIMEOUT_APP_START" flag:"hashrate-validation-timeout-app-start" validate:"omitempty,duration"  desc:"disables validation of the incoming hashrate for specified amount of time right after application startup"`
+		ContractDestParams        string        `env:"HASHRATE_CONTRACT_DEST_PARAMS"         flag:"hashrate-contract-dest-params"                                        desc:"comma separated list of contractID?params, the destination url params (e.g. pow=scrypt, payout=<address>) applied to the destination of the contract"`
 	}
 	Marketplace struct {
 		CloneFactoryAddress string `env:"CLONE_FACTORY_ADDRESS" flag:"contract-address"   validate:"required_if=Disable false,omitempty,eth_addr"`
@@ -34,6 +35,10 @@ type Config struct {
 		NotPropagateWorkerName bool          `env:"MINER_NOT_PROPAGATE_WORKER_NAME" flag:"miner-not-propagate-worker-name"     validate:""                      desc:"not preserve worker name from the source in the destination pool. Preserving works only if the source miner worker name is defined as 'accountName.workerName'. Does not apply for contracts"`
 		IdleReadTimeout        time.Duration `env:"MINER_IDLE_READ_TIMEOUT"         flag:"miner-idle-read-timeout"             validate:"omitempty,duration"    desc:"closes connection if no read operation performed for this duration (e.g. no share submitted)"`
 		VettingShares          int           `env:"MINER_VETTING_SHARES"            flag:"miner-vetting-shares"                validate:"omitempty,number"`
+		VardiffTarget          float64       `env:"MINER_VARDIFF_TARGET"            flag:"miner-vardiff-target"                validate:"omitempty,gte=0"       desc:"enables proxy-side variable difficulty targeting this number of shares per minute per miner, only shares meeting the pool difficulty are forwarded. Disabled if zero"`
+		VardiffMinDiff         float64       `env:"MINER_VARDIFF_MIN_DIFF"          flag:"miner-vardiff-min-diff"              validate:"omitempty,gte=0"       desc:"minimum difficulty set by vardiff"`
+		VardiffMaxDiff         float64       `env:"MINER_VARDIFF_MAX_DIFF"          flag:"miner-vardiff-max-diff"              validate:"omitempty,gte=0"       desc:"maximum difficulty set by vardiff, unbounded if zero"`
+		VardiffRetarget        time.Duration `env:"MINER_VARDIFF_RETARGET_INTERVAL" flag:"miner-vardiff-retarget-interval"     validate:"omitempty,duration"    desc:"minimal interval between vardiff difficulty adjustments"`
 	}
 	Log struct {
 		Color           bool   `env:"LOG_COLOR"            flag:"log-color"`
@@ -47,13 +52,42 @@ type Config struct {
 		LevelContract   string `env:"LOG_LEVEL_CONTRACT"   flag:"log-level-contract"   validate:"omitempty,oneof=debug info warn error dpanic panic fatal"`
 	}
 	Pool struct {
-		Address          string        `env:"POOL_ADDRESS" flag:"pool-address" validate:"required,uri"`
-		CleanJobTimeout  time.Duration `env:"POOL_CLEAN_JOB_TIMEOUT" flag:"pool-clean-job-timeout" validate:"duration" desc:"duration after which jobs are removed from the cache after receiving clean_jobs flag from the pool notify message"`
-		IdleWriteTimeout time.Duration `env:"POOL_IDLE_WRITE_TIMEOUT" flag:"pool-idle-write-timeout" validate:"duration" desc:"if there are no writes for this duration, the connection is going to be closed"`
+		Address             string        `env:"POOL_ADDRESS" flag:"pool-address" validate:"required,uri"`
+		FailoverAddresses   string        `env:"POOL_FAILOVER_ADDRESSES" flag:"pool-failover-addresses" validate:"omitempty" desc:"comma separated list of backup pool urls in priority order, miners fail over to them when POOL_ADDRESS is down and fail back when it recovers"`
+		HealthCheckInterval time.Duration `env:"POOL_HEALTH_CHECK_INTERVAL" flag:"pool-health-check-interval" validate:"omitempty,duration" desc:"interval between default pool health checks (connect, subscribe and authorize)"`
+		HealthCheckTimeout  time.Duration `env:"POOL_HEALTH_CHECK_TIMEOUT" flag:"pool-health-check-timeout" validate:"omitempty,duration" desc:"timeout of a single pool health check"`
+		CleanJobTimeout     time.Duration `env:"POOL_CLEAN_JOB_TIMEOUT" flag:"pool-clean-job-timeout" validate:"duration" desc:"duration after which jobs are removed from the cache after receiving clean_jobs flag from the pool notify message"`
+		IdleWriteTimeout    time.Duration `env:"POOL_IDLE_WRITE_TIMEOUT" flag:"pool-idle-write-timeout" validate:"duration" desc:"if there are no writes for this duration, the connection is going to be closed"`
+		TLSCAFile           string        `env:"POOL_TLS_CA_FILE" flag:"pool-tls-ca-file" validate:"omitempty,file" desc:"path to the PEM encoded CA bundle to verify stratum+ssl pools, system CA pool is used if empty. Per destination the CA can be set with the ca url query parameter (base64 DER) and the certificate can be pinned with the pin-sha256 parameter"`
 	}
 	Proxy struct {
-		Address        string `env:"PROXY_ADDRESS" flag:"proxy-address" validate:"required,hostname_port"`
-		MaxCachedDests int    `env:"PROXY_MAX_CACHED_DESTS" flag:"proxy-max-cached-dests" validate:"required,number" desc:"maximum number of cached destinations per proxy"`
+		Address               string        `env:"PROXY_ADDRESS" flag:"proxy-address" validate:"required,hostname_port"`
+		Aggregation           bool          `env:"PROXY_AGGREGATION" flag:"proxy-aggregation" desc:"miners going to the same destination share one pool connection, each miner gets a disjoint part of the pool extranonce2 space. Worker names are not propagated to the pool in this mode"`
+		AggregationPrefixSize int           `env:"PROXY_AGGREGATION_PREFIX_SIZE" flag:"proxy-aggregation-prefix-size" validate:"omitempty,min=1,max=4" desc:"bytes of the pool extranonce2 reserved to distinguish miners in the shared connection"`
+		AggregationMaxMiners  int           `env:"PROXY_AGGREGATION_MAX_MINERS" flag:"proxy-aggregation-max-miners" validate:"omitempty,min=1" desc:"maximum number of miners per shared pool connection, new connection is opened when exceeded"`
+		BanDuration           time.Duration `env:"PROXY_BAN_DURATION" flag:"proxy-ban-duration" validate:"omitempty,duration" desc:"for how long the miner ip is banned"`
+		BanThreshold          int           `env:"PROXY_BAN_THRESHOLD" flag:"proxy-ban-threshold" validate:"omitempty,min=0" desc:"number of failures (non-stratum connections, too many invalid shares, unknown contracts) within the ban window to temporarily ban the miner ip, 0 disables bans"`
+		BanWindow             time.Duration `env:"PROXY_BAN_WINDOW" flag:"proxy-ban-window" validate:"omitempty,duration" desc:"window in which failures are counted for the ban threshold"`
+		DrainTarget           string        `env:"PROXY_DRAIN_TARGET" flag:"proxy-drain-target" validate:"omitempty,hostname_port" desc:"address of the sibling router the miners are asked to reconnect to (client.reconnect) during drain. If empty miners are asked to reconnect to the same address, e.g. through the load balancer. Drain is started with SIGUSR1 or POST /drain"`
+		DrainTimeout          time.Duration `env:"PROXY_DRAIN_TIMEOUT" flag:"proxy-drain-timeout" validate:"omitempty,duration" desc:"maximum duration of the drain, the router exits after it even if miners are still connected. Defaults to two hashrate cycles"`
+		HandshakeRate         int           `env:"PROXY_HANDSHAKE_RATE_PER_MIN" flag:"proxy-handshake-rate-per-min" validate:"omitempty,min=0" desc:"maximum number of new miner connections per minute from a single ip, 0 is unlimited"`
+		MaxCachedDests        int           `env:"PROXY_MAX_CACHED_DESTS" flag:"proxy-max-cached-dests" validate:"required,number" desc:"maximum number of cached destinations per proxy"`
+		MaxConns              int           `env:"PROXY_MAX_CONNECTIONS" flag:"proxy-max-connections" validate:"omitempty,min=0" desc:"maximum number of miner connections in total, 0 is unlimited"`
+		MaxConnsPerIP         int           `env:"PROXY_MAX_CONNECTIONS_PER_IP" flag:"proxy-max-connections-per-ip" validate:"omitempty,min=0" desc:"maximum number of miner connections from a single ip, 0 is unlimited. Load balancers from the proxy protocol trusted networks are exempt from the limits and bans"`
+		ProxyProtocol         bool          `env:"PROXY_PROXY_PROTOCOL" flag:"proxy-proxy-protocol" desc:"expect HAProxy PROXY protocol v1/v2 header on the miner listeners to get the real miner address when running behind a load balancer"`
+		ProxyProtocolTrusted  string        `env:"PROXY_PROXY_PROTOCOL_TRUSTED_CIDRS" flag:"proxy-proxy-protocol-trusted-cidrs" validate:"required_if=ProxyProtocol true" desc:"comma separated list of networks of the load balancers allowed to send PROXY protocol header, connections from other networks are treated as direct. Required if PROXY protocol is enabled"`
+		RecordContracts       string        `env:"PROXY_RECORD_CONTRACTS" flag:"proxy-record-contracts" validate:"omitempty" desc:"comma separated list of incoming contract IDs which sessions are recorded"`
+		RecordDir             string        `env:"PROXY_RECORD_DIR" flag:"proxy-record-dir" validate:"omitempty" desc:"directory to write stratum session recordings to (JSONL, one message per line), recording is disabled if empty. Recordings can be replayed with cmd/replay"`
+		RecordWorkers         string        `env:"PROXY_RECORD_WORKERS" flag:"proxy-record-workers" validate:"omitempty" desc:"comma separated list of glob patterns matched against the miner username to select sessions to record, e.g. \"acc1.*\""`
+		RoutingRulesFile      string        `env:"PROXY_ROUTING_RULES_FILE" flag:"proxy-routing-rules-file" validate:"omitempty,file" desc:"path to the json file with the list of rules routing miners to default destinations by worker name pattern, account prefix or source network. Rules can be edited at runtime with the /routing-rules endpoint"`
+		SV2Address            string        `env:"PROXY_SV2_ADDRESS" flag:"proxy-sv2-address" validate:"omitempty,hostname_port" desc:"address of the stratum v2 listener for miners, disabled if empty"`
+		SV2AuthorityKey       string        `env:"PROXY_SV2_AUTHORITY_KEY" flag:"proxy-sv2-authority-key" validate:"omitempty,hexadecimal" desc:"hex secp256k1 private key used to sign the stratum v2 noise static key, generated on startup if empty"`
+		SV2CertValidity       time.Duration `env:"PROXY_SV2_CERT_VALIDITY" flag:"proxy-sv2-cert-validity" validate:"omitempty,duration" desc:"validity period of the stratum v2 noise certificate"`
+		SV2NoEncryption       bool          `env:"PROXY_SV2_NO_ENCRYPTION" flag:"proxy-sv2-no-encryption" desc:"disables noise encryption for stratum v2 miners, use only in trusted networks"`
+		TLSAddress            string        `env:"PROXY_TLS_ADDRESS" flag:"proxy-tls-address" validate:"omitempty,hostname_port" desc:"address of the TLS (stratum+ssl) listener for miners, runs alongside the plain listener, disabled if empty"`
+		TLSCertFile           string        `env:"PROXY_TLS_CERT_FILE" flag:"proxy-tls-cert-file" validate:"required_with=TLSAddress,omitempty,file" desc:"path to the PEM encoded certificate (chain) of the TLS listener"`
+		TLSKeyFile            string        `env:"PROXY_TLS_KEY_FILE" flag:"proxy-tls-key-file" validate:"required_with=TLSAddress,omitempty,file" desc:"path to the PEM encoded private key of the TLS listener"`
+		TLSClientCAFile       string        `env:"PROXY_TLS_CLIENT_CA_FILE" flag:"proxy-tls-client-ca-file" validate:"omitempty,file" desc:"path to the PEM encoded CA bundle, if set miners are required to present a client certificate signed by it"`
 	}
 	System struct {
 		Enable           bool   `env:"SYS_ENABLE"              flag:"sys-enable" desc:"enable system level configuration adjustments"`
@@ -115,6 +149,14 @@ func (cfg *Config) SetDefaults() {
 		cfg.Miner.IdleReadTimeout = 10 * time.Minute
 	}
 
+	if cfg.Miner.VardiffMinDiff == 0 {
+		cfg.Miner.VardiffMinDiff = 1
+	}
+
+	if cfg.Miner.VardiffRetarget == 0 {
+		cfg.Miner.VardiffRetarget = 90 * time.Second
+	}
+
 	// Log
 
 	if cfg.Log.LevelConnection == "" {
@@ -140,11 +182,36 @@ func (cfg *Config) SetDefaults() {
 	if cfg.Pool.CleanJobTimeout == 0 {
 		cfg.Pool.CleanJobTimeout = 2 * time.Minute
 	}
+	if cfg.Pool.HealthCheckInterval == 0 {
+		cfg.Pool.HealthCheckInterval = 30 * time.Second
+	}
+	if cfg.Pool.HealthCheckTimeout == 0 {
+		cfg.Pool.HealthCheckTimeout = 10 * time.Second
+	}
 
 	// Proxy
 	if cfg.Proxy.MaxCachedDests == 0 {
 		cfg.Proxy.MaxCachedDests = 5
 	}
+	if cfg.Proxy.BanWindow == 0 {
+		cfg.Proxy.BanWindow = 10 * time.Minute
+	}
+	if cfg.Proxy.BanDuration == 0 {
+		cfg.Proxy.BanDuration = time.Hour
+	}
+	if cfg.Proxy.DrainTimeout == 0 {
+		cfg.Proxy.DrainTimeout = 2 * cfg.Hashrate.CycleDuration
+	}
+	if cfg.Proxy.AggregationPrefixSize == 0 {
+		cfg.Proxy.AggregationPrefixSize = 2
+	}
+	if cfg.Proxy.AggregationMaxMiners == 0 {
+		cfg.Proxy.AggregationMaxMiners = 1024
+	}
+	if cfg.Proxy.SV2CertValidity == 0 {
+		cfg.Proxy.SV2CertValidity = 365 * 24 * time.Hour
+	}
+	cfg.Proxy.SV2AuthorityKey = strings.TrimPrefix(cfg.Proxy.SV2AuthorityKey, "0x")
 
 	// System
 
@@ -201,12 +268,17 @@ func (cfg *Config) GetSanitized() interface{} {
 	publicCfg.Hashrate.ShareTimeout = cfg.Hashrate.ShareTimeout
 	publicCfg.Hashrate.ValidatorFlatness = cfg.Hashrate.ValidatorFlatness
 	publicCfg.Hashrate.ValidationTimeoutAppStart = cfg.Hashrate.ValidationTimeoutAppStart
+	publicCfg.Hashrate.ContractDestParams = cfg.Hashrate.ContractDestParams
 
 	publicCfg.Marketplace.CloneFactoryAddress = cfg.Marketplace.CloneFactoryAddress
 
 	publicCfg.Miner.NotPropagateWorkerName = cfg.Miner.NotPropagateWorkerName
 	publicCfg.Miner.IdleReadTimeout = cfg.Miner.IdleReadTimeout
 	publicCfg.Miner.VettingShares = cfg.Miner.VettingShares
+	publicCfg.Miner.VardiffTarget = cfg.Miner.VardiffTarget
+	publicCfg.Miner.VardiffMinDiff = cfg.Miner.VardiffMinDiff
+	publicCfg.Miner.VardiffMaxDiff = cfg.Miner.VardiffMaxDiff
+	publicCfg.Miner.VardiffRetarget = cfg.Miner.VardiffRetarget
 
 	publicCfg.Log.Color = cfg.Log.Color
 	publicCfg.Log.FolderPath = cfg.Log.FolderPath
@@ -219,9 +291,35 @@ func (cfg *Config) GetSanitized() interface{} {
 
 	publicCfg.Pool.Address = cfg.Pool.Address
 	publicCfg.Pool.IdleWriteTimeout = cfg.Pool.IdleWriteTimeout
+	publicCfg.Pool.TLSCAFile = cfg.Pool.TLSCAFile
+	publicCfg.Pool.HealthCheckInterval = cfg.Pool.HealthCheckInterval
+	publicCfg.Pool.HealthCheckTimeout = cfg.Pool.HealthCheckTimeout
 
 	publicCfg.Proxy.Address = cfg.Proxy.Address
+	publicCfg.Proxy.Aggregation = cfg.Proxy.Aggregation
+	publicCfg.Proxy.AggregationPrefixSize = cfg.Proxy.AggregationPrefixSize
+	publicCfg.Proxy.AggregationMaxMiners = cfg.Proxy.AggregationMaxMiners
+	publicCfg.Proxy.BanDuration = cfg.Proxy.BanDuration
+	publicCfg.Proxy.BanThreshold = cfg.Proxy.BanThreshold
+	publicCfg.Proxy.BanWindow = cfg.Proxy.BanWindow
+	publicCfg.Proxy.DrainTarget = cfg.Proxy.DrainTarget
+	publicCfg.Proxy.DrainTimeout = cfg.Proxy.DrainTimeout
+	publicCfg.Proxy.HandshakeRate = cfg.Proxy.HandshakeRate
 	publicCfg.Proxy.MaxCachedDests = cfg.Proxy.MaxCachedDests
+	publicCfg.Proxy.MaxConns = cfg.Proxy.MaxConns
+	publicCfg.Proxy.MaxConnsPerIP = cfg.Proxy.MaxConnsPerIP
+	publicCfg.Proxy.ProxyProtocol = cfg.Proxy.ProxyProtocol
+	publicCfg.Proxy.ProxyProtocolTrusted = cfg.Proxy.ProxyProtocolTrusted
+	publicCfg.Proxy.RecordContracts = cfg.Proxy.RecordContracts
+	publicCfg.Proxy.RecordDir = cfg.Proxy.RecordDir
+	publicCfg.Proxy.RecordWorkers = cfg.Proxy.RecordWorkers
+	publicCfg.Proxy.RoutingRulesFile = cfg.Proxy.RoutingRulesFile
+	publicCfg.Proxy.SV2Address = cfg.Proxy.SV2Address
+	publicCfg.Proxy.SV2CertValidity = cfg.Proxy.SV2CertValidity
+	publicCfg.Proxy.SV2NoEncryption = cfg.Proxy.SV2NoEncryption
+	publicCfg.Proxy.TLSAddress = cfg.Proxy.TLSAddress
+	publicCfg.Proxy.TLSCertFile = cfg.Proxy.TLSCertFile
+	publicCfg.Proxy.TLSClientCAFile = cfg.Proxy.TLSClientCAFile
 
 	publicCfg.System.Enable = cfg.System.Enable
 	publicCfg.System.LocalPortRange = cfg.System.LocalPortRange
@@ -0,0 +1,27 @@
+package httphandlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
+)
+
+func (c *HTTPHandler) GetBans(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.admission.GetBans())
+}
+
+func (c *HTTPHandler) ClearBans(ctx *gin.Context) {
+	c.admission.ClearBans()
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (c *HTTPHandler) ClearBan(ctx *gin.Context) {
+	err := c.admission.ClearBan(ctx.Param("IP"))
+	if errors.Is(err, transport.ErrBanNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,12 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBlockCandidates returns the shares that would solve the block, counted per miner, destination and contract
+func (c *HTTPHandler) GetBlockCandidates(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.blockCandidates.GetReport())
+}
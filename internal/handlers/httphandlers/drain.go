@@ -0,0 +1,24 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (c *HTTPHandler) GetDrain(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"draining": c.drainer.IsDraining(),
+		"miners":   c.allocator.GetMiners().Len(),
+	})
+}
+
+// StartDrain stops accepting new miners and asks the connected ones to reconnect to the sibling router
+// once their current tasks are finished. The router exits when all of the miners are gone or on timeout
+func (c *HTTPHandler) StartDrain(ctx *gin.Context) {
+	if !c.drainer.Start() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "drain is already started"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "draining"})
+}
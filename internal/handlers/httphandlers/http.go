@@ -17,10 +17,14 @@ import (
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/contractmanager"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/allocator"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/failover"
 	hr "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/system"
 )
 
@@ -28,6 +32,12 @@ type Proxy interface {
 	SetDest(ctx context.Context, newDestURL *url.URL, onSubmit func(diff float64)) error
 }
 
+// Drainer moves the miners to the sibling router before the app exits
+type Drainer interface {
+	Start() bool
+	IsDraining() bool
+}
+
 type ContractFactory func(contractData *hashrate.Terms) (resources.Contract, error)
 type Sanitizable interface {
 	GetSanitized() any
@@ -36,8 +46,13 @@ type Sanitizable interface {
 type HTTPHandler struct {
 	globalHashrate         *hr.GlobalHashrate
 	allocator              *allocator.Allocator
+	failover               *failover.Failover
+	router                 *routing.Router
+	admission              *transport.Admission
 	contractManager        *contractmanager.ContractManager
 	sysConfig              *system.SystemConfigurator
+	drainer                Drainer
+	blockCandidates        *proxy.BlockCandidates
 	cfg                    Sanitizable
 	cycleDuration          time.Duration
 	hashrateCounterDefault string
@@ -51,12 +66,17 @@ type HTTPHandler struct {
 	log                    interfaces.ILogger
 }
 
-func NewHTTPHandler(allocator *allocator.Allocator, contractManager *contractmanager.ContractManager, globalHashrate *hr.GlobalHashrate, sysConfig *system.SystemConfigurator, publicUrl *url.URL, hashrateCounter string, cycleDuration time.Duration, config Sanitizable, derivedConfig *config.DerivedConfig, appStartTime time.Time, logStorage *lib.Collection[*interfaces.LogStorage], log interfaces.ILogger) *gin.Engine {
+func NewHTTPHandler(allocator *allocator.Allocator, failover *failover.Failover, router *routing.Router, admission *transport.Admission, contractManager *contractmanager.ContractManager, globalHashrate *hr.GlobalHashrate, sysConfig *system.SystemConfigurator, drainer Drainer, blockCandidates *proxy.BlockCandidates, publicUrl *url.URL, hashrateCounter string, cycleDuration time.Duration, config Sanitizable, derivedConfig *config.DerivedConfig, appStartTime time.Time, logStorage *lib.Collection[*interfaces.LogStorage], log interfaces.ILogger) *gin.Engine {
 	handl := &HTTPHandler{
 		allocator:              allocator,
+		failover:               failover,
+		router:                 router,
+		admission:              admission,
 		contractManager:        contractManager,
 		globalHashrate:         globalHashrate,
 		sysConfig:              sysConfig,
+		drainer:                drainer,
+		blockCandidates:        blockCandidates,
 		publicUrl:              publicUrl,
 		hashrateCounterDefault: hashrateCounter,
 		cycleDuration:          cycleDuration,
@@ -76,6 +96,7 @@ func NewHTTPHandler(allocator *allocator.Allocator, contractManager *contractman
 	r.GET("/files", handl.GetFiles)
 
 	r.GET("/miners", handl.GetMiners)
+	r.GET("/pools", handl.GetPools)
 
 	r.GET("/contracts", handl.GetContracts)
 	r.GET("/contracts-v2", handl.GetContractsV2)
@@ -87,6 +108,20 @@ func NewHTTPHandler(allocator *allocator.Allocator, contractManager *contractman
 	r.GET("/workers", handl.GetWorkers)
 	r.POST("/change-dest", handl.ChangeDest)
 
+	r.GET("/routing-rules", handl.GetRoutingRules)
+	r.POST("/routing-rules", handl.AddRoutingRule)
+	r.PUT("/routing-rules", handl.SetRoutingRules)
+	r.DELETE("/routing-rules/:ID", handl.DeleteRoutingRule)
+
+	r.GET("/bans", handl.GetBans)
+	r.DELETE("/bans", handl.ClearBans)
+	r.DELETE("/bans/:IP", handl.ClearBan)
+
+	r.GET("/drain", handl.GetDrain)
+	r.POST("/drain", handl.StartDrain)
+
+	r.GET("/block-candidates", handl.GetBlockCandidates)
+
 	r.Any("/debug/pprof/*action", gin.WrapF(pprof.Index))
 
 	err := r.SetTrustedProxies(nil)
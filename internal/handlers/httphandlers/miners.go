@@ -93,6 +93,7 @@ func (c *HTTPHandler) MapMiner(m *allocator.Scheduler) *Miner {
 		Stats:                 m.GetStats(),                            // multiple atomics
 		Uptime:                formatDuration(m.GetUptime()),           // readonly
 		ActivePoolConnections: m.GetDestConns(),                        // sync map range + multiple atomics
+		ExtraNonceMode:        m.GetExtraNonceMode(),                   // atomic
 		// Destinations:          m.GetDestinations(c.cycleDuration),      // readonly temporarily
 	}
 }
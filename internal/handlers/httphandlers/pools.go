@@ -0,0 +1,30 @@
+package httphandlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (c *HTTPHandler) GetPools(ctx *gin.Context) {
+	Pools := []Pool{}
+
+	for _, p := range c.failover.GetStatus() {
+		lastCheckedAt := ""
+		if !p.LastCheckedAt.IsZero() {
+			lastCheckedAt = p.LastCheckedAt.Format(time.RFC3339)
+		}
+		Pools = append(Pools, Pool{
+			URL:                 p.URL,
+			Priority:            p.Priority,
+			IsHealthy:           p.IsHealthy,
+			IsActive:            p.IsActive,
+			LastCheckedAt:       lastCheckedAt,
+			LatencyMs:           p.Latency.Milliseconds(),
+			LastError:           p.LastError,
+			ConsecutiveFailures: p.ConsecutiveFailures,
+		})
+	}
+
+	ctx.JSON(200, Pools)
+}
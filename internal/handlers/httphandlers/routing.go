@@ -0,0 +1,65 @@
+package httphandlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
+)
+
+// Routing rules are applied to the miners when they connect, already connected miners keep their destination
+
+func (c *HTTPHandler) GetRoutingRules(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.router.GetRules())
+}
+
+func (c *HTTPHandler) AddRoutingRule(ctx *gin.Context) {
+	var rule routing.Rule
+	if err := ctx.ShouldBindJSON(&rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.router.AddRule(rule); err != nil {
+		ctx.JSON(routingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.router.GetRules())
+}
+
+func (c *HTTPHandler) SetRoutingRules(ctx *gin.Context) {
+	var rules []routing.Rule
+	if err := ctx.ShouldBindJSON(&rules); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.router.SetRules(rules); err != nil {
+		ctx.JSON(routingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.router.GetRules())
+}
+
+func (c *HTTPHandler) DeleteRoutingRule(ctx *gin.Context) {
+	if err := c.router.DeleteRule(ctx.Param("ID")); err != nil {
+		ctx.JSON(routingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.router.GetRules())
+}
+
+func routingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, routing.ErrRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, routing.ErrDuplicateRule):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
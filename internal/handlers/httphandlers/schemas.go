@@ -68,6 +68,7 @@ type Miner struct {
 	ConnectedAt           string
 	Uptime                string
 	ActivePoolConnections *map[string]string `json:",omitempty"`
+	ExtraNonceMode        string
 	Destinations          []*allocator.DestItem
 	Stats                 interface{}
 }
@@ -116,3 +117,14 @@ type Worker struct {
 	Hashrate   map[string]float64
 	Reconnects int
 }
+
+type Pool struct {
+	URL                 string
+	Priority            int
+	IsHealthy           bool
+	IsActive            bool
+	LastCheckedAt       string
+	LatencyMs           int64
+	LastError           string `json:",omitempty"`
+	ConsecutiveFailures int
+}
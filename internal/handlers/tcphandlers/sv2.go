@@ -0,0 +1,64 @@
+package tcphandlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_noise"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_translator"
+)
+
+const (
+	SV2_HANDSHAKE_TIMEOUT = 10 * time.Second
+)
+
+// NewSV2Handler wraps stratum v1 handler, so stratum v2 miners are served by the same proxy flow.
+// Incoming connection is translated to stratum v1 and passed to v1Handler over in-memory pipe.
+// If noiseCfg is nil the connection is not encrypted
+func NewSV2Handler(v1Handler transport.Handler, noiseCfg *stratumv2_noise.ResponderConfig, connLog interfaces.ILogger) transport.Handler {
+	return func(ctx context.Context, conn net.Conn) {
+		addr := conn.RemoteAddr().String()
+		log := connLog.Named("SV2").With("SrcAddr", addr)
+
+		var frameConn sv2.FrameConn
+		if noiseCfg == nil {
+			frameConn = sv2.NewPlainFrameConn(conn)
+		} else {
+			_ = conn.SetDeadline(time.Now().Add(SV2_HANDSHAKE_TIMEOUT))
+			noiseConn, err := stratumv2_noise.Accept(conn, noiseCfg)
+			if err != nil {
+				log.Debugf("noise handshake failed: %s", err)
+				return
+			}
+			_ = conn.SetDeadline(time.Time{})
+			frameConn = noiseConn
+		}
+
+		translatorSide, proxySide := net.Pipe()
+		translator := stratumv2_translator.NewDownstream(frameConn, translatorSide, log)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		v1DoneCh := make(chan struct{})
+		go func() {
+			defer close(v1DoneCh)
+			v1Handler(ctx, lib.NewConnWithAddr(proxySide, conn.LocalAddr(), conn.RemoteAddr()))
+			_ = proxySide.Close()
+		}()
+
+		err := translator.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Infof("stratum v2 connection closed: %s", err)
+		}
+
+		cancel()
+		<-v1DoneCh
+	}
+}
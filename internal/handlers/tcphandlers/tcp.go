@@ -8,11 +8,12 @@ import (
 	"time"
 
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
-	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/allocator"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/recorder"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
 )
 
 func NewTCPHandler(
@@ -20,12 +21,17 @@ func NewTCPHandler(
 	schedulerLogFactory func(contractID string) (interfaces.ILogger, error),
 	notPropagateWorkerName bool, idleReadTimeout, idleWriteTimeout time.Duration,
 	minerVettingShares, maxCachedDests int,
-	defaultDestUrl *url.URL,
+	vardiffCfg proxy.VardiffConfig,
+	defaultDest func() *url.URL,
+	router *routing.Router,
 	destFactory proxy.DestConnFactory,
 	hashrateFactory proxy.HashrateFactory,
 	globalHashrate *hashrate.GlobalHashrate,
 	hashrateCounterDefault string,
 	alloc *allocator.Allocator,
+	admission *transport.Admission,
+	rec *recorder.Recorder,
+	blockCandidates *proxy.BlockCandidates,
 	getContractFromStoreFn proxy.GetContractFromStoreFn,
 ) transport.Handler {
 	return func(ctx context.Context, conn net.Conn) {
@@ -37,6 +43,22 @@ func NewTCPHandler(
 
 		sourceConn := proxy.NewSourceConn(stratumConn, sourceLog)
 
+		sessionDestFactory := destFactory
+		if rec != nil {
+			session := rec.NewSession(addr)
+			defer func() { _ = session.Close() }()
+
+			stratumConn.SetRecorder(session.Source())
+			sessionDestFactory = func(ctx context.Context, url *url.URL, srcWorker, srcAddr string) (*proxy.ConnDest, error) {
+				dest, err := destFactory(ctx, url, srcWorker, srcAddr)
+				if err != nil {
+					return nil, err
+				}
+				dest.SetRecorder(session.Dest(url))
+				return dest, nil
+			}
+		}
+
 		schedulerLog, err := schedulerLogFactory(addr)
 		defer func() {
 			_ = schedulerLog.Close()
@@ -49,19 +71,22 @@ func NewTCPHandler(
 
 		defer func() { _ = schedulerLog.Sync() }()
 
-		url := lib.CopyURL(defaultDestUrl) // clones url
+		url := defaultDest() // returns a copy of the currently active default pool
 		prx := proxy.NewProxy(
 			addr, sourceConn,
-			destFactory, hashrateFactory,
+			sessionDestFactory, hashrateFactory,
 			globalHashrate, url, notPropagateWorkerName,
 			minerVettingShares, maxCachedDests,
+			vardiffCfg,
 			proxyLog.Named("PRX").With("SrcAddr", addr),
 			getContractFromStoreFn,
 		)
+		prx.SetBlockCandidates(blockCandidates)
 		scheduler := allocator.NewScheduler(
 			prx,
 			hashrateCounterDefault,
 			url,
+			router,
 			minerVettingShares,
 			hashrateFactory,
 			alloc.InvokeVettedListeners,
@@ -93,9 +118,27 @@ func NewTCPHandler(
 				logFunc = connLog.Warnf
 			}
 			logFunc("proxy disconnected: %s %s", err, addr)
+
+			if reason := admissionFailureReason(err); admission != nil && reason != "" {
+				admission.ReportFailure(transport.AddrIP(conn.RemoteAddr()), reason)
+			}
 		}
 
 		alloc.GetMiners().Delete(addr)
 		return
 	}
 }
+
+// admissionFailureReason returns the reason if the error is caused by misbehaving source
+func admissionFailureReason(err error) string {
+	switch {
+	case errors.Is(err, proxy.ErrNotStratum):
+		return "not stratum"
+	case errors.Is(err, proxy.ErrUnknownContract):
+		return "unknown contract"
+	case errors.Is(err, proxy.ErrTooManyInvalidShares):
+		return "invalid shares"
+	default:
+		return ""
+	}
+}
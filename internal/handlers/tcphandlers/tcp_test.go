@@ -0,0 +1,107 @@
+package tcphandlers
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/repositories/transport"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/allocator"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/testlib/stratumsim"
+)
+
+// newTestHandler creates the handler that connects miners to the simulated pool
+func newTestHandler(t *testing.T, ctx context.Context) (transport.Handler, *stratumsim.Pool, *allocator.Allocator) {
+	log := lib.NewTestLogger()
+
+	pool := stratumsim.NewPool(stratumsim.PoolConfig{Difficulty: 0.001, ExtraNonce2Size: 8}, log)
+	require.NoError(t, pool.Listen("127.0.0.1:0"))
+	go func() { _ = pool.Run(ctx) }()
+
+	poolURL := pool.URL("pool.worker")
+	router, err := routing.NewRouter(nil)
+	require.NoError(t, err)
+
+	hashrateFactory := func() *hashrate.Hashrate {
+		return hashrate.NewHashrate(map[string]hashrate.Counter{"ema-5m": hashrate.NewEma(5 * time.Minute)})
+	}
+	destFactory := func(ctx context.Context, url *url.URL, srcWorker, srcAddr string) (*proxy.ConnDest, error) {
+		return proxy.ConnectDest(ctx, url, nil, validator.NewValidator(time.Minute), time.Minute, time.Minute, log)
+	}
+	alloc := allocator.NewAllocator(lib.NewCollection[*allocator.Scheduler](), log)
+
+	handler := NewTCPHandler(
+		log, log, log,
+		func(contractID string) (interfaces.ILogger, error) { return lib.NewTestLogger(), nil },
+		false, time.Minute, time.Minute,
+		0, 0,
+		proxy.VardiffConfig{},
+		func() *url.URL { return lib.CopyURL(poolURL) },
+		router,
+		destFactory,
+		hashrateFactory,
+		hashrate.NewGlobalHashrate(hashrateFactory),
+		"ema-5m",
+		alloc,
+		nil,
+		nil,
+		nil,
+		func(id string) (resources.Contract, bool) { return nil, false },
+	)
+
+	return handler, pool, alloc
+}
+
+// connectTestMiner runs the simulated miner through the handler
+func connectTestMiner(ctx context.Context, handler transport.Handler, cfg stratumsim.MinerConfig) (*stratumsim.Miner, chan error) {
+	minerConn, proxyConn := net.Pipe()
+	go handler(ctx, proxyConn)
+
+	miner := stratumsim.NewMiner(cfg, lib.NewTestLogger())
+	errCh := make(chan error, 1)
+	go func() { errCh <- miner.Run(ctx, minerConn) }()
+
+	return miner, errCh
+}
+
+func TestTCPHandlerWithSimulators(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, pool, alloc := newTestHandler(t, ctx)
+	miner, _ := connectTestMiner(ctx, handler, stratumsim.MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000})
+
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted >= 5 }, 5*time.Second, 10*time.Millisecond)
+	require.Zero(t, miner.GetStats().Rejected)
+	require.Eventually(t, func() bool { return pool.GetStats().Accepted >= 5 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, alloc.GetMiners().Len())
+}
+
+func TestTCPHandlerDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, _, alloc := newTestHandler(t, ctx)
+	miner, minerErrCh := connectTestMiner(ctx, handler, stratumsim.MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000})
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted >= 1 }, 5*time.Second, 10*time.Millisecond)
+
+	drainCtx, drainCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer drainCancel()
+	require.NoError(t, alloc.Drain(drainCtx, "sibling.example.com", 3333))
+	require.True(t, alloc.IsDraining())
+
+	err := <-minerErrCh
+	require.ErrorIs(t, err, stratumsim.ErrMinerReconnect)
+	require.ErrorContains(t, err, "sibling.example.com:3333")
+	require.Zero(t, alloc.GetMiners().Len())
+}
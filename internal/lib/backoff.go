@@ -0,0 +1,33 @@
+package lib
+
+import "time"
+
+// Backoff is the exponentially growing delay between retries. Not safe for concurrent use
+type Backoff struct {
+	initial time.Duration
+	max     time.Duration
+	next    time.Duration
+}
+
+func NewBackoff(initial, max time.Duration) *Backoff {
+	return &Backoff{
+		initial: initial,
+		max:     max,
+		next:    initial,
+	}
+}
+
+// Next returns the delay before the next retry and doubles the following one up to the maximum
+func (b *Backoff) Next() time.Duration {
+	delay := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+	return delay
+}
+
+// Reset starts the delays over, should be called after the successful attempt
+func (b *Backoff) Reset() {
+	b.next = b.initial
+}
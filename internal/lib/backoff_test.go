@@ -0,0 +1,21 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(time.Second, 5*time.Second)
+
+	require.Equal(t, time.Second, b.Next())
+	require.Equal(t, 2*time.Second, b.Next())
+	require.Equal(t, 4*time.Second, b.Next())
+	require.Equal(t, 5*time.Second, b.Next())
+	require.Equal(t, 5*time.Second, b.Next())
+
+	b.Reset()
+	require.Equal(t, time.Second, b.Next())
+}
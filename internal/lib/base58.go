@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	ErrBase58Invalid  = errors.New("invalid base58 string")
+	ErrBase58Checksum = errors.New("invalid base58 checksum")
+)
+
+var base58Radix = big.NewInt(58)
+
+// Base58Encode encodes bytes using bitcoin base58 alphabet
+func Base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	mod := new(big.Int)
+	res := make([]byte, 0, len(b)*138/100+1)
+
+	for x.Sign() > 0 {
+		x.DivMod(x, base58Radix, mod)
+		res = append(res, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		res = append(res, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return string(res)
+}
+
+// Base58Decode decodes string encoded with bitcoin base58 alphabet
+func Base58Decode(s string) ([]byte, error) {
+	x := new(big.Int)
+	for _, c := range []byte(s) {
+		idx := strings.IndexByte(base58Alphabet, c)
+		if idx < 0 {
+			return nil, ErrBase58Invalid
+		}
+		x.Mul(x, base58Radix)
+		x.Add(x, big.NewInt(int64(idx)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	decoded := x.Bytes()
+	res := make([]byte, zeros+len(decoded))
+	copy(res[zeros:], decoded)
+	return res, nil
+}
+
+// Base58CheckEncode appends 4-byte double sha256 checksum and encodes the result with base58
+func Base58CheckEncode(payload []byte) string {
+	checksum := doubleSha256(payload)
+	return Base58Encode(append(append([]byte{}, payload...), checksum[:4]...))
+}
+
+// Base58CheckDecode decodes base58 string and verifies its 4-byte checksum, returns payload without checksum
+func Base58CheckDecode(s string) ([]byte, error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, ErrBase58Checksum
+	}
+	payload, checksum := b[:len(b)-4], b[len(b)-4:]
+	expected := doubleSha256(payload)
+	for i := 0; i < 4; i++ {
+		if checksum[i] != expected[i] {
+			return nil, ErrBase58Checksum
+		}
+	}
+	return payload, nil
+}
+
+func doubleSha256(b []byte) [32]byte {
+	h := sha256.Sum256(b)
+	return sha256.Sum256(h[:])
+}
@@ -0,0 +1,23 @@
+package lib
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase58CheckEncode(t *testing.T) {
+	// P2PKH address of the genesis block coinbase output
+	payload, _ := hex.DecodeString("0062e907b15cbf27d5425399ebf6f0fb50ebb88f18")
+	require.Equal(t, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", Base58CheckEncode(payload))
+
+	decoded, err := Base58CheckDecode("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+	require.NoError(t, err)
+	require.Equal(t, payload, decoded)
+}
+
+func TestBase58CheckDecodeInvalidChecksum(t *testing.T) {
+	_, err := Base58CheckDecode("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb")
+	require.ErrorIs(t, err, ErrBase58Checksum)
+}
@@ -2,6 +2,7 @@ package lib
 
 import (
 	"net"
+	"strings"
 )
 
 func TCPPipe() (clientConn net.Conn, serverConn net.Conn, err error) {
@@ -35,3 +36,44 @@ func ParsePort(addr string) (port string) {
 	}
 	return port
 }
+
+// ParseCIDRList parses comma separated list of networks, empty entries are skipped
+func ParseCIDRList(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ConnWithAddr overrides addresses of the wrapped connection, used to make
+// in-memory pipes look like the original network connection
+type ConnWithAddr struct {
+	net.Conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func NewConnWithAddr(conn net.Conn, localAddr, remoteAddr net.Addr) *ConnWithAddr {
+	return &ConnWithAddr{
+		Conn:       conn,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+	}
+}
+
+func (c *ConnWithAddr) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *ConnWithAddr) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
@@ -2,6 +2,7 @@ package lib
 
 import (
 	"fmt"
+	"strings"
 )
 
 // StrShort returns a short version of the string in a format "aaaaa..aa"
@@ -20,3 +21,15 @@ func StrShortConf(str string, prefix, suffix int) string {
 	}
 	return str
 }
+
+// SplitList splits comma separated list, trimming spaces and skipping empty entries
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
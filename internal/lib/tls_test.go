@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	parentCert, parentKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func tlsHandshake(t *testing.T, serverCfg, clientCfg *tls.Config) (serverErr, clientErr error) {
+	client, server, err := TCPPipe()
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tls.Server(server, serverCfg).Handshake()
+		server.Close()
+	}()
+
+	clientErr = tls.Client(client, clientCfg).Handshake()
+	client.Close()
+	return <-errCh, clientErr
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "client", ca)
+
+	certFile := writeTestFile(t, dir, "server.crt", server.certPEM)
+	keyFile := writeTestFile(t, dir, "server.key", server.keyPEM)
+	caFile := writeTestFile(t, dir, "ca.crt", ca.certPEM)
+
+	caPool, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	require.NoError(t, err)
+
+	t.Run("without client auth", func(t *testing.T) {
+		cfg, err := NewServerTLSConfig(certFile, keyFile, "")
+		require.NoError(t, err)
+
+		serverErr, clientErr := tlsHandshake(t, cfg, &tls.Config{RootCAs: caPool, ServerName: "127.0.0.1"})
+		require.NoError(t, serverErr)
+		require.NoError(t, clientErr)
+	})
+
+	t.Run("client certificate required", func(t *testing.T) {
+		cfg, err := NewServerTLSConfig(certFile, keyFile, caFile)
+		require.NoError(t, err)
+
+		serverErr, _ := tlsHandshake(t, cfg, &tls.Config{RootCAs: caPool, ServerName: "127.0.0.1"})
+		require.Error(t, serverErr)
+
+		serverErr, clientErr := tlsHandshake(t, cfg, &tls.Config{RootCAs: caPool, ServerName: "127.0.0.1", Certificates: []tls.Certificate{clientCert}})
+		require.NoError(t, serverErr)
+		require.NoError(t, clientErr)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		_, err := NewServerTLSConfig(filepath.Join(dir, "missing.crt"), keyFile, "")
+		require.ErrorIs(t, err, ErrTLSConfig)
+
+		_, err = LoadCertPool(keyFile)
+		require.ErrorIs(t, err, ErrTLSConfig)
+	})
+}
@@ -0,0 +1,296 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+const (
+	ADMISSION_CLEANUP_INTERVAL = time.Minute
+)
+
+var (
+	ErrAdmission     = errors.New("connection rejected")
+	ErrBanned        = errors.New("source is banned")
+	ErrMaxConns      = errors.New("max connections reached")
+	ErrMaxConnsPerIP = errors.New("max connections per ip reached")
+	ErrHandshakeRate = errors.New("handshake rate limit exceeded")
+	ErrBanNotFound   = errors.New("ban not found")
+)
+
+type AdmissionConfig struct {
+	MaxConns              int           // maximum number of connections in total, 0 is unlimited
+	MaxConnsPerIP         int           // maximum number of connections from a single ip, 0 is unlimited
+	HandshakesPerMinPerIP int           // new connections allowed per minute from a single ip, 0 is unlimited
+	BanThreshold          int           // failures within the ban window to ban the ip, 0 disables bans
+	BanWindow             time.Duration // window to count failures in
+	BanDuration           time.Duration // for how long the ip is banned
+	Exempt                []*net.IPNet  // networks that are never limited or banned, e.g. load balancers
+}
+
+type Ban struct {
+	IP        string
+	Reason    string
+	Failures  int
+	BannedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type admissionFailures struct {
+	count       int
+	windowStart time.Time
+}
+
+// tokenBucket limits the rate of handshakes, refilled continuously up to its capacity
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Admission decides if the incoming connection is accepted, limiting number of connections,
+// handshake rate, and temporarily banning sources that repeatedly fail
+type Admission struct {
+	// config
+	cfg AdmissionConfig
+
+	// state
+	totalConns int
+	conns      map[string]int
+	buckets    map[string]*tokenBucket
+	failures   map[string]*admissionFailures
+	bans       map[string]*Ban
+	mutex      sync.Mutex
+
+	// deps
+	log interfaces.ILogger
+}
+
+func NewAdmission(cfg AdmissionConfig, log interfaces.ILogger) *Admission {
+	return &Admission{
+		cfg:      cfg,
+		conns:    make(map[string]int),
+		buckets:  make(map[string]*tokenBucket),
+		failures: make(map[string]*admissionFailures),
+		bans:     make(map[string]*Ban),
+		log:      log,
+	}
+}
+
+// Run periodically removes expired bans and stale counters
+func (a *Admission) Run(ctx context.Context) error {
+	ticker := time.NewTicker(ADMISSION_CLEANUP_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			a.cleanup(time.Now())
+		}
+	}
+}
+
+// Admit checks if the connection from the ip is allowed and reserves a connection slot,
+// Release has to be called when the connection is closed
+func (a *Admission) Admit(ip string) error {
+	if a.isExempt(ip) {
+		return nil
+	}
+	now := time.Now()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if ban, ok := a.bans[ip]; ok {
+		if now.Before(ban.ExpiresAt) {
+			return lib.WrapError(ErrAdmission, lib.WrapError(ErrBanned, fmt.Errorf("%s until %s", ban.Reason, ban.ExpiresAt.Format(time.RFC3339))))
+		}
+		delete(a.bans, ip)
+	}
+
+	if a.cfg.MaxConns > 0 && a.totalConns >= a.cfg.MaxConns {
+		return lib.WrapError(ErrAdmission, ErrMaxConns)
+	}
+
+	if a.cfg.MaxConnsPerIP > 0 && a.conns[ip] >= a.cfg.MaxConnsPerIP {
+		return lib.WrapError(ErrAdmission, ErrMaxConnsPerIP)
+	}
+
+	if a.cfg.HandshakesPerMinPerIP > 0 && !a.takeToken(ip, now) {
+		return lib.WrapError(ErrAdmission, ErrHandshakeRate)
+	}
+
+	a.totalConns++
+	a.conns[ip]++
+	return nil
+}
+
+// Release frees the connection slot reserved by Admit
+func (a *Admission) Release(ip string) {
+	if a.isExempt(ip) {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.totalConns--
+	a.conns[ip]--
+	if a.conns[ip] <= 0 {
+		delete(a.conns, ip)
+	}
+}
+
+// ReportFailure records misbehavior of the source, banning it if the threshold is reached within the window
+func (a *Admission) ReportFailure(ip string, reason string) {
+	if a.cfg.BanThreshold <= 0 || a.isExempt(ip) {
+		return
+	}
+	now := time.Now()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, ok := a.failures[ip]
+	if !ok || now.Sub(f.windowStart) > a.cfg.BanWindow {
+		f = &admissionFailures{windowStart: now}
+		a.failures[ip] = f
+	}
+	f.count++
+
+	if f.count < a.cfg.BanThreshold {
+		return
+	}
+
+	a.bans[ip] = &Ban{
+		IP:        ip,
+		Reason:    reason,
+		Failures:  f.count,
+		BannedAt:  now,
+		ExpiresAt: now.Add(a.cfg.BanDuration),
+	}
+	delete(a.failures, ip)
+	a.log.Warnf("banned %s for %s: %d failures, last %s", ip, a.cfg.BanDuration, f.count, reason)
+}
+
+// GetBans returns active bans sorted by expiration
+func (a *Admission) GetBans() []Ban {
+	now := time.Now()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bans := make([]Ban, 0, len(a.bans))
+	for _, ban := range a.bans {
+		if now.Before(ban.ExpiresAt) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].ExpiresAt.Before(bans[j].ExpiresAt)
+	})
+	return bans
+}
+
+// ClearBan removes the ban and failure history of the ip
+func (a *Admission) ClearBan(ip string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.bans[ip]; !ok {
+		return lib.WrapError(ErrBanNotFound, fmt.Errorf("%s", ip))
+	}
+	delete(a.bans, ip)
+	delete(a.failures, ip)
+	return nil
+}
+
+// ClearBans removes all of the bans and failure history
+func (a *Admission) ClearBans() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.bans = make(map[string]*Ban)
+	a.failures = make(map[string]*admissionFailures)
+}
+
+func (a *Admission) isExempt(ip string) bool {
+	if len(a.cfg.Exempt) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	for _, network := range a.cfg.Exempt {
+		if parsed != nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Admission) takeToken(ip string, now time.Time) bool {
+	capacity := float64(a.cfg.HandshakesPerMinPerIP)
+	bucket, ok := a.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updatedAt: now}
+		a.buckets[ip] = bucket
+	}
+
+	refill := now.Sub(bucket.updatedAt).Minutes() * capacity
+	bucket.tokens = minFloat(capacity, bucket.tokens+refill)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (a *Admission) cleanup(now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for ip, ban := range a.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(a.bans, ip)
+		}
+	}
+	for ip, f := range a.failures {
+		if now.Sub(f.windowStart) > a.cfg.BanWindow {
+			delete(a.failures, ip)
+		}
+	}
+	// bucket is refilled completely after a minute, so it is the same as a new one
+	for ip, bucket := range a.buckets {
+		if now.Sub(bucket.updatedAt) > time.Minute {
+			delete(a.buckets, ip)
+		}
+	}
+}
+
+// AddrIP returns the ip part of the address
+func AddrIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+func TestAdmissionConnLimits(t *testing.T) {
+	a := NewAdmission(AdmissionConfig{MaxConns: 3, MaxConnsPerIP: 2}, lib.NewTestLogger())
+
+	require.NoError(t, a.Admit("10.0.0.1"))
+	require.NoError(t, a.Admit("10.0.0.1"))
+	require.ErrorIs(t, a.Admit("10.0.0.1"), ErrMaxConnsPerIP)
+
+	require.NoError(t, a.Admit("10.0.0.2"))
+	require.ErrorIs(t, a.Admit("10.0.0.3"), ErrMaxConns)
+
+	a.Release("10.0.0.1")
+	require.NoError(t, a.Admit("10.0.0.3"))
+}
+
+func TestAdmissionHandshakeRate(t *testing.T) {
+	a := NewAdmission(AdmissionConfig{HandshakesPerMinPerIP: 2}, lib.NewTestLogger())
+
+	require.NoError(t, a.Admit("10.0.0.1"))
+	require.NoError(t, a.Admit("10.0.0.1"))
+	require.ErrorIs(t, a.Admit("10.0.0.1"), ErrHandshakeRate)
+	require.NoError(t, a.Admit("10.0.0.2"), "limit is per ip")
+
+	// half a minute refills one token
+	a.buckets["10.0.0.1"].updatedAt = a.buckets["10.0.0.1"].updatedAt.Add(-30 * time.Second)
+	require.NoError(t, a.Admit("10.0.0.1"))
+	require.ErrorIs(t, a.Admit("10.0.0.1"), ErrHandshakeRate)
+}
+
+func TestAdmissionBans(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("192.168.0.0/24")
+	a := NewAdmission(AdmissionConfig{
+		BanThreshold: 3,
+		BanWindow:    time.Minute,
+		BanDuration:  time.Hour,
+		Exempt:       []*net.IPNet{lb},
+	}, lib.NewTestLogger())
+
+	a.ReportFailure("10.0.0.1", "not stratum")
+	a.ReportFailure("10.0.0.1", "not stratum")
+	require.NoError(t, a.Admit("10.0.0.1"))
+
+	a.ReportFailure("10.0.0.1", "unknown contract")
+	err := a.Admit("10.0.0.1")
+	require.ErrorIs(t, err, ErrBanned)
+	require.ErrorIs(t, err, ErrAdmission)
+
+	bans := a.GetBans()
+	require.Len(t, bans, 1)
+	require.Equal(t, "10.0.0.1", bans[0].IP)
+	require.Equal(t, "unknown contract", bans[0].Reason)
+	require.Equal(t, 3, bans[0].Failures)
+
+	require.NoError(t, a.ClearBan("10.0.0.1"))
+	require.ErrorIs(t, a.ClearBan("10.0.0.1"), ErrBanNotFound)
+	require.NoError(t, a.Admit("10.0.0.1"))
+
+	// exempt networks are never banned
+	for i := 0; i < 5; i++ {
+		a.ReportFailure("192.168.0.10", "not stratum")
+	}
+	require.NoError(t, a.Admit("192.168.0.10"))
+	require.Empty(t, a.GetBans())
+}
+
+func TestAdmissionBanExpires(t *testing.T) {
+	a := NewAdmission(AdmissionConfig{BanThreshold: 1, BanWindow: time.Minute, BanDuration: time.Hour}, lib.NewTestLogger())
+
+	a.ReportFailure("10.0.0.1", "invalid shares")
+	require.ErrorIs(t, a.Admit("10.0.0.1"), ErrBanned)
+
+	a.cleanup(time.Now().Add(2 * time.Hour))
+	require.Empty(t, a.GetBans())
+	require.NoError(t, a.Admit("10.0.0.1"))
+}
@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PROXY_PROTOCOL_HEADER_TIMEOUT = 10 * time.Second
+	PROXY_PROTOCOL_V1_MAX_LENGTH  = 107 // including CRLF
+)
+
+var (
+	ErrProxyProtocol = errors.New("invalid proxy protocol header")
+
+	proxyProtocolV1Prefix    = []byte("PROXY ")
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolConn is a connection with the client address taken from the proxy protocol header
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// readProxyProtocol reads PROXY protocol v1 or v2 header and returns the connection reporting
+// the original client address. If the header doesn't carry the address (UNKNOWN or LOCAL command)
+// the address of the connection is kept
+func readProxyProtocol(conn net.Conn, timeout time.Duration) (net.Conn, error) {
+	err := conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	srcAddr, err := readProxyProtocolHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	if srcAddr == nil {
+		srcAddr = conn.RemoteAddr()
+	}
+
+	return &proxyProtocolConn{Conn: conn, reader: reader, remoteAddr: srcAddr}, nil
+}
+
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, err)
+	}
+
+	if bytes.Equal(prefix, proxyProtocolV1Prefix) {
+		return readProxyProtocolV1(r)
+	}
+
+	signature, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, err)
+	}
+	if bytes.Equal(signature, proxyProtocolV2Signature) {
+		return readProxyProtocolV2(r)
+	}
+
+	return nil, fmt.Errorf("%w: no header", ErrProxyProtocol)
+}
+
+// readProxyProtocolV1 parses text header, e.g. "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, PROXY_PROTOCOL_V1_MAX_LENGTH)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= PROXY_PROTOCOL_V1_MAX_LENGTH {
+			return nil, fmt.Errorf("%w: v1 header is too long", ErrProxyProtocol)
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header should end with CRLF", ErrProxyProtocol)
+	}
+	header := string(line[:len(line)-2])
+
+	fields := strings.Split(header, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, header)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("%w: invalid source address %s", ErrProxyProtocol, fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid source port %s", ErrProxyProtocol, fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtocolV2 parses binary header
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, err)
+	}
+
+	verCmd, family := header[12], header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrProxyProtocol, verCmd>>4)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProxyProtocol, err)
+	}
+
+	switch verCmd & 0x0F {
+	case 0x0: // LOCAL, connection established by the proxy itself, e.g. health check
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrProxyProtocol, verCmd&0x0F)
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: short ipv4 address block", ErrProxyProtocol)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: short ipv6 address block", ErrProxyProtocol)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default: // UNSPEC, UDP or unix sockets
+		return nil, nil
+	}
+}
@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func proxyProtocolV2Header(cmd byte, family byte, addrs []byte) []byte {
+	header := append([]byte{}, proxyProtocolV2Signature...)
+	header = append(header, 0x20|cmd, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	ipv4Block := []byte{
+		10, 0, 0, 5, // src
+		10, 0, 0, 1, // dst
+		0x13, 0x88, // src port 5000
+		0x0d, 0x05, // dst port 3333
+	}
+	ipv6Block := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x13, 0x88, 0x0d, 0x05)
+
+	tests := []struct {
+		name   string
+		header []byte
+		addr   string // empty if the connection address should be kept
+		err    bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 3333\r\n"), "192.168.0.1:56324", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 3333\r\n"), "[2001:db8::1]:56324", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 no crlf", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 3333\n"), "", true},
+		{"v1 bad ip", []byte("PROXY TCP4 abc 192.168.0.11 56324 3333\r\n"), "", true},
+		{"v2 tcp4", proxyProtocolV2Header(0x1, 0x11, ipv4Block), "10.0.0.5:5000", false},
+		{"v2 tcp6", proxyProtocolV2Header(0x1, 0x21, ipv6Block), "[2001:db8::1]:5000", false},
+		{"v2 tcp4 with tlv", proxyProtocolV2Header(0x1, 0x11, append(append([]byte{}, ipv4Block...), 0x04, 0x00, 0x01, 0xff)), "10.0.0.5:5000", false},
+		{"v2 local", proxyProtocolV2Header(0x0, 0x00, nil), "", false},
+		{"v2 short block", proxyProtocolV2Header(0x1, 0x11, ipv4Block[:6]), "", true},
+		{"no header", []byte(`{"id":1,"method":"mining.subscribe","params":[]}` + "\n"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(`{"id":1}` + "\n")
+			r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, tt.header...), payload...)))
+
+			addr, err := readProxyProtocolHeader(r)
+			if tt.err {
+				require.ErrorIs(t, err, ErrProxyProtocol)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.addr == "" {
+				require.Nil(t, addr)
+			} else {
+				require.Equal(t, tt.addr, addr.String())
+			}
+
+			// data after the header is left for the handler
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, payload, rest)
+		})
+	}
+}
+
+func TestReadProxyProtocolConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 3333\r\nhello\n"))
+	}()
+
+	conn, err := readProxyProtocol(server, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.1:56324", conn.RemoteAddr().String())
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", line)
+}
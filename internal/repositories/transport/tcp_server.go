@@ -2,21 +2,34 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/netip"
 	"sync"
+	"time"
 
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
 )
 
 // const kb = 1024 //temp
 
+const (
+	TLS_HANDSHAKE_TIMEOUT = 10 * time.Second
+)
+
 type TCPServer struct {
-	serverAddr string
-	handler    Handler
-	log        interfaces.ILogger
+	serverAddr           string
+	handler              Handler
+	tlsConfig            *tls.Config
+	proxyProtocol        bool
+	proxyProtocolTrusted []*net.IPNet
+	admission            *Admission
+	listener             net.Listener
+	stopped              bool
+	listenerMutex        sync.Mutex
+	log                  interfaces.ILogger
 }
 
 func NewTCPServer(serverAddr string, log interfaces.ILogger) *TCPServer {
@@ -30,6 +43,49 @@ func (p *TCPServer) SetConnectionHandler(handler Handler) {
 	p.handler = handler
 }
 
+// SetTLSConfig enables TLS mode, the handler receives connection after successful handshake
+func (p *TCPServer) SetTLSConfig(cfg *tls.Config) {
+	p.tlsConfig = cfg
+}
+
+// SetProxyProtocol enables parsing of PROXY protocol v1/v2 headers, so the handler receives connection
+// with the original client address. Header is required from the trusted networks, connections from
+// other networks are treated as direct. Empty list doesn't trust anyone
+func (p *TCPServer) SetProxyProtocol(trusted []*net.IPNet) {
+	p.proxyProtocol = true
+	p.proxyProtocolTrusted = trusted
+}
+
+// SetAdmission enables admission control, connections can be shared between multiple servers
+func (p *TCPServer) SetAdmission(admission *Admission) {
+	p.admission = admission
+}
+
+// StopAccepting closes the listener, so no new connections are accepted. The open connections are
+// served until they are closed or the context is cancelled, Run returns after all of them are closed
+func (p *TCPServer) StopAccepting() {
+	p.listenerMutex.Lock()
+	defer p.listenerMutex.Unlock()
+
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	if p.listener != nil {
+		err := p.listener.Close()
+		if err != nil {
+			p.log.Warnf("error closing listener %s: %s", p.serverAddr, err)
+		}
+	}
+	p.log.Infof("stopped accepting connections: %s", p.serverAddr)
+}
+
+func (p *TCPServer) isStopped() bool {
+	p.listenerMutex.Lock()
+	defer p.listenerMutex.Unlock()
+	return p.stopped
+}
+
 func (p *TCPServer) Run(ctx context.Context) error {
 	add, err := netip.ParseAddrPort(p.serverAddr)
 	if err != nil {
@@ -42,7 +98,19 @@ func (p *TCPServer) Run(ctx context.Context) error {
 		return fmt.Errorf("listener error %s %w", p.serverAddr, err)
 	}
 
-	p.log.Infof("tcp server is listening: %s", p.serverAddr)
+	p.listenerMutex.Lock()
+	if p.stopped {
+		p.listenerMutex.Unlock()
+		return listener.Close()
+	}
+	p.listener = listener
+	p.listenerMutex.Unlock()
+
+	if p.tlsConfig != nil {
+		p.log.Infof("tls server is listening: %s", p.serverAddr)
+	} else {
+		p.log.Infof("tcp server is listening: %s", p.serverAddr)
+	}
 
 	serverErr := make(chan error, 1)
 
@@ -53,7 +121,7 @@ func (p *TCPServer) Run(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		err := listener.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			return err
 		}
 		err = ctx.Err()
@@ -80,6 +148,9 @@ func (p *TCPServer) startAccepting(ctx context.Context, listener net.Listener) e
 		conn, err := listener.Accept()
 
 		if errors.Is(err, net.ErrClosed) {
+			if p.isStopped() {
+				return nil
+			}
 			return fmt.Errorf("incoming connection listener was closed")
 		}
 
@@ -93,6 +164,41 @@ func (p *TCPServer) startAccepting(ctx context.Context, listener net.Listener) e
 			defer wg.Done()
 
 			p.log.Debugf("incoming connection accepted: %s", conn.RemoteAddr().String())
+
+			// proxy protocol header is sent before tls handshake
+			if p.isProxyProtocolTrusted(conn.RemoteAddr()) {
+				ppConn, err := readProxyProtocol(conn, PROXY_PROTOCOL_HEADER_TIMEOUT)
+				if err != nil {
+					p.log.Warnf("proxy protocol error: %s %s", conn.RemoteAddr().String(), err)
+					_ = conn.Close()
+					return
+				}
+				p.log.Debugf("proxy protocol client address: %s via %s", ppConn.RemoteAddr().String(), conn.RemoteAddr().String())
+				conn = ppConn
+			}
+
+			if p.admission != nil {
+				ip := AddrIP(conn.RemoteAddr())
+				err := p.admission.Admit(ip)
+				if err != nil {
+					p.log.Debugf("%s: %s", err, conn.RemoteAddr().String())
+					_ = conn.Close()
+					return
+				}
+				defer p.admission.Release(ip)
+			}
+
+			if p.tlsConfig != nil {
+				tlsConn := tls.Server(conn, p.tlsConfig)
+				err := p.tlsHandshake(ctx, tlsConn)
+				if err != nil {
+					p.log.Debugf("tls handshake failed: %s %s", conn.RemoteAddr().String(), err)
+					_ = conn.Close()
+					return
+				}
+				conn = tlsConn
+			}
+
 			p.handler(ctx, conn)
 
 			err = conn.Close()
@@ -108,3 +214,27 @@ func (p *TCPServer) startAccepting(ctx context.Context, listener net.Listener) e
 
 	}
 }
+
+func (p *TCPServer) isProxyProtocolTrusted(addr net.Addr) bool {
+	if !p.proxyProtocol {
+		return false
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range p.proxyProtocolTrusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsHandshake performs handshake explicitly with a timeout, so slow clients
+// do not hold the connection before reaching the handler
+func (p *TCPServer) tlsHandshake(ctx context.Context, conn *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, TLS_HANDSHAKE_TIMEOUT)
+	defer cancel()
+	return conn.HandshakeContext(ctx)
+}
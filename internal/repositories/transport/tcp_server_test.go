@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestTCPServerStopAccepting(t *testing.T) {
+	addr := freeAddr(t)
+	server := NewTCPServer(addr, lib.NewTestLogger())
+	server.SetConnectionHandler(func(ctx context.Context, conn net.Conn) {
+		// echoes a single byte, then waits for the client to close
+		b := make([]byte, 1)
+		for {
+			_, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(b)
+		}
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Run(context.Background()) }()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	server.StopAccepting()
+
+	_, err := net.Dial("tcp", addr)
+	require.Error(t, err, "new connections are refused")
+
+	// open connection is still served
+	_, err = conn.Write([]byte{1})
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	require.NoError(t, err)
+
+	select {
+	case <-errCh:
+		require.Fail(t, "server exited with open connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, conn.Close())
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "server didn't exit after the last connection closed")
+	}
+}
+
+func TestTCPServerProxyProtocolTrusted(t *testing.T) {
+	server := NewTCPServer("127.0.0.1:0", lib.NewTestLogger())
+	lbAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 1000}
+	minerAddr := &net.TCPAddr{IP: net.ParseIP("192.168.1.5"), Port: 1000}
+
+	require.False(t, server.isProxyProtocolTrusted(lbAddr))
+
+	// empty list doesn't trust anyone
+	server.SetProxyProtocol(nil)
+	require.False(t, server.isProxyProtocolTrusted(lbAddr))
+	require.False(t, server.isProxyProtocolTrusted(minerAddr))
+
+	trusted, err := lib.ParseCIDRList("10.0.0.0/8")
+	require.NoError(t, err)
+	server.SetProxyProtocol(trusted)
+	require.True(t, server.isProxyProtocolTrusted(lbAddr))
+	require.False(t, server.isProxyProtocolTrusted(minerAddr))
+}
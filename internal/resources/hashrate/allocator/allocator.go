@@ -10,6 +10,7 @@ import (
 	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
+	"go.uber.org/atomic"
 	"golang.org/x/exp/slices"
 )
 
@@ -48,6 +49,7 @@ type Allocator struct {
 	lastListenerID  int
 	vettedListeners map[int]func(ID string)
 	vettedMutex     sync.RWMutex
+	draining        atomic.Bool
 
 	// read only
 	proxies *lib.Collection[*Scheduler]
@@ -66,6 +68,18 @@ func (p *Allocator) GetMiners() *lib.Collection[*Scheduler] {
 	return p.proxies
 }
 
+// SwitchPrimaryPool moves miners assigned to the prev default pool to the next one
+func (p *Allocator) SwitchPrimaryPool(prev, next *url.URL) {
+	count := 0
+	p.proxies.Range(func(item *Scheduler) bool {
+		if item.SwitchPrimaryPool(prev, next) {
+			count++
+		}
+		return true
+	})
+	p.log.Infof("moved %d miners from %s to %s", count, prev.Redacted(), next.Redacted())
+}
+
 func (p *Allocator) AllocateFullMinersForHR(
 	ID string,
 	hrGHS float64,
@@ -236,6 +250,11 @@ func (p *Allocator) InvokeVettedListeners(minerID string) {
 func (p *Allocator) getMinersSnapshot(remainingCycleDuration time.Duration) minerSnapshot {
 	snap := minerSnapshot{}
 
+	// no new tasks are allocated during drain
+	if p.draining.Load() {
+		return snap
+	}
+
 	p.proxies.Range(func(item *Scheduler) bool {
 		if item.IsVetting() { // atomic
 			return true
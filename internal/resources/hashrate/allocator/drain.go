@@ -0,0 +1,59 @@
+package allocator
+
+import (
+	"context"
+	"time"
+)
+
+const DRAIN_CHECK_INTERVAL = time.Second
+
+// Drain stops allocating new tasks and asks each miner to reconnect to the host and port with client.reconnect
+// once its current tasks are finished, so running contracts are delivered till the end of the cycle.
+// Empty host means reconnect to the same address. Returns when all of the miners are disconnected or ctx is done
+func (p *Allocator) Drain(ctx context.Context, host string, port int) error {
+	p.draining.Store(true)
+	requested := make(map[string]bool)
+
+	ticker := time.NewTicker(DRAIN_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		var free []*Scheduler
+		remaining := 0
+		p.proxies.Range(func(item *Scheduler) bool {
+			remaining++
+			if !requested[item.ID()] && item.IsFree() {
+				free = append(free, item)
+			}
+			return true
+		})
+
+		if remaining == 0 {
+			p.log.Infof("drain completed, all miners disconnected")
+			return nil
+		}
+
+		for _, item := range free {
+			requested[item.ID()] = true
+			err := item.RequestReconnect(ctx, host, port)
+			if err != nil {
+				p.log.Warnf("failed to request reconnect from miner %s: %s", item.ID(), err)
+			}
+		}
+		if len(free) > 0 {
+			p.log.Infof("requested reconnect from %d miners, %d miners remaining", len(free), remaining)
+		}
+
+		select {
+		case <-ctx.Done():
+			p.log.Warnf("drain stopped with %d miners connected: %s", remaining, ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsDraining returns true if Drain was called
+func (p *Allocator) IsDraining() bool {
+	return p.draining.Load()
+}
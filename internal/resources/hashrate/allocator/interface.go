@@ -17,6 +17,7 @@ type StratumProxyInterface interface {
 	Run(ctx context.Context) error
 	SetDest(ctx context.Context, dest *url.URL, onSubmit func(diff float64)) error
 	SetDestWithoutAutoread(ctx context.Context, dest *url.URL, onSubmit func(diff float64)) error
+	RequestReconnect(ctx context.Context, host string, port int) error
 
 	GetID() string
 	GetHashrate() proxy.Hashrate
@@ -27,9 +28,11 @@ type StratumProxyInterface interface {
 	GetMinerConnectedAt() time.Time
 	GetStats() map[string]int
 	GetDestConns() *map[string]string
+	GetExtraNonceMode() proxy.ExtraNonceMode
 	IsVetting() bool
 	VettingDone() <-chan struct{}
 	GetIncomingContractID() *string
+	SetOutgoingContractID(contractID string)
 }
 
 type HashrateFactory = func() *hashrate.Hashrate
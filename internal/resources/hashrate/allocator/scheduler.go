@@ -11,6 +11,7 @@ import (
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/routing"
 	"go.uber.org/atomic"
 )
 
@@ -22,6 +23,11 @@ var (
 	ErrTaskMinerDisconnected = errors.New("miner disconnected")
 )
 
+const (
+	PRIMARY_RECONNECT_MIN_BACKOFF = 3 * time.Second // initial delay before retrying to switch to the primary dest
+	PRIMARY_RECONNECT_MAX_BACKOFF = time.Minute     // maximum delay between the retries to switch to the primary dest
+)
+
 // Scheduler is a proxy wrapper that can schedule one-time tasks to different destinations
 type Scheduler struct {
 	// config
@@ -37,12 +43,13 @@ type Scheduler struct {
 
 	// deps
 	proxy     StratumProxyInterface
+	router    *routing.Router
 	onVetted  func(ID string)
 	onDestErr func(contractID *string, err error)
 	log       interfaces.ILogger
 }
 
-func NewScheduler(proxy StratumProxyInterface, hashrateCounterID string, defaultDest *url.URL, minerVettingShares int, hashrateFactory HashrateFactory, onVetted func(ID string), onDestErr func(contractID *string, err error), log interfaces.ILogger) *Scheduler {
+func NewScheduler(proxy StratumProxyInterface, hashrateCounterID string, defaultDest *url.URL, router *routing.Router, minerVettingShares int, hashrateFactory HashrateFactory, onVetted func(ID string), onDestErr func(contractID *string, err error), log interfaces.ILogger) *Scheduler {
 	return &Scheduler{
 		primaryDest:        defaultDest,
 		hashrateCounterID:  hashrateCounterID,
@@ -51,6 +58,7 @@ func NewScheduler(proxy StratumProxyInterface, hashrateCounterID string, default
 		tasks:              NewTaskList(),
 		usedHR:             hashrateFactory(),
 		proxy:              proxy,
+		router:             router,
 		onVetted:           onVetted,
 		onDestErr:          onDestErr,
 		isDisconnecting:    atomic.NewBool(false),
@@ -68,20 +76,29 @@ func (p *Scheduler) Run(ctx context.Context) error {
 		return err // handshake error
 	}
 
+	defaultDest := p.primaryDest
 	p.primaryDest = p.proxy.GetDest()
 	p.log = p.log.Named("SCH").With("SrcWorker", p.proxy.GetSourceWorkerName(), "SrcAddr", p.proxy.GetID())
 
 	p.logInfof("proxy connected")
 
+	if p.router != nil {
+		if dest, ruleID, ok := p.router.Match(p.proxy.GetSourceWorkerName(), p.proxy.GetID()); ok {
+			p.primaryDest = keepWorkerName(dest, p.primaryDest, defaultDest)
+			p.logInfof("routed by rule %s to %s", ruleID, p.primaryDest.Redacted())
+		}
+	}
+
 	for {
 		if p.proxy.GetDest().String() != p.primaryDest.String() {
 			err := p.proxy.SetDestWithoutAutoread(ctx, p.primaryDest, nil)
 
+			// the miner is kept on the current dest, switching to primary is retried in the main loop
 			if err != nil {
 				err := lib.WrapError(ErrConnPrimary, err)
 				p.logWarnf("%s: %s", err, p.primaryDest)
-				p.onDisconnect()
-				return err
+			} else {
+				p.proxy.SetOutgoingContractID("")
 			}
 		}
 		proxyTask := lib.NewTaskFunc(p.proxy.Run)
@@ -130,6 +147,8 @@ func (p *Scheduler) Run(ctx context.Context) error {
 }
 
 func (p *Scheduler) mainLoop(ctx context.Context, proxyTask *lib.Task) error {
+	backoff := lib.NewBackoff(PRIMARY_RECONNECT_MIN_BACKOFF, PRIMARY_RECONNECT_MAX_BACKOFF)
+
 	for {
 		// do tasks
 		proxyExited, err := p.taskLoop(ctx, proxyTask)
@@ -149,8 +168,21 @@ func (p *Scheduler) mainLoop(ctx context.Context, proxyTask *lib.Task) error {
 		// all tasks are done, switch to default destination
 		err = p.proxy.SetDest(ctx, p.primaryDest, nil)
 		if err != nil {
-			return lib.WrapError(ErrConnPrimary, err)
+			// the miner stays on the current dest until primary is reachable
+			delay := backoff.Next()
+			p.logWarnf("%s, retrying in %s: %s", ErrConnPrimary, delay, err)
+
+			select {
+			case <-proxyTask.Done():
+				p.logInfof("proxy exited: %v", proxyTask.Err())
+				return proxyTask.Err()
+			case <-p.newTaskSignal:
+			case <-time.After(delay):
+			}
+			continue
 		}
+		backoff.Reset()
+		p.proxy.SetOutgoingContractID("")
 
 		select {
 		case <-proxyTask.Done():
@@ -210,6 +242,7 @@ func (p *Scheduler) taskLoop(ctx context.Context, proxyTask *lib.Task) (proxyExi
 			task.OnEnd(p.ID(), p.HashrateGHS(), float64(task.RemainingJobToSubmit.Load()), err)
 			return true, err
 		}
+		p.proxy.SetOutgoingContractID(task.ID)
 
 		select {
 		case <-proxyTask.Done():
@@ -291,6 +324,35 @@ func (p *Scheduler) SetPrimaryDest(dest *url.URL) {
 	}
 }
 
+// SwitchPrimaryPool moves the miner from the prev default pool to the next one if it is currently
+// assigned to prev, keeping the propagated worker name. Not protected by mutex, same as SetPrimaryDest
+func (p *Scheduler) SwitchPrimaryPool(prev, next *url.URL) bool {
+	primary := p.primaryDest
+	if primary == nil || primary.Host != prev.Host || primary.Scheme != prev.Scheme {
+		return false
+	}
+
+	p.SetPrimaryDest(keepWorkerName(lib.CopyURL(next), primary, prev))
+	return true
+}
+
+// keepWorkerName sets the worker name of the current dest to the new dest if it was propagated
+// from the miner, i.e. the current username differs from the username of the base url
+func keepWorkerName(dest, current, base *url.URL) *url.URL {
+	if base == nil || current.User.Username() == base.User.Username() {
+		return dest
+	}
+	if _, workerName, ok := lib.SplitUsername(current.User.Username()); ok {
+		lib.SetWorkerName(dest, workerName)
+	}
+	return dest
+}
+
+// RequestReconnect asks the miner to reconnect to another router, empty host means the same address
+func (p *Scheduler) RequestReconnect(ctx context.Context, host string, port int) error {
+	return p.proxy.RequestReconnect(ctx, host, port)
+}
+
 // Scheduler getters protected by mutex
 
 func (p *Scheduler) GetTaskCount() int {
@@ -437,6 +499,10 @@ func (p *Scheduler) GetDestConns() *map[string]string {
 	return p.proxy.GetDestConns()
 }
 
+func (p *Scheduler) GetExtraNonceMode() string {
+	return string(p.proxy.GetExtraNonceMode())
+}
+
 func (p *Scheduler) GetHashrate() proxy.Hashrate {
 	return p.proxy.GetHashrate()
 }
@@ -0,0 +1,188 @@
+package coinbase
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+var (
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+var (
+	// version bytes of base58 addresses of bitcoin and litecoin, mainnet and testnet
+	p2pkhVersions = []byte{0x00, 0x6f, 0x30}
+	p2shVersions  = []byte{0x05, 0xc4, 0x32, 0x3a}
+)
+
+// AddressToScript returns the output script paying to the address. Supported are base58 P2PKH and P2SH,
+// bech32 segwit v0 and bech32m segwit v1+ (taproot) addresses
+func AddressToScript(address string) ([]byte, error) {
+	if script, err := segwitAddressToScript(address); err == nil {
+		return script, nil
+	}
+
+	payload, err := decodeBase58Check(address)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidAddress, fmt.Errorf("%s: %w", address, err))
+	}
+	if len(payload) != 21 {
+		return nil, lib.WrapError(ErrInvalidAddress, fmt.Errorf("%s: invalid length", address))
+	}
+
+	version, hash := payload[0], payload[1:]
+	switch {
+	case bytes.IndexByte(p2pkhVersions, version) >= 0:
+		// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		return append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac), nil
+	case bytes.IndexByte(p2shVersions, version) >= 0:
+		// OP_HASH160 <hash> OP_EQUAL
+		return append(append([]byte{0xa9, 0x14}, hash...), 0x87), nil
+	}
+	return nil, lib.WrapError(ErrInvalidAddress, fmt.Errorf("%s: unknown version %d", address, version))
+}
+
+func decodeBase58Check(s string) ([]byte, error) {
+	num := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		num.Mul(num, radix)
+		num.Add(num, big.NewInt(int64(idx)))
+	}
+
+	leadingZeros := 0
+	for leadingZeros < len(s) && s[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
+	decoded := append(make([]byte, leadingZeros), num.Bytes()...)
+	if len(decoded) < 5 {
+		return nil, fmt.Errorf("too short")
+	}
+
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, fmt.Errorf("invalid checksum")
+	}
+	return payload, nil
+}
+
+// segwitAddressToScript decodes bech32 (BIP173) and bech32m (BIP350) addresses
+func segwitAddressToScript(address string) ([]byte, error) {
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return nil, fmt.Errorf("mixed case")
+	}
+	address = strings.ToLower(address)
+
+	sep := strings.LastIndexByte(address, '1')
+	if sep < 1 || sep+7 > len(address) || len(address) > 90 {
+		return nil, fmt.Errorf("invalid separator position")
+	}
+	hrp := address[:sep]
+
+	data := make([]byte, 0, len(address)-sep-1)
+	for _, c := range address[sep+1:] {
+		idx := strings.IndexRune(bech32Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid bech32 character %q", c)
+		}
+		data = append(data, byte(idx))
+	}
+
+	checksum := bech32Polymod(append(bech32HrpExpand(hrp), data...))
+	data = data[:len(data)-6]
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty data")
+	}
+
+	witnessVersion := data[0]
+	program, err := convertBits(data[1:], 5, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case witnessVersion > 16:
+		return nil, fmt.Errorf("invalid witness version %d", witnessVersion)
+	case witnessVersion == 0 && checksum != bech32Const, witnessVersion > 0 && checksum != bech32mConst:
+		return nil, fmt.Errorf("invalid checksum")
+	case len(program) < 2 || len(program) > 40:
+		return nil, fmt.Errorf("invalid program length %d", len(program))
+	case witnessVersion == 0 && len(program) != 20 && len(program) != 32:
+		return nil, fmt.Errorf("invalid v0 program length %d", len(program))
+	}
+
+	// OP_0 or OP_1 - OP_16, followed by the push of the program
+	op := byte(0x00)
+	if witnessVersion > 0 {
+		op = 0x50 + witnessVersion
+	}
+	return append([]byte{op, byte(len(program))}, program...), nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	res := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		res = append(res, hrp[i]>>5)
+	}
+	res = append(res, 0)
+	for i := 0; i < len(hrp); i++ {
+		res = append(res, hrp[i]&31)
+	}
+	return res
+}
+
+func convertBits(data []byte, from, to uint) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		res  []byte
+	)
+	maxv := uint32(1)<<to - 1
+	for _, v := range data {
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			res = append(res, byte(acc>>bits&maxv))
+		}
+	}
+	if bits >= from || (acc<<(to-bits))&maxv != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package coinbase
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+var (
+	ErrMalformedCoinbase = errors.New("malformed coinbase transaction")
+)
+
+type TxOut struct {
+	Value  uint64 // in satoshis
+	Script []byte
+}
+
+// Coinbase is the parsed coinbase transaction of the job
+type Coinbase struct {
+	Height  int64 // block height from the coinbase script (BIP34), -1 if not present
+	Outputs []TxOut
+}
+
+// ParseCoinbase assembles the coinbase transaction from the parts of mining.notify, with zero-filled extranonce2
+func ParseCoinbase(coinb1, extraNonce1 string, extraNonce2Size int, coinb2 string) (*Coinbase, error) {
+	raw, err := hex.DecodeString(coinb1 + extraNonce1 + strings.Repeat("00", extraNonce2Size) + coinb2)
+	if err != nil {
+		return nil, lib.WrapError(ErrMalformedCoinbase, err)
+	}
+	return ParseCoinbaseTx(raw)
+}
+
+// ParseCoinbaseTx parses the transaction serialized without witness, as it is sent in mining.notify
+func ParseCoinbaseTx(raw []byte) (*Coinbase, error) {
+	r := &txReader{b: raw}
+
+	r.skip(4) // version
+	if inputs := r.varInt(); inputs != 1 && r.err == nil {
+		return nil, lib.WrapError(ErrMalformedCoinbase, fmt.Errorf("expected 1 input, got %d", inputs))
+	}
+	r.skip(36) // prevout, null for coinbase
+	scriptSig := r.bytes(r.varInt())
+	r.skip(4) // sequence
+
+	outputCount := r.varInt()
+	if outputCount > uint64(len(raw)) {
+		return nil, lib.WrapError(ErrMalformedCoinbase, fmt.Errorf("output count %d", outputCount))
+	}
+	cb := &Coinbase{
+		Height:  parseHeight(scriptSig),
+		Outputs: make([]TxOut, 0, outputCount),
+	}
+	for i := uint64(0); i < outputCount && r.err == nil; i++ {
+		value := r.uint64()
+		script := r.bytes(r.varInt())
+		cb.Outputs = append(cb.Outputs, TxOut{Value: value, Script: script})
+	}
+	r.skip(4) // locktime
+
+	if r.err != nil {
+		return nil, lib.WrapError(ErrMalformedCoinbase, r.err)
+	}
+	if r.pos != len(raw) {
+		return nil, lib.WrapError(ErrMalformedCoinbase, fmt.Errorf("%d trailing bytes", len(raw)-r.pos))
+	}
+	return cb, nil
+}
+
+// parseHeight returns the height pushed first to the coinbase script, -1 if it is not there
+func parseHeight(script []byte) int64 {
+	if len(script) == 0 {
+		return -1
+	}
+	op := script[0]
+	switch {
+	case op == 0x00: // OP_0
+		return 0
+	case op >= 0x51 && op <= 0x60: // OP_1 - OP_16
+		return int64(op - 0x50)
+	case op >= 1 && op <= 8 && len(script) > int(op):
+		var height int64
+		for i := int(op); i >= 1; i-- {
+			height = height<<8 | int64(script[i])
+		}
+		return height
+	}
+	return -1
+}
+
+// txReader reads the serialized transaction, the first error is kept and the subsequent reads are no-op
+type txReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *txReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.b)-r.pos) {
+		r.err = fmt.Errorf("unexpected end of data at %d, need %d bytes", r.pos, n)
+		return nil
+	}
+	res := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return res
+}
+
+func (r *txReader) skip(n uint64) {
+	r.bytes(n)
+}
+
+func (r *txReader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *txReader) varInt() uint64 {
+	prefix := r.bytes(1)
+	if prefix == nil {
+		return 0
+	}
+	switch prefix[0] {
+	case 0xfd:
+		if b := r.bytes(2); b != nil {
+			return uint64(binary.LittleEndian.Uint16(b))
+		}
+	case 0xfe:
+		if b := r.bytes(4); b != nil {
+			return uint64(binary.LittleEndian.Uint32(b))
+		}
+	case 0xff:
+		if b := r.bytes(8); b != nil {
+			return binary.LittleEndian.Uint64(b)
+		}
+	default:
+		return uint64(prefix[0])
+	}
+	return 0
+}
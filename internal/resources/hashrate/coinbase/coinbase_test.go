@@ -0,0 +1,72 @@
+package coinbase
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parts of the coinbase of the mainnet block 800481 mined by Braiins pool
+const (
+	testCoinb1          = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4b03e1360cfabe6d6ddecabad1af6410018e1f62f26730ccb9c8a4a55c1c90fb96d7b124a68f126bcf0100000000000000"
+	testCoinb2          = "2e7c42c32d2f736c7573682f000000000383d02826000000001976a9147c154ed1dc59609e3d26abb2df2ea3d587cd8c4188ac00000000000000002c6a4c2952534b424c4f434b3aa126fd3abcfed0d9d2fdf56d5650fda514e1a35408b1b8445c907d21005402510000000000000000266a24aa21a9ed217bdf1fc8e2ca2f98f2f3dc804fa19609ad045e8761e3fcd6b60baf80d1f5bf00000000"
+	testExtraNonce1     = "11650804a6c84c"
+	testExtraNonce2Size = 8
+	testPayoutAddress   = "1CK6KHY6MHgYvmRQ4PAafKYDrg1ejbH1cE"
+)
+
+func TestParseCoinbase(t *testing.T) {
+	cb, err := ParseCoinbase(testCoinb1, testExtraNonce1, testExtraNonce2Size, testCoinb2)
+	require.NoError(t, err)
+
+	require.Equal(t, int64(800481), cb.Height)
+	require.Len(t, cb.Outputs, 3)
+	require.Equal(t, uint64(640209027), cb.Outputs[0].Value)
+	require.Equal(t, "76a9147c154ed1dc59609e3d26abb2df2ea3d587cd8c4188ac", hex.EncodeToString(cb.Outputs[0].Script))
+	require.Zero(t, cb.Outputs[1].Value)
+	require.Zero(t, cb.Outputs[2].Value)
+}
+
+func TestParseCoinbaseMalformed(t *testing.T) {
+	_, err := ParseCoinbase(testCoinb1, testExtraNonce1, testExtraNonce2Size-1, testCoinb2)
+	require.ErrorIs(t, err, ErrMalformedCoinbase)
+
+	_, err = ParseCoinbase(testCoinb1, "zz", testExtraNonce2Size, testCoinb2)
+	require.ErrorIs(t, err, ErrMalformedCoinbase)
+
+	_, err = ParseCoinbase(testCoinb1[:40], "", 0, "")
+	require.ErrorIs(t, err, ErrMalformedCoinbase)
+}
+
+func TestParseHeight(t *testing.T) {
+	require.Equal(t, int64(-1), parseHeight(nil))
+	require.Equal(t, int64(0), parseHeight([]byte{0x00}))
+	require.Equal(t, int64(16), parseHeight([]byte{0x60}))
+	require.Equal(t, int64(227836), parseHeight([]byte{0x03, 0xfc, 0x79, 0x03, 0xff}))
+	require.Equal(t, int64(-1), parseHeight([]byte{0x03, 0xfc}))
+}
+
+func TestAddressToScript(t *testing.T) {
+	cases := map[string]string{
+		testPayoutAddress:                                                "76a9147c154ed1dc59609e3d26abb2df2ea3d587cd8c4188ac",
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy":                             "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87",
+		"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4":                     "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0": "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+	}
+	for address, script := range cases {
+		res, err := AddressToScript(address)
+		require.NoError(t, err, address)
+		require.Equal(t, script, hex.EncodeToString(res), address)
+	}
+
+	for _, address := range []string{
+		"",
+		"1CK6KHY6MHgYvmRQ4PAafKYDrg1ejbH1cF", // bad checksum
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", // bad checksum
+		"bc1qw508d6qejxtdg4y5r3ZARVARY0C5XW7KV8F3T4", // mixed case
+	} {
+		_, err := AddressToScript(address)
+		require.ErrorIs(t, err, ErrInvalidAddress, address)
+	}
+}
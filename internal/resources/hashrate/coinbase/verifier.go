@@ -0,0 +1,71 @@
+package coinbase
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+// PAYOUT_URL_PARAM is the query parameter of the destination URL with the comma-separated list of the
+// expected payout addresses, e.g. stratum+tcp://user@pool:3333?payout=bc1q...,1CK6...
+const PAYOUT_URL_PARAM = "payout"
+
+var (
+	ErrPayoutMismatch = errors.New("coinbase pays to unexpected address")
+)
+
+// PayoutVerifier checks that the coinbase of the job pays only to the expected addresses
+type PayoutVerifier struct {
+	scripts map[string]string // hex encoded output script -> address
+}
+
+func NewPayoutVerifier(addresses []string) (*PayoutVerifier, error) {
+	v := &PayoutVerifier{scripts: make(map[string]string, len(addresses))}
+	for _, address := range addresses {
+		script, err := AddressToScript(address)
+		if err != nil {
+			return nil, err
+		}
+		v.scripts[hex.EncodeToString(script)] = address
+	}
+	return v, nil
+}
+
+// NewPayoutVerifierFromURL returns the verifier for the addresses set by the URL parameter, nil if not set
+func NewPayoutVerifierFromURL(destURL *url.URL) (*PayoutVerifier, error) {
+	param := destURL.Query().Get(PAYOUT_URL_PARAM)
+	if param == "" {
+		return nil, nil
+	}
+
+	var addresses []string
+	for _, address := range strings.Split(param, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return NewPayoutVerifier(addresses)
+}
+
+// Verify checks that every output carrying value pays to one of the expected addresses,
+// zero-value outputs such as the witness commitment are skipped
+func (v *PayoutVerifier) Verify(cb *Coinbase) error {
+	paid := false
+	for i, out := range cb.Outputs {
+		if out.Value == 0 {
+			continue
+		}
+		if _, ok := v.scripts[hex.EncodeToString(out.Script)]; !ok {
+			return lib.WrapError(ErrPayoutMismatch, fmt.Errorf("height %d, output %d pays %d to script %x", cb.Height, i, out.Value, out.Script))
+		}
+		paid = true
+	}
+	if !paid {
+		return lib.WrapError(ErrPayoutMismatch, fmt.Errorf("height %d, no outputs to the expected addresses", cb.Height))
+	}
+	return nil
+}
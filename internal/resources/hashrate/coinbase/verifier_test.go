@@ -0,0 +1,44 @@
+package coinbase
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
+
+func TestPayoutVerifier(t *testing.T) {
+	cb, err := ParseCoinbase(testCoinb1, testExtraNonce1, testExtraNonce2Size, testCoinb2)
+	require.NoError(t, err)
+
+	v, err := NewPayoutVerifier([]string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", testPayoutAddress})
+	require.NoError(t, err)
+	require.NoError(t, v.Verify(cb))
+
+	v, err = NewPayoutVerifier([]string{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"})
+	require.NoError(t, err)
+	require.ErrorIs(t, v.Verify(cb), ErrPayoutMismatch)
+	require.ErrorContains(t, v.Verify(cb), "height 800481")
+
+	_, err = NewPayoutVerifier([]string{"not-an-address"})
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestNewPayoutVerifierFromURL(t *testing.T) {
+	v, err := NewPayoutVerifierFromURL(mustParseURL(t, "stratum+tcp://acc.worker@pool.example.com:3333"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	v, err = NewPayoutVerifierFromURL(mustParseURL(t, "stratum+tcp://acc.worker@pool.example.com:3333?payout="+testPayoutAddress+",3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"))
+	require.NoError(t, err)
+	require.Len(t, v.scripts, 2)
+
+	_, err = NewPayoutVerifierFromURL(mustParseURL(t, "stratum+tcp://acc.worker@pool.example.com:3333?payout=1abc"))
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
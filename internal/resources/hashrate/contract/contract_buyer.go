@@ -27,6 +27,7 @@ type ContractWatcherBuyer struct {
 	role                     resources.ContractRole
 	validatorStartTime       time.Time
 	defaultDest              *url.URL
+	destParams               url.Values // destination URL params configured for this contract
 
 	// state
 	state                *lib.AtomicValue[resources.ContractState]
@@ -69,6 +70,7 @@ func NewContractWatcherBuyer(
 	validatorStartTime time.Time,
 	role resources.ContractRole,
 	defaultDest *url.URL,
+	destParams url.Values,
 ) *ContractWatcherBuyer {
 	return &ContractWatcherBuyer{
 		contractCycleDuration:    cycleDuration,
@@ -79,6 +81,7 @@ func NewContractWatcherBuyer(
 		role:                     role,
 		validatorStartTime:       validatorStartTime,
 		defaultDest:              defaultDest,
+		destParams:               destParams,
 
 		state:                lib.NewAtomicValue(resources.ContractStatePending),
 		validationStage:      lib.NewAtomicValue(hashrateContract.ValidationStageValidating),
@@ -325,11 +328,12 @@ func (p *ContractWatcherBuyer) Dest() string {
 }
 
 func (p *ContractWatcherBuyer) PoolDest() string {
-	url := p.Terms.DestinationURL
+	// the params of the contract destination are not trusted, unlike the ones of the default
+	url := stripDestParams(p.Terms.DestinationURL)
 	if url == nil {
-		return p.defaultDest.String()
+		url = p.defaultDest
 	}
-	return url.String()
+	return applyDestParams(url, p.destParams).String()
 }
 
 func (p *ContractWatcherBuyer) StarvingGHS() int {
@@ -25,6 +25,7 @@ type ContractFactory struct {
 	validatorFlatness        time.Duration
 	validatorStartTime       time.Time
 	defaultDest              *url.URL
+	destParams               ContractDestParams
 
 	// state
 	address common.Address // derived from private key
@@ -52,6 +53,7 @@ func NewContractFactory(
 	validatorFlatness time.Duration,
 	validatorStartTime time.Time,
 	defaultDest *url.URL,
+	destParams ContractDestParams,
 ) (*ContractFactory, error) {
 	address, err := lib.PrivKeyStringToAddr(privateKey)
 	if err != nil {
@@ -75,6 +77,7 @@ func NewContractFactory(
 		validatorFlatness:        validatorFlatness,
 		validatorStartTime:       validatorStartTime,
 		defaultDest:              defaultDest,
+		destParams:               destParams,
 	}, nil
 }
 
@@ -93,7 +96,7 @@ func (c *ContractFactory) CreateContract(contractData *hashrateContract.Encrypte
 			ValidatorURL:   nil,
 		}
 
-		watcher := NewContractWatcherSellerV2(terms, c.cycleDuration, c.hashrateFactory, c.allocator, logNamed)
+		watcher := NewContractWatcherSellerV2(terms, c.cycleDuration, c.destParams.Get(contractData.ID()), c.hashrateFactory, c.allocator, logNamed)
 		return NewControllerSeller(watcher, c.store, c.privateKey), nil
 	}
 
@@ -133,6 +136,7 @@ func (c *ContractFactory) CreateContract(contractData *hashrateContract.Encrypte
 			c.validatorStartTime,
 			role,
 			c.defaultDest,
+			c.destParams.Get(contractData.ID()),
 		)
 
 		if destErr != nil {
@@ -31,6 +31,7 @@ var (
 type ContractWatcherSellerV2 struct {
 	// config
 	contractCycleDuration time.Duration
+	destParams            url.Values // destination URL params configured for this contract
 
 	// state
 	stats             *stats
@@ -57,9 +58,10 @@ type ContractWatcherSellerV2 struct {
 	log       interfaces.ILogger
 }
 
-func NewContractWatcherSellerV2(terms *hashrateContract.Terms, cycleDuration time.Duration, hashrateFactory func() *hr.Hashrate, allocator *allocator.Allocator, log interfaces.ILogger) *ContractWatcherSellerV2 {
+func NewContractWatcherSellerV2(terms *hashrateContract.Terms, cycleDuration time.Duration, destParams url.Values, hashrateFactory func() *hr.Hashrate, allocator *allocator.Allocator, log interfaces.ILogger) *ContractWatcherSellerV2 {
 	return &ContractWatcherSellerV2{
 		contractCycleDuration: cycleDuration,
+		destParams:            destParams,
 		stats: &stats{
 			actualHRGHS: hashrateFactory(),
 		},
@@ -482,12 +484,13 @@ func (p *ContractWatcherSellerV2) isTimeExpired() bool {
 }
 
 // getAdjustedDest returns the destination url with the username set to the contractID
-// this is required for the buyer to distinguish incoming hashrate between different contracts
+// this is required for the buyer to distinguish incoming hashrate between different contracts.
+// The params configured for the contract (e.g. pow algorithm) replace the ones set by the buyer
 func (p *ContractWatcherSellerV2) getAdjustedDest() *url.URL {
 	if p.Terms.Dest() == nil {
 		return nil
 	}
-	dest := lib.CopyURL(p.Terms.Dest())
+	dest := applyDestParams(stripDestParams(p.Terms.Dest()), p.destParams)
 	lib.SetUserName(dest, p.Terms.ID())
 	return dest
 }
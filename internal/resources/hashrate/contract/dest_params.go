@@ -0,0 +1,97 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/coinbase"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+var (
+	ErrInvalidDestParams = errors.New("invalid contract destination params")
+)
+
+// operatorDestParams are the destination URL params that affect validation and accounting of the shares.
+// They are taken from the operator config only, otherwise the contract party could set e.g. the pow
+// that fails every share locally while the shares are still forwarded to its pool
+var operatorDestParams = []string{
+	validator.POW_URL_PARAM,
+	coinbase.PAYOUT_URL_PARAM,
+	proxy.DIALECT_URL_PARAM,
+}
+
+// ContractDestParams holds the destination URL query parameters (e.g. pow=scrypt, payout=bc1q...) configured per contract,
+// the keys are checksummed contract addresses
+type ContractDestParams map[string]url.Values
+
+// ParseContractDestParams parses the comma separated list of contractID?query items,
+// e.g. 0x1234...?pow=scrypt,0x5678...?payout=bc1q...
+func ParseContractDestParams(list string) (ContractDestParams, error) {
+	params := make(ContractDestParams)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		contractID, query, _ := strings.Cut(item, "?")
+		if !common.IsHexAddress(contractID) {
+			return nil, lib.WrapError(ErrInvalidDestParams, fmt.Errorf("invalid contract address %s", contractID))
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, lib.WrapError(ErrInvalidDestParams, fmt.Errorf("%s: %w", contractID, err))
+		}
+		// validated the same way as the params of the destination URL
+		paramsURL := &url.URL{RawQuery: values.Encode()}
+		if _, err := validator.GetPowAlgorithmByURL(paramsURL); err != nil {
+			return nil, lib.WrapError(ErrInvalidDestParams, fmt.Errorf("%s: %w", contractID, err))
+		}
+		if _, err := coinbase.NewPayoutVerifierFromURL(paramsURL); err != nil {
+			return nil, lib.WrapError(ErrInvalidDestParams, fmt.Errorf("%s: %w", contractID, err))
+		}
+		params[common.HexToAddress(contractID).Hex()] = values
+	}
+	return params, nil
+}
+
+// Get returns the params of the contract, nil if not configured
+func (p ContractDestParams) Get(contractID string) url.Values {
+	if !common.IsHexAddress(contractID) {
+		return nil
+	}
+	return p[common.HexToAddress(contractID).Hex()]
+}
+
+// stripDestParams returns the copy of the destination URL from the contract without the params reserved for the operator
+func stripDestParams(dest *url.URL) *url.URL {
+	dest = lib.CopyURL(dest)
+	if dest == nil {
+		return nil
+	}
+	query := dest.Query()
+	for _, key := range operatorDestParams {
+		query.Del(key)
+	}
+	dest.RawQuery = query.Encode()
+	return dest
+}
+
+// applyDestParams returns the copy of the destination URL with the params set, overriding the existing ones
+func applyDestParams(dest *url.URL, params url.Values) *url.URL {
+	dest = lib.CopyURL(dest)
+	if dest == nil || len(params) == 0 {
+		return dest
+	}
+	query := dest.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	dest.RawQuery = query.Encode()
+	return dest
+}
@@ -0,0 +1,219 @@
+package failover
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+const (
+	FAILURES_TO_FAILOVER  = 2 // consecutive failed probes to consider the pool down
+	SUCCESSES_TO_FAILBACK = 3 // consecutive successful probes to switch back to the higher priority pool
+)
+
+// ProbeFunc checks if the pool accepts miners
+type ProbeFunc func(ctx context.Context, poolURL *url.URL) error
+
+// OnChangeFunc is called when the active pool changes
+type OnChangeFunc func(prev, next *url.URL)
+
+type PoolStatus struct {
+	URL                 string
+	Priority            int
+	IsHealthy           bool
+	IsActive            bool
+	LastCheckedAt       time.Time
+	Latency             time.Duration
+	LastError           string
+	ConsecutiveFailures int
+}
+
+type pool struct {
+	url                  *url.URL
+	isHealthy            bool
+	lastCheckedAt        time.Time
+	latency              time.Duration
+	lastErr              error
+	consecutiveFailures  int
+	consecutiveSuccesses int
+}
+
+// Failover keeps an ordered list of default pools, probes them periodically and
+// selects the first healthy one as active. Lower priority pools are used only
+// until the higher priority pool recovers
+type Failover struct {
+	// config
+	interval time.Duration
+	timeout  time.Duration
+
+	// state
+	pools     []*pool
+	active    int
+	mutex     sync.RWMutex
+	onChange  []OnChangeFunc
+	onChangeM sync.Mutex
+
+	// deps
+	probe ProbeFunc
+	log   gi.ILogger
+}
+
+func NewFailover(poolURLs []*url.URL, probe ProbeFunc, interval, timeout time.Duration, log gi.ILogger) *Failover {
+	pools := make([]*pool, len(poolURLs))
+	for i, u := range poolURLs {
+		// pools are assumed healthy until proven otherwise, so the primary is used on startup
+		pools[i] = &pool{url: u, isHealthy: true}
+	}
+	return &Failover{
+		interval: interval,
+		timeout:  timeout,
+		pools:    pools,
+		probe:    probe,
+		log:      log,
+	}
+}
+
+// Run probes the pools every interval until context is cancelled
+func (f *Failover) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes all of the pools concurrently and updates the active pool
+func (f *Failover) CheckAll(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for i := range f.pools {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f.check(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	f.selectActive()
+}
+
+func (f *Failover) check(ctx context.Context, i int) {
+	f.mutex.RLock()
+	poolURL := lib.CopyURL(f.pools[i].url)
+	f.mutex.RUnlock()
+
+	probeCtx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := f.probe(probeCtx, poolURL)
+	latency := time.Since(start)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	p := f.pools[i]
+	p.lastCheckedAt, p.latency, p.lastErr = start, latency, err
+
+	if err != nil {
+		p.consecutiveFailures++
+		p.consecutiveSuccesses = 0
+		if p.isHealthy && p.consecutiveFailures >= FAILURES_TO_FAILOVER {
+			p.isHealthy = false
+			f.log.Warnf("pool %s is down: %s", poolURL.Redacted(), err)
+		}
+		return
+	}
+
+	p.consecutiveFailures = 0
+	p.consecutiveSuccesses++
+	if !p.isHealthy {
+		p.isHealthy = true
+		f.log.Infof("pool %s is up", poolURL.Redacted())
+	}
+}
+
+func (f *Failover) selectActive() {
+	f.mutex.Lock()
+
+	next := -1
+	for i, p := range f.pools {
+		if !p.isHealthy {
+			continue
+		}
+		// higher priority pool has to be stable before failing back
+		if i < f.active && p.consecutiveSuccesses < SUCCESSES_TO_FAILBACK {
+			continue
+		}
+		next = i
+		break
+	}
+
+	// if all of the pools are down the active one is kept
+	if next == -1 || next == f.active {
+		f.mutex.Unlock()
+		return
+	}
+
+	prev := lib.CopyURL(f.pools[f.active].url)
+	nextURL := lib.CopyURL(f.pools[next].url)
+	f.active = next
+	f.mutex.Unlock()
+
+	f.log.Warnf("switching default pool from %s to %s", prev.Redacted(), nextURL.Redacted())
+
+	f.onChangeM.Lock()
+	defer f.onChangeM.Unlock()
+	for _, cb := range f.onChange {
+		cb(prev, nextURL)
+	}
+}
+
+// OnChange registers callback that is called when the active pool changes
+func (f *Failover) OnChange(cb OnChangeFunc) {
+	f.onChangeM.Lock()
+	defer f.onChangeM.Unlock()
+	f.onChange = append(f.onChange, cb)
+}
+
+// GetActive returns a copy of the url of the active pool
+func (f *Failover) GetActive() *url.URL {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return lib.CopyURL(f.pools[f.active].url)
+}
+
+func (f *Failover) GetStatus() []PoolStatus {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	statuses := make([]PoolStatus, len(f.pools))
+	for i, p := range f.pools {
+		lastErr := ""
+		if p.lastErr != nil {
+			lastErr = p.lastErr.Error()
+		}
+		statuses[i] = PoolStatus{
+			URL:                 p.url.Redacted(),
+			Priority:            i,
+			IsHealthy:           p.isHealthy,
+			IsActive:            i == f.active,
+			LastCheckedAt:       p.lastCheckedAt,
+			Latency:             p.latency,
+			LastError:           lastErr,
+			ConsecutiveFailures: p.consecutiveFailures,
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+const (
+	AGGREGATOR_MIN_EXTRANONCE2_SIZE = 2          // minimal extranonce2 size left to the miner after partitioning
+	AGGREGATOR_MEMBER_QUEUE_SIZE    = 100        // messages buffered per miner, miners that don't keep up are disconnected
+	AGGREGATOR_VERSION_ROLLING_MASK = "1fffe000" // version rolling mask requested from the pool for the shared session
+)
+
+var (
+	ErrAggregator                = errors.New("aggregator error")
+	ErrAggregatorExtranonceSpace = errors.New("not enough extranonce2 space for partitioning")
+	ErrAggregatorSessionClosed   = errors.New("aggregated session closed")
+)
+
+// Aggregator shares upstream connections between miners going to the same destination.
+// Each miner gets a disjoint slice of the pool extranonce2 space by prefixing its
+// extranonce2 with a unique value, so the pool sees a single worker. Miners are
+// connected to the session with in-memory pipes, so for the proxy they look like regular destinations
+type Aggregator struct {
+	// config
+	prefixSize       int // bytes of the pool extranonce2 used as a miner prefix
+	maxMembers       int // maximum number of miners per upstream connection
+	cleanJobTimeout  time.Duration
+	idleReadTimeout  time.Duration
+	idleWriteTimeout time.Duration
+
+	// state
+	sessions map[string][]*aggregatorSession // sessions by destination url
+	pending  map[string]chan struct{}        // closed when session for the destination url is created
+	mutex    sync.Mutex
+
+	// deps
+	upstreamFactory DestConnFactory
+	log             gi.ILogger
+}
+
+func NewAggregator(upstreamFactory DestConnFactory, prefixSize, maxMembers int, cleanJobTimeout, idleReadTimeout, idleWriteTimeout time.Duration, log gi.ILogger) *Aggregator {
+	if capacity := 1 << (8 * prefixSize); prefixSize < 4 && maxMembers > capacity {
+		maxMembers = capacity
+	}
+	return &Aggregator{
+		prefixSize:       prefixSize,
+		maxMembers:       maxMembers,
+		cleanJobTimeout:  cleanJobTimeout,
+		idleReadTimeout:  idleReadTimeout,
+		idleWriteTimeout: idleWriteTimeout,
+		sessions:         make(map[string][]*aggregatorSession),
+		pending:          make(map[string]chan struct{}),
+		upstreamFactory:  upstreamFactory,
+		log:              log,
+	}
+}
+
+// ConnectDest joins the miner to the shared session for the destination, creating one if
+// there are no sessions with free slots. Has the signature of DestConnFactory
+func (a *Aggregator) ConnectDest(ctx context.Context, destURL *url.URL, srcWorker string, srcAddr string) (*ConnDest, error) {
+	key := destURL.String()
+	destLog := a.log.Named("DST").With("DstAddr", fmt.Sprintf("%s@%s", destURL.User.Username(), destURL.Host), "SrcWorker", srcWorker, "SrcAddr", srcAddr)
+
+	for {
+		a.mutex.Lock()
+		for _, session := range a.sessions[key] {
+			conn, ok := session.join()
+			if ok {
+				a.mutex.Unlock()
+				return a.newMemberDest(conn, session, destURL, destLog), nil
+			}
+		}
+
+		// wait for the session that is being created by another miner
+		if ch, ok := a.pending[key]; ok {
+			a.mutex.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-ch:
+			}
+			continue
+		}
+
+		ch := make(chan struct{})
+		a.pending[key] = ch
+		a.mutex.Unlock()
+
+		session, err := a.newSession(ctx, destURL)
+
+		a.mutex.Lock()
+		delete(a.pending, key)
+		close(ch)
+		if err != nil {
+			a.mutex.Unlock()
+			return nil, lib.WrapError(ErrConnectDest, lib.WrapError(ErrAggregator, err))
+		}
+		a.sessions[key] = append(a.sessions[key], session)
+		a.mutex.Unlock()
+	}
+}
+
+// GetSessionCount returns number of upstream connections opened by the aggregator
+func (a *Aggregator) GetSessionCount() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	count := 0
+	for _, sessions := range a.sessions {
+		count += len(sessions)
+	}
+	return count
+}
+
+func (a *Aggregator) newSession(ctx context.Context, destURL *url.URL) (*aggregatorSession, error) {
+	upstream, err := a.upstreamFactory(ctx, destURL, "aggregator", "")
+	if err != nil {
+		return nil, err
+	}
+
+	session := newAggregatorSession(upstream, destURL, a.prefixSize, a.maxMembers, a.idleReadTimeout, a.idleWriteTimeout, a.removeSession, a.log.Named("AGG").With("DstAddr", destURL.Host))
+	err = session.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (a *Aggregator) removeSession(session *aggregatorSession) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key := session.url.String()
+	sessions := a.sessions[key]
+	for i, s := range sessions {
+		if s == session {
+			sessions = append(sessions[:i], sessions[i+1:]...)
+			break
+		}
+	}
+
+	if len(sessions) == 0 {
+		delete(a.sessions, key)
+	} else {
+		a.sessions[key] = sessions
+	}
+}
+
+func (a *Aggregator) newMemberDest(conn net.Conn, session *aggregatorSession, destURL *url.URL, log gi.ILogger) *ConnDest {
+	upstreamConn := session.upstream.conn.conn
+	conn = lib.NewConnWithAddr(conn, upstreamConn.LocalAddr(), upstreamConn.RemoteAddr())
+	log = log.With("DstPort", lib.ParsePort(upstreamConn.LocalAddr().String()))
+
+	stratumConn := CreateConnection(conn, destURL.String(), a.idleReadTimeout, a.idleWriteTimeout, log)
+	// the members receive the jobs of the upstream, so its payout addresses apply
+	return NewDestConn(stratumConn, validator.NewValidator(a.cleanJobTimeout), destURL, session.upstream.payout, log)
+}
+
+// andVersionMask returns the bits allowed by both version rolling masks
+func andVersionMask(mask1, mask2 string) (string, error) {
+	m1, err := strconv.ParseUint(mask1, 16, 32)
+	if err != nil {
+		return "", err
+	}
+	m2, err := strconv.ParseUint(mask2, 16, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", m1&m2), nil
+}
@@ -0,0 +1,391 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	"go.uber.org/atomic"
+)
+
+// aggregatorSession is a single upstream connection shared by multiple miners
+type aggregatorSession struct {
+	// config
+	url              *url.URL
+	prefixSize       int
+	maxMembers       int
+	idleReadTimeout  time.Duration
+	idleWriteTimeout time.Duration
+
+	// state
+	members         map[uint32]*aggregatorMember // members by extranonce2 prefix
+	nextPrefix      uint32
+	extraNonce1     string
+	extraNonce2Size int
+	versionMask     string // negotiated with the pool, empty if version rolling is not supported
+	diff            float64
+	notify          *sm.MiningNotify // latest job
+	firstJobCh      chan struct{}
+	firstJobOnce    sync.Once
+	isClosed        bool
+	mutex           sync.Mutex
+	msgID           atomic.Int64
+	cancel          context.CancelFunc
+
+	// deps
+	upstream *ConnDest
+	onClose  func(*aggregatorSession)
+	log      gi.ILogger
+}
+
+// aggregatorMember is a miner connected to the shared session
+type aggregatorMember struct {
+	prefix       string // hex encoded extranonce2 prefix
+	isSubscribed bool   // jobs are sent only after subscribe result
+	queue        chan i.MiningMessageGeneric
+	conn         *StratumConnection // session side of the in-memory pipe
+	doneCh       chan struct{}
+	closeOnce    sync.Once
+}
+
+func newAggregatorSession(upstream *ConnDest, url *url.URL, prefixSize, maxMembers int, idleReadTimeout, idleWriteTimeout time.Duration, onClose func(*aggregatorSession), log gi.ILogger) *aggregatorSession {
+	return &aggregatorSession{
+		url:              url,
+		prefixSize:       prefixSize,
+		maxMembers:       maxMembers,
+		idleReadTimeout:  idleReadTimeout,
+		idleWriteTimeout: idleWriteTimeout,
+		members:          make(map[uint32]*aggregatorMember),
+		firstJobCh:       make(chan struct{}),
+		upstream:         upstream,
+		onClose:          onClose,
+		log:              log,
+	}
+}
+
+// start performs handshake with the pool and starts reading from it in the background
+func (s *aggregatorSession) start(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		err := s.run(runCtx)
+		s.close(err)
+	}()
+
+	err := s.handshake(ctx)
+	if err != nil {
+		s.close(err)
+		return err
+	}
+
+	s.log.Infof("aggregated session connected %s, extranonce2 size %d", s.url.Host, s.extraNonce2Size)
+	return nil
+}
+
+func (s *aggregatorSession) handshake(ctx context.Context) error {
+	dialect := s.upstream.GetDialect()
+
+	// 1. MINING.CONFIGURE
+	if dialect.VersionRolling {
+		cfgMsg := sm.NewMiningConfigure(s.nextMsgID(), nil)
+		cfgMsg.SetVersionRolling(AGGREGATOR_VERSION_ROLLING_MASK, 2)
+		res, err := s.upstream.WriteAwaitRes(ctx, cfgMsg)
+		if errors.Is(err, ErrDest) {
+			return err
+		}
+		if err != nil {
+			// some pools don't answer unknown methods, continue without version rolling
+			s.log.Warnf("pool didn't answer mining.configure: %s", err)
+		} else if cfgRes, err := sm.ToMiningConfigureResult(res.(*sm.MiningResult)); err == nil && !cfgRes.IsError() && cfgRes.GetVersionRolling() {
+			s.versionMask = cfgRes.GetVersionRollingMask()
+			s.upstream.SetVersionRolling(true, s.versionMask)
+		}
+	}
+
+	// 2. MINING.SUBSCRIBE
+	res, err := s.upstream.WriteAwaitRes(ctx, dialect.NewSubscribe(s.nextMsgID()))
+	if err != nil {
+		return err
+	}
+	subRes, err := sm.ToMiningSubscribeResult(res.(*sm.MiningResult))
+	if err != nil {
+		return err
+	}
+	if subRes.IsError() {
+		return fmt.Errorf("pool returned error: %s", subRes.GetError())
+	}
+	xn, xnSize := subRes.GetExtranonce()
+	if xnSize-s.prefixSize < AGGREGATOR_MIN_EXTRANONCE2_SIZE {
+		return lib.WrapError(ErrAggregatorExtranonceSpace, fmt.Errorf("pool extranonce2 size %d, prefix size %d", xnSize, s.prefixSize))
+	}
+	s.mutex.Lock()
+	s.extraNonce1, s.extraNonce2Size = xn, xnSize
+	s.mutex.Unlock()
+	s.upstream.SetExtraNonce(xn, xnSize)
+
+	// 3. MINING.AUTHORIZE
+	pwd, _ := s.url.User.Password()
+	res, err = s.upstream.WriteAwaitRes(ctx, sm.NewMiningAuthorize(s.nextMsgID(), s.url.User.Username(), pwd))
+	if err != nil {
+		return err
+	}
+	if authRes := res.(*sm.MiningResult); authRes.IsError() {
+		return lib.WrapError(ErrNotAuthorizedPool, fmt.Errorf("%s", authRes.GetError()))
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.firstJobCh:
+	}
+
+	return nil
+}
+
+// run reads messages from the pool and broadcasts them to the members
+func (s *aggregatorSession) run(ctx context.Context) error {
+	for {
+		msg, err := s.upstream.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch typed := msg.(type) {
+		case *sm.MiningNotify:
+			s.mutex.Lock()
+			s.notify = typed
+			s.broadcast(typed)
+			s.mutex.Unlock()
+			s.firstJobOnce.Do(func() {
+				close(s.firstJobCh)
+			})
+		case *sm.MiningSetDifficulty:
+			s.mutex.Lock()
+			s.diff = typed.GetDifficulty()
+			s.broadcast(typed)
+			s.mutex.Unlock()
+		case *sm.MiningSetExtranonce:
+			xn, xnSize := typed.GetExtranonce()
+			if xnSize-s.prefixSize < AGGREGATOR_MIN_EXTRANONCE2_SIZE {
+				return lib.WrapError(ErrAggregatorExtranonceSpace, fmt.Errorf("pool extranonce2 size %d, prefix size %d", xnSize, s.prefixSize))
+			}
+			s.mutex.Lock()
+			s.extraNonce1, s.extraNonce2Size = xn, xnSize
+			for _, member := range s.members {
+				if member.isSubscribed {
+					s.send(member, sm.NewMiningSetExtranonce(xn+member.prefix, xnSize-s.prefixSize))
+				}
+			}
+			s.mutex.Unlock()
+		case *sm.MiningSetVersionMask:
+			s.mutex.Lock()
+			s.broadcast(typed)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// join allocates extranonce2 prefix for the new miner, returns false if session is full or closed
+func (s *aggregatorSession) join() (net.Conn, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isClosed || len(s.members) >= s.maxMembers {
+		return nil, false
+	}
+
+	prefix := s.nextPrefix
+	for {
+		if _, ok := s.members[prefix]; !ok {
+			break
+		}
+		prefix = (prefix + 1) % uint32(s.maxMembers)
+	}
+	s.nextPrefix = (prefix + 1) % uint32(s.maxMembers)
+
+	sessionSide, proxySide := net.Pipe()
+	member := &aggregatorMember{
+		prefix: fmt.Sprintf("%0*x", s.prefixSize*2, prefix),
+		queue:  make(chan i.MiningMessageGeneric, AGGREGATOR_MEMBER_QUEUE_SIZE),
+		conn:   CreateConnection(sessionSide, s.url.String(), s.idleReadTimeout, s.idleWriteTimeout, s.log),
+		doneCh: make(chan struct{}),
+	}
+	s.members[prefix] = member
+
+	go s.runMemberWriter(member)
+	go func() {
+		err := s.runMemberReader(member)
+		s.log.Debugf("miner with prefix %s left the session: %s", member.prefix, err)
+		s.leave(prefix, member)
+	}()
+
+	return proxySide, true
+}
+
+func (s *aggregatorSession) leave(prefix uint32, member *aggregatorMember) {
+	member.close()
+
+	s.mutex.Lock()
+	if s.members[prefix] == member {
+		delete(s.members, prefix)
+	}
+	isEmpty := len(s.members) == 0
+	s.mutex.Unlock()
+
+	if isEmpty {
+		s.close(errors.New("no miners left"))
+	}
+}
+
+func (s *aggregatorSession) runMemberReader(member *aggregatorMember) error {
+	ctx := context.Background()
+	for {
+		msg, err := member.conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch typed := msg.(type) {
+		case *sm.MiningConfigure:
+			mask, minBits := typed.GetVersionRolling()
+			res := sm.NewMiningConfigureResult(typed.GetID(), false, "")
+			if s.versionMask != "" && mask != "" {
+				negotiated, err := andVersionMask(mask, s.versionMask)
+				if err != nil {
+					return err
+				}
+				res = sm.NewMiningConfigureResult(typed.GetID(), true, negotiated)
+			}
+			s.log.Debugf("miner configure mask %s min bits %d", mask, minBits)
+			s.mutex.Lock()
+			s.send(member, res)
+			s.mutex.Unlock()
+
+		case *sm.MiningSubscribe:
+			s.mutex.Lock()
+			member.isSubscribed = true
+			s.send(member, sm.NewMiningSubscribeResult(typed.GetID(), s.extraNonce1+member.prefix, s.extraNonce2Size-s.prefixSize))
+			if s.diff > 0 {
+				s.send(member, sm.NewMiningSetDifficulty(s.diff))
+			}
+			if s.notify != nil {
+				notify := s.notify.Copy()
+				notify.SetCleanJobs(true)
+				s.send(member, notify)
+			}
+			s.mutex.Unlock()
+
+		case *sm.MiningAuthorize:
+			// the session is authorized with the destination credentials
+			s.mutex.Lock()
+			s.send(member, sm.NewMiningResultSuccess(typed.GetID()))
+			s.mutex.Unlock()
+
+		case *sm.MiningExtranonceSubscribe:
+			s.mutex.Lock()
+			s.send(member, sm.NewMiningResultSuccess(typed.GetID()))
+			s.mutex.Unlock()
+
+		case *sm.MiningSubmit:
+			s.onMemberSubmit(member, typed)
+
+		default:
+			s.log.Warnf("unexpected message from miner, ignoring: %s", string(msg.Serialize()))
+		}
+	}
+}
+
+// onMemberSubmit prefixes the extranonce2 of the miner and submits share over the shared session
+func (s *aggregatorSession) onMemberSubmit(member *aggregatorMember, msg *sm.MiningSubmit) {
+	// the upstream assigns unique message ID, so IDs of the members don't collide
+	msg.SetExtraNonce2(member.prefix + msg.GetExtraNonce2())
+	msg.SetUserName(s.url.User.Username())
+
+	go func() {
+		res, err := s.upstream.WriteAwaitRes(context.Background(), msg)
+		if err != nil {
+			s.log.Warnf("cannot submit share for miner with prefix %s: %s", member.prefix, err)
+			return
+		}
+
+		s.mutex.Lock()
+		s.send(member, res)
+		s.mutex.Unlock()
+	}()
+}
+
+func (s *aggregatorSession) runMemberWriter(member *aggregatorMember) {
+	for {
+		select {
+		case <-member.doneCh:
+			return
+		case msg := <-member.queue:
+			err := member.conn.Write(context.Background(), msg)
+			if err != nil {
+				member.close()
+				return
+			}
+		}
+	}
+}
+
+// broadcast sends message to all subscribed members, should be called under s.mutex
+func (s *aggregatorSession) broadcast(msg i.MiningMessageGeneric) {
+	for _, member := range s.members {
+		if member.isSubscribed {
+			s.send(member, msg)
+		}
+	}
+}
+
+// send queues the message for the member without blocking the session,
+// should be called under s.mutex
+func (s *aggregatorSession) send(member *aggregatorMember, msg i.MiningMessageGeneric) {
+	select {
+	case member.queue <- msg:
+	default:
+		s.log.Warnf("miner with prefix %s is too slow, disconnecting", member.prefix)
+		member.close()
+	}
+}
+
+func (s *aggregatorSession) close(err error) {
+	s.mutex.Lock()
+	if s.isClosed {
+		s.mutex.Unlock()
+		return
+	}
+	s.isClosed = true
+	members := s.members
+	s.members = make(map[uint32]*aggregatorMember)
+	s.mutex.Unlock()
+
+	s.log.Infof("aggregated session closed %s: %s", s.url.Host, err)
+
+	s.cancel()
+	_ = s.upstream.conn.Close()
+	for _, member := range members {
+		member.close()
+	}
+	s.onClose(s)
+}
+
+func (s *aggregatorSession) nextMsgID() int {
+	return int(s.msgID.Inc())
+}
+
+func (m *aggregatorMember) close() {
+	m.closeOnce.Do(func() {
+		close(m.doneCh)
+		_ = m.conn.Close()
+	})
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	BLOCK_CANDIDATES_HISTORY  = 100  // number of the latest block candidates kept in memory
+	BLOCK_CANDIDATES_MAX_KEYS = 1000 // max number of miners, dests or contracts counted, the one with the least candidates is evicted
+)
+
+// BlockCandidateRecord is the share that would solve the block, with the context it was submitted in
+type BlockCandidateRecord struct {
+	Time        time.Time `json:"time"`
+	MinerID     string    `json:"minerID"`
+	WorkerName  string    `json:"workerName"`
+	Dest        string    `json:"dest"`
+	ContractID  string    `json:"contractID,omitempty"`
+	JobID       string    `json:"jobID"`
+	BlockHash   string    `json:"blockHash"`
+	PowHash     string    `json:"powHash"`
+	Header      string    `json:"header"`
+	ShareDiff   uint64    `json:"shareDiff"`
+	NetworkDiff float64   `json:"networkDiff"`
+}
+
+type BlockCandidatesReport struct {
+	Total      int                    `json:"total"`
+	ByMiner    map[string]int         `json:"byMiner"`
+	ByDest     map[string]int         `json:"byDest"`
+	ByContract map[string]int         `json:"byContract"`
+	Latest     []BlockCandidateRecord `json:"latest"`
+}
+
+// BlockCandidates counts the block candidates found by all of the miners, it is
+// the independent evidence of the luck of the pool or of the contract
+type BlockCandidates struct {
+	total      int
+	byMiner    map[string]int
+	byDest     map[string]int
+	byContract map[string]int
+	latest     []BlockCandidateRecord
+	mutex      sync.RWMutex
+}
+
+func NewBlockCandidates() *BlockCandidates {
+	return &BlockCandidates{
+		byMiner:    make(map[string]int),
+		byDest:     make(map[string]int),
+		byContract: make(map[string]int),
+	}
+}
+
+func (b *BlockCandidates) Add(record BlockCandidateRecord) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.total++
+	incCount(b.byMiner, record.MinerID)
+	incCount(b.byDest, record.Dest)
+	if record.ContractID != "" {
+		incCount(b.byContract, record.ContractID)
+	}
+
+	b.latest = append(b.latest, record)
+	if len(b.latest) > BLOCK_CANDIDATES_HISTORY {
+		b.latest = b.latest[len(b.latest)-BLOCK_CANDIDATES_HISTORY:]
+	}
+}
+
+// GetReport returns the counters and the latest candidates, newest first
+func (b *BlockCandidates) GetReport() BlockCandidatesReport {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	report := BlockCandidatesReport{
+		Total:      b.total,
+		ByMiner:    copyCounts(b.byMiner),
+		ByDest:     copyCounts(b.byDest),
+		ByContract: copyCounts(b.byContract),
+		Latest:     make([]BlockCandidateRecord, 0, len(b.latest)),
+	}
+	for i := len(b.latest) - 1; i >= 0; i-- {
+		report.Latest = append(report.Latest, b.latest[i])
+	}
+	return report
+}
+
+// incCount increments the counter of the key, evicting the smallest counter if the map is full.
+// Miner IDs are unique per connection, so the counters of the disconnected miners are evicted eventually
+func incCount(m map[string]int, key string) {
+	if _, ok := m[key]; !ok && len(m) >= BLOCK_CANDIDATES_MAX_KEYS {
+		minKey, minCount := "", 0
+		for k, v := range m {
+			if minKey == "" || v < minCount {
+				minKey, minCount = k, v
+			}
+		}
+		delete(m, minKey)
+	}
+	m[key]++
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	res := make(map[string]int, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCandidates(t *testing.T) {
+	candidates := NewBlockCandidates()
+
+	for i := 0; i < BLOCK_CANDIDATES_HISTORY+5; i++ {
+		record := BlockCandidateRecord{
+			MinerID:   fmt.Sprintf("miner%d", i%2),
+			Dest:      "stratum+tcp://pool.worker@pool.example.com:3333",
+			BlockHash: fmt.Sprintf("%064x", i),
+		}
+		if i < 3 {
+			record.ContractID = "0xcontract"
+		}
+		candidates.Add(record)
+	}
+
+	report := candidates.GetReport()
+	require.Equal(t, BLOCK_CANDIDATES_HISTORY+5, report.Total)
+	require.Equal(t, map[string]int{"miner0": 53, "miner1": 52}, report.ByMiner)
+	require.Equal(t, BLOCK_CANDIDATES_HISTORY+5, report.ByDest["stratum+tcp://pool.worker@pool.example.com:3333"])
+	require.Equal(t, map[string]int{"0xcontract": 3}, report.ByContract)
+
+	require.Len(t, report.Latest, BLOCK_CANDIDATES_HISTORY)
+	require.Equal(t, fmt.Sprintf("%064x", BLOCK_CANDIDATES_HISTORY+4), report.Latest[0].BlockHash)
+}
+
+func TestBlockCandidatesMaxKeys(t *testing.T) {
+	candidates := NewBlockCandidates()
+
+	candidates.Add(BlockCandidateRecord{MinerID: "miner0", Dest: "dest"})
+	for i := 0; i < BLOCK_CANDIDATES_MAX_KEYS+10; i++ {
+		candidates.Add(BlockCandidateRecord{MinerID: fmt.Sprintf("miner%d", i), Dest: "dest"})
+	}
+
+	report := candidates.GetReport()
+	require.Equal(t, BLOCK_CANDIDATES_MAX_KEYS+11, report.Total)
+	require.Len(t, report.ByMiner, BLOCK_CANDIDATES_MAX_KEYS)
+	require.Equal(t, 2, report.ByMiner["miner0"], "miner with the most candidates should be kept")
+	require.Equal(t, 1, report.ByMiner[fmt.Sprintf("miner%d", BLOCK_CANDIDATES_MAX_KEYS+9)], "latest miner should be counted")
+	require.Equal(t, BLOCK_CANDIDATES_MAX_KEYS+11, report.ByDest["dest"])
+}
+
+func TestBlockCandidateContractOfDest(t *testing.T) {
+	prx := &Proxy{}
+	oldDest, newDest := &ConnDest{}, &ConnDest{}
+
+	prx.dest = oldDest
+	prx.SetOutgoingContractID("0xcontract1")
+	prx.dest = newDest
+	prx.SetOutgoingContractID("0xcontract2")
+
+	require.Equal(t, "0xcontract1", prx.getDestContractID(oldDest), "shares for the previous dest jobs should be credited to its contract")
+	require.Equal(t, "0xcontract2", prx.getDestContractID(newDest))
+
+	prx.SetOutgoingContractID("")
+	require.Equal(t, "", prx.getDestContractID(newDest))
+
+	incomingContractID := "0xincoming"
+	prx.contractID = &incomingContractID
+	require.Equal(t, incomingContractID, prx.getDestContractID(newDest))
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -52,8 +53,11 @@ type StratumConnection struct {
 	writeSync   sync.Mutex
 
 	// deps
-	conn net.Conn
-	log  gi.ILogger
+	conn          net.Conn
+	log           gi.ILogger
+	logMutex      sync.RWMutex
+	recorder      MessageRecorder
+	recorderMutex sync.RWMutex
 }
 
 // CreateConnection creates a new StratumConnection and starts background timer for its closure
@@ -86,9 +90,21 @@ func CreateConnection(conn net.Conn, address string, idleReadTimeout, idleWriteT
 	return c
 }
 
-// Connect connects to destination with default close timeouts
-func Connect(address *url.URL, idleReadCloseTimeout, idleWriteCloseTimeout time.Duration, log gi.ILogger) (*StratumConnection, error) {
-	conn, err := net.DialTimeout("tcp", address.Host, DIAL_TIMEOUT)
+// Connect connects to destination with default close timeouts. The tlsConfig is used for stratum+ssl
+// destinations, if nil the system CA pool is used. The ctx bounds the connection setup only
+func Connect(ctx context.Context, address *url.URL, tlsConfig *tls.Config, idleReadCloseTimeout, idleWriteCloseTimeout time.Duration, log gi.ILogger) (*StratumConnection, error) {
+	if IsStratumV2(address) {
+		return connectStratumV2(ctx, address, idleReadCloseTimeout, idleWriteCloseTimeout, log)
+	}
+
+	var conn net.Conn
+	var err error
+	if IsTLS(address) {
+		conn, err = dialTLS(ctx, address, tlsConfig)
+	} else {
+		dialer := &net.Dialer{Timeout: DIAL_TIMEOUT}
+		conn, err = dialer.DialContext(ctx, "tcp", address.Host)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -120,11 +136,11 @@ func (c *StratumConnection) Read(ctx context.Context) (interfaces.MiningMessageG
 
 		select {
 		case <-ctx.Done():
-			c.log.Debugf("connection %s read cancelled", c.id)
+			c.getLog().Debugf("connection %s read cancelled", c.id)
 			err := c.conn.SetReadDeadline(time.Now())
 			if err != nil {
 				// may return ErrNetClosing if fd is already closed
-				c.log.Warnf("err during setting read deadline: %s", err)
+				c.getLog().Warnf("err during setting read deadline: %s", err)
 				return
 			}
 		case <-doneCh:
@@ -167,12 +183,13 @@ func (c *StratumConnection) Read(ctx context.Context) (interfaces.MiningMessageG
 			c.readBuffer = []byte{}
 			line = newLine
 		}
-		c.log.Debugf("<= %s", string(line))
+		c.getLog().Debugf("<= %s", string(line))
+		c.record(line, false)
 
 		m, err := stratumv1_message.ParseStratumMessage(line)
 
 		if errors.Is(err, stratumv1_message.ErrStratumV1Unknown) {
-			c.log.Warnf("unknown stratum message, ignoring: %s", string(line))
+			c.getLog().Warnf("unknown stratum message, ignoring: %s", string(line))
 			continue
 		}
 
@@ -194,7 +211,8 @@ func (c *StratumConnection) Write(ctx context.Context, msg interfaces.MiningMess
 		return fmt.Errorf("nil message write attempt")
 	}
 
-	b := append(msg.Serialize(), lib.CharNewLine)
+	serialized := msg.Serialize()
+	b := append(serialized, lib.CharNewLine)
 
 	err := c.conn.SetWriteDeadline(time.Time{})
 	if err != nil {
@@ -223,7 +241,7 @@ func (c *StratumConnection) Write(ctx context.Context, msg interfaces.MiningMess
 			err := c.conn.SetWriteDeadline(time.Now())
 			if err != nil {
 				// may return ErrNetClosing if fd is already closed
-				c.log.Warnf("err during setting write deadline: %s", err)
+				c.getLog().Warnf("err during setting write deadline: %s", err)
 				return
 			}
 		case <-doneCh:
@@ -245,11 +263,46 @@ func (c *StratumConnection) Write(ctx context.Context, msg interfaces.MiningMess
 
 	c.writeHappened <- struct{}{}
 
-	c.log.Debugf("=> %s", string(msg.Serialize()))
+	c.getLog().Debugf("=> %s", string(serialized))
+	c.record(serialized, true)
 
 	return nil
 }
 
+// SetLog replaces the logger, safe to call while the connection is used
+func (c *StratumConnection) SetLog(log gi.ILogger) {
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	c.log = log
+}
+
+func (c *StratumConnection) getLog() gi.ILogger {
+	c.logMutex.RLock()
+	defer c.logMutex.RUnlock()
+	return c.log
+}
+
+// SetRecorder sets the recorder receiving every message read from or written to the connection
+func (c *StratumConnection) SetRecorder(recorder MessageRecorder) {
+	c.recorderMutex.Lock()
+	defer c.recorderMutex.Unlock()
+	c.recorder = recorder
+}
+
+func (c *StratumConnection) record(msg []byte, isWrite bool) {
+	c.recorderMutex.RLock()
+	defer c.recorderMutex.RUnlock()
+
+	if c.recorder == nil {
+		return
+	}
+	if isWrite {
+		c.recorder.OnWrite(msg)
+	} else {
+		c.recorder.OnRead(msg)
+	}
+}
+
 func (c *StratumConnection) GetID() string {
 	return c.id
 }
@@ -257,9 +310,9 @@ func (c *StratumConnection) GetID() string {
 func (c *StratumConnection) Close() error {
 	err := c.conn.Close()
 	if err == nil {
-		c.log.Debugf("connection closed %s", c.id)
+		c.getLog().Debugf("connection closed %s", c.id)
 	} else {
-		c.log.Warnf("connection already closed %s", c.id)
+		c.getLog().Warnf("connection already closed %s", c.id)
 	}
 
 	c.closeOnce.Do(func() {
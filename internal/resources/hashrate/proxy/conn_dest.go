@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/url"
@@ -11,6 +12,7 @@ import (
 
 	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/coinbase"
 	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
 	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
@@ -20,14 +22,21 @@ import (
 // with destination specific state variables
 type ConnDest struct {
 	// config
-	userName string
-	destUrl  *url.URL
-	destLock sync.RWMutex
+	userName     string
+	destUrl      *url.URL
+	destLock     sync.RWMutex
+	jobNamespace string // prefix of the job IDs sent to the miner
+	dialect      *PoolDialect
+	payout       *coinbase.PayoutVerifier // nil if the payout addresses are not configured
 
 	// state
 	diff           atomic.Uint64
+	unavailable    atomic.Bool            // connection failed, shares for its jobs are accounted locally
+	payoutErr      atomic.Pointer[error]  // set if the last job pays to unexpected address
+	contractID     atomic.Pointer[string] // outgoing contract served by the dest, empty for the default dest
 	hr             gi.Hashrate
-	resultHandlers sync.Map // map[string]func(*stratumv1_message.MiningResult)
+	resultHandlers sync.Map // map[int]func(*stratumv1_message.MiningResult) by upstream ID
+	msgIDs         *msgIDMap
 
 	extraNonce1     string
 	extraNonce2Size int
@@ -47,30 +56,49 @@ type ConnDest struct {
 	firstJobOnce   sync.Once
 
 	// deps
-	conn *StratumConnection
-	log  gi.ILogger
+	conn             *StratumConnection
+	log              gi.ILogger
+	onPayoutMismatch func(err error)
 }
 
-func NewDestConn(conn *StratumConnection, valid *validator.Validator, url *url.URL, log gi.ILogger) *ConnDest {
+// NewDestConn creates the dest, payout verifies the coinbase of the jobs, nil disables the verification
+func NewDestConn(conn *StratumConnection, valid *validator.Validator, url *url.URL, payout *coinbase.PayoutVerifier, log gi.ILogger) *ConnDest {
+	// unknown algorithm is rejected by ConnectDest before connecting
+	if pow, err := validator.GetPowAlgorithmByURL(url); err == nil {
+		valid.SetPowAlgorithm(pow)
+	}
+
 	return &ConnDest{
 		conn:           conn,
 		validator:      valid,
 		userName:       url.User.Username(),
 		destUrl:        url,
+		dialect:        GetPoolDialect(url),
+		payout:         payout,
 		stats:          &DestStats{},
+		msgIDs:         newMsgIDMap(),
 		firstJobSignal: make(chan struct{}),
 		log:            log,
 	}
 }
 
-func ConnectDest(ctx context.Context, destURL *url.URL, valid *validator.Validator, idleReadCloseTimeout, idleWriteCloseTimeout time.Duration, log gi.ILogger) (*ConnDest, error) {
+func ConnectDest(ctx context.Context, destURL *url.URL, tlsConfig *tls.Config, valid *validator.Validator, idleReadCloseTimeout, idleWriteCloseTimeout time.Duration, log gi.ILogger) (*ConnDest, error) {
+	_, err := validator.GetPowAlgorithmByURL(destURL)
+	if err != nil {
+		return nil, err
+	}
+	payout, err := coinbase.NewPayoutVerifierFromURL(destURL)
+	if err != nil {
+		return nil, err
+	}
+
 	destLog := log.Named("DST").With("DstAddr", fmt.Sprintf("%s@%s", destURL.User.Username(), destURL.Host))
-	conn, err := Connect(destURL, idleReadCloseTimeout, idleWriteCloseTimeout, destLog)
+	conn, err := Connect(ctx, destURL, tlsConfig, idleReadCloseTimeout, idleWriteCloseTimeout, destLog)
 	if err != nil {
 		return nil, err
 	}
 	destLog = destLog.With("DstPort", conn.LocalPort())
-	return NewDestConn(conn, valid, destURL, destLog), nil
+	return NewDestConn(conn, valid, destURL, payout, destLog), nil
 }
 
 func (c *ConnDest) AutoReadStart(ctx context.Context, cb func(err error)) (ok bool) {
@@ -123,6 +151,10 @@ func (c *ConnDest) ID() string {
 	return c.conn.GetID()
 }
 
+func (c *ConnDest) SetRecorder(recorder MessageRecorder) {
+	c.conn.SetRecorder(recorder)
+}
+
 func (c *ConnDest) Read(ctx context.Context) (i.MiningMessageGeneric, error) {
 	msg, err := c.conn.Read(ctx)
 	if err != nil {
@@ -143,6 +175,62 @@ func (c *ConnDest) Write(ctx context.Context, msg i.MiningMessageGeneric) error
 	return nil
 }
 
+// SetJobNamespace sets the prefix of the job IDs sent to the miner, should be called before the dest is used
+func (c *ConnDest) SetJobNamespace(namespace string) {
+	c.jobNamespace = namespace
+}
+
+// SetUnavailable marks the failed destination, so the shares for its jobs are not submitted
+func (c *ConnDest) SetUnavailable() {
+	c.unavailable.Store(true)
+}
+
+func (c *ConnDest) IsUnavailable() bool {
+	return c.unavailable.Load()
+}
+
+// SetContractID sets the outgoing contract the jobs of the dest are mined for
+func (c *ConnDest) SetContractID(contractID string) {
+	c.contractID.Store(&contractID)
+}
+
+func (c *ConnDest) GetContractID() string {
+	if contractID := c.contractID.Load(); contractID != nil {
+		return *contractID
+	}
+	return ""
+}
+
+// SetOnPayoutMismatch sets the callback invoked when the job starts paying to unexpected address,
+// should be called before the dest is used
+func (c *ConnDest) SetOnPayoutMismatch(cb func(err error)) {
+	c.onPayoutMismatch = cb
+}
+
+// GetPayoutError returns the error if the last job of the dest pays to unexpected address
+func (c *ConnDest) GetPayoutError() error {
+	if err := c.payoutErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// GetDialect returns the handshake quirks of the pool
+func (c *ConnDest) GetDialect() *PoolDialect {
+	return c.dialect
+}
+
+func (c *ConnDest) GetJobNamespace() string {
+	return c.jobNamespace
+}
+
+// minerNotify returns the copy of the job notification with the job ID in the namespace of the destination
+func (c *ConnDest) minerNotify(msg *sm.MiningNotify) *sm.MiningNotify {
+	notify := msg.Copy()
+	notify.SetJobID(c.jobNamespace + msg.GetJobID())
+	return notify
+}
+
 func (c *ConnDest) GetExtraNonce() (extraNonce string, extraNonceSize int) {
 	c.extraNonceLock.RLock()
 	defer c.extraNonceLock.RUnlock()
@@ -172,6 +260,12 @@ func (c *ConnDest) GetDiff() float64 {
 	return float64(c.diff.Load())
 }
 
+// GetWork converts the share difficulty of the dest algorithm to the sha256d difficulty
+// the hashrate counters are based on
+func (c *ConnDest) GetWork(diff float64) float64 {
+	return diff * c.validator.GetPowAlgorithm().HashesPerDiff() / validator.PowSha256d.HashesPerDiff()
+}
+
 func (c *ConnDest) GetHR() gi.Hashrate {
 	return c.hr
 }
@@ -196,6 +290,34 @@ func (c *ConnDest) SetUserName(userName string) {
 	c.conn.address = c.destUrl.String()
 }
 
+// verifyPayout checks the coinbase outputs of the job against the configured payout addresses,
+// the mismatch is reported once until the payout is valid again
+func (c *ConnDest) verifyPayout(msg *sm.MiningNotify, xn string, xnsize int) {
+	if c.payout == nil {
+		return
+	}
+
+	cb, err := coinbase.ParseCoinbase(msg.GetGen1(), xn, xnsize, msg.GetGen2())
+	if err == nil {
+		err = c.payout.Verify(cb)
+	}
+	if err == nil {
+		if c.payoutErr.Swap(nil) != nil {
+			c.log.Infof("coinbase payout is valid again, job %s, height %d", msg.GetJobID(), cb.Height)
+		}
+		return
+	}
+
+	c.stats.IncPayoutMismatches()
+	if c.payoutErr.Swap(&err) != nil {
+		return
+	}
+	c.log.Errorf("coinbase payout mismatch, job %s: %s", msg.GetJobID(), err)
+	if c.onPayoutMismatch != nil {
+		c.onPayoutMismatch(err)
+	}
+}
+
 func (c *ConnDest) readInterceptor(msg i.MiningMessageGeneric) (resMsg i.MiningMessageGeneric, err error) {
 	switch typed := msg.(type) {
 	case *sm.MiningNotify:
@@ -204,7 +326,12 @@ func (c *ConnDest) readInterceptor(msg i.MiningMessageGeneric) (resMsg i.MiningM
 		if xn == "" {
 			c.log.Warn("got notify before extranonce was set")
 		}
-		c.validator.AddNewJob(typed, float64(c.diff.Load()), xn, xnsize)
+		// the malformed job is relayed as is, but the shares for it are rejected as not found
+		if err := c.validator.AddNewJob(typed, float64(c.diff.Load()), xn, xnsize); err != nil {
+			c.log.Warnf("skipping job: %s", err)
+			return msg, nil
+		}
+		c.verifyPayout(typed, xn, xnsize)
 		c.firstJobOnce.Do(func() {
 			close(c.firstJobSignal)
 		})
@@ -217,7 +344,15 @@ func (c *ConnDest) readInterceptor(msg i.MiningMessageGeneric) (resMsg i.MiningM
 
 	// TODO: handle multiversion
 	case *sm.MiningResult:
-		handler, ok := c.resultHandlers.LoadAndDelete(typed.GetID())
+		upstreamID := typed.GetID()
+		origID, ok := c.msgIDs.Resolve(upstreamID)
+		if !ok {
+			// result for the message that wasn't sent by the proxy, passed as is
+			return msg, nil
+		}
+		typed.SetID(origID)
+
+		handler, ok := c.resultHandlers.LoadAndDelete(upstreamID)
 		if ok {
 			resMsg, err := handler.(ResultHandler)(typed)
 			if err != nil {
@@ -229,15 +364,20 @@ func (c *ConnDest) readInterceptor(msg i.MiningMessageGeneric) (resMsg i.MiningM
 	return msg, nil
 }
 
-// onceResult registers single time handler for the destination response with particular message ID,
-// sets default timeout and does a cleanup when it expires. Returns error on result timeout
-func (s *ConnDest) onceResult(ctx context.Context, msgID int, handler ResultHandler) <-chan error {
+// onceResult registers single time handler for the destination response to the message, which is
+// about to be written. The message gets unique upstream ID, the result is passed to the handler
+// with the original ID. Sets default timeout and does a cleanup when it expires. Returns error on result timeout
+func (s *ConnDest) onceResult(ctx context.Context, msg i.MiningMessageWithID, handler ResultHandler) <-chan error {
 	errCh := make(chan error, 1)
 
 	ctx, cancel := context.WithTimeout(ctx, RESPONSE_TIMEOUT)
 	didRun := false
 
-	s.resultHandlers.Store(msgID, func(a *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
+	msgID := msg.GetID()
+	upstreamID := s.msgIDs.Map(msgID)
+	msg.SetID(upstreamID)
+
+	s.resultHandlers.Store(upstreamID, func(a *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
 		didRun = true
 		defer cancel()
 		defer close(errCh)
@@ -246,7 +386,8 @@ func (s *ConnDest) onceResult(ctx context.Context, msgID int, handler ResultHand
 
 	go func() {
 		<-ctx.Done()
-		s.resultHandlers.Delete(msgID)
+		s.resultHandlers.Delete(upstreamID)
+		s.msgIDs.Delete(upstreamID)
 		if !didRun {
 			errCh <- fmt.Errorf("dest response timeout (%s) msgID(%d)", RESPONSE_TIMEOUT, msgID)
 		}
@@ -255,20 +396,38 @@ func (s *ConnDest) onceResult(ctx context.Context, msgID int, handler ResultHand
 	return errCh
 }
 
-// WriteAwaitRes writes message to the destination connection and awaits for the response
+// forwardRequest assigns upstream ID to the request of the source that is passed to the destination,
+// the result is returned by Read with the original ID. Other messages are left as is
+func (s *ConnDest) forwardRequest(ctx context.Context, msg i.MiningMessageGeneric) {
+	switch typed := msg.(type) {
+	case *sm.MiningResult:
+		// response of the source to the destination request keeps the destination ID
+	case i.MiningMessageWithID:
+		s.onceResult(ctx, typed, func(res *sm.MiningResult) (i.MiningMessageWithID, error) {
+			return res, nil
+		})
+	}
+}
+
+// WriteAwaitRes writes message to the destination connection and awaits for the response.
+// The message is written with unique upstream ID, the response has the original ID of the message
 func (s *ConnDest) WriteAwaitRes(parentCtx context.Context, msg i.MiningMessageWithID) (resMsg i.MiningMessageWithID, err error) {
 	resCh := make(chan i.MiningMessageWithID, 1)
 	msgID := msg.GetID()
+	upstreamID := s.msgIDs.Map(msgID)
+	msg.SetID(upstreamID)
+	defer msg.SetID(msgID)
 
 	responceCtx, responceCancel := context.WithTimeout(parentCtx, RESPONSE_TIMEOUT)
 	defer responceCancel()
 
 	go func() {
 		<-responceCtx.Done()
-		s.resultHandlers.Delete(msgID)
+		s.resultHandlers.Delete(upstreamID)
+		s.msgIDs.Delete(upstreamID)
 	}()
 
-	s.resultHandlers.Store(msgID, func(a *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
+	s.resultHandlers.Store(upstreamID, func(a *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
 		select {
 		case <-responceCtx.Done():
 		case resCh <- a:
@@ -301,7 +460,7 @@ func (c *ConnDest) HasJob(jobID string) bool {
 	return c.validator.HasJob(jobID)
 }
 
-func (c *ConnDest) ValidateAndAddShare(msg *sm.MiningSubmit) (float64, error) {
+func (c *ConnDest) ValidateAndAddShare(msg *sm.MiningSubmit) (float64, *validator.BlockCandidate, error) {
 	return c.validator.ValidateAndAddShare(msg)
 }
 
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+var (
+	ErrProbeDest = errors.New("destination health probe failed")
+)
+
+// ProbeDest checks that the destination accepts miners by performing connect, subscribe and
+// authorize with the credentials from the url. Connection is closed afterwards
+func ProbeDest(ctx context.Context, destURL *url.URL, tlsConfig *tls.Config, log gi.ILogger) error {
+	dest, err := ConnectDest(ctx, destURL, tlsConfig, validator.NewValidator(RESPONSE_TIMEOUT), RESPONSE_TIMEOUT, RESPONSE_TIMEOUT, log)
+	if err != nil {
+		return lib.WrapError(ErrProbeDest, err)
+	}
+
+	dest.AutoReadStart(ctx, func(err error) {})
+	defer func() {
+		_ = dest.conn.Close()
+		_ = dest.AutoReadStop()
+	}()
+
+	res, err := dest.WriteAwaitRes(ctx, dest.GetDialect().NewSubscribe(1))
+	if err != nil {
+		return lib.WrapError(ErrProbeDest, err)
+	}
+	subRes, err := sm.ToMiningSubscribeResult(res.(*sm.MiningResult))
+	if err != nil {
+		return lib.WrapError(ErrProbeDest, err)
+	}
+	if subRes.IsError() {
+		return lib.WrapError(ErrProbeDest, fmt.Errorf("subscribe error: %s", subRes.GetError()))
+	}
+
+	pwd, _ := destURL.User.Password()
+	res, err = dest.WriteAwaitRes(ctx, sm.NewMiningAuthorize(2, destURL.User.Username(), pwd))
+	if err != nil {
+		return lib.WrapError(ErrProbeDest, err)
+	}
+	if authRes := res.(*sm.MiningResult); authRes.IsError() {
+		return lib.WrapError(ErrProbeDest, lib.WrapError(ErrNotAuthorizedPool, fmt.Errorf("%s", authRes.GetError())))
+	}
+
+	return nil
+}
@@ -7,16 +7,26 @@ import (
 	globalInterfaces "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	"go.uber.org/atomic"
+)
+
+// ExtraNonceMode is the way the miner gets new extranonce when destination changes
+type ExtraNonceMode string
+
+const (
+	ExtraNonceModeSetExtranonce ExtraNonceMode = "set_extranonce" // miner subscribed to extranonce changes
+	ExtraNonceModeReconnect     ExtraNonceMode = "reconnect"      // miner is asked to reconnect using client.reconnect
 )
 
 // ConnSource is a miner connection, a wrapper around StratumConnection
 // that adds miner specific state variables
 type ConnSource struct {
 	// state
-	userName string
+	userName atomic.String
 
-	extraNonce     string // last relevant extraNonce (from subscribe or set_extranonce)
-	extraNonceSize int
+	extraNonce           string // last relevant extraNonce (from subscribe or set_extranonce)
+	extraNonceSize       int
+	extraNonceSubscribed atomic.Bool // true if the miner sent mining.extranonce.subscribe
 
 	versionRollingMask        string // original supported rolling mask from the miner
 	versionRollingMinBitCount int    // originally sent from the miner
@@ -67,6 +77,19 @@ func (c *ConnSource) SetExtraNonce(extraNonce string, extraNonceSize int) {
 	c.extraNonce, c.extraNonceSize = extraNonce, extraNonceSize
 }
 
+// SetExtraNonceSubscribed records that the miner supports mining.set_extranonce
+func (c *ConnSource) SetExtraNonceSubscribed() {
+	c.extraNonceSubscribed.Store(true)
+}
+
+// GetExtraNonceMode returns the way extranonce is updated for the miner when destination changes
+func (c *ConnSource) GetExtraNonceMode() ExtraNonceMode {
+	if c.extraNonceSubscribed.Load() {
+		return ExtraNonceModeSetExtranonce
+	}
+	return ExtraNonceModeReconnect
+}
+
 func (c *ConnSource) SetVersionRolling(mask string, minBitCount int) {
 	c.versionRollingMask, c.versionRollingMinBitCount = mask, minBitCount
 }
@@ -86,13 +109,13 @@ func (c *ConnSource) SetNegotiatedVersionRollingMask(mask string) {
 }
 
 func (c *ConnSource) SetUserName(userName string) {
-	c.userName = userName
+	c.userName.Store(userName)
 	c.log = c.log.Named(userName)
-	c.conn.log = c.log
+	c.conn.SetLog(c.log)
 }
 
 func (c *ConnSource) GetUserName() string {
-	return c.userName
+	return c.userName.Load()
 }
 
 func (c *ConnSource) GetConnectedAt() time.Time {
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_noise"
+)
+
+// runSV2Pool accepts stratum v2 connections and passes them to the handler after the noise handshake
+func runSV2Pool(t *testing.T, handler func(conn *stratumv2_noise.Conn)) *url.URL {
+	authority, err := stratumv2_noise.GenerateKeypair()
+	require.NoError(t, err)
+	respCfg, err := stratumv2_noise.NewResponderConfig(authority, time.Hour)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				noiseConn, err := stratumv2_noise.Accept(conn, respCfg)
+				if err != nil {
+					return
+				}
+				handler(noiseConn)
+			}()
+		}
+	}()
+
+	dest, err := url.Parse(fmt.Sprintf("%s://account.worker@%s/%s", SCHEME_STRATUM_V2, listener.Addr().String(), stratumv2_noise.EncodeAuthorityPublicKey(authority.PublicKey())))
+	require.NoError(t, err)
+	return dest
+}
+
+func TestConnectStratumV2SetupRejected(t *testing.T) {
+	dest := runSV2Pool(t, func(conn *stratumv2_noise.Conn) {
+		_, _ = conn.ReadFrame()
+		_ = conn.WriteFrame(sv2.NewFrame(&sv2.SetupConnectionError{ErrorCode: "unsupported-protocol"}))
+		_, _ = conn.ReadFrame()
+	})
+
+	_, err := Connect(context.Background(), dest, nil, time.Minute, time.Minute, lib.NewTestLogger())
+	require.ErrorIs(t, err, ErrConnectDest)
+	require.ErrorIs(t, err, ErrStratumV2Connect)
+	require.Contains(t, err.Error(), "unsupported-protocol")
+}
+
+func TestConnectStratumV2Cancelled(t *testing.T) {
+	dest := runSV2Pool(t, func(conn *stratumv2_noise.Conn) {
+		// never responds to the setup
+		for {
+			if _, err := conn.ReadFrame(); err != nil {
+				return
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Connect(ctx, dest, nil, time.Minute, time.Minute, lib.NewTestLogger())
+	require.ErrorIs(t, err, ErrStratumV2Connect)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+func newTestTLSPool(t *testing.T) (addr string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pool"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	return listener.Addr().String(), cert
+}
+
+func TestConnectTLS(t *testing.T) {
+	addr, cert := newTestTLSPool(t)
+	log := lib.NewTestLogger()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	trustedCfg := &tls.Config{RootCAs: roots}
+
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := url.QueryEscape(base64.StdEncoding.EncodeToString(hash[:]))
+
+	t.Run("trusted CA", func(t *testing.T) {
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s", addr))
+		conn, err := Connect(context.Background(), u, trustedCfg, time.Minute, time.Minute, log)
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		u, _ := url.Parse(fmt.Sprintf("stratum+tls://user:pwd@%s", addr))
+		_, err := Connect(context.Background(), u, nil, time.Minute, time.Minute, log)
+		require.ErrorIs(t, err, ErrConnectDest)
+		require.ErrorIs(t, err, ErrTLSHandshake)
+	})
+
+	t.Run("pinned certificate", func(t *testing.T) {
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s?%s=%s", addr, URL_PARAM_PIN_SHA256, pin))
+		conn, err := Connect(context.Background(), u, nil, time.Minute, time.Minute, log)
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+
+	t.Run("pin mismatch", func(t *testing.T) {
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s?%s=%s", addr, URL_PARAM_PIN_SHA256, "AAAA"))
+		_, err := Connect(context.Background(), u, trustedCfg, time.Minute, time.Minute, log)
+		require.ErrorIs(t, err, ErrTLSHandshake)
+		require.ErrorContains(t, err, ErrTLSPin.Error())
+	})
+
+	t.Run("destination CA", func(t *testing.T) {
+		ca := url.QueryEscape(base64.StdEncoding.EncodeToString(cert.Raw))
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s?%s=%s", addr, URL_PARAM_CA, ca))
+		conn, err := Connect(context.Background(), u, nil, time.Minute, time.Minute, log)
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+
+	t.Run("destination CA replaces global bundle", func(t *testing.T) {
+		_, otherCert := newTestTLSPool(t)
+		ca := url.QueryEscape(base64.StdEncoding.EncodeToString(otherCert.Raw))
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s?%s=%s", addr, URL_PARAM_CA, ca))
+		_, err := Connect(context.Background(), u, trustedCfg, time.Minute, time.Minute, log)
+		require.ErrorIs(t, err, ErrTLSHandshake)
+	})
+
+	t.Run("invalid destination CA", func(t *testing.T) {
+		u, _ := url.Parse(fmt.Sprintf("stratum+ssl://user:pwd@%s?%s=%s", addr, URL_PARAM_CA, "AAAA"))
+		_, err := Connect(context.Background(), u, trustedCfg, time.Minute, time.Minute, log)
+		require.ErrorIs(t, err, ErrConnectDest)
+		require.ErrorIs(t, err, ErrTLSCA)
+	})
+}
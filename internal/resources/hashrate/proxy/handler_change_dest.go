@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
@@ -29,6 +30,7 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 	if err != nil {
 		return nil, lib.WrapError(ErrConnectDest, err)
 	}
+	p.proxy.setupDest(newDest)
 
 	p.proxy.log.Debugf("new dest created")
 
@@ -41,6 +43,7 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 		close(autoReadDone)
 	})
 	if !ok {
+		newDest.conn.Close()
 		return nil, lib.WrapError(ErrConnectDest, fmt.Errorf("autoread already started"))
 	}
 
@@ -58,6 +61,7 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 	select {
 	case err := <-autoReadDone:
 		handshakeTask.Stop()
+		newDest.conn.Close()
 		// if newDestRunTask finished first there was reading error
 		// TODO: fix the case when err == nil
 		return nil, lib.WrapError(ErrConnectDest, err)
@@ -65,6 +69,7 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 	}
 
 	if handshakeTask.Err() != nil {
+		newDest.conn.Close()
 		return nil, lib.WrapError(ErrConnectDest, handshakeTask.Err())
 	}
 	p.proxy.logInfof("new destination connected url %s, localPort %s", newDestURL.String(), newDest.conn.LocalPort())
@@ -72,6 +77,7 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 	// stops temporary reading from newDest
 	err = newDest.AutoReadStop()
 	if err != nil {
+		newDest.conn.Close()
 		return nil, err
 	}
 	<-autoReadDone
@@ -82,10 +88,15 @@ func (p *HandlerChangeDest) connectNewDest(ctx context.Context, newDestURL *url.
 // destHandshake performs handshake with the new dest when there is a dest that already connected
 func (p *HandlerChangeDest) destHandshake(ctx context.Context, newDest *ConnDest, user string, pwd string) error {
 	msgID := 1
+	dialect := newDest.GetDialect()
 
 	// 1. MINING.CONFIGURE
 	// if miner has version mask enabled, send it to the pool
 	if p.proxy.source.GetNegotiatedVersionRollingMask() != "" {
+		if !dialect.VersionRolling {
+			return fmt.Errorf("pool doesn't support version rolling, dialect %s", dialect.Name)
+		}
+
 		// using the same version mask as the miner negotiated during the prev connection
 		cfgMsg := m.NewMiningConfigure(msgID, nil)
 		_, minBits := p.proxy.source.GetVersionRolling()
@@ -118,7 +129,8 @@ func (p *HandlerChangeDest) destHandshake(ctx context.Context, newDest *ConnDest
 	// 2. MINING.SUBSCRIBE
 	msgID++
 	gotResultCh := make(chan struct{})
-	newDest.onceResult(ctx, msgID, func(a *m.MiningResult) (msg i.MiningMessageWithID, err error) {
+	subMsg := dialect.NewSubscribe(msgID)
+	newDest.onceResult(ctx, subMsg, func(a *m.MiningResult) (msg i.MiningMessageWithID, err error) {
 		subRes, err := m.ToMiningSubscribeResult(a)
 		if err != nil {
 			return nil, err
@@ -133,7 +145,7 @@ func (p *HandlerChangeDest) destHandshake(ctx context.Context, newDest *ConnDest
 		return nil, nil
 	})
 
-	err := newDest.Write(ctx, m.NewMiningSubscribe(msgID, "stratum-proxy", "1.0.0"))
+	err := newDest.Write(ctx, subMsg)
 	if err != nil {
 		return lib.WrapError(ErrConnectDest, err)
 	}
@@ -185,22 +197,41 @@ func (p *HandlerChangeDest) resendRelevantNotifications(ctx context.Context, new
 	}
 
 	// 2. SET_EXTRANONCE
-	err = p.proxy.source.Write(ctx, m.NewMiningSetExtranonce(job.GetExtraNonce1(), job.GetExtraNonce2Size()))
-	if err != nil {
-		return lib.WrapError(ErrChangeDest, err)
+	// miners that didn't subscribe to extranonce changes cannot continue
+	// with the new extranonce, so they are asked to reconnect
+	xn, xnSize := p.proxy.source.GetExtraNonce()
+	if p.proxy.source.GetExtraNonceMode() == ExtraNonceModeReconnect {
+		if xn != job.GetExtraNonce1() || xnSize != job.GetExtraNonce2Size() {
+			err = p.proxy.source.Write(ctx, m.NewClientReconnect("", 0, 0))
+			if err != nil {
+				return lib.WrapError(ErrChangeDest, err)
+			}
+			p.proxy.logWarnf("miner doesn't support extranonce change, reconnect requested")
+			return lib.WrapError(ErrChangeDest, ErrSourceReconnect)
+		}
+	} else {
+		err = p.proxy.source.Write(ctx, m.NewMiningSetExtranonce(job.GetExtraNonce1(), job.GetExtraNonce2Size()))
+		if err != nil {
+			return lib.WrapError(ErrChangeDest, err)
+		}
+		p.proxy.source.SetExtraNonce(job.GetExtraNonce1(), job.GetExtraNonce2Size())
+		p.proxy.log.Debugf("extranonce sent")
 	}
-	p.proxy.source.SetExtraNonce(job.GetExtraNonce1(), job.GetExtraNonce2Size())
-	p.proxy.log.Debugf("extranonce sent")
 
 	// 3. SET_DIFFICULTY
-	err = p.proxy.source.Write(ctx, m.NewMiningSetDifficulty(job.GetDiff()))
+	diff := job.GetDiff()
+	if p.proxy.vardiff != nil {
+		// miner keeps its local difficulty, shares are filtered by the new pool difficulty
+		diff = p.proxy.vardiff.Init(diff, time.Now())
+	}
+	err = p.proxy.source.Write(ctx, m.NewMiningSetDifficulty(diff))
 	if err != nil {
 		return lib.WrapError(ErrChangeDest, err)
 	}
 	p.proxy.log.Debugf("set difficulty sent")
 
 	// 4. NOTIFY
-	msg := job.GetNotify()
+	msg := newDest.minerNotify(job.GetNotify())
 	msg.SetCleanJobs(true)
 
 	err = p.proxy.source.Write(ctx, msg)
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	CLIENT_VERSION            = "stratum-proxy/1.0.0" // reported to the pool on client.get_version, same as in mining.subscribe
+	CLIENT_RECONNECT_MAX_WAIT = time.Minute           // upper bound of the delay requested by client.reconnect
+)
+
+var (
+	ErrDestReconnect      = errors.New("destination requested reconnect")
+	ErrRedirectNotAllowed = errors.New("redirect to a different domain is not allowed")
+)
+
+// destRedirect is the destination requested by the pool with client.reconnect
+type destRedirect struct {
+	url  *url.URL
+	wait time.Duration
+}
+
+// onClientReconnect stores the address the pool redirects to. The redirect is followed by the proxy
+// itself, the miner keeps the connection to the proxy. Returns false if the redirect is ignored
+func onClientReconnect(proxy *Proxy, msg *m.ClientReconnect) bool {
+	redirectURL, err := getRedirectURL(proxy.destURL.Load(), msg.GetHost(), msg.GetPort())
+	if err != nil {
+		proxy.logWarnf("dest reconnect request ignored: %s", err)
+		return false
+	}
+	redirect := &destRedirect{
+		url:  redirectURL,
+		wait: time.Duration(msg.GetWaitSeconds()) * time.Second,
+	}
+	if redirect.wait > CLIENT_RECONNECT_MAX_WAIT {
+		redirect.wait = CLIENT_RECONNECT_MAX_WAIT
+	}
+	proxy.destRedirect.Store(redirect)
+	proxy.logInfof("dest requested reconnect to %s in %s", redirect.url.Redacted(), redirect.wait)
+	return true
+}
+
+// onClientShowMessage only logs the message. It is not forwarded, because the miner
+// shouldn't see the messages of the pool it was routed to
+func onClientShowMessage(proxy *Proxy, msg *m.ClientShowMessage) {
+	proxy.logInfof("message from dest: %s", msg.GetMessage())
+}
+
+// onClientGetVersion is answered by the proxy, as it is the proxy that is the client of the pool
+func onClientGetVersion(ctx context.Context, proxy *Proxy, msg *m.ClientGetVersion) error {
+	return proxy.dest.Write(ctx, m.NewMiningResultString(msg.GetID(), CLIENT_VERSION))
+}
+
+// onMiningPing answers the ping locally, so it works regardless of the state of the other side
+func onMiningPing(ctx context.Context, conn i.StratumReadWriter, msg *m.MiningPing) error {
+	return conn.Write(ctx, m.NewMiningResultString(msg.GetID(), "pong"))
+}
+
+// followRedirect reconnects to the destination requested by the pool with client.reconnect. The configured
+// dest url stays the identity of the dest, so the redirected connection is served as the configured dest
+func (p *Proxy) followRedirect(ctx context.Context, redirect *destRedirect) error {
+	p.logInfof("following dest redirect to %s", redirect.url.Redacted())
+
+	if p.dest != nil {
+		p.destMap.Delete(p.dest.ID())
+		p.dest.conn.Close()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(redirect.wait):
+	}
+
+	err := p.connectDest(ctx, redirect.url, p.destURL.Load())
+	if err != nil {
+		return lib.WrapError(ErrDestReconnect, err)
+	}
+	return nil
+}
+
+// getRedirectURL returns the copy of the current dest with host and port from client.reconnect,
+// the empty values are taken from the current dest
+func getRedirectURL(current *url.URL, host string, port int) (*url.URL, error) {
+	if !isRedirectAllowed(current.Hostname(), host) {
+		return nil, lib.WrapError(ErrRedirectNotAllowed, fmt.Errorf("from %s to %s", current.Hostname(), host))
+	}
+	redirect := lib.CopyURL(current)
+	if host == "" {
+		host = current.Hostname()
+	}
+	portStr := current.Port()
+	if port > 0 {
+		portStr = strconv.Itoa(port)
+	}
+	if portStr == "" {
+		redirect.Host = host
+	} else {
+		redirect.Host = net.JoinHostPort(host, portStr)
+	}
+	return redirect, nil
+}
+
+// isRedirectAllowed allows redirects within the domain of the pool only, as cgminer does, e.g. from
+// eu.pool.com to us.pool.com, so the pool cannot send the proxy with its credentials to an arbitrary host.
+// The hosts must share the registrable domain, so pool.co.uk doesn't allow redirect to evil.co.uk
+func isRedirectAllowed(currentHost string, host string) bool {
+	currentHost, host = strings.ToLower(currentHost), strings.ToLower(host)
+	if host == "" || host == currentHost {
+		return true
+	}
+	if net.ParseIP(currentHost) != nil || net.ParseIP(host) != nil {
+		return false
+	}
+	_, currentDomain, ok1 := strings.Cut(currentHost, ".")
+	_, domain, ok2 := strings.Cut(host, ".")
+	if !ok1 || !ok2 || domain != currentDomain {
+		return false
+	}
+
+	// public suffix is not enough, pool.com doesn't allow redirect to evil.com
+	currentRegistrable, err := publicsuffix.EffectiveTLDPlusOne(currentHost)
+	if err != nil {
+		return false
+	}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return false
+	}
+	return registrable == currentRegistrable
+}
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
@@ -68,12 +68,19 @@ func (p *HandlerFirstConnect) handleSource(ctx context.Context, msg i.MiningMess
 	case *m.MiningAuthorize:
 		return nil, p.onMiningAuthorize(ctx, msgTyped)
 
+	case *m.MiningExtranonceSubscribe:
+		return nil, onMiningExtranonceSubscribe(ctx, p.proxy, msgTyped)
+
+	case *m.MiningPing:
+		return nil, onMiningPing(ctx, p.proxy.source, msgTyped)
+
 	case *m.MiningSubmit:
 		return nil, fmt.Errorf("unexpected handshake message from source: %s", string(msg.Serialize()))
 
 	default:
 		p.proxy.logWarnf("unknown handshake message from source: %s", string(msg.Serialize()))
 		// todo: maybe just return message, so pipe will write it
+		p.proxy.dest.forwardRequest(ctx, msgTyped)
 		return nil, p.proxy.dest.Write(context.Background(), msgTyped)
 	}
 }
@@ -83,10 +90,14 @@ func (p *HandlerFirstConnect) handleDest(ctx context.Context, msg i.MiningMessag
 
 	switch typed := msg.(type) {
 	case *sm.MiningNotify:
-		msgOut = typed
+		msgOut = p.proxy.dest.minerNotify(typed)
 
 	case *sm.MiningSetDifficulty:
 		msgOut = typed
+		if p.proxy.vardiff != nil {
+			// miner starts with the pool difficulty and then is adjusted locally
+			msgOut = sm.NewMiningSetDifficulty(p.proxy.vardiff.Init(typed.GetDifficulty(), time.Now()))
+		}
 
 	case *sm.MiningSetExtranonce:
 		msgOut = nil
@@ -98,6 +109,21 @@ func (p *HandlerFirstConnect) handleDest(ctx context.Context, msg i.MiningMessag
 	case *sm.MiningResult:
 		msgOut = typed
 
+	case *sm.ClientReconnect:
+		// handshake is completed with the current dest, the redirect is followed in Proxy.Run
+		_ = onClientReconnect(p.proxy, typed)
+		msgOut = nil
+
+	case *sm.ClientShowMessage:
+		onClientShowMessage(p.proxy, typed)
+		msgOut = nil
+
+	case *sm.ClientGetVersion:
+		return nil, onClientGetVersion(ctx, p.proxy, typed)
+
+	case *sm.MiningPing:
+		return nil, onMiningPing(ctx, p.proxy.dest, typed)
+
 	default:
 		p.proxy.logWarnf("unknown message from dest: %s", string(typed.Serialize()))
 		msgOut = typed
@@ -151,12 +177,24 @@ func (p *HandlerFirstConnect) onMiningConfigure(ctx context.Context, msgTyped *m
 	if err != nil {
 		return err
 	}
+	p.proxy.setupDest(destConn)
 
 	p.proxy.dest = destConn
 	p.handshakePipe.SetStream2(destConn)
 	p.handshakePipe.StartStream2()
 
-	p.proxy.dest.onceResult(ctx, msgTyped.GetID(), func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
+	dialect := destConn.GetDialect()
+	if !dialect.VersionRolling {
+		// the pool doesn't know mining.configure, so the miner continues without version rolling
+		p.proxy.logInfof("version rolling is not supported by the pool, dialect %s", dialect.Name)
+		err = p.proxy.source.Write(ctx, m.NewMiningConfigureResult(msgTyped.GetID(), false, ""))
+		if err != nil {
+			return lib.WrapError(ErrHandshakeSource, err)
+		}
+		return nil
+	}
+
+	p.proxy.dest.onceResult(ctx, msgTyped, func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
 		configureResult, err := m.ToMiningConfigureResult(res)
 		if err != nil {
 			p.proxy.logErrorf("expected MiningConfigureResult message, got %s", res.Serialize())
@@ -167,20 +205,19 @@ func (p *HandlerFirstConnect) onMiningConfigure(ctx context.Context, msgTyped *m
 		destConn.SetVersionRolling(vr, mask)
 		p.proxy.source.SetNegotiatedVersionRollingMask(mask)
 
-		configureResult.SetID(msgTyped.GetID())
 		err = p.proxy.source.Write(ctx, configureResult)
 		if err != nil {
 			return nil, lib.WrapError(ErrHandshakeSource, err)
 		}
-		// Brains pool sends extra set-version mask message after configure result
-		// In this implementation is causes issues with titan pool. Miner sends subscribe message twice
-		// and then all submits become incorrect in titan. It may happen because the second message is a little bit
-		// late. So we just skip it for now
-		//
-		// err = p.proxy.source.Write(ctx, m.NewMiningSetVersionMask(configureResult.GetVersionRollingMask()))
-		// if err != nil {
-		// 	return nil, lib.WrapError(ErrHandshakeSource, err)
-		// }
+
+		// some pools send extra set_version_mask after configure result, for the others
+		// it is skipped as the miners may subscribe twice after it
+		if dialect.ExtraVersionMask && vr {
+			err = p.proxy.source.Write(ctx, m.NewMiningSetVersionMask(mask))
+			if err != nil {
+				return nil, lib.WrapError(ErrHandshakeSource, err)
+			}
+		}
 		return nil, nil
 	})
 
@@ -200,13 +237,15 @@ func (p *HandlerFirstConnect) onMiningSubscribe(ctx context.Context, msgTyped *m
 		if err != nil {
 			return err
 		}
+		p.proxy.setupDest(destConn)
 
 		p.proxy.dest = destConn
 		p.handshakePipe.SetStream2(destConn)
 		p.handshakePipe.StartStream2()
 	}
 
-	p.proxy.dest.onceResult(ctx, msgTyped.GetID(), func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
+	p.proxy.dest.GetDialect().ApplySubscribeStyle(msgTyped)
+	p.proxy.dest.onceResult(ctx, msgTyped, func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
 		subscribeResult, err := m.ToMiningSubscribeResult(res)
 		if err != nil {
 			return nil, fmt.Errorf("expected MiningSubscribeResult message, got %s", res.Serialize())
@@ -215,8 +254,6 @@ func (p *HandlerFirstConnect) onMiningSubscribe(ctx context.Context, msgTyped *m
 		p.proxy.source.SetExtraNonce(subscribeResult.GetExtranonce())
 		p.proxy.dest.SetExtraNonce(subscribeResult.GetExtranonce())
 
-		subscribeResult.SetID(msgTyped.GetID())
-
 		err = p.proxy.source.Write(ctx, subscribeResult)
 		if err != nil {
 			return nil, lib.WrapError(ErrHandshakeSource, err)
@@ -232,6 +269,19 @@ func (p *HandlerFirstConnect) onMiningSubscribe(ctx context.Context, msgTyped *m
 	return nil
 }
 
+// onMiningExtranonceSubscribe is answered by the proxy itself, because it is
+// the proxy that changes extranonce of the miner when switching destinations
+func onMiningExtranonceSubscribe(ctx context.Context, proxy *Proxy, msgTyped *m.MiningExtranonceSubscribe) error {
+	proxy.source.SetExtraNonceSubscribed()
+	proxy.logDebugf("miner subscribed to extranonce changes")
+
+	err := proxy.source.Write(ctx, m.NewMiningResultSuccess(msgTyped.GetID()))
+	if err != nil {
+		return lib.WrapError(ErrHandshakeSource, err)
+	}
+	return nil
+}
+
 func (p *HandlerFirstConnect) onMiningAuthorize(ctx context.Context, msgTyped *m.MiningAuthorize) error {
 	p.proxy.globalHashrate.OnConnect(msgTyped.GetUserName())
 	p.proxy.source.SetUserName(msgTyped.GetUserName())
@@ -278,7 +328,7 @@ func (p *HandlerFirstConnect) onMiningAuthorize(ctx context.Context, msgTyped *m
 	}
 	destAuthMsg := m.NewMiningAuthorize(msgID, userName, pwd)
 
-	p.proxy.dest.onceResult(ctx, msgID, func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
+	p.proxy.dest.onceResult(ctx, destAuthMsg, func(res *sm.MiningResult) (msg i.MiningMessageWithID, err error) {
 		if res.IsError() {
 			return nil, lib.WrapError(ErrHandshakeDest, fmt.Errorf("cannot authorize in dest pool: %s", res.GetError()))
 		}
@@ -317,16 +367,13 @@ func getDestUserName(notPreserveWorkerName bool, incomingUserName string, destUR
 
 // shouldPropagateWorkerName checks if the dest worker name should be set equal to the source
 // Allows to track performance of each worker in the destination pool separately
-// we have to exclude workerName propagation for contracts and for lightning address destination
-// cause they may contain a period symbol that can be treated as a worker name separator
+// we have to exclude workerName propagation for contracts and for the pools which dialect doesn't allow it,
+// like lightning address destinations, cause they may contain a period symbol that can be treated as a worker name separator
 func shouldPropagateWorkerName(notPreserveWorkerName bool, incomingUserName string, destURL *url.URL) bool {
 	if notPreserveWorkerName {
 		return false
 	}
-	if hasLightningAddress(destURL) {
-		return false
-	}
-	if hasPPLPHost(destURL) { // extra check for lightning pools
+	if !GetPoolDialect(destURL).PropagateWorkerName {
 		return false
 	}
 	if isContractAddress(incomingUserName) {
@@ -335,16 +382,6 @@ func shouldPropagateWorkerName(notPreserveWorkerName bool, incomingUserName stri
 	return true
 }
 
-// hasLightningAddress checks if the username has lightning address (email-like, check for @ symbol)
-func hasLightningAddress(url *url.URL) bool {
-	return strings.Contains(url.User.Username(), "@")
-}
-
-// hasPPLPHost checks if the host name contains pplp, extra check for lightning payouts
-func hasPPLPHost(url *url.URL) bool {
-	return strings.Contains(strings.ToLower(url.Host), "pplp")
-}
-
 // isContractAddress checks if the username is a valid contract address, meaning it's an incoming traffic for contract
 func isContractAddress(username string) bool {
 	return common.IsHexAddress(username)
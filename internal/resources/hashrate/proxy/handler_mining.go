@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
 	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
@@ -13,6 +15,10 @@ import (
 
 const MAX_CONSEQUENT_INVALID_SHARES = 100
 
+var (
+	ErrTooManyInvalidShares = errors.New("too many consequent invalid shares")
+)
+
 type HandlerMining struct {
 	// deps
 	proxy                       *Proxy
@@ -30,6 +36,11 @@ func (p *HandlerMining) sourceInterceptor(ctx context.Context, msg i.MiningMessa
 	switch msgTyped := msg.(type) {
 	case *m.MiningSubmit:
 		return p.onMiningSubmit(ctx, msgTyped)
+	case *m.MiningExtranonceSubscribe:
+		// some miners subscribe only after authorization
+		return nil, onMiningExtranonceSubscribe(ctx, p.proxy, msgTyped)
+	case *m.MiningPing:
+		return nil, onMiningPing(ctx, p.proxy.source, msgTyped)
 	// errors
 	case *m.MiningConfigure:
 		return nil, fmt.Errorf("unexpected message from source after handshake: %s", string(msg.Serialize()))
@@ -39,6 +50,7 @@ func (p *HandlerMining) sourceInterceptor(ctx context.Context, msg i.MiningMessa
 		return nil, fmt.Errorf("unexpected message from source after handshake: %s", string(msg.Serialize()))
 	default:
 		p.proxy.logWarnf("unknown message from source: %s", string(msg.Serialize()))
+		p.proxy.dest.forwardRequest(ctx, msg)
 		return msg, nil
 	}
 }
@@ -48,6 +60,10 @@ func (p *HandlerMining) destInterceptor(ctx context.Context, msg i.MiningMessage
 	switch msgTyped := msg.(type) {
 	case *m.MiningSetDifficulty:
 		p.proxy.logDebugf("new diff: %.0f", msgTyped.GetDifficulty())
+		if p.proxy.vardiff != nil {
+			// miner difficulty is managed locally, pool difficulty is only used to filter shares
+			return nil, nil
+		}
 		return msg, nil
 	case *m.MiningSetVersionMask:
 		p.proxy.logDebugf("got version mask: %s", msgTyped.GetVersionMask())
@@ -57,9 +73,22 @@ func (p *HandlerMining) destInterceptor(ctx context.Context, msg i.MiningMessage
 		p.proxy.logDebugf("got extranonce: %s %d", xn, xn2size)
 		return msg, nil
 	case *m.MiningNotify:
-		return msg, nil
+		return p.proxy.dest.minerNotify(msgTyped), nil
 	case *m.MiningResult:
 		return msg, nil
+	case *m.ClientReconnect:
+		// stops the pipe, the redirect is followed in Proxy.Run
+		if !onClientReconnect(p.proxy, msgTyped) {
+			return nil, nil
+		}
+		return nil, ErrDestReconnect
+	case *m.ClientShowMessage:
+		onClientShowMessage(p.proxy, msgTyped)
+		return nil, nil
+	case *m.ClientGetVersion:
+		return nil, onClientGetVersion(ctx, p.proxy, msgTyped)
+	case *m.MiningPing:
+		return nil, onMiningPing(ctx, p.proxy.dest, msgTyped)
 	default:
 		p.proxy.logWarnf("unknown message from dest: %s", string(msg.Serialize()))
 		return msg, nil
@@ -69,58 +98,76 @@ func (p *HandlerMining) destInterceptor(ctx context.Context, msg i.MiningMessage
 // onMiningSubmit is only called when handshake is completed. It doesn't require determinism
 // in message ordering, so to improve performance we can use asynchronous pipe
 func (p *HandlerMining) onMiningSubmit(ctx context.Context, msgTyped *m.MiningSubmit) (i.MiningMessageGeneric, error) {
-	p.proxy.unansweredMsg.Add(1)
+	p.proxy.unansweredMsg.Inc()
+	defer p.proxy.unansweredMsg.Dec()
 
-	dest := p.proxy.dest
-	var res *m.MiningResult
+	var (
+		res       *m.MiningResult
+		diff      float64
+		candidate *validator.BlockCandidate
+		err       error
+	)
 
-	// searching for a job in main destination
-	diff, err := dest.ValidateAndAddShare(msgTyped)
+	// job ID carries the namespace of the destination that sent the job
+	dest, jobID, destFound := p.proxy.GetDestByJobID(msgTyped.GetJobId())
+	if destFound {
+		if dest != p.proxy.dest {
+			p.proxy.logDebugf("share for job %s of the previous dest %s", jobID, dest.ID())
+		}
+		msgTyped.SetJobId(jobID)
+		diff, candidate, err = dest.ValidateAndAddShare(msgTyped)
+		if candidate != nil {
+			p.onBlockCandidate(dest, jobID, candidate)
+		}
+	} else {
+		dest, err = p.proxy.dest, validator.ErrJobNotFound
+	}
 	weAccepted := err == nil
 
-	// if share has old destination the error is job not found
-	// or low difficulty (in case of job ID collision)
-	if errors.Is(err, validator.ErrJobNotFound) || errors.Is(err, validator.ErrLowDifficulty) {
-		// searching for a job in previous destination
-		d, _, err := p.proxy.GetDestByJobIDAndValidate(msgTyped)
-		if err != nil {
-			weAccepted = false
-			p.proxy.logWarnf("job %s not found in previous destinations", msgTyped.GetJobId())
-		} else {
-			weAccepted = true
-			p.proxy.logWarnf("job %s found in different dest %s", msgTyped.GetJobId(), d.ID())
-			dest = d
-		}
+	// with vardiff the share below pool difficulty can be accepted locally, but it is not forwarded to the pool
+	meetsPoolDiff := weAccepted
+	if p.proxy.vardiff != nil && errors.Is(err, validator.ErrLowDifficulty) && diff >= p.proxy.vardiff.GetAcceptDiff(time.Now()) {
+		weAccepted, err = true, nil
+	}
 
+	// hashrate is accounted from the shares accepted from the miner
+	acceptedDiff := dest.GetDiff()
+	if p.proxy.vardiff != nil {
+		acceptedDiff = p.proxy.vardiff.GetAcceptDiff(time.Now())
 	}
+	acceptedWork := dest.GetWork(acceptedDiff)
 
 	if !weAccepted {
 		count := p.consequentInvalidShareCount.Inc()
 		if count > MAX_CONSEQUENT_INVALID_SHARES {
-			p.proxy.logWarnf("too many consequent invalid shares (> %d), canceling run", MAX_CONSEQUENT_INVALID_SHARES)
-			p.proxy.cancelRun()
-			return nil, nil
+			p.proxy.logWarnf("too many consequent invalid shares (> %d), disconnecting", MAX_CONSEQUENT_INVALID_SHARES)
+			return nil, lib.WrapError(ErrTooManyInvalidShares, fmt.Errorf("> %d", MAX_CONSEQUENT_INVALID_SHARES))
 		}
 		p.proxy.source.GetStats().IncWeRejectedShares()
+		p.proxy.source.GetStats().IncRejectReason(err)
 
-		if errors.Is(err, validator.ErrDuplicateShare) {
+		switch {
+		case errors.Is(err, validator.ErrDuplicateShare):
 			p.proxy.logWarnf("duplicate share, jobID %s, msg id: %d", msgTyped.GetJobId(), msgTyped.GetID())
 			res = m.NewMiningResultDuplicatedShare(msgTyped.GetID())
-		} else if errors.Is(err, validator.ErrLowDifficulty) {
+		case errors.Is(err, validator.ErrLowDifficulty):
 			p.proxy.logWarnf("low difficulty share jobID %s, msg id: %d, diff %.f, err %s", msgTyped.GetJobId(), msgTyped.GetID(), diff, err)
 			res = m.NewMiningResultLowDifficulty(msgTyped.GetID())
-		} else {
+		case errors.Is(err, validator.ErrJobNotFound):
 			p.proxy.logWarnf("job %s not found", msgTyped.GetJobId())
 			res = m.NewMiningResultJobNotFound(msgTyped.GetID())
+		default:
+			p.proxy.logWarnf("invalid share jobID %s, msg id: %d, err %s", msgTyped.GetJobId(), msgTyped.GetID(), err)
+			res = m.NewMiningResultInvalidShare(msgTyped.GetID(), invalidShareReason(err))
 		}
 	} else {
 		p.consequentInvalidShareCount.Store(0)
 		p.proxy.source.GetStats().IncWeAcceptedShares()
 
 		// miner hashrate
-		p.proxy.hashrate.OnSubmit(dest.GetDiff())
+		p.proxy.hashrate.OnSubmit(acceptedWork)
 		// workername hashrate
-		p.proxy.globalHashrate.OnSubmit(p.proxy.source.GetUserName(), dest.GetDiff())
+		p.proxy.globalHashrate.OnSubmit(p.proxy.source.GetUserName(), acceptedWork)
 		if p.proxy.hashrate.GetTotalShares() > p.proxy.vettingShares {
 			select {
 			case <-p.proxy.vettingDoneCh:
@@ -129,57 +176,144 @@ func (p *HandlerMining) onMiningSubmit(ctx context.Context, msgTyped *m.MiningSu
 			}
 		}
 
-		// contract hashrate
-		p.proxy.onSubmitMutex.RLock()
-		if p.proxy.onSubmit != nil {
-			p.proxy.onSubmit(dest.GetDiff())
+		// contract hashrate, the shares of the unavailable dest are not delivered to the contract
+		if dest.IsUnavailable() {
+			p.proxy.source.GetStats().IncOutageShares()
+		} else {
+			p.proxy.onSubmitMutex.RLock()
+			if p.proxy.onSubmit != nil {
+				p.proxy.onSubmit(acceptedWork)
+			}
+			p.proxy.onSubmitMutex.RUnlock()
 		}
-		p.proxy.onSubmitMutex.RUnlock()
 
 		res = m.NewMiningResultSuccess(msgTyped.GetID())
 	}
 
-	// does not wait for response from destination pool
-	// TODO: implement buffering for source/dest messages
-	// to avoid blocking source/dest when one of them is slow
-	// and fix error handling to avoid p.cancelRun
-	go func(res1 *m.MiningResult) {
-		defer p.proxy.unansweredMsg.Done()
+	var setDiff *m.MiningSetDifficulty
+	if p.proxy.vardiff != nil && weAccepted {
+		if newDiff, ok := p.proxy.vardiff.OnShare(time.Now()); ok {
+			p.proxy.logDebugf("vardiff retarget, new miner diff: %.0f", newDiff)
+			setDiff = m.NewMiningSetDifficulty(newDiff)
+		}
+	}
 
-		err = p.proxy.source.Write(ctx, res1)
+	err = p.proxy.source.Write(ctx, res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write response (%d) to miner: %w", res.ID, err)
+	}
+
+	if setDiff != nil {
+		err = p.proxy.source.Write(ctx, setDiff)
 		if err != nil {
-			p.proxy.logErrorf("cannot write response (%d) to miner: %s", res1.ID, err)
-			p.proxy.cancelRun()
-			return
+			return nil, fmt.Errorf("cannot write set_difficulty to miner: %w", err)
 		}
+	}
 
-		// send and await submit response from pool
-		msgTyped.SetUserName(dest.GetUserName())
-		res, err := dest.WriteAwaitRes(ctx, msgTyped)
-		if err != nil {
-			p.proxy.logErrorf("cannot write response to pool: %s", err)
-			p.proxy.cancelRun()
-			return
+	// the malformed share would be rejected by the pool as well
+	if len(msgTyped.Params) < validator.SUBMIT_MIN_PARAMS {
+		return nil, nil
+	}
+
+	// no pool can match the job of unknown namespace
+	if !destFound {
+		return nil, nil
+	}
+
+	// with vardiff only shares that meet pool difficulty are forwarded
+	if p.proxy.vardiff != nil && !meetsPoolDiff {
+		return nil, nil
+	}
+
+	// the unavailable dest won't accept shares for its jobs after reconnect
+	if dest.IsUnavailable() {
+		return nil, nil
+	}
+
+	// submit is queued and doesn't wait for response from the pool, so a slow
+	// or reconnecting destination doesn't block the miner
+	// stays unanswered until the pool responds, so the dest change waits for it
+	p.proxy.unansweredMsg.Inc()
+	err = p.proxy.getSubmitQueue(dest.ID()).Enqueue(ctx, msgTyped, func(d *ConnDest, res *m.MiningResult, err error) {
+		defer p.proxy.unansweredMsg.Dec()
+		p.onSubmitResult(d, res, err, weAccepted, diff)
+	})
+	if err != nil {
+		p.proxy.unansweredMsg.Dec()
+		p.onSubmitResult(dest, nil, err, weAccepted, diff)
+	}
+
+	return nil, nil
+}
+
+// onSubmitResult updates the stats with the pool response to the submitted share
+func (p *HandlerMining) onSubmitResult(dest *ConnDest, res *m.MiningResult, err error, weAccepted bool, diff float64) {
+	if err != nil {
+		if weAccepted {
+			p.proxy.source.GetStats().IncSubmitDropped()
 		}
+		p.proxy.logWarnf("share was not submitted to the pool: %s", err)
+		return
+	}
 
-		if res.(*m.MiningResult).IsError() {
-			if weAccepted {
-				p.proxy.source.GetStats().IncWeAcceptedTheyRejected()
-				dest.GetStats().IncWeAcceptedTheyAccepted()
-				p.proxy.logWarnf("we accepted share, they rejected with err %s", res.(*m.MiningResult).GetError())
-			} else {
-				p.proxy.logWarnf("we rejected share, and they rejected with err %s", res.(*m.MiningResult).GetError())
-			}
+	if res.IsError() {
+		if weAccepted {
+			p.proxy.source.GetStats().IncWeAcceptedTheyRejected()
+			dest.GetStats().IncWeAcceptedTheyRejected()
+			p.proxy.logWarnf("we accepted share, they rejected with err %s", res.GetError())
 		} else {
-			if weAccepted {
-				dest.GetStats().IncWeAcceptedTheyAccepted()
-			} else {
-				dest.GetStats().IncWeRejectedTheyAccepted()
-				p.proxy.source.GetStats().IncWeRejectedTheyAccepted()
-				p.proxy.logWarnf("we rejected share, but dest accepted, diff: %.f", diff)
-			}
+			p.proxy.logWarnf("we rejected share, and they rejected with err %s", res.GetError())
 		}
-	}(res)
+	} else {
+		if weAccepted {
+			dest.GetStats().IncWeAcceptedTheyAccepted()
+		} else {
+			dest.GetStats().IncWeRejectedTheyAccepted()
+			p.proxy.source.GetStats().IncWeRejectedTheyAccepted()
+			p.proxy.logWarnf("we rejected share, but dest accepted, diff: %.f", diff)
+		}
+	}
+}
 
-	return nil, nil
+// invalidShareReason returns the message for the miner about the share rejected by the sanity checks
+func invalidShareReason(err error) string {
+	switch {
+	case errors.Is(err, validator.ErrVersionOutOfMask):
+		return "Invalid version bits"
+	case errors.Is(err, validator.ErrNtimeOutOfRange):
+		return "Ntime out of range"
+	case errors.Is(err, validator.ErrInvalidExtraNonce2Size):
+		return "Invalid extranonce2 size"
+	case errors.Is(err, validator.ErrInvalidHex):
+		return "Invalid hex"
+	case errors.Is(err, validator.ErrInvalidParams):
+		return "Invalid params"
+	}
+	return "Invalid share"
+}
+
+// onBlockCandidate records the share that would solve the block, so the luck of the pool can be verified
+func (p *HandlerMining) onBlockCandidate(dest *ConnDest, jobID string, candidate *validator.BlockCandidate) {
+	record := BlockCandidateRecord{
+		Time:        time.Now(),
+		MinerID:     p.proxy.GetID(),
+		WorkerName:  p.proxy.source.GetUserName(),
+		Dest:        dest.destUrl.Redacted(),
+		ContractID:  p.proxy.getDestContractID(dest),
+		JobID:       jobID,
+		BlockHash:   candidate.GetBlockHashHex(),
+		PowHash:     candidate.GetPowHashHex(),
+		Header:      candidate.GetHeaderHex(),
+		ShareDiff:   candidate.ShareDiff,
+		NetworkDiff: candidate.NetworkDiff,
+	}
+
+	p.proxy.source.GetStats().IncBlockCandidates()
+	dest.GetStats().IncBlockCandidates()
+	if p.proxy.blockCandidates != nil {
+		p.proxy.blockCandidates.Add(record)
+	}
+
+	p.proxy.logInfof("block candidate found, block hash %s, job %s, dest %s, contract %s, share diff %d, network diff %.0f, header %s",
+		record.BlockHash, record.JobID, record.Dest, record.ContractID, record.ShareDiff, record.NetworkDiff, record.Header)
 }
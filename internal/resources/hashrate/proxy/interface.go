@@ -31,6 +31,12 @@ type Hashrate interface {
 	GetTotalShares() int
 }
 
+// MessageRecorder receives raw messages of the connection, used to record sessions for debugging
+type MessageRecorder interface {
+	OnRead(msg []byte)
+	OnWrite(msg []byte)
+}
+
 type DestConnFactory = func(ctx context.Context, url *url.URL, srcWorker, srcAddr string) (*ConnDest, error)
 
 type Interceptor = func(context.Context, i.MiningMessageGeneric) (i.MiningMessageGeneric, error)
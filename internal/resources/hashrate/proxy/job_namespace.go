@@ -0,0 +1,20 @@
+package proxy
+
+import "fmt"
+
+// JOB_NAMESPACE_LEN is the length of the prefix added to the job IDs sent to the miner. The prefix identifies
+// the destination that sent the job, so the share is attributed to the destination without guessing
+const JOB_NAMESPACE_LEN = 4
+
+// formatJobNamespace returns the namespace for the n-th destination of the proxy
+func formatJobNamespace(n uint32) string {
+	return fmt.Sprintf("%0*x", JOB_NAMESPACE_LEN, n%(1<<(4*JOB_NAMESPACE_LEN)))
+}
+
+// splitJobID returns namespace and the job ID as it was sent by the destination
+func splitJobID(minerJobID string) (namespace string, jobID string, ok bool) {
+	if len(minerJobID) <= JOB_NAMESPACE_LEN {
+		return "", "", false
+	}
+	return minerJobID[:JOB_NAMESPACE_LEN], minerJobID[JOB_NAMESPACE_LEN:], true
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+func TestSplitJobID(t *testing.T) {
+	ns := formatJobNamespace(1)
+	require.Len(t, ns, JOB_NAMESPACE_LEN)
+	require.Equal(t, formatJobNamespace(0), formatJobNamespace(1<<(4*JOB_NAMESPACE_LEN)))
+
+	namespace, jobID, ok := splitJobID(ns + "620daf25f")
+	require.True(t, ok)
+	require.Equal(t, ns, namespace)
+	require.Equal(t, "620daf25f", jobID)
+
+	_, _, ok = splitJobID(ns)
+	require.False(t, ok)
+}
+
+func TestGetDestByJobID(t *testing.T) {
+	log := lib.NewTestLogger()
+	hashrateFactory := func() *hashrate.Hashrate {
+		return hashrate.NewHashrate(map[string]hashrate.Counter{})
+	}
+	newDest := func(addr string) *ConnDest {
+		destURL, _ := url.Parse("stratum+tcp://pool.worker:pwd@" + addr)
+		conn, _ := net.Pipe()
+		t.Cleanup(func() { _ = conn.Close() })
+		return NewDestConn(CreateConnection(conn, destURL.String(), time.Minute, time.Minute, log), validator.NewValidator(time.Minute), destURL, nil, log)
+	}
+
+	prx := NewProxy("test", nil, nil, hashrateFactory, hashrate.NewGlobalHashrate(hashrateFactory), nil, true, 1, 5, VardiffConfig{}, log, func(id string) (resources.Contract, bool) {
+		return nil, false
+	})
+	prevDest, curDest := newDest("pool-a:3333"), newDest("pool-b:3333")
+	prx.setupDest(prevDest)
+	prx.setupDest(curDest)
+	prx.destMap.Store(prevDest)
+	prx.destMap.Store(curDest)
+	prx.dest = curDest
+
+	// both pools use the same job ID
+	notify := m.NewMiningNotify("1", "00", "01", "02", []string{}, "20000000", "1705ae3a", "64c25820", true)
+	prevJobID := prevDest.minerNotify(notify).GetJobID()
+	curJobID := curDest.minerNotify(notify).GetJobID()
+	require.NotEqual(t, prevJobID, curJobID)
+	require.Equal(t, "1", notify.GetJobID())
+
+	dest, jobID, ok := prx.GetDestByJobID(prevJobID)
+	require.True(t, ok)
+	require.Equal(t, prevDest, dest)
+	require.Equal(t, "1", jobID)
+
+	dest, _, ok = prx.GetDestByJobID(curJobID)
+	require.True(t, ok)
+	require.Equal(t, curDest, dest)
+
+	_, _, ok = prx.GetDestByJobID(formatJobNamespace(100) + "1")
+	require.False(t, ok)
+}
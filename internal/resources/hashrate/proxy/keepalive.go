@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+const (
+	RECONNECT_MAX_BACKOFF  = time.Minute      // maximum delay between the attempts to reconnect to the failed dest
+	DEST_OUTAGE_TIMEOUT    = 10 * time.Minute // for how long the miner is kept connected while the dest is unavailable
+	KEEPALIVE_JOB_INTERVAL = 30 * time.Second // interval of resending the last job to the miner while the dest is unavailable
+)
+
+var (
+	ErrDestOutage = errors.New("destination is unavailable for too long")
+)
+
+// outageConn replaces the destination in the pipe while it is unavailable.
+// Messages of the miner that are not answered by the proxy are dropped
+type outageConn struct {
+	log gi.ILogger
+}
+
+func (c *outageConn) Read(ctx context.Context) (i.MiningMessageGeneric, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *outageConn) Write(ctx context.Context, msg i.MiningMessageGeneric) error {
+	c.log.Warnf("dest is unavailable, dropping message: %s", string(msg.Serialize()))
+	return nil
+}
+
+// reconnectDest keeps the miner session while reconnecting to the failed destination with exponential backoff.
+// Meanwhile the shares are validated against the last jobs of the failed destination and accounted locally,
+// and the last job is resent to the miner, so it doesn't switch to its own failover pool
+func (p *Proxy) reconnectDest(ctx context.Context, handler *HandlerMining) error {
+	failedDest := p.dest
+	destURL := lib.CopyURL(p.destURL.Load())
+	outageStart := time.Now()
+
+	failedDest.SetUnavailable()
+	failedDest.conn.Close()
+	p.destMap.Delete(failedDest.ID())
+
+	p.setDestLock.Lock()
+	outageCtx, outageCancel := context.WithCancel(ctx)
+	p.cancelOutage = outageCancel
+	p.pipe = NewPipe(p.source, &outageConn{log: p.log}, handler.sourceInterceptor, handler.destInterceptor, p.log)
+	pipe := p.pipe
+	pipe.StartSourceToDest(ctx)
+	p.setDestLock.Unlock()
+	defer outageCancel()
+
+	go p.serveLastJob(outageCtx, failedDest)
+
+	backoff := lib.NewBackoff(RECONNECT_TIMEOUT, RECONNECT_MAX_BACKOFF)
+	for {
+		delay := backoff.Next()
+		p.logWarnf("dest is unavailable, reconnecting in %s", delay)
+
+		select {
+		case <-outageCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// dest was changed meanwhile
+			return nil
+		case <-pipe.sourceToDestTask.Done():
+			return pipe.sourceToDestTask.Err()
+		case <-time.After(delay):
+		}
+
+		ok, err := p.reconnectAttempt(ctx, outageCtx, destURL)
+		if ok {
+			p.logInfof("dest reconnected after %s", time.Since(outageStart).Round(time.Second))
+			return nil
+		}
+		if errors.Is(err, ErrSourceReconnect) {
+			return err
+		}
+		p.logWarnf("error reconnecting to dest %s: %s", destURL.Redacted(), err)
+
+		if time.Since(outageStart) > DEST_OUTAGE_TIMEOUT {
+			return lib.WrapError(ErrDestOutage, err)
+		}
+	}
+}
+
+// reconnectAttempt connects to the destination and replaces the failed one in the pipe. Returns true
+// if the outage is over, including the case when the destination was changed meanwhile
+func (p *Proxy) reconnectAttempt(ctx context.Context, outageCtx context.Context, destURL *url.URL) (bool, error) {
+	destChanger := NewHandlerChangeDest(p, p.destFactory)
+
+	newDest, err := destChanger.connectNewDest(ctx, destURL)
+	if err != nil {
+		return false, err
+	}
+
+	p.setDestLock.Lock()
+	defer p.setDestLock.Unlock()
+
+	if outageCtx.Err() != nil {
+		newDest.conn.Close()
+		return true, nil
+	}
+
+	// source is read by the pipe again when the new dest is set
+	<-p.pipe.StopSourceToDest()
+
+	err = destChanger.resendRelevantNotifications(ctx, newDest)
+	if err != nil {
+		newDest.conn.Close()
+		if errors.Is(err, ErrSourceReconnect) {
+			p.closeSource(ctx)
+			return false, err
+		}
+		p.pipe.StartSourceToDest(ctx)
+		return false, err
+	}
+
+	p.dest = newDest
+	p.destURL.Store(destURL)
+	p.destMap.Store(newDest)
+	p.pipe.SetDest(newDest)
+	p.endOutage()
+
+	return true, nil
+}
+
+// endOutage stops serving the failed dest, should be called under setDestLock when the dest is replaced
+func (p *Proxy) endOutage() {
+	if p.cancelOutage != nil {
+		p.cancelOutage()
+		p.cancelOutage = nil
+	}
+}
+
+// serveLastJob periodically resends the last job of the failed dest, so the miner doesn't consider the pool dead
+func (p *Proxy) serveLastJob(ctx context.Context, dest *ConnDest) {
+	ticker := time.NewTicker(KEEPALIVE_JOB_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		job, ok := dest.GetLatestJob()
+		if !ok {
+			continue
+		}
+		msg := dest.minerNotify(job.GetNotify())
+		msg.SetCleanJobs(false)
+
+		err := p.source.Write(ctx, msg)
+		if err != nil {
+			p.logWarnf("cannot resend last job to the miner: %s", err)
+			return
+		}
+	}
+}
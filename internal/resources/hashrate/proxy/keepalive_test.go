@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/testlib/stratumsim"
+)
+
+func TestMinerKeptDuringDestOutage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := runSimPool(t, ctx, stratumsim.PoolConfig{Difficulty: 0.001})
+	prx, miner := runSimProxy(t, ctx, pool.URL("pool.worker"), stratumsim.MinerConfig{
+		UserName: "acc1.rig1", SharesPerMin: 6000, ExtranonceSubscribe: true,
+	})
+	require.Eventually(t, func() bool { return pool.GetStats().Accepted >= 2 }, 5*time.Second, 10*time.Millisecond)
+
+	pool.DisconnectAll()
+
+	// shares are accepted locally while the dest is unavailable
+	require.Eventually(t, func() bool { return prx.source.GetStats().OutageShares.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// the same dest is reconnected without dropping the miner
+	accepted := pool.GetStats().Accepted
+	require.Eventually(t, func() bool { return pool.GetStats().Accepted >= accepted+2 }, 2*RECONNECT_TIMEOUT, 10*time.Millisecond)
+	require.False(t, prx.dest.IsUnavailable())
+	require.NotZero(t, miner.GetStats().Accepted)
+}
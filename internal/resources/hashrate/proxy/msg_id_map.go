@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// msgIDMap translates the IDs of the messages written to the destination. Each message gets
+// an ID unique within the destination connection, so messages of the miner, the handshake replays
+// and resubmits never collide. The original ID is restored on the result
+type msgIDMap struct {
+	lastID atomic.Int64
+	ids    sync.Map // map[int]int upstream ID -> original ID
+}
+
+func newMsgIDMap() *msgIDMap {
+	return &msgIDMap{}
+}
+
+// Map allocates the upstream ID for the message with the original ID
+func (m *msgIDMap) Map(origID int) (upstreamID int) {
+	upstreamID = int(m.lastID.Add(1))
+	m.ids.Store(upstreamID, origID)
+	return upstreamID
+}
+
+// Resolve returns the original ID for the upstream ID and removes the mapping
+func (m *msgIDMap) Resolve(upstreamID int) (origID int, ok bool) {
+	val, ok := m.ids.LoadAndDelete(upstreamID)
+	if !ok {
+		return 0, false
+	}
+	return val.(int), true
+}
+
+// Delete removes the mapping, used when the result is not received in time
+func (m *msgIDMap) Delete(upstreamID int) {
+	m.ids.Delete(upstreamID)
+}
+
+// Len returns the number of messages awaiting the result
+func (m *msgIDMap) Len() int {
+	count := 0
+	m.ids.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/coinbase"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/testlib/stratumsim"
+)
+
+type payoutTestContract struct {
+	resources.Contract
+	err atomic.Pointer[error]
+}
+
+func (c *payoutTestContract) SetError(err error) {
+	c.err.Store(&err)
+}
+
+// runPayoutTest runs the miner through the proxy to the pool with the expected payout address
+func runPayoutTest(t *testing.T, ctx context.Context, payoutAddress string) (*Proxy, *stratumsim.Miner, *payoutTestContract) {
+	log := lib.NewTestLogger()
+	pool := runSimPool(t, ctx, stratumsim.PoolConfig{Difficulty: 0.001})
+	destURL := pool.URL("pool.worker")
+	destURL.RawQuery = url.Values{coinbase.PAYOUT_URL_PARAM: {payoutAddress}}.Encode()
+
+	contract := &payoutTestContract{}
+	destFactory := func(ctx context.Context, url *url.URL, srcWorker string, srcAddr string) (*ConnDest, error) {
+		return ConnectDest(ctx, url, nil, validator.NewValidator(time.Minute), time.Minute, time.Minute, log)
+	}
+	hashrateFactory := func() *hashrate.Hashrate {
+		return hashrate.NewHashrate(map[string]hashrate.Counter{})
+	}
+
+	minerConn, sourceConn := net.Pipe()
+	source := NewSourceConn(CreateConnection(sourceConn, "miner", time.Minute, time.Minute, log), log)
+	prx := NewProxy("test", source, destFactory, hashrateFactory, hashrate.NewGlobalHashrate(hashrateFactory), destURL, true, 1, 5, VardiffConfig{}, log, func(id string) (resources.Contract, bool) {
+		return contract, id == "contract1"
+	})
+	go func() {
+		if err := prx.Connect(ctx); err != nil {
+			return
+		}
+		_ = prx.Run(ctx)
+	}()
+
+	miner := stratumsim.NewMiner(stratumsim.MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000}, log)
+	go func() { _ = miner.Run(ctx, minerConn) }()
+
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted >= 1 }, 5*time.Second, 10*time.Millisecond)
+	prx.SetOutgoingContractID("contract1")
+	return prx, miner, contract
+}
+
+func TestPayoutMismatchSetsContractError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prx, miner, contract := runPayoutTest(t, ctx, "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")
+
+	require.Eventually(t, func() bool { return contract.err.Load() != nil }, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, *contract.err.Load(), ErrPayoutMismatch)
+	require.ErrorIs(t, *contract.err.Load(), coinbase.ErrPayoutMismatch)
+	require.ErrorIs(t, prx.dest.GetPayoutError(), coinbase.ErrPayoutMismatch)
+	require.Positive(t, prx.dest.GetStats().GetStatsMap()["payout_mismatches"])
+
+	// mining is not interrupted, the contract decides what to do with the error
+	accepted := miner.GetStats().Accepted
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted > accepted }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPayoutMatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prx, _, contract := runPayoutTest(t, ctx, stratumsim.JobPayoutAddress)
+
+	require.NoError(t, prx.dest.GetPayoutError())
+	require.Zero(t, prx.dest.GetStats().GetStatsMap()["payout_mismatches"])
+	require.Nil(t, contract.err.Load())
+}
+
+func TestConnectDestInvalidPayoutAddress(t *testing.T) {
+	destURL, _ := url.Parse("stratum+tcp://pool.worker@localhost:3333?payout=1abc")
+	_, err := ConnectDest(context.Background(), destURL, nil, validator.NewValidator(time.Minute), time.Minute, time.Minute, lib.NewTestLogger())
+	require.ErrorIs(t, err, coinbase.ErrInvalidAddress)
+}
@@ -14,14 +14,13 @@ import (
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/hashrate"
 	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
-	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
 	"go.uber.org/atomic"
 )
 
 const (
 	CONNECTION_TIMEOUT = 10 * time.Minute
 	RESPONSE_TIMEOUT   = 30 * time.Second
-	RECONNECT_TIMEOUT  = 3 * time.Second
+	RECONNECT_TIMEOUT  = 3 * time.Second // initial delay before reconnecting to the failed dest
 )
 
 var (
@@ -33,6 +32,8 @@ var (
 	ErrNotAuthorizedPool = errors.New("not authorized in the pool")
 	ErrChangeDest        = errors.New("destination change error")
 	ErrAutoreadStarted   = errors.New("autoread already started")
+	ErrSourceReconnect   = errors.New("miner was asked to reconnect")
+	ErrPayoutMismatch    = errors.New("destination pays to unexpected address")
 )
 
 type Proxy struct {
@@ -46,26 +47,32 @@ type Proxy struct {
 	destToSourceStartSignal chan struct{}      // signal to start reading from destination
 	hashrate                *hashrate.Hashrate // hashrate of the source validated by the proxy
 	pipe                    *Pipe
-	cancelRun               context.CancelFunc         // cancels Run() task
-	setDestLock             sync.Mutex                 // mutex to protect SetDest() from concurrent calls
-	unansweredMsg           sync.WaitGroup             // number of unanswered messages from the source
-	onSubmit                HashrateCounterFunc        // callback to update contract hashrate
-	onSubmitMutex           sync.RWMutex               // mutex to protect onSubmit
-	destMap                 *lib.Collection[*ConnDest] // map of all available destinations (pools) currently connected to the single source (miner)
-	vettingDoneCh           chan struct{}              // channel to signal that the miner has been vetted
-	vettingShares           int                        // number of shares to vet the miner
-	contractID              *string                    // is set if incoming connection is a hashrate contract
+	cancelRun               context.CancelFunc            // cancels Run() task
+	cancelOutage            context.CancelFunc            // ends serving the miner while the dest is unavailable, protected by setDestLock
+	setDestLock             sync.Mutex                    // mutex to protect SetDest() from concurrent calls
+	unansweredMsg           atomic.Int64                  // number of unanswered messages from the source, including the submits awaiting the pool response
+	onSubmit                HashrateCounterFunc           // callback to update contract hashrate
+	onSubmitMutex           sync.RWMutex                  // mutex to protect onSubmit
+	destMap                 *lib.Collection[*ConnDest]    // map of all available destinations (pools) currently connected to the single source (miner)
+	vettingDoneCh           chan struct{}                 // channel to signal that the miner has been vetted
+	vettingShares           int                           // number of shares to vet the miner
+	contractID              *string                       // is set if incoming connection is a hashrate contract
+	vardiff                 *Vardiff                      // local difficulty of the miner, nil if vardiff is disabled
+	submitQueues            *lib.Collection[*SubmitQueue] // shares waiting to be submitted, per destination
+	destRedirect            *atomic.Pointer[destRedirect] // pending client.reconnect request from the dest
+	jobNamespaceSeq         atomic.Uint32                 // sequence number of the last job namespace assigned to the dest
 
 	// deps
 	source                 *ConnSource           // initiator of the communication, miner
 	dest                   *ConnDest             // receiver of the communication, pool
 	globalHashrate         GlobalHashrateCounter // callback to update global hashrate per worker
 	destFactory            DestConnFactory       // factory to create new destination connections
+	blockCandidates        *BlockCandidates      // registry of the shares that would solve the block, optional
 	log                    gi.ILogger
 	getContractFromStoreFn GetContractFromStoreFn
 }
 
-func NewProxy(ID string, source *ConnSource, destFactory DestConnFactory, hashrateFactory HashrateFactory, globalHashrate GlobalHashrateCounter, destURL *url.URL, notPropagateWorkerName bool, vettingShares int, maxCachedDests int, log gi.ILogger, getContractFromStoreFn GetContractFromStoreFn) *Proxy {
+func NewProxy(ID string, source *ConnSource, destFactory DestConnFactory, hashrateFactory HashrateFactory, globalHashrate GlobalHashrateCounter, destURL *url.URL, notPropagateWorkerName bool, vettingShares int, maxCachedDests int, vardiffCfg VardiffConfig, log gi.ILogger, getContractFromStoreFn GetContractFromStoreFn) *Proxy {
 	proxy := &Proxy{
 		ID:                     ID,
 		destURL:                atomic.NewPointer(destURL),
@@ -74,6 +81,8 @@ func NewProxy(ID string, source *ConnSource, destFactory DestConnFactory, hashra
 
 		source:        source,
 		destMap:       lib.NewCollection[*ConnDest](),
+		submitQueues:  lib.NewCollection[*SubmitQueue](),
+		destRedirect:  atomic.NewPointer[destRedirect](nil),
 		destFactory:   destFactory,
 		log:           log,
 		vettingDoneCh: make(chan struct{}),
@@ -85,6 +94,10 @@ func NewProxy(ID string, source *ConnSource, destFactory DestConnFactory, hashra
 		getContractFromStoreFn: getContractFromStoreFn,
 	}
 
+	if vardiffCfg.IsEnabled() {
+		proxy.vardiff = NewVardiff(vardiffCfg)
+	}
+
 	return proxy
 }
 
@@ -105,9 +118,23 @@ func (p *Proxy) Connect(ctx context.Context) error {
 
 func (p *Proxy) Run(ctx context.Context) error {
 	defer p.closeConnections()
+	defer p.closeSubmitQueues()
 	handler := NewHandlerMining(p)
 	p.pipe = NewPipe(p.source, p.dest, handler.sourceInterceptor, handler.destInterceptor, p.log)
 
+	// the dest may request reconnect during handshake, it is followed once the pipe is set up
+	if redirect := p.destRedirect.Swap(nil); redirect != nil {
+		err := p.followRedirect(ctx, redirect)
+		if err != nil {
+			p.logWarnf("error following dest redirect, reconnecting to the configured dest: %s", err)
+			err := p.reconnectDest(ctx, handler)
+			if err != nil {
+				p.logErrorf("error reconnecting to dest %s: %s", p.destURL.Load().Redacted(), err)
+				return err
+			}
+		}
+	}
+
 	for {
 		p.pipe.StartSourceToDest(ctx)
 		p.pipe.StartDestToSource(ctx)
@@ -117,9 +144,29 @@ func (p *Proxy) Run(ctx context.Context) error {
 
 		err := p.pipe.Run(ctx)
 		p.logWarnf("pipe exited with error: %s", err)
-		// p.unansweredMsg.Wait() ignore waiting because on error it doesn't matter, we will drop the connection anyway
+		// p.waitUnanswered() ignore waiting because on error it doesn't matter, we will drop the connection anyway
 
 		if err != nil {
+			// destination asked to reconnect to a different address
+			if errors.Is(err, ErrDestReconnect) {
+				if redirect := p.destRedirect.Swap(nil); redirect != nil {
+					// the exited pipe tasks cannot be restarted, so the pipe is recreated
+					p.pipe = NewPipe(p.source, p.dest, handler.sourceInterceptor, handler.destInterceptor, p.log)
+					err := p.followRedirect(ctx, redirect)
+					if err != nil {
+						// the miner is kept connected while reconnecting to the configured dest
+						p.logWarnf("error following dest redirect, reconnecting to the configured dest: %s", err)
+						err := p.reconnectDest(ctx, handler)
+						if err != nil {
+							cancel()
+							p.logErrorf("error reconnecting to dest %s: %s", p.destURL.Load().Redacted(), err)
+							return err
+						}
+					}
+					continue
+				}
+			}
+
 			// destination error
 			if errors.Is(err, ErrDest) {
 				if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
@@ -127,21 +174,11 @@ func (p *Proxy) Run(ctx context.Context) error {
 				} else {
 					p.logErrorf("destination error, source %s dest %s: %s", p.source.GetID(), p.dest.ID(), err)
 				}
-				if p.dest != nil {
-					p.dest.conn.Close()
-				}
 
-				select {
-				case <-ctx.Done():
-					cancel()
-					return ctx.Err()
-				case <-time.After(RECONNECT_TIMEOUT):
-				}
-
-				// try to reconnect to the same dest
-				p.destMap.Delete(p.dest.ID())
-				err := p.ConnectDest(ctx, lib.CopyURL(p.destURL.Load()))
+				// the miner is kept connected while reconnecting to the same dest
+				err := p.reconnectDest(ctx, handler)
 				if err != nil {
+					cancel()
 					p.logErrorf("error reconnecting to dest %s: %s", p.dest.ID(), err)
 					return err
 				}
@@ -172,25 +209,31 @@ func (p *Proxy) Run(ctx context.Context) error {
 }
 
 func (p *Proxy) ConnectDest(ctx context.Context, newDestURL *url.URL) error {
+	return p.connectDest(ctx, newDestURL, newDestURL)
+}
+
+// connectDest connects to connURL and serves it as destURL, they differ when the dest redirected the proxy
+func (p *Proxy) connectDest(ctx context.Context, connURL *url.URL, destURL *url.URL) error {
 	p.setDestLock.Lock()
 	defer p.setDestLock.Unlock()
 
-	p.logDebugf("reconnecting to destination %s", newDestURL.String())
+	p.logDebugf("reconnecting to destination %s", connURL.String())
 
 	destChanger := NewHandlerChangeDest(p, p.destFactory)
 
-	newDest, err := destChanger.connectNewDest(ctx, newDestURL)
+	newDest, err := destChanger.connectNewDest(ctx, connURL)
 	if err != nil {
 		return err
 	}
 
 	err = destChanger.resendRelevantNotifications(ctx, newDest)
 	if err != nil {
+		newDest.conn.Close()
 		return err
 	}
 
 	p.dest = newDest
-	p.destURL.Store(newDestURL)
+	p.destURL.Store(destURL)
 	p.destMap.Store(newDest)
 
 	p.pipe.SetDest(newDest)
@@ -198,7 +241,7 @@ func (p *Proxy) ConnectDest(ctx context.Context, newDestURL *url.URL) error {
 	p.pipe.StartSourceToDest(ctx)
 	p.pipe.StartDestToSource(ctx)
 
-	p.logInfof("destination reconnected %s", newDestURL.String())
+	p.logInfof("destination reconnected %s", connURL.String())
 
 	return nil
 }
@@ -207,6 +250,12 @@ func (p *Proxy) SetDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 	return p.setDest(ctx, newDestURL, onSubmit, true)
 }
 
+// RequestReconnect asks the miner to reconnect to the address with client.reconnect,
+// empty host means reconnect to the same address
+func (p *Proxy) RequestReconnect(ctx context.Context, host string, port int) error {
+	return p.source.Write(ctx, stratumv1_message.NewClientReconnect(host, port, 0))
+}
+
 func (p *Proxy) SetDestWithoutAutoread(ctx context.Context, newDestURL *url.URL, onSubmit func(diff float64)) error {
 	return p.setDest(ctx, newDestURL, onSubmit, false)
 }
@@ -227,8 +276,6 @@ func (p *Proxy) setDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 	cachedDest, ok := p.destMap.Load(newDestURL.String())
 	if ok {
 		p.logInfof("reusing connection from cache %s", newDestURL.String())
-		// limit waiting time, disconnect if not answered in time
-		p.unansweredMsg.Wait()
 		err := cachedDest.AutoReadStop()
 		if err != nil {
 			p.logErrorf("error stopping autoread for cached dest %s: %s", newDestURL.String(), err)
@@ -242,14 +289,16 @@ func (p *Proxy) setDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 		if err != nil {
 			return err
 		}
-
-		p.unansweredMsg.Wait()
 		newDest = dest
 	}
 
-	// stop source and old dest
-	<-p.pipe.StopDestToSource()
+	// stop source and wait for the submits to be answered, the responses of the old dest are read
+	// by the pipe until it is stopped
 	<-p.pipe.StopSourceToDest()
+	if !p.waitUnanswered(SUBMIT_DRAIN_TIMEOUT) {
+		p.logWarnf("%d messages left unanswered after %s, changing dest anyway", p.unansweredMsg.Load(), SUBMIT_DRAIN_TIMEOUT)
+	}
+	<-p.pipe.StopDestToSource()
 	p.logDebugf("stopped source and old dest")
 
 	// TODO: wait to stop?
@@ -280,10 +329,19 @@ func (p *Proxy) setDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 		} else {
 			p.logDebugf("set old dest to autoread")
 		}
+	} else if queue, ok := p.submitQueues.Load(p.dest.ID()); ok {
+		// old dest is not read anymore, the shares left in its queue would never be answered
+		queue.Close()
+		p.submitQueues.Delete(queue.ID())
 	}
 
 	err := destChanger.resendRelevantNotifications(ctx, newDest)
 	if err != nil {
+		p.destMap.Delete(newDest.ID())
+		newDest.conn.Close()
+		if errors.Is(err, ErrSourceReconnect) {
+			p.closeSource(ctx)
+		}
 		return err
 	}
 
@@ -294,6 +352,7 @@ func (p *Proxy) setDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 	p.dest = newDest
 	p.destURL.Store(newDestURL)
 	p.destMap.Store(newDest)
+	p.endOutage()
 
 	p.onSubmitMutex.Lock()
 	p.onSubmit = onSubmit
@@ -308,6 +367,18 @@ func (p *Proxy) setDest(ctx context.Context, newDestURL *url.URL, onSubmit func(
 	return nil
 }
 
+// waitUnanswered waits until the messages from the source are answered, returns false on timeout
+func (p *Proxy) waitUnanswered(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for p.unansweredMsg.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
 func (p *Proxy) closeOldestConn() {
 	p.logDebugf("dest map size %d exceeds max cached dests %d, closing oldest dest", p.destMap.Len(), p.maxCachedDests)
 	var oldestDest *ConnDest
@@ -327,6 +398,16 @@ func (p *Proxy) closeOldestConn() {
 	p.destMap.Delete(oldestDest.ID())
 }
 
+// closeSource ends the session of the miner that was asked to reconnect. The source is read
+// by the pipe again, so Run exits on the closed connection
+func (p *Proxy) closeSource(ctx context.Context) {
+	err := p.source.conn.Close()
+	if err != nil {
+		p.logWarnf("error closing source %s: %s", p.source.GetID(), err)
+	}
+	p.pipe.StartSourceToDest(ctx)
+}
+
 func (p *Proxy) closeConnections() {
 	if p.dest != nil {
 		p.dest.conn.Close()
@@ -339,41 +420,70 @@ func (p *Proxy) closeConnections() {
 	})
 }
 
-func (p *Proxy) GetDestByJobID(jobID string) *ConnDest {
-	var dest *ConnDest
+// getSubmitQueue returns the submit queue of the destination, creating one if needed
+func (p *Proxy) getSubmitQueue(destID string) *SubmitQueue {
+	queue, ok := p.submitQueues.Load(destID)
+	if ok {
+		return queue
+	}
+	queue, _ = p.submitQueues.LoadOrStore(NewSubmitQueue(
+		destID, p.destMap.Load,
+		SUBMIT_QUEUE_SIZE, SUBMIT_QUEUE_WORKERS, SUBMIT_MAX_AGE, SUBMIT_ENQUEUE_TIMEOUT,
+		p.log,
+	))
+	return queue
+}
 
-	p.destMap.Range(func(d *ConnDest) bool {
-		if d.HasJob(jobID) {
-			dest = d
-			return false
-		}
+func (p *Proxy) closeSubmitQueues() {
+	p.submitQueues.Range(func(queue *SubmitQueue) bool {
+		queue.Close()
+		p.submitQueues.Delete(queue.ID())
 		return true
 	})
+}
 
-	return dest
+// setupDest prepares the new dest: sets the unique within the proxy namespace for the job IDs
+// and reports the coinbase payout mismatches
+func (p *Proxy) setupDest(dest *ConnDest) {
+	dest.SetJobNamespace(formatJobNamespace(p.jobNamespaceSeq.Inc()))
+	// called from the reader of the dest, so the contract is taken from the dest rather than from the current one
+	dest.SetOnPayoutMismatch(func(err error) {
+		p.reportPayoutMismatch(dest, err)
+	})
 }
 
-func (p *Proxy) GetDestByJobIDAndValidate(msg *stratumv1_message.MiningSubmit) (*ConnDest, float64, error) {
-	var dest *ConnDest
-	var diff float64
+// reportPayoutMismatch sets the error on the contract served by the dest
+func (p *Proxy) reportPayoutMismatch(dest *ConnDest, err error) {
+	contractID := p.getDestContractID(dest)
+	p.logErrorf("coinbase payout mismatch, dest %s, contract %s: %s", dest.destUrl.Redacted(), contractID, err)
+	if contractID == "" {
+		return
+	}
+	if contract, ok := p.getContractFromStoreFn(contractID); ok {
+		contract.SetError(lib.WrapError(ErrPayoutMismatch, err))
+	}
+}
+
+// GetDestByJobID returns the destination that sent the job by the job ID received from the miner,
+// and the job ID as it was sent by the destination
+func (p *Proxy) GetDestByJobID(minerJobID string) (dest *ConnDest, jobID string, ok bool) {
+	namespace, jobID, ok := splitJobID(minerJobID)
+	if !ok {
+		return nil, "", false
+	}
+	if p.dest != nil && p.dest.GetJobNamespace() == namespace {
+		return p.dest, jobID, true
+	}
 
 	p.destMap.Range(func(d *ConnDest) bool {
-		if d.HasJob(msg.GetJobId()) {
-			difficulty, err := d.ValidateAndAddShare(msg)
-			if err == nil {
-				dest = d
-				diff = difficulty
-				return false
-			}
+		if d.GetJobNamespace() == namespace {
+			dest = d
+			return false
 		}
 		return true
 	})
 
-	if dest != nil {
-		return dest, diff, nil
-	}
-
-	return nil, 0, validator.ErrJobNotFound
+	return dest, jobID, dest != nil
 }
 
 // Getters
@@ -400,6 +510,11 @@ func (p *Proxy) GetDifficulty() float64 {
 	return p.dest.GetDiff()
 }
 
+// GetExtraNonceMode returns the way extranonce is updated for the miner when destination changes
+func (p *Proxy) GetExtraNonceMode() ExtraNonceMode {
+	return p.source.GetExtraNonceMode()
+}
+
 func (p *Proxy) GetHashrate() Hashrate {
 	return p.hashrate
 }
@@ -429,6 +544,42 @@ func (p *Proxy) GetIncomingContractID() *string {
 	return p.contractID
 }
 
+// SetOutgoingContractID sets the contract the current dest is serving, empty for the default dest
+func (p *Proxy) SetOutgoingContractID(contractID string) {
+	p.setDestLock.Lock()
+	defer p.setDestLock.Unlock()
+
+	dest := p.dest
+	if dest == nil {
+		return
+	}
+	// the shares for the jobs of the previous dest stay credited to its contract
+	dest.SetContractID(contractID)
+
+	// the first jobs of the contract dest are received before the contract is set
+	if contractID != "" {
+		if err := dest.GetPayoutError(); err != nil {
+			p.reportPayoutMismatch(dest, err)
+		}
+	}
+}
+
+// SetBlockCandidates sets the registry for the shares that would solve the block
+func (p *Proxy) SetBlockCandidates(blockCandidates *BlockCandidates) {
+	p.blockCandidates = blockCandidates
+}
+
+// getDestContractID returns the contract the jobs of the dest are mined for, if any
+func (p *Proxy) getDestContractID(dest *ConnDest) string {
+	if contractID := dest.GetContractID(); contractID != "" {
+		return contractID
+	}
+	if p.contractID != nil {
+		return *p.contractID
+	}
+	return ""
+}
+
 func (p *Proxy) VettingDone() <-chan struct{} {
 	return p.vettingDoneCh
 }
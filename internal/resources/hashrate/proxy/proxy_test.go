@@ -28,7 +28,7 @@ func RunTestProxy() (p *Proxy, s *StratumConnection, d *StratumConnection, cance
 
 	sourceConn := NewSourceConn(CreateConnection(sourceClient, "", timeout, timeout, log), log)
 	valid := validator.NewValidator(time.Minute)
-	destConn := NewDestConn(CreateConnection(destClient, destURL.String(), timeout, timeout, log), valid, destURL, log)
+	destConn := NewDestConn(CreateConnection(destClient, destURL.String(), timeout, timeout, log), valid, destURL, nil, log)
 
 	destConnFactory := func(ctx context.Context, url *url.URL, srcWorker string, srcAddr string) (*ConnDest, error) {
 		return destConn, nil
@@ -39,7 +39,7 @@ func RunTestProxy() (p *Proxy, s *StratumConnection, d *StratumConnection, cance
 
 	globalHashrate := hashrate.NewGlobalHashrate(hashrateFactory)
 
-	proxy := NewProxy("test", sourceConn, destConnFactory, hashrateFactory, globalHashrate, destURL, true, 1, 5, log, func(id string) (resources.Contract, bool) {
+	proxy := NewProxy("test", sourceConn, destConnFactory, hashrateFactory, globalHashrate, destURL, true, 1, 5, VardiffConfig{}, log, func(id string) (resources.Contract, bool) {
 		return nil, false
 	})
 
@@ -1,11 +1,19 @@
 package proxy
 
-import "sync/atomic"
+import (
+	"errors"
+	"sync/atomic"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
 
 type DestStats struct {
 	WeAcceptedTheyAccepted atomic.Uint64 // our validator accepted and dest accepted
 	WeAcceptedTheyRejected atomic.Uint64 // our validator accepted and dest rejected
 	WeRejectedTheyAccepted atomic.Uint64 // our validator rejected, but dest accepted
+	SubmitRetried          atomic.Uint64 // submits that failed to be written and were retried after reconnect
+	BlockCandidates        atomic.Uint64 // shares that meet the network target
+	PayoutMismatches       atomic.Uint64 // jobs with coinbase paying to unexpected address
 }
 
 func (s *DestStats) IncWeAcceptedTheyAccepted() {
@@ -20,11 +28,26 @@ func (s *DestStats) IncWeRejectedTheyAccepted() {
 	s.WeRejectedTheyAccepted.Add(1)
 }
 
+func (s *DestStats) IncSubmitRetried() {
+	s.SubmitRetried.Add(1)
+}
+
+func (s *DestStats) IncBlockCandidates() {
+	s.BlockCandidates.Add(1)
+}
+
+func (s *DestStats) IncPayoutMismatches() {
+	s.PayoutMismatches.Add(1)
+}
+
 func (s *DestStats) GetStatsMap() map[string]int {
 	return map[string]int{
 		"we_accepted_they_accepted": int(s.WeAcceptedTheyAccepted.Load()),
 		"we_accepted_they_rejected": int(s.WeAcceptedTheyRejected.Load()),
 		"we_rejected_they_accepted": int(s.WeRejectedTheyAccepted.Load()),
+		"submit_retried":            int(s.SubmitRetried.Load()),
+		"block_candidates":          int(s.BlockCandidates.Load()),
+		"payout_mismatches":         int(s.PayoutMismatches.Load()),
 	}
 }
 
@@ -33,6 +56,18 @@ type SourceStats struct {
 	WeRejectedShares       atomic.Uint64 // shares that failed during validation (incl RejectedUsAcceptedThem)
 	WeAcceptedTheyRejected atomic.Uint64 // shares that passed our validator, but rejected by the destination
 	WeRejectedTheyAccepted atomic.Uint64 // shares that failed our validator, but accepted by the destination
+	SubmitDropped          atomic.Uint64 // shares that passed our validator, but were not delivered to the destination
+	OutageShares           atomic.Uint64 // shares that passed our validator while the destination was unavailable, accounted locally
+	BlockCandidates        atomic.Uint64 // shares that meet the network target
+
+	// reasons of the shares rejected by our validator
+	RejectedJobNotFound     atomic.Uint64
+	RejectedDuplicate       atomic.Uint64
+	RejectedLowDifficulty   atomic.Uint64
+	RejectedVersionMask     atomic.Uint64 // version bits outside of the negotiated mask
+	RejectedNtime           atomic.Uint64 // ntime out of range
+	RejectedExtraNonce2Size atomic.Uint64
+	RejectedInvalidHex      atomic.Uint64
 }
 
 func (s *SourceStats) IncWeAcceptedShares() {
@@ -51,11 +86,53 @@ func (s *SourceStats) IncWeRejectedTheyAccepted() {
 	s.WeRejectedTheyAccepted.Add(1)
 }
 
+func (s *SourceStats) IncSubmitDropped() {
+	s.SubmitDropped.Add(1)
+}
+
+func (s *SourceStats) IncOutageShares() {
+	s.OutageShares.Add(1)
+}
+
+func (s *SourceStats) IncBlockCandidates() {
+	s.BlockCandidates.Add(1)
+}
+
+// IncRejectReason counts the share rejected by our validator by the reason
+func (s *SourceStats) IncRejectReason(err error) {
+	switch {
+	case errors.Is(err, validator.ErrJobNotFound):
+		s.RejectedJobNotFound.Add(1)
+	case errors.Is(err, validator.ErrDuplicateShare):
+		s.RejectedDuplicate.Add(1)
+	case errors.Is(err, validator.ErrLowDifficulty):
+		s.RejectedLowDifficulty.Add(1)
+	case errors.Is(err, validator.ErrVersionOutOfMask):
+		s.RejectedVersionMask.Add(1)
+	case errors.Is(err, validator.ErrNtimeOutOfRange):
+		s.RejectedNtime.Add(1)
+	case errors.Is(err, validator.ErrInvalidExtraNonce2Size):
+		s.RejectedExtraNonce2Size.Add(1)
+	case errors.Is(err, validator.ErrInvalidHex):
+		s.RejectedInvalidHex.Add(1)
+	}
+}
+
 func (s *SourceStats) GetStatsMap() map[string]int {
 	return map[string]int{
 		"we_accepted_shares":        int(s.WeAcceptedShares.Load()),
 		"we_rejected_shares":        int(s.WeRejectedShares.Load()),
 		"we_accepted_they_rejected": int(s.WeAcceptedTheyRejected.Load()),
 		"we_rejected_they_accepted": int(s.WeRejectedTheyAccepted.Load()),
+		"submit_dropped":            int(s.SubmitDropped.Load()),
+		"outage_shares":             int(s.OutageShares.Load()),
+		"block_candidates":          int(s.BlockCandidates.Load()),
+		"rejected_job_not_found":    int(s.RejectedJobNotFound.Load()),
+		"rejected_duplicate":        int(s.RejectedDuplicate.Load()),
+		"rejected_low_difficulty":   int(s.RejectedLowDifficulty.Load()),
+		"rejected_version_mask":     int(s.RejectedVersionMask.Load()),
+		"rejected_ntime":            int(s.RejectedNtime.Load()),
+		"rejected_extranonce2_size": int(s.RejectedExtraNonce2Size.Load()),
+		"rejected_invalid_hex":      int(s.RejectedInvalidHex.Load()),
 	}
 }
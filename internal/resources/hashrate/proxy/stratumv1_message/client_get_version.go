@@ -0,0 +1,47 @@
+package stratumv1_message
+
+import (
+	"encoding/json"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+// Message: {"id":7,"method":"client.get_version","params":[]}
+// Request from the pool, the client answers with its version string
+const MethodClientGetVersion = "client.get_version"
+
+type ClientGetVersion struct {
+	ID     int                     `json:"id"`
+	Method string                  `json:"method,omitempty"`
+	Params *clientGetVersionParams `json:"params"`
+}
+
+type clientGetVersionParams = [0]interface{}
+
+func NewClientGetVersion(id int) *ClientGetVersion {
+	return &ClientGetVersion{
+		ID:     id,
+		Method: MethodClientGetVersion,
+		Params: &clientGetVersionParams{},
+	}
+}
+
+func ParseClientGetVersion(b []byte) (*ClientGetVersion, error) {
+	m := &ClientGetVersion{}
+	return m, json.Unmarshal(b, m)
+}
+
+func (m *ClientGetVersion) GetID() int {
+	return m.ID
+}
+
+func (m *ClientGetVersion) SetID(ID int) {
+	m.ID = ID
+}
+
+func (m *ClientGetVersion) Serialize() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+var _ interfaces.MiningMessageWithID = new(ClientGetVersion)
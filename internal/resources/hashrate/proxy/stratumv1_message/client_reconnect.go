@@ -0,0 +1,81 @@
+package stratumv1_message
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+// Message: {"id":null,"method":"client.reconnect","params":["stratum.example.com",3333,0]}
+// Params are optional, if empty the client reconnects to the same host and port
+const MethodClientReconnect = "client.reconnect"
+
+type ClientReconnect struct {
+	Method string        `json:"method,omitempty"`
+	Params []interface{} `json:"params"`
+}
+
+// NewClientReconnect creates reconnect message, empty host means reconnect to the same address
+func NewClientReconnect(host string, port int, waitSeconds int) *ClientReconnect {
+	params := []interface{}{}
+	if host != "" {
+		params = append(params, host, port, waitSeconds)
+	}
+	return &ClientReconnect{
+		Method: MethodClientReconnect,
+		Params: params,
+	}
+}
+
+func ParseClientReconnect(b []byte) (*ClientReconnect, error) {
+	m := &ClientReconnect{}
+	return m, json.Unmarshal(b, m)
+}
+
+// GetHost returns the host to reconnect to, empty if the client should reconnect to the same host
+func (m *ClientReconnect) GetHost() string {
+	if len(m.Params) < 1 {
+		return ""
+	}
+	host, _ := m.Params[0].(string)
+	return host
+}
+
+// GetPort returns the port to reconnect to, 0 if not set
+func (m *ClientReconnect) GetPort() int {
+	if len(m.Params) < 2 {
+		return 0
+	}
+	return paramToInt(m.Params[1])
+}
+
+// GetWaitSeconds returns the delay before reconnecting, 0 if not set
+func (m *ClientReconnect) GetWaitSeconds() int {
+	if len(m.Params) < 3 {
+		return 0
+	}
+	return paramToInt(m.Params[2])
+}
+
+func (m *ClientReconnect) Serialize() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+var _ interfaces.MiningMessageGeneric = new(ClientReconnect)
+
+// paramToInt converts the numeric param that some pools send as a string
+func paramToInt(param interface{}) int {
+	switch v := param.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	default:
+		return 0
+	}
+}
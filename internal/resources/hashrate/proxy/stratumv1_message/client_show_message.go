@@ -0,0 +1,44 @@
+package stratumv1_message
+
+import (
+	"encoding/json"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+// Message: {"id":null,"method":"client.show_message","params":["Pool maintenance in 10 minutes"]}
+// Human-readable message from the pool that the client should display
+const MethodClientShowMessage = "client.show_message"
+
+type ClientShowMessage struct {
+	Method string                   `json:"method,omitempty"`
+	Params *clientShowMessageParams `json:"params"`
+}
+
+type clientShowMessageParams = [1]string
+
+func NewClientShowMessage(message string) *ClientShowMessage {
+	return &ClientShowMessage{
+		Method: MethodClientShowMessage,
+		Params: &clientShowMessageParams{message},
+	}
+}
+
+func ParseClientShowMessage(b []byte) (*ClientShowMessage, error) {
+	m := &ClientShowMessage{}
+	return m, json.Unmarshal(b, m)
+}
+
+func (m *ClientShowMessage) GetMessage() string {
+	if m.Params == nil {
+		return ""
+	}
+	return m.Params[0]
+}
+
+func (m *ClientShowMessage) Serialize() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+var _ interfaces.MiningMessageGeneric = new(ClientShowMessage)
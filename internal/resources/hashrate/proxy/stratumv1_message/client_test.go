@@ -0,0 +1,47 @@
+package stratumv1_message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientReconnectParams(t *testing.T) {
+	parsed, err := ParseStratumMessage([]byte(`{"id":null,"method":"client.reconnect","params":["stratum.example.com","3334",5]}`))
+	require.NoError(t, err)
+	typed := parsed.(*ClientReconnect)
+	require.Equal(t, "stratum.example.com", typed.GetHost())
+	require.Equal(t, 3334, typed.GetPort())
+	require.Equal(t, 5, typed.GetWaitSeconds())
+
+	empty := NewClientReconnect("", 0, 0)
+	require.Equal(t, "", empty.GetHost())
+	require.Equal(t, 0, empty.GetPort())
+}
+
+func TestClientShowMessage(t *testing.T) {
+	msg := []byte(`{"method":"client.show_message","params":["maintenance"]}`)
+	parsed, err := ParseStratumMessage(msg)
+	require.NoError(t, err)
+	require.IsType(t, &ClientShowMessage{}, parsed)
+	require.Equal(t, "maintenance", parsed.(*ClientShowMessage).GetMessage())
+	require.Equal(t, string(msg), string(NewClientShowMessage("maintenance").Serialize()))
+}
+
+func TestClientGetVersion(t *testing.T) {
+	msg := []byte(`{"id":7,"method":"client.get_version","params":[]}`)
+	parsed, err := ParseStratumMessage(msg)
+	require.NoError(t, err)
+	require.IsType(t, &ClientGetVersion{}, parsed)
+	require.Equal(t, 7, parsed.(*ClientGetVersion).GetID())
+	require.Equal(t, string(msg), string(NewClientGetVersion(7).Serialize()))
+}
+
+func TestMiningPing(t *testing.T) {
+	msg := []byte(`{"id":8,"method":"mining.ping","params":[]}`)
+	parsed, err := ParseStratumMessage(msg)
+	require.NoError(t, err)
+	require.IsType(t, &MiningPing{}, parsed)
+	require.Equal(t, 8, parsed.(*MiningPing).GetID())
+	require.Equal(t, `{"id":8,"result":"pong","error":null}`, string(NewMiningResultString(8, "pong").Serialize()))
+}
@@ -38,6 +38,12 @@ func ParseStratumMessage(raw []byte) (interfaces.MiningMessageGeneric, error) {
 	case MethodMiningConfigure:
 		return ParseMiningConfigure(raw)
 
+	case MethodMiningExtranonceSubscribe:
+		return ParseMiningExtranonceSubscribe(raw)
+
+	case MethodMiningPing:
+		return ParseMiningPing(raw)
+
 	// server messages
 	case MethodMiningNotify:
 		return ParseMiningNotify(raw)
@@ -51,6 +57,15 @@ func ParseStratumMessage(raw []byte) (interfaces.MiningMessageGeneric, error) {
 	case MethodMiningSetExtranonce:
 		return ParseMiningSetExtranonce(raw)
 
+	case MethodClientReconnect:
+		return ParseClientReconnect(raw)
+
+	case MethodClientShowMessage:
+		return ParseClientShowMessage(raw)
+
+	case MethodClientGetVersion:
+		return ParseClientGetVersion(raw)
+
 	default:
 		if msg.Result != nil {
 			return ParseMiningResult(raw)
@@ -83,6 +83,15 @@ func TestMiningNotify(t *testing.T) {
 	if string(msg2) != string(msg) {
 		t.Fail()
 	}
+
+	merkel := []string{}
+	for _, m := range obj.GetMerkel() {
+		merkel = append(merkel, m.(string))
+	}
+	newObj := NewMiningNotify(obj.GetJobID(), obj.GetPrevBlockHash(), obj.GetGen1(), obj.GetGen2(), merkel, obj.GetVersion(), obj.GetNbits(), obj.GetNtime(), obj.GetCleanJobs())
+	if string(newObj.Serialize()) != string(msg) {
+		t.Fatalf("NewMiningNotify")
+	}
 }
 
 func TestMiningSubmit(t *testing.T) {
@@ -0,0 +1,47 @@
+package stratumv1_message
+
+import (
+	"encoding/json"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+// Message: {"id": 3, "method": "mining.extranonce.subscribe", "params": []}
+// Signals that the miner supports mining.set_extranonce messages
+const MethodMiningExtranonceSubscribe = "mining.extranonce.subscribe"
+
+type MiningExtranonceSubscribe struct {
+	ID     int                              `json:"id"`
+	Method string                           `json:"method,omitempty"`
+	Params *miningExtranonceSubscribeParams `json:"params"`
+}
+
+type miningExtranonceSubscribeParams = [0]interface{}
+
+func NewMiningExtranonceSubscribe(id int) *MiningExtranonceSubscribe {
+	return &MiningExtranonceSubscribe{
+		ID:     id,
+		Method: MethodMiningExtranonceSubscribe,
+		Params: &miningExtranonceSubscribeParams{},
+	}
+}
+
+func ParseMiningExtranonceSubscribe(b []byte) (*MiningExtranonceSubscribe, error) {
+	m := &MiningExtranonceSubscribe{}
+	return m, json.Unmarshal(b, m)
+}
+
+func (m *MiningExtranonceSubscribe) GetID() int {
+	return m.ID
+}
+
+func (m *MiningExtranonceSubscribe) SetID(ID int) {
+	m.ID = ID
+}
+
+func (m *MiningExtranonceSubscribe) Serialize() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+var _ interfaces.MiningMessageWithID = new(MiningExtranonceSubscribe)
@@ -0,0 +1,28 @@
+package stratumv1_message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiningExtranonceSubscribe(t *testing.T) {
+	msg := []byte(`{"id":3,"method":"mining.extranonce.subscribe","params":[]}`)
+	parsed, err := ParseStratumMessage(msg)
+	require.NoError(t, err)
+	require.IsType(t, &MiningExtranonceSubscribe{}, parsed)
+
+	typed := parsed.(*MiningExtranonceSubscribe)
+	require.Equal(t, 3, typed.GetID())
+	require.Equal(t, string(msg), string(NewMiningExtranonceSubscribe(3).Serialize()))
+}
+
+func TestClientReconnect(t *testing.T) {
+	require.Equal(t, `{"method":"client.reconnect","params":[]}`, string(NewClientReconnect("", 0, 0).Serialize()))
+
+	msg := []byte(`{"method":"client.reconnect","params":["stratum.example.com",3333,5]}`)
+	parsed, err := ParseStratumMessage(msg)
+	require.NoError(t, err)
+	require.IsType(t, &ClientReconnect{}, parsed)
+	require.Equal(t, string(msg), string(NewClientReconnect("stratum.example.com", 3333, 5).Serialize()))
+}
@@ -17,6 +17,25 @@ type MiningNotify struct {
 	Params [9]json.RawMessage `json:"params"`
 }
 
+func NewMiningNotify(jobID, prevBlockHash, gen1, gen2 string, merkel []string, version, nbits, ntime string, cleanJobs bool) *MiningNotify {
+	m := &MiningNotify{
+		Method: MethodMiningNotify,
+	}
+	if merkel == nil {
+		merkel = []string{}
+	}
+	m.Params[0], _ = json.Marshal(jobID)
+	m.Params[1], _ = json.Marshal(prevBlockHash)
+	m.Params[2], _ = json.Marshal(gen1)
+	m.Params[3], _ = json.Marshal(gen2)
+	m.Params[4], _ = json.Marshal(merkel)
+	m.Params[5], _ = json.Marshal(version)
+	m.Params[6], _ = json.Marshal(nbits)
+	m.Params[7], _ = json.Marshal(ntime)
+	m.Params[8], _ = json.Marshal(cleanJobs)
+	return m
+}
+
 func ParseMiningNotify(b []byte) (*MiningNotify, error) {
 	m := &MiningNotify{}
 	return m, json.Unmarshal(b, m)
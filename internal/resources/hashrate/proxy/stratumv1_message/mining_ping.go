@@ -0,0 +1,47 @@
+package stratumv1_message
+
+import (
+	"encoding/json"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+)
+
+// Message: {"id":8,"method":"mining.ping","params":[]}
+// Liveness check, answered with {"id":8,"result":"pong","error":null}
+const MethodMiningPing = "mining.ping"
+
+type MiningPing struct {
+	ID     int               `json:"id"`
+	Method string            `json:"method,omitempty"`
+	Params *miningPingParams `json:"params"`
+}
+
+type miningPingParams = [0]interface{}
+
+func NewMiningPing(id int) *MiningPing {
+	return &MiningPing{
+		ID:     id,
+		Method: MethodMiningPing,
+		Params: &miningPingParams{},
+	}
+}
+
+func ParseMiningPing(b []byte) (*MiningPing, error) {
+	m := &MiningPing{}
+	return m, json.Unmarshal(b, m)
+}
+
+func (m *MiningPing) GetID() int {
+	return m.ID
+}
+
+func (m *MiningPing) SetID(ID int) {
+	m.ID = ID
+}
+
+func (m *MiningPing) Serialize() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+var _ interfaces.MiningMessageWithID = new(MiningPing)
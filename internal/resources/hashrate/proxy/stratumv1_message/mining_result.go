@@ -61,6 +61,29 @@ func NewMiningResultDuplicatedShare(ID int) *MiningResult {
 	}
 }
 
+// NewMiningResultInvalidShare creates the "Other/Unknown" error for the share rejected with the reason
+func NewMiningResultInvalidShare(ID int, reason string) *MiningResult {
+	msg, _ := json.Marshal(reason)
+	return &MiningResult{
+		ID: ID,
+		Error: MiningResultError{
+			json.RawMessage(`"20"`),
+			json.RawMessage(msg),
+		},
+	}
+}
+
+// NewMiningResultUnsupportedMethod creates the error result for the request that is not handled
+func NewMiningResultUnsupportedMethod(ID int) *MiningResult {
+	return &MiningResult{
+		ID: ID,
+		Error: MiningResultError{
+			json.RawMessage(`"20"`),
+			json.RawMessage(`"Unsupported method"`),
+		},
+	}
+}
+
 func NewMiningResultFalse(ID int) *MiningResult {
 	return &MiningResult{
 		ID:     ID,
@@ -68,6 +91,15 @@ func NewMiningResultFalse(ID int) *MiningResult {
 	}
 }
 
+// NewMiningResultString creates result with string value, e.g. version or "pong"
+func NewMiningResultString(ID int, result string) *MiningResult {
+	b, _ := json.Marshal(result)
+	return &MiningResult{
+		ID:     ID,
+		Result: b,
+	}
+}
+
 func (m *MiningResult) GetID() int {
 	return m.ID
 }
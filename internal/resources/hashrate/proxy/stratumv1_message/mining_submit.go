@@ -37,7 +37,7 @@ func (m *MiningSubmit) SetID(ID int) {
 }
 
 func (m *MiningSubmit) GetUserName() string {
-	return m.Params[0]
+	return m.getParam(0)
 }
 
 func (m *MiningSubmit) SetUserName(name string) {
@@ -45,11 +45,15 @@ func (m *MiningSubmit) SetUserName(name string) {
 }
 
 func (m *MiningSubmit) GetJobId() string {
-	return m.Params[1]
+	return m.getParam(1)
+}
+
+func (m *MiningSubmit) SetJobId(jobID string) {
+	m.Params[1] = jobID
 }
 
 func (m *MiningSubmit) GetExtraNonce2() string {
-	return m.Params[2]
+	return m.getParam(2)
 }
 
 func (m *MiningSubmit) SetExtraNonce2(xnonce2 string) {
@@ -57,11 +61,11 @@ func (m *MiningSubmit) SetExtraNonce2(xnonce2 string) {
 }
 
 func (m *MiningSubmit) GetNtime() string {
-	return m.Params[3]
+	return m.getParam(3)
 }
 
 func (m *MiningSubmit) GetNonce() string {
-	return m.Params[4]
+	return m.getParam(4)
 }
 
 func (m *MiningSubmit) GetVmask() string {
@@ -71,6 +75,14 @@ func (m *MiningSubmit) GetVmask() string {
 	return m.Params[5]
 }
 
+// getParam returns empty string for the missing param of the malformed submit
+func (m *MiningSubmit) getParam(i int) string {
+	if i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
 func (m *MiningSubmit) Serialize() []byte {
 	b, _ := json.Marshal(m)
 	return b
@@ -0,0 +1,20 @@
+package stratumv1_message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiningSubmitShortParams(t *testing.T) {
+	msgParsed, err := ParseStratumMessage([]byte(`{"id":4,"method":"mining.submit","params":["worker","620daf25f"]}`))
+	require.NoError(t, err)
+
+	msg := msgParsed.(*MiningSubmit)
+	require.Equal(t, "worker", msg.GetUserName())
+	require.Equal(t, "620daf25f", msg.GetJobId())
+	require.Equal(t, "", msg.GetExtraNonce2())
+	require.Equal(t, "", msg.GetNtime())
+	require.Equal(t, "", msg.GetNonce())
+	require.Equal(t, "00000000", msg.GetVmask())
+}
@@ -13,6 +13,8 @@ type MiningSubscribe struct {
 	ID     int                    `json:"id"`
 	Method string                 `json:"method,omitempty"`
 	Params *miningSubscribeParams `json:"params"`
+
+	omitParams int // number of trailing params that are not serialized
 }
 
 type miningSubscribeParams = [2]string
@@ -56,8 +58,27 @@ func (m *MiningSubscribe) SetWorkerNumber(name string) {
 	m.Params[1] = name
 }
 
+// KeepParams limits serialized params to the first n, for the pools that don't accept all of them
+func (m *MiningSubscribe) KeepParams(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(m.Params) {
+		n = len(m.Params)
+	}
+	m.omitParams = len(m.Params) - n
+}
+
 func (m *MiningSubscribe) Serialize() []byte {
-	b, _ := json.Marshal(m)
+	if m.omitParams == 0 || m.Params == nil {
+		b, _ := json.Marshal(m)
+		return b
+	}
+	b, _ := json.Marshal(&struct {
+		ID     int      `json:"id"`
+		Method string   `json:"method,omitempty"`
+		Params []string `json:"params"`
+	}{m.ID, m.Method, m.Params[:len(m.Params)-m.omitParams]})
 	return b
 }
 
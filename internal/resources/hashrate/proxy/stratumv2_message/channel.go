@@ -0,0 +1,130 @@
+package stratumv2_message
+
+type UpdateChannel struct {
+	ChannelID       uint32
+	NominalHashRate float32
+	MaximumTarget   [32]byte
+}
+
+func ParseUpdateChannel(b []byte) (*UpdateChannel, error) {
+	d := newDecoder(b)
+	m := &UpdateChannel{
+		ChannelID:       d.U32(),
+		NominalHashRate: d.F32(),
+		MaximumTarget:   d.U256(),
+	}
+	return m, d.Err()
+}
+
+func (m *UpdateChannel) MsgType() uint8     { return MsgTypeUpdateChannel }
+func (m *UpdateChannel) IsChannelMsg() bool { return true }
+
+func (m *UpdateChannel) SerializePayload() []byte {
+	e := newEncoder(40)
+	e.U32(m.ChannelID)
+	e.F32(m.NominalHashRate)
+	e.U256(m.MaximumTarget)
+	return e.Bytes()
+}
+
+type CloseChannel struct {
+	ChannelID  uint32
+	ReasonCode string
+}
+
+func ParseCloseChannel(b []byte) (*CloseChannel, error) {
+	d := newDecoder(b)
+	m := &CloseChannel{
+		ChannelID:  d.U32(),
+		ReasonCode: d.Str0_255(),
+	}
+	return m, d.Err()
+}
+
+func (m *CloseChannel) MsgType() uint8     { return MsgTypeCloseChannel }
+func (m *CloseChannel) IsChannelMsg() bool { return true }
+
+func (m *CloseChannel) SerializePayload() []byte {
+	e := newEncoder(32)
+	e.U32(m.ChannelID)
+	e.Str0_255(m.ReasonCode)
+	return e.Bytes()
+}
+
+type SetExtranoncePrefix struct {
+	ChannelID        uint32
+	ExtranoncePrefix []byte
+}
+
+func ParseSetExtranoncePrefix(b []byte) (*SetExtranoncePrefix, error) {
+	d := newDecoder(b)
+	m := &SetExtranoncePrefix{
+		ChannelID:        d.U32(),
+		ExtranoncePrefix: d.B0_32(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetExtranoncePrefix) MsgType() uint8     { return MsgTypeSetExtranoncePrefix }
+func (m *SetExtranoncePrefix) IsChannelMsg() bool { return true }
+
+func (m *SetExtranoncePrefix) SerializePayload() []byte {
+	e := newEncoder(40)
+	e.U32(m.ChannelID)
+	e.B0_32(m.ExtranoncePrefix)
+	return e.Bytes()
+}
+
+type SetTarget struct {
+	ChannelID     uint32
+	MaximumTarget [32]byte
+}
+
+func ParseSetTarget(b []byte) (*SetTarget, error) {
+	d := newDecoder(b)
+	m := &SetTarget{
+		ChannelID:     d.U32(),
+		MaximumTarget: d.U256(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetTarget) MsgType() uint8     { return MsgTypeSetTarget }
+func (m *SetTarget) IsChannelMsg() bool { return true }
+
+func (m *SetTarget) SerializePayload() []byte {
+	e := newEncoder(36)
+	e.U32(m.ChannelID)
+	e.U256(m.MaximumTarget)
+	return e.Bytes()
+}
+
+type Reconnect struct {
+	NewHost string
+	NewPort uint16
+}
+
+func ParseReconnect(b []byte) (*Reconnect, error) {
+	d := newDecoder(b)
+	m := &Reconnect{
+		NewHost: d.Str0_255(),
+		NewPort: d.U16(),
+	}
+	return m, d.Err()
+}
+
+func (m *Reconnect) MsgType() uint8     { return MsgTypeReconnect }
+func (m *Reconnect) IsChannelMsg() bool { return false }
+
+func (m *Reconnect) SerializePayload() []byte {
+	e := newEncoder(32)
+	e.Str0_255(m.NewHost)
+	e.U16(m.NewPort)
+	return e.Bytes()
+}
+
+var _ Message = new(UpdateChannel)
+var _ Message = new(CloseChannel)
+var _ Message = new(SetExtranoncePrefix)
+var _ Message = new(SetTarget)
+var _ Message = new(Reconnect)
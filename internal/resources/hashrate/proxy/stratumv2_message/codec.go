@@ -0,0 +1,248 @@
+package stratumv2_message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Binary encoding of the Stratum V2 data types as described in
+// https://github.com/stratum-mining/sv2-spec/blob/main/03-Protocol-Overview.md#31-data-types-mapping
+// All the integers are little-endian.
+
+var (
+	ErrStratumV2Decode = errors.New("cannot decode stratumv2 message")
+)
+
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(size int) *encoder {
+	return &encoder{buf: make([]byte, 0, size)}
+}
+
+func (e *encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *encoder) Bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) U8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) U16(v uint16) {
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, v)
+}
+
+func (e *encoder) U24(v uint32) {
+	e.buf = append(e.buf, byte(v), byte(v>>8), byte(v>>16))
+}
+
+func (e *encoder) U32(v uint32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) U64(v uint64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) F32(v float32) {
+	e.U32(math.Float32bits(v))
+}
+
+func (e *encoder) U256(v [32]byte) {
+	e.buf = append(e.buf, v[:]...)
+}
+
+// Str0_255 encodes string with 1 byte length prefix, string is truncated if it is longer than 255 bytes
+func (e *encoder) Str0_255(v string) {
+	e.B0_255([]byte(v))
+}
+
+func (e *encoder) B0_32(v []byte) {
+	if len(v) > 32 {
+		v = v[:32]
+	}
+	e.U8(uint8(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) B0_255(v []byte) {
+	if len(v) > math.MaxUint8 {
+		v = v[:math.MaxUint8]
+	}
+	e.U8(uint8(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) B0_64K(v []byte) {
+	if len(v) > math.MaxUint16 {
+		v = v[:math.MaxUint16]
+	}
+	e.U16(uint16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) Seq0_255U256(v [][32]byte) {
+	if len(v) > math.MaxUint8 {
+		v = v[:math.MaxUint8]
+	}
+	e.U8(uint8(len(v)))
+	for _, item := range v {
+		e.U256(item)
+	}
+}
+
+// OptionU32 encodes optional value as a sequence of 0 or 1 elements
+func (e *encoder) OptionU32(v *uint32) {
+	if v == nil {
+		e.U8(0)
+		return
+	}
+	e.U8(1)
+	e.U32(*v)
+}
+
+// decoder reads values sequentially, the first error is sticky and returned by Err()
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func newDecoder(b []byte) *decoder {
+	return &decoder{buf: b}
+}
+
+func (d *decoder) Err() error {
+	return d.err
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if d.pos+n > len(d.buf) {
+		d.err = fmt.Errorf("%w: unexpected end of payload, need %d bytes at offset %d, have %d", ErrStratumV2Decode, n, d.pos, len(d.buf))
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) Bool() bool {
+	return d.U8() == 1
+}
+
+func (d *decoder) U8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) U16() uint16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *decoder) U24() uint32 {
+	b := d.next(3)
+	if b == nil {
+		return 0
+	}
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func (d *decoder) U32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) U64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) F32() float32 {
+	return math.Float32frombits(d.U32())
+}
+
+func (d *decoder) U256() (v [32]byte) {
+	b := d.next(32)
+	copy(v[:], b)
+	return v
+}
+
+func (d *decoder) Str0_255() string {
+	return string(d.B0_255())
+}
+
+func (d *decoder) B0_32() []byte {
+	l := int(d.U8())
+	if l > 32 {
+		d.err = fmt.Errorf("%w: B0_32 length %d exceeds 32", ErrStratumV2Decode, l)
+		return nil
+	}
+	return d.copyNext(l)
+}
+
+func (d *decoder) B0_255() []byte {
+	return d.copyNext(int(d.U8()))
+}
+
+func (d *decoder) B0_64K() []byte {
+	return d.copyNext(int(d.U16()))
+}
+
+func (d *decoder) Seq0_255U256() [][32]byte {
+	l := int(d.U8())
+	res := make([][32]byte, 0, l)
+	for i := 0; i < l; i++ {
+		res = append(res, d.U256())
+	}
+	return res
+}
+
+func (d *decoder) OptionU32() *uint32 {
+	switch d.U8() {
+	case 0:
+		return nil
+	case 1:
+		v := d.U32()
+		return &v
+	default:
+		d.err = fmt.Errorf("%w: invalid option length", ErrStratumV2Decode)
+		return nil
+	}
+}
+
+func (d *decoder) copyNext(n int) []byte {
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	res := make([]byte, n)
+	copy(res, b)
+	return res
+}
@@ -0,0 +1,153 @@
+package stratumv2_message
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+const (
+	FRAME_HEADER_SIZE  = 6
+	MAX_PAYLOAD_SIZE   = 1<<24 - 1
+	MAX_FRAME_SIZE     = 1 << 18 // accepted payload size, the largest message (extended job with 64K coinbase parts) is ~140K
+	CHANNEL_MSG_BIT    = 0x8000
+	EXTENSION_TYPE_STD = 0x0000
+)
+
+var (
+	ErrFrameTooLarge = errors.New("stratumv2 frame too large")
+)
+
+// FrameHeader is the header of every Stratum V2 message
+//
+//	extension_type U16, the highest bit is the channel_msg flag
+//	msg_type       U8
+//	msg_length     U24
+type FrameHeader struct {
+	ExtensionType uint16
+	MsgType       uint8
+	MsgLength     uint32
+}
+
+func (h FrameHeader) IsChannelMsg() bool {
+	return h.ExtensionType&CHANNEL_MSG_BIT != 0
+}
+
+func (h FrameHeader) Serialize() []byte {
+	e := newEncoder(FRAME_HEADER_SIZE)
+	e.U16(h.ExtensionType)
+	e.U8(h.MsgType)
+	e.U24(h.MsgLength)
+	return e.Bytes()
+}
+
+func ParseFrameHeader(b []byte) (FrameHeader, error) {
+	d := newDecoder(b)
+	h := FrameHeader{
+		ExtensionType: d.U16(),
+		MsgType:       d.U8(),
+		MsgLength:     d.U24(),
+	}
+	if err := d.Err(); err != nil {
+		return h, err
+	}
+	// checked before the payload is allocated
+	if h.MsgLength > MAX_FRAME_SIZE {
+		return h, lib.WrapError(ErrFrameTooLarge, fmt.Errorf("%d bytes", h.MsgLength))
+	}
+	return h, nil
+}
+
+// Frame is a single Stratum V2 message with undecoded payload
+type Frame struct {
+	Header  FrameHeader
+	Payload []byte
+}
+
+func NewFrame(msg Message) *Frame {
+	payload := msg.SerializePayload()
+	ext := uint16(EXTENSION_TYPE_STD)
+	if msg.IsChannelMsg() {
+		ext |= CHANNEL_MSG_BIT
+	}
+	return &Frame{
+		Header: FrameHeader{
+			ExtensionType: ext,
+			MsgType:       msg.MsgType(),
+			MsgLength:     uint32(len(payload)),
+		},
+		Payload: payload,
+	}
+}
+
+func (f *Frame) Serialize() []byte {
+	return append(f.Header.Serialize(), f.Payload...)
+}
+
+// ReadFrame reads single plaintext frame from the reader
+func ReadFrame(r io.Reader) (*Frame, error) {
+	headerBytes := make([]byte, FRAME_HEADER_SIZE)
+	_, err := io.ReadFull(r, headerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ParseFrameHeader(headerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, header.MsgLength)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frame{Header: header, Payload: payload}, nil
+}
+
+// WriteFrame writes single plaintext frame to the writer
+func WriteFrame(w io.Writer, f *Frame) error {
+	if len(f.Payload) > MAX_PAYLOAD_SIZE {
+		return fmt.Errorf("frame payload too large: %d", len(f.Payload))
+	}
+	_, err := w.Write(f.Serialize())
+	return err
+}
+
+// FrameReadWriter is implemented by both plaintext and encrypted (noise) connections
+type FrameReadWriter interface {
+	ReadFrame() (*Frame, error)
+	WriteFrame(f *Frame) error
+}
+
+// FrameConn is a FrameReadWriter that owns the underlying connection
+type FrameConn interface {
+	FrameReadWriter
+	io.Closer
+}
+
+// PlainFrameConn is an unencrypted FrameReadWriter
+type PlainFrameConn struct {
+	rw io.ReadWriteCloser
+}
+
+func NewPlainFrameConn(rw io.ReadWriteCloser) *PlainFrameConn {
+	return &PlainFrameConn{rw: rw}
+}
+
+func (c *PlainFrameConn) ReadFrame() (*Frame, error) {
+	return ReadFrame(c.rw)
+}
+
+func (c *PlainFrameConn) WriteFrame(f *Frame) error {
+	return WriteFrame(c.rw, f)
+}
+
+func (c *PlainFrameConn) Close() error {
+	return c.rw.Close()
+}
+
+var _ FrameConn = new(PlainFrameConn)
@@ -0,0 +1,122 @@
+package stratumv2_message
+
+// NewMiningJob is sent to the standard channels, the merkle root is precomputed by upstream.
+// If MinNtime is empty the job is a future job and becomes active after SetNewPrevHash
+type NewMiningJob struct {
+	ChannelID  uint32
+	JobID      uint32
+	MinNtime   *uint32
+	Version    uint32
+	MerkleRoot [32]byte
+}
+
+func ParseNewMiningJob(b []byte) (*NewMiningJob, error) {
+	d := newDecoder(b)
+	m := &NewMiningJob{
+		ChannelID: d.U32(),
+		JobID:     d.U32(),
+		MinNtime:  d.OptionU32(),
+		Version:   d.U32(),
+	}
+	copy(m.MerkleRoot[:], d.B0_32())
+	return m, d.Err()
+}
+
+func (m *NewMiningJob) MsgType() uint8     { return MsgTypeNewMiningJob }
+func (m *NewMiningJob) IsChannelMsg() bool { return true }
+
+func (m *NewMiningJob) IsFutureJob() bool { return m.MinNtime == nil }
+
+func (m *NewMiningJob) SerializePayload() []byte {
+	e := newEncoder(52)
+	e.U32(m.ChannelID)
+	e.U32(m.JobID)
+	e.OptionU32(m.MinNtime)
+	e.U32(m.Version)
+	e.B0_32(m.MerkleRoot[:])
+	return e.Bytes()
+}
+
+// NewExtendedMiningJob is sent to the extended and group channels. Coinbase prefix and suffix
+// contain the coinbase transaction without the extranonce (prefix + extranonce + suffix)
+type NewExtendedMiningJob struct {
+	ChannelID             uint32
+	JobID                 uint32
+	MinNtime              *uint32
+	Version               uint32
+	VersionRollingAllowed bool
+	MerklePath            [][32]byte
+	CoinbaseTxPrefix      []byte
+	CoinbaseTxSuffix      []byte
+}
+
+func ParseNewExtendedMiningJob(b []byte) (*NewExtendedMiningJob, error) {
+	d := newDecoder(b)
+	m := &NewExtendedMiningJob{
+		ChannelID:             d.U32(),
+		JobID:                 d.U32(),
+		MinNtime:              d.OptionU32(),
+		Version:               d.U32(),
+		VersionRollingAllowed: d.Bool(),
+		MerklePath:            d.Seq0_255U256(),
+		CoinbaseTxPrefix:      d.B0_64K(),
+		CoinbaseTxSuffix:      d.B0_64K(),
+	}
+	return m, d.Err()
+}
+
+func (m *NewExtendedMiningJob) MsgType() uint8     { return MsgTypeNewExtendedMiningJob }
+func (m *NewExtendedMiningJob) IsChannelMsg() bool { return true }
+
+func (m *NewExtendedMiningJob) IsFutureJob() bool { return m.MinNtime == nil }
+
+func (m *NewExtendedMiningJob) SerializePayload() []byte {
+	e := newEncoder(64 + 32*len(m.MerklePath) + len(m.CoinbaseTxPrefix) + len(m.CoinbaseTxSuffix))
+	e.U32(m.ChannelID)
+	e.U32(m.JobID)
+	e.OptionU32(m.MinNtime)
+	e.U32(m.Version)
+	e.Bool(m.VersionRollingAllowed)
+	e.Seq0_255U256(m.MerklePath)
+	e.B0_64K(m.CoinbaseTxPrefix)
+	e.B0_64K(m.CoinbaseTxSuffix)
+	return e.Bytes()
+}
+
+// SetNewPrevHash activates the future job with JobID. PrevHash is in the block header byte order
+type SetNewPrevHash struct {
+	ChannelID uint32
+	JobID     uint32
+	PrevHash  [32]byte
+	MinNtime  uint32
+	Nbits     uint32
+}
+
+func ParseSetNewPrevHash(b []byte) (*SetNewPrevHash, error) {
+	d := newDecoder(b)
+	m := &SetNewPrevHash{
+		ChannelID: d.U32(),
+		JobID:     d.U32(),
+		PrevHash:  d.U256(),
+		MinNtime:  d.U32(),
+		Nbits:     d.U32(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetNewPrevHash) MsgType() uint8     { return MsgTypeSetNewPrevHash }
+func (m *SetNewPrevHash) IsChannelMsg() bool { return true }
+
+func (m *SetNewPrevHash) SerializePayload() []byte {
+	e := newEncoder(52)
+	e.U32(m.ChannelID)
+	e.U32(m.JobID)
+	e.U256(m.PrevHash)
+	e.U32(m.MinNtime)
+	e.U32(m.Nbits)
+	return e.Bytes()
+}
+
+var _ Message = new(NewMiningJob)
+var _ Message = new(NewExtendedMiningJob)
+var _ Message = new(SetNewPrevHash)
@@ -0,0 +1,109 @@
+package stratumv2_message
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+var (
+	ErrStratumV2Unknown = errors.New("unknown stratumv2 message")
+)
+
+// Message types of the common and mining subprotocols
+// https://github.com/stratum-mining/sv2-spec/blob/main/08-Message-Types.md
+const (
+	MsgTypeSetupConnection                  uint8 = 0x00
+	MsgTypeSetupConnectionSuccess           uint8 = 0x01
+	MsgTypeSetupConnectionError             uint8 = 0x02
+	MsgTypeChannelEndpointChanged           uint8 = 0x03
+	MsgTypeOpenStandardMiningChannel        uint8 = 0x10
+	MsgTypeOpenStandardMiningChannelSuccess uint8 = 0x11
+	MsgTypeOpenMiningChannelError           uint8 = 0x12
+	MsgTypeOpenExtendedMiningChannel        uint8 = 0x13
+	MsgTypeOpenExtendedMiningChannelSuccess uint8 = 0x14
+	MsgTypeNewMiningJob                     uint8 = 0x15
+	MsgTypeUpdateChannel                    uint8 = 0x16
+	MsgTypeUpdateChannelError               uint8 = 0x17
+	MsgTypeCloseChannel                     uint8 = 0x18
+	MsgTypeSetExtranoncePrefix              uint8 = 0x19
+	MsgTypeSubmitSharesStandard             uint8 = 0x1a
+	MsgTypeSubmitSharesExtended             uint8 = 0x1b
+	MsgTypeSubmitSharesSuccess              uint8 = 0x1c
+	MsgTypeSubmitSharesError                uint8 = 0x1d
+	MsgTypeNewExtendedMiningJob             uint8 = 0x1f
+	MsgTypeSetNewPrevHash                   uint8 = 0x20
+	MsgTypeSetTarget                        uint8 = 0x21
+	MsgTypeReconnect                        uint8 = 0x25
+)
+
+// Message is a decoded Stratum V2 message
+type Message interface {
+	MsgType() uint8
+	IsChannelMsg() bool
+	SerializePayload() []byte
+}
+
+// ParseStratumV2Message decodes frame payload into the typed message
+func ParseStratumV2Message(f *Frame) (Message, error) {
+	if f.Header.ExtensionType&^CHANNEL_MSG_BIT != EXTENSION_TYPE_STD {
+		return nil, lib.WrapError(ErrStratumV2Unknown, fmt.Errorf("extension type %d", f.Header.ExtensionType))
+	}
+
+	var (
+		msg Message
+		err error
+	)
+
+	switch f.Header.MsgType {
+	case MsgTypeSetupConnection:
+		msg, err = ParseSetupConnection(f.Payload)
+	case MsgTypeSetupConnectionSuccess:
+		msg, err = ParseSetupConnectionSuccess(f.Payload)
+	case MsgTypeSetupConnectionError:
+		msg, err = ParseSetupConnectionError(f.Payload)
+	case MsgTypeOpenStandardMiningChannel:
+		msg, err = ParseOpenStandardMiningChannel(f.Payload)
+	case MsgTypeOpenStandardMiningChannelSuccess:
+		msg, err = ParseOpenStandardMiningChannelSuccess(f.Payload)
+	case MsgTypeOpenMiningChannelError:
+		msg, err = ParseOpenMiningChannelError(f.Payload)
+	case MsgTypeOpenExtendedMiningChannel:
+		msg, err = ParseOpenExtendedMiningChannel(f.Payload)
+	case MsgTypeOpenExtendedMiningChannelSuccess:
+		msg, err = ParseOpenExtendedMiningChannelSuccess(f.Payload)
+	case MsgTypeNewMiningJob:
+		msg, err = ParseNewMiningJob(f.Payload)
+	case MsgTypeNewExtendedMiningJob:
+		msg, err = ParseNewExtendedMiningJob(f.Payload)
+	case MsgTypeSetNewPrevHash:
+		msg, err = ParseSetNewPrevHash(f.Payload)
+	case MsgTypeSetTarget:
+		msg, err = ParseSetTarget(f.Payload)
+	case MsgTypeUpdateChannel:
+		msg, err = ParseUpdateChannel(f.Payload)
+	case MsgTypeCloseChannel:
+		msg, err = ParseCloseChannel(f.Payload)
+	case MsgTypeSetExtranoncePrefix:
+		msg, err = ParseSetExtranoncePrefix(f.Payload)
+	case MsgTypeSubmitSharesStandard:
+		msg, err = ParseSubmitSharesStandard(f.Payload)
+	case MsgTypeSubmitSharesExtended:
+		msg, err = ParseSubmitSharesExtended(f.Payload)
+	case MsgTypeSubmitSharesSuccess:
+		msg, err = ParseSubmitSharesSuccess(f.Payload)
+	case MsgTypeSubmitSharesError:
+		msg, err = ParseSubmitSharesError(f.Payload)
+	case MsgTypeReconnect:
+		msg, err = ParseReconnect(f.Payload)
+	default:
+		return nil, lib.WrapError(ErrStratumV2Unknown, fmt.Errorf("msg type 0x%02x", f.Header.MsgType))
+	}
+
+	if err != nil {
+		return nil, lib.WrapError(ErrStratumV2Decode, fmt.Errorf("msg type 0x%02x: %w", f.Header.MsgType, err))
+	}
+
+	return msg, nil
+}
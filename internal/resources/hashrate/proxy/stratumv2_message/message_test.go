@@ -0,0 +1,74 @@
+package stratumv2_message
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundtrip(t *testing.T) {
+	minNtime := uint32(1690000000)
+	messages := []Message{
+		&SetupConnection{
+			Protocol:     ProtocolMining,
+			MinVersion:   2,
+			MaxVersion:   2,
+			Flags:        FlagRequiresStandardJobs | FlagRequiresVersionRolling,
+			EndpointHost: "0.0.0.0",
+			EndpointPort: 3336,
+			Vendor:       "Bitmain",
+			DeviceID:     "some-device-id",
+		},
+		&SetupConnectionSuccess{UsedVersion: 2, Flags: 0},
+		&OpenStandardMiningChannel{RequestID: 1, UserIdentity: "account.worker", NominalHashRate: 100e12, MaxTarget: DifficultyToTarget(1)},
+		&OpenStandardMiningChannelSuccess{RequestID: 1, ChannelID: 7, Target: DifficultyToTarget(1024), ExtranoncePrefix: []byte{1, 2, 3, 4}},
+		&OpenExtendedMiningChannelSuccess{RequestID: 1, ChannelID: 7, Target: DifficultyToTarget(1024), ExtranonceSize: 8, ExtranoncePrefix: []byte{1, 2, 3, 4}},
+		&NewMiningJob{ChannelID: 7, JobID: 3, MinNtime: &minNtime, Version: 0x20000000, MerkleRoot: [32]byte{1, 2, 3}},
+		&NewMiningJob{ChannelID: 7, JobID: 4, Version: 0x20000000},
+		&NewExtendedMiningJob{ChannelID: 7, JobID: 3, Version: 0x20000000, VersionRollingAllowed: true, MerklePath: [][32]byte{{1}, {2}}, CoinbaseTxPrefix: []byte{1, 2}, CoinbaseTxSuffix: []byte{3, 4}},
+		&SetNewPrevHash{ChannelID: 7, JobID: 4, PrevHash: [32]byte{0xaa}, MinNtime: minNtime, Nbits: 0x17056102},
+		&SetTarget{ChannelID: 7, MaximumTarget: DifficultyToTarget(2048)},
+		&SubmitSharesStandard{ChannelID: 7, SequenceNumber: 10, JobID: 3, Nonce: 0x591d28da, Ntime: minNtime, Version: 0x20092000},
+		&SubmitSharesExtended{SubmitSharesStandard: SubmitSharesStandard{ChannelID: 7, SequenceNumber: 11}, Extranonce: []byte{0, 0, 0, 1}},
+		&SubmitSharesSuccess{ChannelID: 7, LastSequenceNumber: 10, NewSubmitsAcceptedCount: 1, NewSharesSum: 1024},
+		&SubmitSharesError{ChannelID: 7, SequenceNumber: 10, ErrorCode: ErrCodeDifficultyTooLow},
+		&Reconnect{NewHost: "pool.example.com", NewPort: 3336},
+	}
+
+	for _, msg := range messages {
+		buf := new(bytes.Buffer)
+		err := WriteFrame(buf, NewFrame(msg))
+		require.NoError(t, err)
+
+		frame, err := ReadFrame(buf)
+		require.NoError(t, err)
+		require.Equal(t, msg.IsChannelMsg(), frame.Header.IsChannelMsg())
+
+		parsed, err := ParseStratumV2Message(frame)
+		require.NoError(t, err)
+		require.Equal(t, msg, parsed)
+	}
+}
+
+func TestParseTruncatedPayload(t *testing.T) {
+	frame := NewFrame(&SubmitSharesStandard{ChannelID: 1})
+	frame.Payload = frame.Payload[:10]
+
+	_, err := ParseStratumV2Message(frame)
+	require.ErrorIs(t, err, ErrStratumV2Decode)
+}
+
+func TestDifficultyToTarget(t *testing.T) {
+	for _, diff := range []float64{1, 1024, 699, 65536, 1e9} {
+		actual := TargetToDifficulty(DifficultyToTarget(diff))
+		require.InEpsilon(t, diff, actual, 1e-9)
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	header := FrameHeader{MsgType: MsgTypeNewExtendedMiningJob, MsgLength: MAX_PAYLOAD_SIZE}
+	// payload is not sent, the frame must be rejected by the header
+	_, err := ReadFrame(bytes.NewReader(header.Serialize()))
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+}
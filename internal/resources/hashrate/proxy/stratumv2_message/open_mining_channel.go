@@ -0,0 +1,169 @@
+package stratumv2_message
+
+const (
+	ErrCodeUnknownUser       = "unknown-user"
+	ErrCodeMaxTargetOutOfRng = "max-target-out-of-range"
+)
+
+type OpenStandardMiningChannel struct {
+	RequestID       uint32
+	UserIdentity    string
+	NominalHashRate float32 // hashes per second
+	MaxTarget       [32]byte
+}
+
+func ParseOpenStandardMiningChannel(b []byte) (*OpenStandardMiningChannel, error) {
+	d := newDecoder(b)
+	m := &OpenStandardMiningChannel{
+		RequestID:       d.U32(),
+		UserIdentity:    d.Str0_255(),
+		NominalHashRate: d.F32(),
+		MaxTarget:       d.U256(),
+	}
+	return m, d.Err()
+}
+
+func (m *OpenStandardMiningChannel) MsgType() uint8     { return MsgTypeOpenStandardMiningChannel }
+func (m *OpenStandardMiningChannel) IsChannelMsg() bool { return false }
+
+func (m *OpenStandardMiningChannel) SerializePayload() []byte {
+	e := newEncoder(96)
+	e.U32(m.RequestID)
+	e.Str0_255(m.UserIdentity)
+	e.F32(m.NominalHashRate)
+	e.U256(m.MaxTarget)
+	return e.Bytes()
+}
+
+type OpenStandardMiningChannelSuccess struct {
+	RequestID        uint32
+	ChannelID        uint32
+	Target           [32]byte
+	ExtranoncePrefix []byte
+	GroupChannelID   uint32
+}
+
+func ParseOpenStandardMiningChannelSuccess(b []byte) (*OpenStandardMiningChannelSuccess, error) {
+	d := newDecoder(b)
+	m := &OpenStandardMiningChannelSuccess{
+		RequestID:        d.U32(),
+		ChannelID:        d.U32(),
+		Target:           d.U256(),
+		ExtranoncePrefix: d.B0_32(),
+		GroupChannelID:   d.U32(),
+	}
+	return m, d.Err()
+}
+
+func (m *OpenStandardMiningChannelSuccess) MsgType() uint8 {
+	return MsgTypeOpenStandardMiningChannelSuccess
+}
+func (m *OpenStandardMiningChannelSuccess) IsChannelMsg() bool { return false }
+
+func (m *OpenStandardMiningChannelSuccess) SerializePayload() []byte {
+	e := newEncoder(96)
+	e.U32(m.RequestID)
+	e.U32(m.ChannelID)
+	e.U256(m.Target)
+	e.B0_32(m.ExtranoncePrefix)
+	e.U32(m.GroupChannelID)
+	return e.Bytes()
+}
+
+type OpenExtendedMiningChannel struct {
+	RequestID        uint32
+	UserIdentity     string
+	NominalHashRate  float32
+	MaxTarget        [32]byte
+	MinExtranonceLen uint16
+}
+
+func ParseOpenExtendedMiningChannel(b []byte) (*OpenExtendedMiningChannel, error) {
+	d := newDecoder(b)
+	m := &OpenExtendedMiningChannel{
+		RequestID:        d.U32(),
+		UserIdentity:     d.Str0_255(),
+		NominalHashRate:  d.F32(),
+		MaxTarget:        d.U256(),
+		MinExtranonceLen: d.U16(),
+	}
+	return m, d.Err()
+}
+
+func (m *OpenExtendedMiningChannel) MsgType() uint8     { return MsgTypeOpenExtendedMiningChannel }
+func (m *OpenExtendedMiningChannel) IsChannelMsg() bool { return false }
+
+func (m *OpenExtendedMiningChannel) SerializePayload() []byte {
+	e := newEncoder(96)
+	e.U32(m.RequestID)
+	e.Str0_255(m.UserIdentity)
+	e.F32(m.NominalHashRate)
+	e.U256(m.MaxTarget)
+	e.U16(m.MinExtranonceLen)
+	return e.Bytes()
+}
+
+type OpenExtendedMiningChannelSuccess struct {
+	RequestID        uint32
+	ChannelID        uint32
+	Target           [32]byte
+	ExtranonceSize   uint16 // number of bytes the downstream is allowed to roll
+	ExtranoncePrefix []byte
+}
+
+func ParseOpenExtendedMiningChannelSuccess(b []byte) (*OpenExtendedMiningChannelSuccess, error) {
+	d := newDecoder(b)
+	m := &OpenExtendedMiningChannelSuccess{
+		RequestID:        d.U32(),
+		ChannelID:        d.U32(),
+		Target:           d.U256(),
+		ExtranonceSize:   d.U16(),
+		ExtranoncePrefix: d.B0_32(),
+	}
+	return m, d.Err()
+}
+
+func (m *OpenExtendedMiningChannelSuccess) MsgType() uint8 {
+	return MsgTypeOpenExtendedMiningChannelSuccess
+}
+func (m *OpenExtendedMiningChannelSuccess) IsChannelMsg() bool { return false }
+
+func (m *OpenExtendedMiningChannelSuccess) SerializePayload() []byte {
+	e := newEncoder(96)
+	e.U32(m.RequestID)
+	e.U32(m.ChannelID)
+	e.U256(m.Target)
+	e.U16(m.ExtranonceSize)
+	e.B0_32(m.ExtranoncePrefix)
+	return e.Bytes()
+}
+
+type OpenMiningChannelError struct {
+	RequestID uint32
+	ErrorCode string
+}
+
+func ParseOpenMiningChannelError(b []byte) (*OpenMiningChannelError, error) {
+	d := newDecoder(b)
+	m := &OpenMiningChannelError{
+		RequestID: d.U32(),
+		ErrorCode: d.Str0_255(),
+	}
+	return m, d.Err()
+}
+
+func (m *OpenMiningChannelError) MsgType() uint8     { return MsgTypeOpenMiningChannelError }
+func (m *OpenMiningChannelError) IsChannelMsg() bool { return false }
+
+func (m *OpenMiningChannelError) SerializePayload() []byte {
+	e := newEncoder(32)
+	e.U32(m.RequestID)
+	e.Str0_255(m.ErrorCode)
+	return e.Bytes()
+}
+
+var _ Message = new(OpenStandardMiningChannel)
+var _ Message = new(OpenStandardMiningChannelSuccess)
+var _ Message = new(OpenExtendedMiningChannel)
+var _ Message = new(OpenExtendedMiningChannelSuccess)
+var _ Message = new(OpenMiningChannelError)
@@ -0,0 +1,120 @@
+package stratumv2_message
+
+const (
+	ProtocolMining uint8 = 0
+
+	ProtocolVersion uint16 = 2
+
+	// SetupConnection flags for the mining protocol
+	FlagRequiresStandardJobs   uint32 = 1 << 0
+	FlagRequiresWorkSelection  uint32 = 1 << 1
+	FlagRequiresVersionRolling uint32 = 1 << 2
+
+	// SetupConnection.Success flags for the mining protocol
+	FlagRequiresFixedVersion     uint32 = 1 << 0
+	FlagRequiresExtendedChannels uint32 = 1 << 1
+
+	ErrCodeUnsupportedFeatureFlags = "unsupported-feature-flags"
+	ErrCodeUnsupportedProtocol     = "unsupported-protocol"
+	ErrCodeProtocolVersionMismatch = "protocol-version-mismatch"
+)
+
+type SetupConnection struct {
+	Protocol        uint8
+	MinVersion      uint16
+	MaxVersion      uint16
+	Flags           uint32
+	EndpointHost    string
+	EndpointPort    uint16
+	Vendor          string
+	HardwareVersion string
+	Firmware        string
+	DeviceID        string
+}
+
+func ParseSetupConnection(b []byte) (*SetupConnection, error) {
+	d := newDecoder(b)
+	m := &SetupConnection{
+		Protocol:        d.U8(),
+		MinVersion:      d.U16(),
+		MaxVersion:      d.U16(),
+		Flags:           d.U32(),
+		EndpointHost:    d.Str0_255(),
+		EndpointPort:    d.U16(),
+		Vendor:          d.Str0_255(),
+		HardwareVersion: d.Str0_255(),
+		Firmware:        d.Str0_255(),
+		DeviceID:        d.Str0_255(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetupConnection) MsgType() uint8     { return MsgTypeSetupConnection }
+func (m *SetupConnection) IsChannelMsg() bool { return false }
+
+func (m *SetupConnection) SerializePayload() []byte {
+	e := newEncoder(64)
+	e.U8(m.Protocol)
+	e.U16(m.MinVersion)
+	e.U16(m.MaxVersion)
+	e.U32(m.Flags)
+	e.Str0_255(m.EndpointHost)
+	e.U16(m.EndpointPort)
+	e.Str0_255(m.Vendor)
+	e.Str0_255(m.HardwareVersion)
+	e.Str0_255(m.Firmware)
+	e.Str0_255(m.DeviceID)
+	return e.Bytes()
+}
+
+type SetupConnectionSuccess struct {
+	UsedVersion uint16
+	Flags       uint32
+}
+
+func ParseSetupConnectionSuccess(b []byte) (*SetupConnectionSuccess, error) {
+	d := newDecoder(b)
+	m := &SetupConnectionSuccess{
+		UsedVersion: d.U16(),
+		Flags:       d.U32(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetupConnectionSuccess) MsgType() uint8     { return MsgTypeSetupConnectionSuccess }
+func (m *SetupConnectionSuccess) IsChannelMsg() bool { return false }
+
+func (m *SetupConnectionSuccess) SerializePayload() []byte {
+	e := newEncoder(6)
+	e.U16(m.UsedVersion)
+	e.U32(m.Flags)
+	return e.Bytes()
+}
+
+type SetupConnectionError struct {
+	Flags     uint32
+	ErrorCode string
+}
+
+func ParseSetupConnectionError(b []byte) (*SetupConnectionError, error) {
+	d := newDecoder(b)
+	m := &SetupConnectionError{
+		Flags:     d.U32(),
+		ErrorCode: d.Str0_255(),
+	}
+	return m, d.Err()
+}
+
+func (m *SetupConnectionError) MsgType() uint8     { return MsgTypeSetupConnectionError }
+func (m *SetupConnectionError) IsChannelMsg() bool { return false }
+
+func (m *SetupConnectionError) SerializePayload() []byte {
+	e := newEncoder(32)
+	e.U32(m.Flags)
+	e.Str0_255(m.ErrorCode)
+	return e.Bytes()
+}
+
+var _ Message = new(SetupConnection)
+var _ Message = new(SetupConnectionSuccess)
+var _ Message = new(SetupConnectionError)
@@ -0,0 +1,137 @@
+package stratumv2_message
+
+const (
+	ErrCodeInvalidChannelID = "invalid-channel-id"
+	ErrCodeStaleShare       = "stale-share"
+	ErrCodeDifficultyTooLow = "difficulty-too-low"
+	ErrCodeInvalidJobID     = "invalid-job-id"
+)
+
+type SubmitSharesStandard struct {
+	ChannelID      uint32
+	SequenceNumber uint32
+	JobID          uint32
+	Nonce          uint32
+	Ntime          uint32
+	Version        uint32
+}
+
+func ParseSubmitSharesStandard(b []byte) (*SubmitSharesStandard, error) {
+	d := newDecoder(b)
+	m := &SubmitSharesStandard{
+		ChannelID:      d.U32(),
+		SequenceNumber: d.U32(),
+		JobID:          d.U32(),
+		Nonce:          d.U32(),
+		Ntime:          d.U32(),
+		Version:        d.U32(),
+	}
+	return m, d.Err()
+}
+
+func (m *SubmitSharesStandard) MsgType() uint8     { return MsgTypeSubmitSharesStandard }
+func (m *SubmitSharesStandard) IsChannelMsg() bool { return true }
+
+func (m *SubmitSharesStandard) SerializePayload() []byte {
+	e := newEncoder(24)
+	e.U32(m.ChannelID)
+	e.U32(m.SequenceNumber)
+	e.U32(m.JobID)
+	e.U32(m.Nonce)
+	e.U32(m.Ntime)
+	e.U32(m.Version)
+	return e.Bytes()
+}
+
+type SubmitSharesExtended struct {
+	SubmitSharesStandard
+	Extranonce []byte
+}
+
+func ParseSubmitSharesExtended(b []byte) (*SubmitSharesExtended, error) {
+	d := newDecoder(b)
+	m := &SubmitSharesExtended{
+		SubmitSharesStandard: SubmitSharesStandard{
+			ChannelID:      d.U32(),
+			SequenceNumber: d.U32(),
+			JobID:          d.U32(),
+			Nonce:          d.U32(),
+			Ntime:          d.U32(),
+			Version:        d.U32(),
+		},
+		Extranonce: d.B0_32(),
+	}
+	return m, d.Err()
+}
+
+func (m *SubmitSharesExtended) MsgType() uint8     { return MsgTypeSubmitSharesExtended }
+func (m *SubmitSharesExtended) IsChannelMsg() bool { return true }
+
+func (m *SubmitSharesExtended) SerializePayload() []byte {
+	e := newEncoder(57)
+	e.buf = append(e.buf, m.SubmitSharesStandard.SerializePayload()...)
+	e.B0_32(m.Extranonce)
+	return e.Bytes()
+}
+
+type SubmitSharesSuccess struct {
+	ChannelID               uint32
+	LastSequenceNumber      uint32
+	NewSubmitsAcceptedCount uint32
+	NewSharesSum            uint64
+}
+
+func ParseSubmitSharesSuccess(b []byte) (*SubmitSharesSuccess, error) {
+	d := newDecoder(b)
+	m := &SubmitSharesSuccess{
+		ChannelID:               d.U32(),
+		LastSequenceNumber:      d.U32(),
+		NewSubmitsAcceptedCount: d.U32(),
+		NewSharesSum:            d.U64(),
+	}
+	return m, d.Err()
+}
+
+func (m *SubmitSharesSuccess) MsgType() uint8     { return MsgTypeSubmitSharesSuccess }
+func (m *SubmitSharesSuccess) IsChannelMsg() bool { return true }
+
+func (m *SubmitSharesSuccess) SerializePayload() []byte {
+	e := newEncoder(20)
+	e.U32(m.ChannelID)
+	e.U32(m.LastSequenceNumber)
+	e.U32(m.NewSubmitsAcceptedCount)
+	e.U64(m.NewSharesSum)
+	return e.Bytes()
+}
+
+type SubmitSharesError struct {
+	ChannelID      uint32
+	SequenceNumber uint32
+	ErrorCode      string
+}
+
+func ParseSubmitSharesError(b []byte) (*SubmitSharesError, error) {
+	d := newDecoder(b)
+	m := &SubmitSharesError{
+		ChannelID:      d.U32(),
+		SequenceNumber: d.U32(),
+		ErrorCode:      d.Str0_255(),
+	}
+	return m, d.Err()
+}
+
+func (m *SubmitSharesError) MsgType() uint8     { return MsgTypeSubmitSharesError }
+func (m *SubmitSharesError) IsChannelMsg() bool { return true }
+
+func (m *SubmitSharesError) SerializePayload() []byte {
+	e := newEncoder(32)
+	e.U32(m.ChannelID)
+	e.U32(m.SequenceNumber)
+	e.Str0_255(m.ErrorCode)
+	return e.Bytes()
+}
+
+var _ Message = new(SubmitSharesStandard)
+var _ Message = new(SubmitSharesExtended)
+var _ Message = new(SubmitSharesSuccess)
+var _ Message = new(SubmitSharesError)
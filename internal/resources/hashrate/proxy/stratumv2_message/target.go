@@ -0,0 +1,47 @@
+package stratumv2_message
+
+import (
+	"math/big"
+)
+
+// diff1Target is the target of difficulty 1 share for sha256d (bdiff)
+var diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+
+// DifficultyToTarget converts stratum v1 difficulty to the U256 little-endian target
+func DifficultyToTarget(diff float64) [32]byte {
+	var res [32]byte
+	if diff <= 0 {
+		for i := range res {
+			res[i] = 0xff
+		}
+		return res
+	}
+
+	target := new(big.Float).SetInt(diff1Target)
+	target.Quo(target, big.NewFloat(diff))
+	targetInt, _ := target.Int(nil)
+
+	b := targetInt.Bytes()
+	if len(b) > 32 {
+		b = b[len(b)-32:]
+	}
+	// big-endian to little-endian
+	for i := 0; i < len(b); i++ {
+		res[i] = b[len(b)-1-i]
+	}
+	return res
+}
+
+// TargetToDifficulty converts U256 little-endian target to the stratum v1 difficulty
+func TargetToDifficulty(target [32]byte) float64 {
+	be := make([]byte, 32)
+	for i := 0; i < 32; i++ {
+		be[i] = target[31-i]
+	}
+	t := new(big.Int).SetBytes(be)
+	if t.Sign() == 0 {
+		return 0
+	}
+	diff, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target), new(big.Float).SetInt(t)).Float64()
+	return diff
+}
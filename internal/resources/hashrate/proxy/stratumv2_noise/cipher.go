@@ -0,0 +1,140 @@
+package stratumv2_noise
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	PROTOCOL_NAME = "Noise_NX_Secp256k1+EllSwift_ChaChaPoly_SHA256"
+	MAC_SIZE      = chacha20poly1305.Overhead
+)
+
+var (
+	ErrNonceExhausted = errors.New("noise nonce exhausted")
+	ErrDecrypt        = errors.New("noise decryption failed")
+)
+
+// cipherState is the CipherState object from the noise specification
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+func (c *cipherState) initializeKey(key []byte) {
+	aead, _ := chacha20poly1305.New(key) // key is always 32 bytes
+	c.aead = aead
+	c.nonce = 0
+}
+
+func (c *cipherState) hasKey() bool {
+	return c.aead != nil
+}
+
+func (c *cipherState) encryptWithAd(ad, plaintext []byte) ([]byte, error) {
+	if !c.hasKey() {
+		return plaintext, nil
+	}
+	if c.nonce == ^uint64(0) {
+		return nil, ErrNonceExhausted
+	}
+	ct := c.aead.Seal(nil, c.nonceBytes(), plaintext, ad)
+	c.nonce++
+	return ct, nil
+}
+
+func (c *cipherState) decryptWithAd(ad, ciphertext []byte) ([]byte, error) {
+	if !c.hasKey() {
+		return ciphertext, nil
+	}
+	if c.nonce == ^uint64(0) {
+		return nil, ErrNonceExhausted
+	}
+	pt, err := c.aead.Open(nil, c.nonceBytes(), ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	c.nonce++
+	return pt, nil
+}
+
+// nonceBytes returns 96-bit nonce, 32 bits of zeros followed by little-endian counter
+func (c *cipherState) nonceBytes() []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(n[4:], c.nonce)
+	return n
+}
+
+// symmetricState is the SymmetricState object from the noise specification
+type symmetricState struct {
+	cs cipherState
+	ck []byte // chaining key
+	h  []byte // handshake hash
+}
+
+func newSymmetricState() *symmetricState {
+	h := sha256.Sum256([]byte(PROTOCOL_NAME))
+	return &symmetricState{
+		ck: h[:],
+		h:  h[:],
+	}
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	ck, tempK := hkdf(s.ck, ikm)
+	s.ck = ck
+	s.cs.initializeKey(tempK)
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(s.h)
+	h.Write(data)
+	s.h = h.Sum(nil)
+}
+
+func (s *symmetricState) encryptAndHash(plaintext []byte) ([]byte, error) {
+	ct, err := s.cs.encryptWithAd(s.h, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ct)
+	return ct, nil
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	pt, err := s.cs.decryptWithAd(s.h, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return pt, nil
+}
+
+// split returns cipher states for initiator->responder and responder->initiator directions
+func (s *symmetricState) split() (c1 *cipherState, c2 *cipherState) {
+	k1, k2 := hkdf(s.ck, nil)
+	c1, c2 = &cipherState{}, &cipherState{}
+	c1.initializeKey(k1)
+	c2.initializeKey(k2)
+	return c1, c2
+}
+
+// hkdf is the HKDF function from the noise specification with two outputs
+func hkdf(chainingKey, ikm []byte) ([]byte, []byte) {
+	tempKey := hmacSha256(chainingKey, ikm)
+	out1 := hmacSha256(tempKey, []byte{0x01})
+	out2 := hmacSha256(tempKey, append(append([]byte{}, out1...), 0x02))
+	return out1, out2
+}
+
+func hmacSha256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package stratumv2_noise
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+)
+
+const (
+	MAX_CHUNK_SIZE           = 65535
+	MAX_CHUNK_PLAINTEXT_SIZE = MAX_CHUNK_SIZE - MAC_SIZE
+	ENCRYPTED_HEADER_SIZE    = sv2.FRAME_HEADER_SIZE + MAC_SIZE
+)
+
+// Conn is an encrypted stratum v2 frame connection established after the noise handshake.
+// The frame header is encrypted separately from the payload, so the reader knows the payload size,
+// payload is split into chunks of at most 65535 bytes of ciphertext
+type Conn struct {
+	rw io.ReadWriteCloser
+
+	send      *cipherState
+	recv      *cipherState
+	readLock  sync.Mutex
+	writeLock sync.Mutex
+}
+
+func newConn(rw io.ReadWriteCloser, send, recv *cipherState) *Conn {
+	return &Conn{
+		rw:   rw,
+		send: send,
+		recv: recv,
+	}
+}
+
+func (c *Conn) ReadFrame() (*sv2.Frame, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	encHeader := make([]byte, ENCRYPTED_HEADER_SIZE)
+	_, err := io.ReadFull(c.rw, encHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := c.recv.decryptWithAd(nil, encHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := sv2.ParseFrameHeader(headerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, header.MsgLength)
+	remaining := int(header.MsgLength)
+	for remaining > 0 {
+		chunkSize := remaining
+		if chunkSize > MAX_CHUNK_PLAINTEXT_SIZE {
+			chunkSize = MAX_CHUNK_PLAINTEXT_SIZE
+		}
+		encChunk := make([]byte, chunkSize+MAC_SIZE)
+		_, err = io.ReadFull(c.rw, encChunk)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := c.recv.decryptWithAd(nil, encChunk)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+		remaining -= chunkSize
+	}
+
+	return &sv2.Frame{Header: header, Payload: payload}, nil
+}
+
+func (c *Conn) WriteFrame(f *sv2.Frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if len(f.Payload) > sv2.MAX_PAYLOAD_SIZE {
+		return fmt.Errorf("frame payload too large: %d", len(f.Payload))
+	}
+
+	header := f.Header
+	header.MsgLength = uint32(len(f.Payload))
+
+	encHeader, err := c.send.encryptWithAd(nil, header.Serialize())
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, len(encHeader)+len(f.Payload)+MAC_SIZE*(len(f.Payload)/MAX_CHUNK_PLAINTEXT_SIZE+1))
+	buf = append(buf, encHeader...)
+
+	for i := 0; i < len(f.Payload); i += MAX_CHUNK_PLAINTEXT_SIZE {
+		end := i + MAX_CHUNK_PLAINTEXT_SIZE
+		if end > len(f.Payload) {
+			end = len(f.Payload)
+		}
+		encChunk, err := c.send.encryptWithAd(nil, f.Payload[i:end])
+		if err != nil {
+			return err
+		}
+		buf = append(buf, encChunk...)
+	}
+
+	_, err = c.rw.Write(buf)
+	return err
+}
+
+func (c *Conn) Close() error {
+	return c.rw.Close()
+}
+
+var _ sv2.FrameConn = new(Conn)
@@ -0,0 +1,175 @@
+package stratumv2_noise
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ElligatorSwift encoding of secp256k1 public keys (BIP324). Stratum V2 sends the noise keys in this
+// encoding, so the handshake is indistinguishable from random bytes. Every 64-byte string decodes
+// to a valid x coordinate, the encoding of a key is randomized.
+//
+// The field arithmetic uses math/big, it runs a few times per handshake only
+
+const (
+	ELLSWIFT_PUBKEY_SIZE = 64 // ElligatorSwift encoded public key, u || t
+)
+
+var (
+	fieldP = btcec.S256().P
+	// ellswiftC is sqrt(-3) mod p
+	ellswiftC, _ = new(big.Int).SetString("0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f852", 16)
+)
+
+// ellswiftEncode returns the random ElligatorSwift encoding of the public key
+func ellswiftEncode(pub *btcec.PublicKey) ([]byte, error) {
+	x := new(big.Int).SetBytes(pub.SerializeCompressed()[1:])
+	for {
+		var rnd [33]byte
+		if _, err := rand.Read(rnd[:]); err != nil {
+			return nil, err
+		}
+		u := feMod(new(big.Int).SetBytes(rnd[:32]))
+		if u.Sign() == 0 {
+			continue
+		}
+		t := xswiftecInv(u, x, int(rnd[32]&7))
+		if t == nil {
+			continue
+		}
+
+		res := make([]byte, ELLSWIFT_PUBKEY_SIZE)
+		u.FillBytes(res[:32])
+		t.FillBytes(res[32:])
+		return res, nil
+	}
+}
+
+// ellswiftDecode returns the public key with even Y for the encoded x coordinate
+func ellswiftDecode(b []byte) (*btcec.PublicKey, error) {
+	if len(b) != ELLSWIFT_PUBKEY_SIZE {
+		return nil, fmt.Errorf("expected %d bytes encoded key, actual %d", ELLSWIFT_PUBKEY_SIZE, len(b))
+	}
+	u := feMod(new(big.Int).SetBytes(b[:32]))
+	t := feMod(new(big.Int).SetBytes(b[32:ELLSWIFT_PUBKEY_SIZE]))
+
+	compressed := make([]byte, 33)
+	compressed[0] = 0x02
+	xswiftec(u, t).FillBytes(compressed[1:])
+	return btcec.ParsePubKey(compressed)
+}
+
+// xswiftec maps the field elements (u, t) to the x coordinate on the curve
+func xswiftec(u, t *big.Int) *big.Int {
+	if u.Sign() == 0 {
+		u = big.NewInt(1)
+	}
+	if t.Sign() == 0 {
+		t = big.NewInt(1)
+	}
+	g := feAdd(feMul(feMul(u, u), u), big.NewInt(7))
+	if feAdd(g, feMul(t, t)).Sign() == 0 {
+		t = feAdd(t, t)
+	}
+
+	x := feDiv(feSub(g, feMul(t, t)), feAdd(t, t))
+	y := feDiv(feAdd(x, t), feMul(ellswiftC, u))
+	half := new(big.Int).ModInverse(big.NewInt(2), fieldP)
+
+	candidates := []*big.Int{
+		feAdd(u, feMul(big.NewInt(4), feMul(y, y))),
+		feMul(feSub(feNeg(feDiv(x, y)), u), half),
+		feMul(feSub(feDiv(x, y), u), half),
+	}
+	for _, candidate := range candidates {
+		if isXOnCurve(candidate) {
+			return candidate
+		}
+	}
+	// unreachable, one of the candidates is always on the curve
+	return candidates[2]
+}
+
+// xswiftecInv returns t such that xswiftec(u, t) == x, nil if there is none for the case
+func xswiftecInv(u, x *big.Int, c int) *big.Int {
+	var s, v *big.Int
+	g := feAdd(feMul(feMul(u, u), u), big.NewInt(7))
+	half := new(big.Int).ModInverse(big.NewInt(2), fieldP)
+
+	if c&2 == 0 {
+		if isXOnCurve(feSub(feNeg(x), u)) {
+			return nil
+		}
+		v = x
+		denom := feAdd(feAdd(feMul(u, u), feMul(u, v)), feMul(v, v))
+		if denom.Sign() == 0 {
+			return nil
+		}
+		s = feNeg(feDiv(g, denom))
+	} else {
+		s = feSub(x, u)
+		if s.Sign() == 0 {
+			return nil
+		}
+		r := feSqrt(feMul(feNeg(s), feAdd(feMul(big.NewInt(4), g), feMul(feMul(big.NewInt(3), s), feMul(u, u)))))
+		if r == nil || (c&1 == 1 && r.Sign() == 0) {
+			return nil
+		}
+		v = feMul(feSub(feDiv(r, s), u), half)
+	}
+
+	w := feSqrt(s)
+	if w == nil {
+		return nil
+	}
+
+	oneMinusC := feSub(big.NewInt(1), ellswiftC)
+	onePlusC := feAdd(big.NewInt(1), ellswiftC)
+	switch c & 5 {
+	case 0:
+		return feNeg(feMul(w, feAdd(feMul(feMul(u, oneMinusC), half), v)))
+	case 1:
+		return feMul(w, feAdd(feMul(feMul(u, onePlusC), half), v))
+	case 4:
+		return feMul(w, feAdd(feMul(feMul(u, oneMinusC), half), v))
+	default:
+		return feNeg(feMul(w, feAdd(feMul(feMul(u, onePlusC), half), v)))
+	}
+}
+
+func isXOnCurve(x *big.Int) bool {
+	return feSqrt(feAdd(feMul(feMul(x, x), x), big.NewInt(7))) != nil
+}
+
+func feMod(a *big.Int) *big.Int {
+	return a.Mod(a, fieldP)
+}
+
+func feAdd(a, b *big.Int) *big.Int {
+	return feMod(new(big.Int).Add(a, b))
+}
+
+func feSub(a, b *big.Int) *big.Int {
+	return feMod(new(big.Int).Sub(a, b))
+}
+
+func feNeg(a *big.Int) *big.Int {
+	return feMod(new(big.Int).Neg(a))
+}
+
+func feMul(a, b *big.Int) *big.Int {
+	return feMod(new(big.Int).Mul(a, b))
+}
+
+// feDiv returns a / b, b must be non-zero
+func feDiv(a, b *big.Int) *big.Int {
+	return feMul(a, new(big.Int).ModInverse(b, fieldP))
+}
+
+// feSqrt returns the square root, nil if a is not a square
+func feSqrt(a *big.Int) *big.Int {
+	return new(big.Int).ModSqrt(a, fieldP)
+}
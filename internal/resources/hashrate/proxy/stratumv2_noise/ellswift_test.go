@@ -0,0 +1,135 @@
+package stratumv2_noise
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/stretchr/testify/require"
+)
+
+// vectors from BIP324 ellswift_decode_test_vectors.csv, referenced by the Stratum V2 spec
+func TestEllSwiftDecodeVectors(t *testing.T) {
+	vectors := []struct {
+		ellswift string
+		x        string
+	}{
+		{
+			"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"000000000000000000000000000000000000000000000000000000000000000001d3475bf7655b0fb2d852921035b2ef607f49069b97454e6795251062741771",
+			"b5da00b73cd6560520e7c364086e7cd23a34bf60d0e707be9fc34d4cd5fdfa2c",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f8530000000000000000000000000000000000000000000000000000000000000000",
+			"532167c11200b08c0e84a354e74dcc40f8b25f4fe686e30869526366278a0688",
+		},
+		{
+			"0ffde9ca81d751e9cdaffc1a50779245320b28996dbaf32f822f20117c22fbd6c74d99efceaa550f1ad1c0f43f46e7ff1ee3bd0162b7bf55f2965da9c3450646",
+			"74e880b3ffd18fe3cddf7902522551ddf97fa4a35a3cfda8197f947081a57b8f",
+		},
+		{
+			"123658444f32be8f02ea2034afa7ef4bbe8adc918ceb49b12773b625f490b368ffffffffffffffffffffffffffffffffffffffffffffffffffffffff8dc5fe11",
+			"ed16d65cf3a9538fcb2c139f1ecbc143ee14827120cbc2659e667256800b8142",
+		},
+	}
+
+	for _, v := range vectors {
+		b, err := hex.DecodeString(v.ellswift)
+		require.NoError(t, err)
+
+		pub, err := ellswiftDecode(b)
+		require.NoError(t, err)
+		require.Equal(t, v.x, hex.EncodeToString(schnorr.SerializePubKey(pub)), v.ellswift)
+	}
+}
+
+// vector from BIP324 packet_encoding_test_vectors.csv, the shared secret is the ellswift_xdh of the initiator
+func TestEllSwiftXdhVectors(t *testing.T) {
+	vectors := []struct {
+		priv         string
+		ellswiftOurs string
+		ellswiftThem string
+		initiating   bool
+		sharedSecret string
+	}{
+		{
+			"61062ea5071d800bbfd59e2e8b53d47d194b095ae5a4df04936b49772ef0d4d7",
+			"ec0adff257bbfe500c188c80b4fdd640f6b45a482bbc15fc7cef5931deff0aa186f6eb9bba7b85dc4dcc28b28722de1e3d9108b985e2967045668f66098e475b",
+			"a4a94dfce69b4a2a0a099313d10f9f7e7d649d60501c9e1d274c300e0d89aafaffffffffffffffffffffffffffffffffffffffffffffffffffffffff8faf88d5",
+			true,
+			"c6992a117f5edbea70c3f511d32d26b9798be4b81a62eaee1a5acaa8459a3592",
+		},
+	}
+
+	for _, v := range vectors {
+		k, err := KeypairFromHex(v.priv)
+		require.NoError(t, err)
+		ours, err := hex.DecodeString(v.ellswiftOurs)
+		require.NoError(t, err)
+		theirs, err := hex.DecodeString(v.ellswiftThem)
+		require.NoError(t, err)
+
+		ellInitiator, ellResponder := ours, theirs
+		if !v.initiating {
+			ellInitiator, ellResponder = theirs, ours
+		}
+		secret, err := k.dh(ellInitiator, ellResponder, v.initiating)
+		require.NoError(t, err)
+		require.Equal(t, v.sharedSecret, hex.EncodeToString(secret))
+	}
+}
+
+func TestEllSwiftXdhSymmetric(t *testing.T) {
+	a, err := GenerateKeypair()
+	require.NoError(t, err)
+	b, err := GenerateKeypair()
+	require.NoError(t, err)
+	ellA, err := a.EllSwiftPublicKey()
+	require.NoError(t, err)
+	ellB, err := b.EllSwiftPublicKey()
+	require.NoError(t, err)
+
+	secretA, err := a.dh(ellA, ellB, true)
+	require.NoError(t, err)
+	secretB, err := b.dh(ellA, ellB, false)
+	require.NoError(t, err)
+	require.Equal(t, secretA, secretB)
+
+	// the hash commits to the encodings, not only to the keys
+	ellA2, err := a.EllSwiftPublicKey()
+	require.NoError(t, err)
+	secretB2, err := b.dh(ellA2, ellB, false)
+	require.NoError(t, err)
+	require.NotEqual(t, secretA, secretB2)
+
+	_, err = a.dh(ellA, ellB[:ELLSWIFT_PUBKEY_SIZE-1], true)
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestEllSwiftEncodeDecode(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		k, err := GenerateKeypair()
+		require.NoError(t, err)
+
+		encoded, err := k.EllSwiftPublicKey()
+		require.NoError(t, err)
+		require.Len(t, encoded, ELLSWIFT_PUBKEY_SIZE)
+
+		xOnly, err := xOnlyFromEllSwift(encoded)
+		require.NoError(t, err)
+		require.Equal(t, k.PublicKey(), xOnly)
+	}
+}
+
+func TestHandshakeActSizes(t *testing.T) {
+	// sizes of the handshake messages from the Stratum V2 spec
+	require.Equal(t, 64, ACT1_SIZE)
+	require.Equal(t, 234, ACT2_SIZE)
+}
@@ -0,0 +1,214 @@
+package stratumv2_noise
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+// Noise NX handshake as used by Stratum V2 (https://github.com/stratum-mining/sv2-spec/blob/main/04-Protocol-Security.md)
+//
+//	-> e
+//	<- e, ee, s, es, SIGNATURE_NOISE_MESSAGE
+//
+// The initiator (client) learns the static key of the responder (server) and verifies that it is
+// signed by the authority key it trusts. The ephemeral and static keys are sent ElligatorSwift encoded,
+// the authority key and the certificate use x-only keys.
+
+const (
+	ACT1_SIZE = ELLSWIFT_PUBKEY_SIZE                                                                     // 64 bytes
+	ACT2_SIZE = ELLSWIFT_PUBKEY_SIZE + (ELLSWIFT_PUBKEY_SIZE + MAC_SIZE) + (CERTIFICATE_SIZE + MAC_SIZE) // 234 bytes
+)
+
+var (
+	ErrHandshake = errors.New("noise handshake failed")
+)
+
+// ResponderConfig is the server side configuration
+type ResponderConfig struct {
+	StaticKey   *Keypair
+	Certificate *Certificate
+}
+
+// InitiatorConfig is the client side configuration. If AuthorityPublicKey is nil, the server
+// certificate is not verified, the connection is still encrypted but not authenticated
+type InitiatorConfig struct {
+	AuthorityPublicKey []byte
+}
+
+// NewResponderConfig generates static key and signs it with the authority key
+func NewResponderConfig(authority *Keypair, certValidity time.Duration) (*ResponderConfig, error) {
+	static, err := GenerateKeypair()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := NewCertificate(authority, static.PublicKey(), time.Now().Add(-time.Minute), certValidity)
+	if err != nil {
+		return nil, err
+	}
+	return &ResponderConfig{
+		StaticKey:   static,
+		Certificate: cert,
+	}, nil
+}
+
+// Accept performs server side of the handshake
+func Accept(rw io.ReadWriteCloser, cfg *ResponderConfig) (*Conn, error) {
+	c1, c2, err := respond(rw, cfg)
+	if err != nil {
+		return nil, lib.WrapError(ErrHandshake, err)
+	}
+	return newConn(rw, c2, c1), nil
+}
+
+// Dial performs client side of the handshake
+func Dial(rw io.ReadWriteCloser, cfg *InitiatorConfig) (*Conn, error) {
+	c1, c2, err := initiate(rw, cfg)
+	if err != nil {
+		return nil, lib.WrapError(ErrHandshake, err)
+	}
+	return newConn(rw, c1, c2), nil
+}
+
+func initiate(rw io.ReadWriter, cfg *InitiatorConfig) (*cipherState, *cipherState, error) {
+	ss := newSymmetricState()
+	ss.mixHash(nil) // empty prologue
+
+	// -> e
+	e, err := GenerateKeypair()
+	if err != nil {
+		return nil, nil, err
+	}
+	ePub, err := e.EllSwiftPublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixHash(ePub)
+	_, _ = ss.encryptAndHash(nil)
+
+	_, err = rw.Write(ePub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee, s, es
+	act2 := make([]byte, ACT2_SIZE)
+	_, err = io.ReadFull(rw, act2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	re := act2[:ELLSWIFT_PUBKEY_SIZE]
+	ss.mixHash(re)
+
+	ee, err := e.dh(ePub, re, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(ee)
+
+	rs, err := ss.decryptAndHash(act2[ELLSWIFT_PUBKEY_SIZE : 2*ELLSWIFT_PUBKEY_SIZE+MAC_SIZE])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	es, err := e.dh(ePub, rs, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(es)
+
+	certBytes, err := ss.decryptAndHash(act2[2*ELLSWIFT_PUBKEY_SIZE+MAC_SIZE:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := ParseCertificate(certBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg != nil && cfg.AuthorityPublicKey != nil {
+		rsXOnly, err := xOnlyFromEllSwift(rs)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = cert.Verify(cfg.AuthorityPublicKey, rsXOnly, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c1, c2 := ss.split()
+	return c1, c2, nil
+}
+
+func respond(rw io.ReadWriter, cfg *ResponderConfig) (*cipherState, *cipherState, error) {
+	if cfg == nil || cfg.StaticKey == nil || cfg.Certificate == nil {
+		return nil, nil, fmt.Errorf("responder static key and certificate are required")
+	}
+
+	ss := newSymmetricState()
+	ss.mixHash(nil) // empty prologue
+
+	// -> e
+	re := make([]byte, ACT1_SIZE)
+	_, err := io.ReadFull(rw, re)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixHash(re)
+	_, _ = ss.decryptAndHash(nil)
+
+	// <- e, ee, s, es
+	e, err := GenerateKeypair()
+	if err != nil {
+		return nil, nil, err
+	}
+	ePub, err := e.EllSwiftPublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	act2 := make([]byte, 0, ACT2_SIZE)
+	act2 = append(act2, ePub...)
+	ss.mixHash(ePub)
+
+	ee, err := e.dh(re, ePub, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(ee)
+
+	sPub, err := cfg.StaticKey.EllSwiftPublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, err := ss.encryptAndHash(sPub)
+	if err != nil {
+		return nil, nil, err
+	}
+	act2 = append(act2, ct...)
+
+	es, err := cfg.StaticKey.dh(re, sPub, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(es)
+
+	ct, err = ss.encryptAndHash(cfg.Certificate.Serialize())
+	if err != nil {
+		return nil, nil, err
+	}
+	act2 = append(act2, ct...)
+
+	_, err = rw.Write(act2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c1, c2 := ss.split()
+	return c1, c2, nil
+}
@@ -0,0 +1,97 @@
+package stratumv2_noise
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+)
+
+func TestHandshakeAndTransport(t *testing.T) {
+	authority, err := GenerateKeypair()
+	require.NoError(t, err)
+
+	respCfg, err := NewResponderConfig(authority, time.Hour)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	serverConnCh := make(chan *Conn, 1)
+	serverErrCh := make(chan error, 1)
+	go func() {
+		conn, err := Accept(server, respCfg)
+		serverErrCh <- err
+		serverConnCh <- conn
+	}()
+
+	clientConn, err := Dial(client, &InitiatorConfig{AuthorityPublicKey: authority.PublicKey()})
+	require.NoError(t, err)
+	require.NoError(t, <-serverErrCh)
+	serverConn := <-serverConnCh
+
+	// payload larger than a single chunk
+	bigPrefix := make([]byte, 70000)
+	bigPrefix[69999] = 1
+	msgs := []sv2.Message{
+		&sv2.SetupConnectionSuccess{UsedVersion: 2},
+		&sv2.NewExtendedMiningJob{ChannelID: 1, JobID: 1, MerklePath: [][32]byte{}, CoinbaseTxPrefix: bigPrefix[:60000], CoinbaseTxSuffix: bigPrefix[:60000]},
+	}
+
+	for _, msg := range msgs {
+		go func(msg sv2.Message) {
+			_ = serverConn.WriteFrame(sv2.NewFrame(msg))
+		}(msg)
+
+		frame, err := clientConn.ReadFrame()
+		require.NoError(t, err)
+
+		parsed, err := sv2.ParseStratumV2Message(frame)
+		require.NoError(t, err)
+		require.Equal(t, msg, parsed)
+	}
+
+	go func() {
+		_ = clientConn.WriteFrame(sv2.NewFrame(&sv2.SubmitSharesStandard{ChannelID: 1, Nonce: 42}))
+	}()
+	frame, err := serverConn.ReadFrame()
+	require.NoError(t, err)
+	parsed, err := sv2.ParseStratumV2Message(frame)
+	require.NoError(t, err)
+	require.Equal(t, uint32(42), parsed.(*sv2.SubmitSharesStandard).Nonce)
+}
+
+func TestHandshakeWrongAuthority(t *testing.T) {
+	authority, err := GenerateKeypair()
+	require.NoError(t, err)
+	otherAuthority, err := GenerateKeypair()
+	require.NoError(t, err)
+
+	respCfg, err := NewResponderConfig(authority, time.Hour)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _ = Accept(server, respCfg)
+	}()
+
+	_, err = Dial(client, &InitiatorConfig{AuthorityPublicKey: otherAuthority.PublicKey()})
+	require.ErrorIs(t, err, ErrHandshake)
+	require.ErrorIs(t, err, ErrInvalidCertificate)
+}
+
+func TestAuthorityPublicKeyEncoding(t *testing.T) {
+	authority, err := GenerateKeypair()
+	require.NoError(t, err)
+
+	encoded := EncodeAuthorityPublicKey(authority.PublicKey())
+	decoded, err := DecodeAuthorityPublicKey(encoded)
+	require.NoError(t, err)
+	require.Equal(t, authority.PublicKey(), decoded)
+}
@@ -0,0 +1,209 @@
+package stratumv2_noise
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+const (
+	PUBKEY_SIZE            = 32 // x-only public key
+	SIGNATURE_SIZE         = 64 // BIP340 schnorr signature
+	CERTIFICATE_SIZE       = 2 + 4 + 4 + SIGNATURE_SIZE
+	CERTIFICATE_VERSION    = 0
+	AUTHORITY_KEY_VERSION  = 1
+	AUTHORITY_KEY_ENC_SIZE = 2 + PUBKEY_SIZE
+	XDH_HASH_TAG           = "bip324_ellswift_xonly_ecdh" // BIP324 hash of the ECDH shared secret
+)
+
+var (
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrInvalidCertificate = errors.New("invalid noise certificate")
+)
+
+// Keypair is a secp256k1 keypair with the public key normalized to have even Y coordinate,
+// so it can be transferred as 32-byte x-only key
+type Keypair struct {
+	priv *btcec.PrivateKey
+}
+
+func GenerateKeypair() (*Keypair, error) {
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return newKeypair(priv), nil
+}
+
+// KeypairFromHex parses 32-byte hex encoded private key
+func KeypairFromHex(privHex string) (*Keypair, error) {
+	b, err := hex.DecodeString(privHex)
+	if err != nil || len(b) != 32 {
+		return nil, lib.WrapError(ErrInvalidKey, fmt.Errorf("expected 32 bytes hex encoded private key"))
+	}
+	priv, _ := btcec.PrivKeyFromBytes(b)
+	return newKeypair(priv), nil
+}
+
+func newKeypair(priv *btcec.PrivateKey) *Keypair {
+	if priv.PubKey().SerializeCompressed()[0] == 0x03 {
+		priv.Key.Negate()
+	}
+	return &Keypair{priv: priv}
+}
+
+// PublicKey returns x-only public key
+func (k *Keypair) PublicKey() []byte {
+	return schnorr.SerializePubKey(k.priv.PubKey())
+}
+
+func (k *Keypair) PrivateKeyHex() string {
+	return hex.EncodeToString(k.priv.Serialize())
+}
+
+// EllSwiftPublicKey returns the ElligatorSwift encoded public key, the encoding is random on each call
+func (k *Keypair) EllSwiftPublicKey() ([]byte, error) {
+	return ellswiftEncode(k.priv.PubKey())
+}
+
+// dh performs BIP324 ellswift_xdh with the other party: ECDH with its ElligatorSwift encoded public key,
+// hashed together with both encoded keys in the initiator, responder order. The encoding of the own key
+// must be the one that was sent to the other party
+func (k *Keypair) dh(ellInitiator, ellResponder []byte, initiator bool) ([]byte, error) {
+	remotePub := ellInitiator
+	if initiator {
+		remotePub = ellResponder
+	}
+	pub, err := ellswiftDecode(remotePub)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidKey, err)
+	}
+	x := btcec.GenerateSharedSecret(k.priv, pub)
+	return taggedHash(XDH_HASH_TAG, ellInitiator, ellResponder, x), nil
+}
+
+// taggedHash is the BIP340 tagged hash, sha256(sha256(tag) || sha256(tag) || msgs...)
+func taggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, msg := range msgs {
+		h.Write(msg)
+	}
+	return h.Sum(nil)
+}
+
+// xOnlyFromEllSwift returns x-only public key for the ElligatorSwift encoded one
+func xOnlyFromEllSwift(pub []byte) ([]byte, error) {
+	key, err := ellswiftDecode(pub)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidKey, err)
+	}
+	return schnorr.SerializePubKey(key), nil
+}
+
+// EncodeAuthorityPublicKey encodes x-only authority public key into the base58check
+// string with the version prefix, this format is used in the pool URLs
+func EncodeAuthorityPublicKey(pub []byte) string {
+	payload := make([]byte, 0, AUTHORITY_KEY_ENC_SIZE)
+	payload = binary.LittleEndian.AppendUint16(payload, AUTHORITY_KEY_VERSION)
+	payload = append(payload, pub...)
+	return lib.Base58CheckEncode(payload)
+}
+
+func DecodeAuthorityPublicKey(s string) ([]byte, error) {
+	payload, err := lib.Base58CheckDecode(s)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidKey, err)
+	}
+	if len(payload) != AUTHORITY_KEY_ENC_SIZE || binary.LittleEndian.Uint16(payload) != AUTHORITY_KEY_VERSION {
+		return nil, lib.WrapError(ErrInvalidKey, fmt.Errorf("unexpected authority key format"))
+	}
+	pub := payload[2:]
+	if _, err := schnorr.ParsePubKey(pub); err != nil {
+		return nil, lib.WrapError(ErrInvalidKey, err)
+	}
+	return pub, nil
+}
+
+// Certificate is the SignatureNoiseMessage, the proof that the server static key
+// is issued by the authority
+type Certificate struct {
+	Version       uint16
+	ValidFrom     time.Time
+	NotValidAfter time.Time
+	Signature     []byte
+}
+
+// NewCertificate signs server static public key with the authority key
+func NewCertificate(authority *Keypair, staticPub []byte, validFrom time.Time, validity time.Duration) (*Certificate, error) {
+	cert := &Certificate{
+		Version:       CERTIFICATE_VERSION,
+		ValidFrom:     time.Unix(validFrom.Unix(), 0),
+		NotValidAfter: time.Unix(validFrom.Add(validity).Unix(), 0),
+	}
+	sig, err := schnorr.Sign(authority.priv, cert.hash(staticPub))
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = sig.Serialize()
+	return cert, nil
+}
+
+func ParseCertificate(b []byte) (*Certificate, error) {
+	if len(b) != CERTIFICATE_SIZE {
+		return nil, lib.WrapError(ErrInvalidCertificate, fmt.Errorf("unexpected size %d", len(b)))
+	}
+	return &Certificate{
+		Version:       binary.LittleEndian.Uint16(b[0:2]),
+		ValidFrom:     time.Unix(int64(binary.LittleEndian.Uint32(b[2:6])), 0),
+		NotValidAfter: time.Unix(int64(binary.LittleEndian.Uint32(b[6:10])), 0),
+		Signature:     append([]byte{}, b[10:]...),
+	}, nil
+}
+
+func (c *Certificate) Serialize() []byte {
+	b := make([]byte, 0, CERTIFICATE_SIZE)
+	b = append(b, c.header()...)
+	return append(b, c.Signature...)
+}
+
+// Verify checks validity period and the signature of the authority over the server static key
+func (c *Certificate) Verify(authorityPub []byte, staticPub []byte, now time.Time) error {
+	if now.Before(c.ValidFrom) || now.After(c.NotValidAfter) {
+		return lib.WrapError(ErrInvalidCertificate, fmt.Errorf("certificate is not valid at %s", now.Format(time.RFC3339)))
+	}
+	pub, err := schnorr.ParsePubKey(authorityPub)
+	if err != nil {
+		return lib.WrapError(ErrInvalidCertificate, err)
+	}
+	sig, err := schnorr.ParseSignature(c.Signature)
+	if err != nil {
+		return lib.WrapError(ErrInvalidCertificate, err)
+	}
+	if !sig.Verify(c.hash(staticPub), pub) {
+		return lib.WrapError(ErrInvalidCertificate, fmt.Errorf("signature mismatch"))
+	}
+	return nil
+}
+
+func (c *Certificate) header() []byte {
+	b := make([]byte, 0, 10)
+	b = binary.LittleEndian.AppendUint16(b, c.Version)
+	b = binary.LittleEndian.AppendUint32(b, uint32(c.ValidFrom.Unix()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(c.NotValidAfter.Unix()))
+	return b
+}
+
+func (c *Certificate) hash(staticPub []byte) []byte {
+	h := sha256.Sum256(append(c.header(), staticPub...))
+	return h[:]
+}
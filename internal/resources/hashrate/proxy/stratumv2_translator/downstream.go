@@ -0,0 +1,542 @@
+package stratumv2_translator
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+)
+
+const (
+	// version rolling mask requested from the upstream, as in BIP320
+	DEFAULT_VERSION_ROLLING_MASK = "1fffe000"
+	FIRST_JOB_TIMEOUT            = 30 * time.Second
+
+	ErrCodeInvalidShare         = "invalid-share"
+	ErrCodeDuplicateShare       = "duplicate-share"
+	ErrCodeInvalidExtranonce    = "invalid-extranonce"
+	ErrCodeTooManyChannels      = "too-many-channels"
+	ErrCodeChannelOpenFailed    = "channel-open-failed"
+	DOWNSTREAM_CHANNEL_ID       = 1
+	DOWNSTREAM_GROUP_CHANNEL_ID = 0
+)
+
+var (
+	ErrSetupConnection = errors.New("stratum v2 setup connection failed")
+	ErrOpenChannel     = errors.New("stratum v2 open channel failed")
+	ErrChannelClosed   = errors.New("stratum v2 channel closed by miner")
+)
+
+type downstreamJob struct {
+	v1JobID string
+	diff    float64
+}
+
+// Downstream terminates stratum v2 connection from the miner and translates it to
+// stratum v1, so the rest of the proxy works with miners of both protocols the same way.
+// Single mining channel (standard or extended) per connection is supported, cause stratum v1
+// connection represents a single worker
+type Downstream struct {
+	// state
+	setupDone       bool
+	channelOpen     bool
+	isExtended      bool
+	userName        string
+	extranonce1     []byte
+	extranonce2Size int
+	versionRolling  bool
+	versionMask     uint32
+	diff            float64
+	lastJobID       uint32
+	lastPrevHash    [32]byte
+	lastNbits       uint32
+	lastJob         *v1Job
+	jobs            map[uint32]*downstreamJob // jobs for the current prevhash
+	prevJobs        map[uint32]*downstreamJob // jobs for the previous prevhash, kept to not lose in-flight shares
+	firstJobCh      chan struct{}
+	firstJobOnce    sync.Once
+	mu              sync.Mutex
+
+	// deps
+	miner sv2.FrameConn
+	v1    *v1Conn
+	log   gi.ILogger
+}
+
+// NewDownstream creates translator between miner stratum v2 connection and the proxy
+// stratum v1 connection. The proxy side is usually a net.Pipe end
+func NewDownstream(miner sv2.FrameConn, proxyConn net.Conn, log gi.ILogger) *Downstream {
+	return &Downstream{
+		jobs:       make(map[uint32]*downstreamJob),
+		prevJobs:   make(map[uint32]*downstreamJob),
+		firstJobCh: make(chan struct{}),
+		miner:      miner,
+		v1:         newV1Conn(proxyConn, log),
+		log:        log,
+	}
+}
+
+// Run translates messages until one of the connections closes, closes both connections on exit
+func (d *Downstream) Run(ctx context.Context) error {
+	errCh := make(chan error, 2)
+
+	go func() {
+		errCh <- d.v1.run(d.handleV1Message)
+	}()
+
+	go func() {
+		errCh <- d.runMiner(ctx)
+	}()
+
+	var err error
+	received := 0
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errCh:
+		received++
+	}
+
+	_ = d.miner.Close()
+	_ = d.v1.close()
+
+	for ; received < 2; received++ {
+		<-errCh
+	}
+
+	return err
+}
+
+func (d *Downstream) runMiner(ctx context.Context) error {
+	for {
+		frame, err := d.miner.ReadFrame()
+		if err != nil {
+			return err
+		}
+
+		msg, err := sv2.ParseStratumV2Message(frame)
+		if errors.Is(err, sv2.ErrStratumV2Unknown) {
+			d.log.Warnf("unknown stratum v2 message, ignoring: type 0x%02x", frame.Header.MsgType)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = d.handleMinerMessage(ctx, msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Downstream) handleMinerMessage(ctx context.Context, msg sv2.Message) error {
+	if !d.setupDone {
+		typed, ok := msg.(*sv2.SetupConnection)
+		if !ok {
+			return lib.WrapError(ErrSetupConnection, fmt.Errorf("expected SetupConnection, got message type 0x%02x", msg.MsgType()))
+		}
+		return d.onSetupConnection(typed)
+	}
+
+	switch typed := msg.(type) {
+	case *sv2.OpenStandardMiningChannel:
+		return d.onOpenChannel(ctx, typed.RequestID, typed.UserIdentity, false)
+	case *sv2.OpenExtendedMiningChannel:
+		return d.onOpenChannel(ctx, typed.RequestID, typed.UserIdentity, true)
+	case *sv2.SubmitSharesStandard:
+		return d.onSubmit(typed, nil)
+	case *sv2.SubmitSharesExtended:
+		return d.onSubmit(&typed.SubmitSharesStandard, typed.Extranonce)
+	case *sv2.UpdateChannel:
+		// nominal hashrate cannot be propagated to stratum v1 upstream, difficulty is controlled by the pool
+		d.log.Debugf("update channel, nominal hashrate %.0f", typed.NominalHashRate)
+		return nil
+	case *sv2.CloseChannel:
+		return lib.WrapError(ErrChannelClosed, fmt.Errorf("reason: %s", typed.ReasonCode))
+	default:
+		d.log.Warnf("unexpected stratum v2 message from miner, ignoring: type 0x%02x", msg.MsgType())
+		return nil
+	}
+}
+
+func (d *Downstream) onSetupConnection(msg *sv2.SetupConnection) error {
+	var errCode string
+	var errFlags uint32
+
+	if msg.Protocol != sv2.ProtocolMining {
+		errCode = sv2.ErrCodeUnsupportedProtocol
+	} else if msg.MinVersion > sv2.ProtocolVersion || msg.MaxVersion < sv2.ProtocolVersion {
+		errCode = sv2.ErrCodeProtocolVersionMismatch
+	} else if msg.Flags&sv2.FlagRequiresWorkSelection != 0 {
+		errCode = sv2.ErrCodeUnsupportedFeatureFlags
+		errFlags = sv2.FlagRequiresWorkSelection
+	}
+
+	if errCode != "" {
+		_ = d.writeMiner(&sv2.SetupConnectionError{Flags: errFlags, ErrorCode: errCode})
+		return lib.WrapError(ErrSetupConnection, errors.New(errCode))
+	}
+
+	d.log.Debugf("setup connection: vendor %s, firmware %s, device %s", msg.Vendor, msg.Firmware, msg.DeviceID)
+	d.setupDone = true
+
+	return d.writeMiner(&sv2.SetupConnectionSuccess{UsedVersion: sv2.ProtocolVersion})
+}
+
+// onOpenChannel performs stratum v1 handshake (configure, subscribe, authorize) and waits
+// for the first job to be able to reply with the current target
+func (d *Downstream) onOpenChannel(ctx context.Context, requestID uint32, userIdentity string, isExtended bool) error {
+	d.mu.Lock()
+	isOpen := d.channelOpen
+	d.mu.Unlock()
+
+	if isOpen {
+		return d.writeMiner(&sv2.OpenMiningChannelError{RequestID: requestID, ErrorCode: ErrCodeTooManyChannels})
+	}
+
+	err := d.v1Handshake(ctx, userIdentity, isExtended)
+	if err != nil {
+		_ = d.writeMiner(&sv2.OpenMiningChannelError{RequestID: requestID, ErrorCode: ErrCodeChannelOpenFailed})
+		return lib.WrapError(ErrOpenChannel, err)
+	}
+
+	select {
+	case <-d.firstJobCh:
+	case <-time.After(FIRST_JOB_TIMEOUT):
+		_ = d.writeMiner(&sv2.OpenMiningChannelError{RequestID: requestID, ErrorCode: ErrCodeChannelOpenFailed})
+		return lib.WrapError(ErrOpenChannel, fmt.Errorf("no job received within %s", FIRST_JOB_TIMEOUT))
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var msg sv2.Message
+	if isExtended {
+		msg = &sv2.OpenExtendedMiningChannelSuccess{
+			RequestID:        requestID,
+			ChannelID:        DOWNSTREAM_CHANNEL_ID,
+			Target:           sv2.DifficultyToTarget(d.diff),
+			ExtranonceSize:   uint16(d.extranonce2Size),
+			ExtranoncePrefix: d.extranonce1,
+		}
+	} else {
+		msg = &sv2.OpenStandardMiningChannelSuccess{
+			RequestID:        requestID,
+			ChannelID:        DOWNSTREAM_CHANNEL_ID,
+			Target:           sv2.DifficultyToTarget(d.diff),
+			ExtranoncePrefix: d.extranonce1,
+			GroupChannelID:   DOWNSTREAM_GROUP_CHANNEL_ID,
+		}
+	}
+
+	err = d.writeMiner(msg)
+	if err != nil {
+		return err
+	}
+
+	d.channelOpen = true
+	d.log.Infof("%s mining channel opened for %s", channelKind(isExtended), userIdentity)
+
+	// the latest job is sent as a new block template, so miner gets the prevhash
+	return d.sendJob(d.lastJob, true)
+}
+
+func (d *Downstream) v1Handshake(ctx context.Context, userIdentity string, isExtended bool) error {
+	d.mu.Lock()
+	d.userName = userIdentity
+	d.isExtended = isExtended
+	d.mu.Unlock()
+
+	configure := m.NewMiningConfigure(0, &m.MiningConfigureExtensionParams{
+		VersionRollingMask:        DEFAULT_VERSION_ROLLING_MASK,
+		VersionRollingMinBitCount: 2,
+	})
+	if common.IsHexAddress(userIdentity) {
+		configure.SetLMRContractAddress(userIdentity)
+	}
+
+	res, err := d.v1.request(ctx, configure)
+	if err != nil {
+		return err
+	}
+	configureRes, err := m.ToMiningConfigureResult(res)
+	if err != nil {
+		return err
+	}
+	if configureRes.GetVersionRolling() {
+		mask, err := parseHexUint32(configureRes.GetVersionRollingMask())
+		if err != nil {
+			return fmt.Errorf("invalid version rolling mask %s", configureRes.GetVersionRollingMask())
+		}
+		d.mu.Lock()
+		d.versionRolling, d.versionMask = true, mask
+		d.mu.Unlock()
+	}
+
+	res, err = d.v1.request(ctx, m.NewMiningSubscribe(0, "stratumv2-translator", ""))
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return resultError(res)
+	}
+	subscribeRes, err := m.ToMiningSubscribeResult(res)
+	if err != nil {
+		return err
+	}
+	err = d.setExtranonce(subscribeRes.GetExtranonce())
+	if err != nil {
+		return err
+	}
+
+	res, err = d.v1.request(ctx, m.NewMiningAuthorize(0, userIdentity, ""))
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return resultError(res)
+	}
+
+	return nil
+}
+
+func (d *Downstream) setExtranonce(xn1 string, xn2size int) error {
+	xn1Bytes, err := hex.DecodeString(xn1)
+	if err != nil {
+		return fmt.Errorf("invalid extranonce1 %s", xn1)
+	}
+	d.mu.Lock()
+	d.extranonce1, d.extranonce2Size = xn1Bytes, xn2size
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *Downstream) onSubmit(msg *sv2.SubmitSharesStandard, extranonce []byte) error {
+	d.mu.Lock()
+	if msg.ChannelID != DOWNSTREAM_CHANNEL_ID || !d.channelOpen {
+		d.mu.Unlock()
+		return d.writeSubmitError(msg, sv2.ErrCodeInvalidChannelID)
+	}
+
+	job, ok := d.jobs[msg.JobID]
+	if !ok {
+		job, ok = d.prevJobs[msg.JobID]
+	}
+	if !ok {
+		d.mu.Unlock()
+		return d.writeSubmitError(msg, sv2.ErrCodeInvalidJobID)
+	}
+
+	var xn2 string
+	if d.isExtended {
+		if len(extranonce) != d.extranonce2Size {
+			d.mu.Unlock()
+			return d.writeSubmitError(msg, ErrCodeInvalidExtranonce)
+		}
+		xn2 = hex.EncodeToString(extranonce)
+	} else {
+		xn2 = strings.Repeat("00", d.extranonce2Size)
+	}
+
+	submit := m.NewMiningSubmit(d.userName, job.v1JobID, xn2, formatHexUint32(msg.Ntime), formatHexUint32(msg.Nonce))
+	if d.versionRolling {
+		submit.Params = append(submit.Params, formatHexUint32(msg.Version&d.versionMask))
+	}
+	d.mu.Unlock()
+
+	return d.v1.send(submit, func(res *m.MiningResult) {
+		var reply sv2.Message
+		if res.IsError() {
+			reply = &sv2.SubmitSharesError{
+				ChannelID:      msg.ChannelID,
+				SequenceNumber: msg.SequenceNumber,
+				ErrorCode:      submitErrorCode(res),
+			}
+		} else {
+			reply = &sv2.SubmitSharesSuccess{
+				ChannelID:               msg.ChannelID,
+				LastSequenceNumber:      msg.SequenceNumber,
+				NewSubmitsAcceptedCount: 1,
+				NewSharesSum:            uint64(job.diff),
+			}
+		}
+		err := d.writeMiner(reply)
+		if err != nil {
+			d.log.Warnf("failed to write submit result to miner: %s", err)
+		}
+	})
+}
+
+func (d *Downstream) handleV1Message(msg i.MiningMessageGeneric) error {
+	switch typed := msg.(type) {
+	case *m.MiningNotify:
+		return d.onNotify(typed)
+	case *m.MiningSetDifficulty:
+		return d.onSetDifficulty(typed)
+	case *m.MiningSetExtranonce:
+		return d.onSetExtranonce(typed)
+	case *m.MiningSetVersionMask:
+		mask, err := parseHexUint32(typed.GetVersionMask())
+		if err != nil {
+			return fmt.Errorf("invalid version mask %s", typed.GetVersionMask())
+		}
+		d.mu.Lock()
+		d.versionRolling, d.versionMask = true, mask
+		d.mu.Unlock()
+		return nil
+	default:
+		d.log.Warnf("unexpected stratum v1 message from proxy, ignoring: %s", string(msg.Serialize()))
+		return nil
+	}
+}
+
+func (d *Downstream) onNotify(msg *m.MiningNotify) error {
+	job, err := decodeNotify(msg)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastJob = job
+	d.firstJobOnce.Do(func() { close(d.firstJobCh) })
+
+	if !d.channelOpen {
+		return nil
+	}
+
+	isNewPrevHash := job.CleanJobs || job.PrevHash != d.lastPrevHash || job.Nbits != d.lastNbits
+	return d.sendJob(job, isNewPrevHash)
+}
+
+// sendJob converts v1 job and sends it to the miner, should be called with lock held.
+// If isNewPrevHash is set the job is sent as a future job followed by SetNewPrevHash
+func (d *Downstream) sendJob(job *v1Job, isNewPrevHash bool) error {
+	d.lastJobID++
+	jobID := d.lastJobID
+
+	if isNewPrevHash {
+		d.prevJobs = d.jobs
+		d.jobs = make(map[uint32]*downstreamJob)
+		d.lastPrevHash, d.lastNbits = job.PrevHash, job.Nbits
+	}
+	d.jobs[jobID] = &downstreamJob{v1JobID: job.JobID, diff: d.diff}
+
+	var minNtime *uint32
+	if !isNewPrevHash {
+		ntime := job.Ntime
+		minNtime = &ntime
+	}
+
+	var jobMsg sv2.Message
+	if d.isExtended {
+		jobMsg = &sv2.NewExtendedMiningJob{
+			ChannelID:             DOWNSTREAM_CHANNEL_ID,
+			JobID:                 jobID,
+			MinNtime:              minNtime,
+			Version:               job.Version,
+			VersionRollingAllowed: d.versionRolling,
+			MerklePath:            job.MerklePath,
+			CoinbaseTxPrefix:      job.Gen1,
+			CoinbaseTxSuffix:      job.Gen2,
+		}
+	} else {
+		// standard channel is header-only mining, extranonce2 is fixed to zeroes
+		xn := make([]byte, len(d.extranonce1)+d.extranonce2Size)
+		copy(xn, d.extranonce1)
+		jobMsg = &sv2.NewMiningJob{
+			ChannelID:  DOWNSTREAM_CHANNEL_ID,
+			JobID:      jobID,
+			MinNtime:   minNtime,
+			Version:    job.Version,
+			MerkleRoot: job.merkleRoot(xn),
+		}
+	}
+
+	err := d.writeMiner(jobMsg)
+	if err != nil {
+		return err
+	}
+
+	if !isNewPrevHash {
+		return nil
+	}
+
+	return d.writeMiner(&sv2.SetNewPrevHash{
+		ChannelID: DOWNSTREAM_CHANNEL_ID,
+		JobID:     jobID,
+		PrevHash:  job.PrevHash,
+		MinNtime:  job.Ntime,
+		Nbits:     job.Nbits,
+	})
+}
+
+func (d *Downstream) onSetDifficulty(msg *m.MiningSetDifficulty) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.diff = msg.GetDifficulty()
+	if !d.channelOpen {
+		return nil
+	}
+
+	return d.writeMiner(&sv2.SetTarget{
+		ChannelID:     DOWNSTREAM_CHANNEL_ID,
+		MaximumTarget: sv2.DifficultyToTarget(d.diff),
+	})
+}
+
+func (d *Downstream) onSetExtranonce(msg *m.MiningSetExtranonce) error {
+	err := d.setExtranonce(msg.GetExtranonce())
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// standard channel picks up new extranonce with the next job, when merkle root is recalculated
+	if !d.channelOpen || !d.isExtended {
+		return nil
+	}
+
+	return d.writeMiner(&sv2.SetExtranoncePrefix{
+		ChannelID:        DOWNSTREAM_CHANNEL_ID,
+		ExtranoncePrefix: d.extranonce1,
+	})
+}
+
+func (d *Downstream) writeSubmitError(msg *sv2.SubmitSharesStandard, code string) error {
+	return d.writeMiner(&sv2.SubmitSharesError{
+		ChannelID:      msg.ChannelID,
+		SequenceNumber: msg.SequenceNumber,
+		ErrorCode:      code,
+	})
+}
+
+func (d *Downstream) writeMiner(msg sv2.Message) error {
+	return d.miner.WriteFrame(sv2.NewFrame(msg))
+}
+
+func channelKind(isExtended bool) string {
+	if isExtended {
+		return "extended"
+	}
+	return "standard"
+}
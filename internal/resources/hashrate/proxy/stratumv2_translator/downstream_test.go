@@ -0,0 +1,193 @@
+package stratumv2_translator
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+const testNotify = `{"id":null,"method":"mining.notify","params":["2dc3427c2e","221a7d5aeda279d8b8455fe56c8dc7d05582575d00038fbf0000000000000000","01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4b03e1360cfabe6d6ddecabad1af6410018e1f62f26730ccb9c8a4a55c1c90fb96d7b124a68f126bcf0100000000000000","2e7c42c32d2f736c7573682f000000000383d02826000000001976a9147c154ed1dc59609e3d26abb2df2ea3d587cd8c4188ac00000000000000002c6a4c2952534b424c4f434b3aa126fd3abcfed0d9d2fdf56d5650fda514e1a35408b1b8445c907d21005402510000000000000000266a24aa21a9ed217bdf1fc8e2ca2f98f2f3dc804fa19609ad045e8761e3fcd6b60baf80d1f5bf00000000",["fd90b0aa15698f631ae06aba1d688db974c899389c874f03b2c91784733ac50c","278cbb17943d36be5e7eaa08b70b733edd2fc6e4143ee7c184d63c8dcb22c48e","e02743f1b8d9050160c811cd8bec5af39c07a47ccade2a466e09409eeeb90b3b","3e76f16fc336d11a98b2c438e7c47b0a6c478a0f8df7c340f57db6887aa05a17","3d84d3378f3647157355aecf67c965f01729b3223f5a787aa7a3eb3de3a33e38","356c1febe5995abebfe7b4476efbf2b83158ce37757e3045f601bb1007ef9602","0064ab04971d60a5761ef07e7ff066a2ecfced7101e73a2d8cea07a730b50695","29ef3189c3aef0da8c1b7204a91f2384b73bdafcc7c1f9123a68b15316f7c5f8","bcc9dc862a6024d4f59ecb69f2adaa1911c6e4813d65a48ead8aa5e4151fb255","7accfd2b86edba50aa41fba73248ea365deaabf12a71c6e4b663be7438d9c091","4cc849c0f0d18f993634ba7563a6c68406e60e0ab1ac4f23bd18401b6e3ab7c4","9a6c6c8936fa3b807e3fbfc107c7427691246aecb89dd8e22bde58b7f748d21b"],"20000004","17056102","64c25820",false]}`
+
+type testV1Peer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (p *testV1Peer) read(t *testing.T) i.MiningMessageGeneric {
+	line, err := p.reader.ReadBytes(lib.CharNewLine)
+	require.NoError(t, err)
+	msg, err := m.ParseStratumMessage(line)
+	require.NoError(t, err)
+	return msg
+}
+
+func (p *testV1Peer) write(t *testing.T, msg i.MiningMessageGeneric) {
+	_, err := p.conn.Write(append(msg.Serialize(), lib.CharNewLine))
+	require.NoError(t, err)
+}
+
+func readMinerMsg(t *testing.T, conn sv2.FrameReadWriter) sv2.Message {
+	frame, err := conn.ReadFrame()
+	require.NoError(t, err)
+	msg, err := sv2.ParseStratumV2Message(frame)
+	require.NoError(t, err)
+	return msg
+}
+
+func runTestDownstream(t *testing.T) (miner sv2.FrameConn, proxy *testV1Peer, cancel func()) {
+	minerClient, minerServer := net.Pipe()
+	proxyClient, proxyServer := net.Pipe()
+
+	ds := NewDownstream(sv2.NewPlainFrameConn(minerServer), proxyClient, lib.NewTestLogger())
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	doneCh := make(chan struct{})
+	go func() {
+		_ = ds.Run(ctx)
+		close(doneCh)
+	}()
+
+	return sv2.NewPlainFrameConn(minerClient),
+		&testV1Peer{conn: proxyServer, reader: bufio.NewReader(proxyServer)},
+		func() {
+			cancelCtx()
+			<-doneCh
+			_ = minerClient.Close()
+			_ = proxyServer.Close()
+		}
+}
+
+// openChannel performs setup connection and open channel, emulating proxy on the v1 side
+func openChannel(t *testing.T, miner sv2.FrameConn, proxy *testV1Peer, openMsg sv2.Message) {
+	go func() {
+		_ = miner.WriteFrame(sv2.NewFrame(&sv2.SetupConnection{
+			Protocol:   sv2.ProtocolMining,
+			MinVersion: 2,
+			MaxVersion: 2,
+		}))
+	}()
+	require.IsType(t, &sv2.SetupConnectionSuccess{}, readMinerMsg(t, miner))
+
+	go func() {
+		_ = miner.WriteFrame(sv2.NewFrame(openMsg))
+	}()
+
+	configure := proxy.read(t).(*m.MiningConfigure)
+	mask, _ := configure.GetVersionRolling()
+	require.Equal(t, DEFAULT_VERSION_ROLLING_MASK, mask)
+	proxy.write(t, m.NewMiningConfigureResult(configure.GetID(), true, "1fffe000"))
+
+	subscribe := proxy.read(t).(*m.MiningSubscribe)
+	proxy.write(t, m.NewMiningSubscribeResult(subscribe.GetID(), "11650804a6c84c", 8))
+
+	authorize := proxy.read(t).(*m.MiningAuthorize)
+	require.Equal(t, "account.worker", authorize.GetUserName())
+	proxy.write(t, m.NewMiningResultSuccess(authorize.GetID()))
+
+	notify, err := m.ParseMiningNotify([]byte(testNotify))
+	require.NoError(t, err)
+
+	proxy.write(t, m.NewMiningSetDifficulty(699))
+	proxy.write(t, notify)
+}
+
+func TestDownstreamStandardChannel(t *testing.T) {
+	miner, proxy, cancel := runTestDownstream(t)
+	defer cancel()
+
+	openChannel(t, miner, proxy, &sv2.OpenStandardMiningChannel{RequestID: 7, UserIdentity: "account.worker"})
+
+	success := readMinerMsg(t, miner).(*sv2.OpenStandardMiningChannelSuccess)
+	require.Equal(t, uint32(7), success.RequestID)
+	require.InDelta(t, 699, sv2.TargetToDifficulty(success.Target), 0.001)
+
+	notify, _ := m.ParseMiningNotify([]byte(testNotify))
+	v1job, err := decodeNotify(notify)
+	require.NoError(t, err)
+
+	job := readMinerMsg(t, miner).(*sv2.NewMiningJob)
+	require.True(t, job.IsFutureJob())
+	require.Equal(t, v1job.merkleRoot(mustDecodeHex("11650804a6c84c0000000000000000")), job.MerkleRoot)
+
+	prevHash := readMinerMsg(t, miner).(*sv2.SetNewPrevHash)
+	require.Equal(t, job.JobID, prevHash.JobID)
+	require.Equal(t, v1job.PrevHash, prevHash.PrevHash)
+
+	go func() {
+		_ = miner.WriteFrame(sv2.NewFrame(&sv2.SubmitSharesStandard{
+			ChannelID:      DOWNSTREAM_CHANNEL_ID,
+			SequenceNumber: 3,
+			JobID:          job.JobID,
+			Nonce:          0x591d28da,
+			Ntime:          0x64c25820,
+			Version:        job.Version,
+		}))
+	}()
+
+	submit := proxy.read(t).(*m.MiningSubmit)
+	require.Equal(t, notify.GetJobID(), submit.GetJobId())
+	require.Equal(t, "0000000000000000", submit.GetExtraNonce2())
+	require.Equal(t, "591d28da", submit.GetNonce())
+	proxy.write(t, m.NewMiningResultLowDifficulty(submit.GetID()))
+
+	submitErr := readMinerMsg(t, miner).(*sv2.SubmitSharesError)
+	require.Equal(t, uint32(3), submitErr.SequenceNumber)
+	require.Equal(t, sv2.ErrCodeDifficultyTooLow, submitErr.ErrorCode)
+}
+
+func TestDownstreamExtendedChannelValidShare(t *testing.T) {
+	miner, proxy, cancel := runTestDownstream(t)
+	defer cancel()
+
+	openChannel(t, miner, proxy, &sv2.OpenExtendedMiningChannel{RequestID: 1, UserIdentity: "account.worker", MinExtranonceLen: 8})
+
+	success := readMinerMsg(t, miner).(*sv2.OpenExtendedMiningChannelSuccess)
+	require.Equal(t, uint16(8), success.ExtranonceSize)
+	require.Equal(t, mustDecodeHex("11650804a6c84c"), success.ExtranoncePrefix)
+
+	job := readMinerMsg(t, miner).(*sv2.NewExtendedMiningJob)
+	_ = readMinerMsg(t, miner).(*sv2.SetNewPrevHash)
+
+	go func() {
+		_ = miner.WriteFrame(sv2.NewFrame(&sv2.SubmitSharesExtended{
+			SubmitSharesStandard: sv2.SubmitSharesStandard{
+				ChannelID:      DOWNSTREAM_CHANNEL_ID,
+				SequenceNumber: 1,
+				JobID:          job.JobID,
+				Nonce:          0x591d28da,
+				Ntime:          0x64c25820,
+				Version:        job.Version&^0x1fffe000 | 0x00092000,
+			},
+			Extranonce: mustDecodeHex("0a00000000000000"),
+		}))
+	}()
+
+	submit := proxy.read(t).(*m.MiningSubmit)
+	require.Equal(t, "00092000", submit.GetVmask())
+
+	// the translated share must be valid for the original stratum v1 job
+	notify, _ := m.ParseMiningNotify([]byte(testNotify))
+	_, ok := validator.ValidateDiff("11650804a6c84c", 8, 699, "1fffe000", notify, submit)
+	require.True(t, ok)
+
+	proxy.write(t, m.NewMiningResultSuccess(submit.GetID()))
+	submitRes := readMinerMsg(t, miner).(*sv2.SubmitSharesSuccess)
+	require.Equal(t, uint32(1), submitRes.LastSequenceNumber)
+	require.Equal(t, uint64(699), submitRes.NewSharesSum)
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
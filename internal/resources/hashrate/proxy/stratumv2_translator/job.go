@@ -0,0 +1,137 @@
+package stratumv2_translator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+)
+
+// v1Job is a stratum v1 job decoded into the binary fields used by stratum v2
+type v1Job struct {
+	JobID      string
+	PrevHash   [32]byte // as in block header
+	Gen1       []byte
+	Gen2       []byte
+	MerklePath [][32]byte
+	Version    uint32
+	Nbits      uint32
+	Ntime      uint32
+	CleanJobs  bool
+}
+
+func decodeNotify(msg *m.MiningNotify) (*v1Job, error) {
+	job := &v1Job{
+		JobID:     msg.GetJobID(),
+		CleanJobs: msg.GetCleanJobs(),
+	}
+
+	prevHash, err := hex.DecodeString(msg.GetPrevBlockHash())
+	if err != nil || len(prevHash) != 32 {
+		return nil, fmt.Errorf("invalid prevhash: %s", msg.GetPrevBlockHash())
+	}
+	// stratum v1 prevhash has 4-byte words swapped
+	for w := 0; w < 32; w += 4 {
+		for i := 0; i < 4; i++ {
+			job.PrevHash[w+i] = prevHash[w+3-i]
+		}
+	}
+
+	job.Gen1, err = hex.DecodeString(msg.GetGen1())
+	if err != nil {
+		return nil, fmt.Errorf("invalid coinbase1: %w", err)
+	}
+	job.Gen2, err = hex.DecodeString(msg.GetGen2())
+	if err != nil {
+		return nil, fmt.Errorf("invalid coinbase2: %w", err)
+	}
+
+	for _, branch := range msg.GetMerkel() {
+		branchStr, ok := branch.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid merkle branch: %v", branch)
+		}
+		b, err := hex.DecodeString(branchStr)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("invalid merkle branch: %s", branchStr)
+		}
+		var h [32]byte
+		copy(h[:], b)
+		job.MerklePath = append(job.MerklePath, h)
+	}
+
+	job.Version, err = parseHexUint32(msg.GetVersion())
+	if err != nil {
+		return nil, fmt.Errorf("invalid version: %w", err)
+	}
+	job.Nbits, err = parseHexUint32(msg.GetNbits())
+	if err != nil {
+		return nil, fmt.Errorf("invalid nbits: %w", err)
+	}
+	job.Ntime, err = parseHexUint32(msg.GetNtime())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ntime: %w", err)
+	}
+
+	return job, nil
+}
+
+// merkleRoot calculates merkle root for the coinbase built with provided extranonce
+func (j *v1Job) merkleRoot(extranonce []byte) [32]byte {
+	coinbase := make([]byte, 0, len(j.Gen1)+len(extranonce)+len(j.Gen2))
+	coinbase = append(coinbase, j.Gen1...)
+	coinbase = append(coinbase, extranonce...)
+	coinbase = append(coinbase, j.Gen2...)
+
+	root := sha256d(coinbase)
+	for _, branch := range j.MerklePath {
+		root = sha256d(append(root[:], branch[:]...))
+	}
+	return root
+}
+
+func parseHexUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	return uint32(v), err
+}
+
+func formatHexUint32(v uint32) string {
+	return fmt.Sprintf("%08x", v)
+}
+
+// prevHashToV1 converts block header prevhash to stratum v1 representation with swapped 4-byte words
+func prevHashToV1(prevHash [32]byte) string {
+	b := make([]byte, 32)
+	for w := 0; w < 32; w += 4 {
+		for i := 0; i < 4; i++ {
+			b[w+i] = prevHash[w+3-i]
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+func sha256d(data []byte) [32]byte {
+	sum := sha256.Sum256(data)
+	return sha256.Sum256(sum[:])
+}
+
+// submitErrorCode maps stratum v1 submit error to the stratum v2 error code
+func submitErrorCode(res *m.MiningResult) string {
+	errStr := strings.ToLower(res.GetError())
+	switch {
+	case strings.Contains(errStr, "job"):
+		return sv2.ErrCodeInvalidJobID
+	case strings.Contains(errStr, "stale"):
+		return sv2.ErrCodeStaleShare
+	case strings.Contains(errStr, "low difficulty"), strings.Contains(errStr, "above target"):
+		return sv2.ErrCodeDifficultyTooLow
+	case strings.Contains(errStr, "duplicate"):
+		return ErrCodeDuplicateShare
+	default:
+		return ErrCodeInvalidShare
+	}
+}
@@ -0,0 +1,552 @@
+package stratumv2_translator
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+)
+
+const (
+	UPSTREAM_RESPONSE_TIMEOUT = 30 * time.Second
+	UPSTREAM_VENDOR           = "proxy-router"
+	// nominal hashrate reported to the pool when opening a channel, the pool uses it to pick
+	// initial target. The real hashrate is not known until the miner starts submitting shares
+	UPSTREAM_NOMINAL_HASHRATE = 100e12
+	UPSTREAM_MIN_EXTRANONCE   = 4
+	// version bits that may be rolled by miners as in BIP320
+	UPSTREAM_VERSION_ROLLING_MASK = 0x1fffe000
+)
+
+var (
+	ErrUpstreamSetup   = errors.New("stratum v2 upstream setup failed")
+	ErrUpstreamChannel = errors.New("stratum v2 upstream channel failed")
+	ErrUpstreamClosed  = errors.New("stratum v2 upstream closed connection")
+)
+
+type upstreamJob struct {
+	Version               uint32
+	VersionRollingAllowed bool
+	MerklePath            [][32]byte
+	CoinbaseTxPrefix      []byte
+	CoinbaseTxSuffix      []byte
+}
+
+// Upstream connects to a stratum v2 pool and exposes it as a stratum v1 pool, so ConnDest and
+// the validator keep working with stratum v1 messages. It opens a single extended channel,
+// jobs are forwarded to the proxy as mining.notify with the extranonce prefix as extranonce1.
+// The channel is opened by Setup with the user identity from the destination URL, because
+// stratum v2 has no separate authorization step, mining.subscribe is answered with its extranonce
+type Upstream struct {
+	// config
+	userIdentity string
+	endpoint     *url.URL
+
+	// state
+	channelID       uint32
+	channelOpen     bool
+	subscribed      bool
+	versionMask     uint32
+	extranonce1     []byte
+	extranonce2Size int
+	target          [32]byte
+	prevHash        [32]byte
+	nbits           uint32
+	hasPrevHash     bool
+	jobs            map[uint32]*upstreamJob
+	pendingV1       []i.MiningMessageGeneric // messages queued until subscribe result is sent
+	lastSeqNum      uint32
+	pendingSubmits  map[uint32]int // sequence number -> stratum v1 message ID
+	mu              sync.Mutex
+
+	// deps
+	pool sv2.FrameConn
+	v1   *v1Conn
+	log  gi.ILogger
+}
+
+// NewUpstream creates translator between stratum v2 pool connection and the proxy stratum v1 connection.
+// The proxy side is usually a net.Pipe end
+func NewUpstream(pool sv2.FrameConn, proxyConn net.Conn, endpoint *url.URL, log gi.ILogger) *Upstream {
+	return &Upstream{
+		userIdentity:   endpoint.User.Username(),
+		endpoint:       endpoint,
+		jobs:           make(map[uint32]*upstreamJob),
+		pendingSubmits: make(map[uint32]int),
+		pool:           pool,
+		v1:             newV1Conn(proxyConn, log),
+		log:            log,
+	}
+}
+
+// Setup sets up the connection and opens the extended channel, so the pool errors are reported
+// before the connection is handed over to the proxy. It doesn't observe any timeout, the caller
+// should set the deadline on the underlying connection. Closes both connections on error
+func (u *Upstream) Setup() error {
+	err := u.setupConnection()
+	if err == nil {
+		err = u.openChannel()
+	}
+	if err != nil {
+		_ = u.pool.Close()
+		_ = u.v1.close()
+		return err
+	}
+	return nil
+}
+
+// Run translates messages until one of the connections closes or ctx is cancelled,
+// closes both connections on exit. Setup should be called first
+func (u *Upstream) Run(ctx context.Context) error {
+	var err error
+	errCh := make(chan error, 2)
+
+	go func() {
+		errCh <- u.v1.run(u.handleV1Message)
+	}()
+
+	go func() {
+		errCh <- u.runPool()
+	}()
+
+	received := 0
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errCh:
+		received++
+	}
+
+	_ = u.pool.Close()
+	_ = u.v1.close()
+
+	for ; received < 2; received++ {
+		<-errCh
+	}
+
+	return err
+}
+
+func (u *Upstream) setupConnection() error {
+	host, portStr, _ := net.SplitHostPort(u.endpoint.Host)
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+
+	err := u.writePool(&sv2.SetupConnection{
+		Protocol:     sv2.ProtocolMining,
+		MinVersion:   sv2.ProtocolVersion,
+		MaxVersion:   sv2.ProtocolVersion,
+		Flags:        sv2.FlagRequiresVersionRolling,
+		EndpointHost: host,
+		EndpointPort: uint16(port),
+		Vendor:       UPSTREAM_VENDOR,
+	})
+	if err != nil {
+		return lib.WrapError(ErrUpstreamSetup, err)
+	}
+
+	frame, err := u.pool.ReadFrame()
+	if err != nil {
+		return lib.WrapError(ErrUpstreamSetup, err)
+	}
+	msg, err := sv2.ParseStratumV2Message(frame)
+	if err != nil {
+		return lib.WrapError(ErrUpstreamSetup, err)
+	}
+
+	switch typed := msg.(type) {
+	case *sv2.SetupConnectionSuccess:
+		if typed.Flags&sv2.FlagRequiresFixedVersion != 0 {
+			u.log.Warnf("pool requires fixed version, version rolling is disabled")
+		}
+		return nil
+	case *sv2.SetupConnectionError:
+		return lib.WrapError(ErrUpstreamSetup, fmt.Errorf("pool error: %s", typed.ErrorCode))
+	default:
+		return lib.WrapError(ErrUpstreamSetup, fmt.Errorf("unexpected message type 0x%02x", msg.MsgType()))
+	}
+}
+
+// openChannel opens the extended channel and waits for the response, the messages received
+// meanwhile are handled as usual and queued for the proxy until it subscribes
+func (u *Upstream) openChannel() error {
+	err := u.writePool(&sv2.OpenExtendedMiningChannel{
+		RequestID:        1,
+		UserIdentity:     u.userIdentity,
+		NominalHashRate:  UPSTREAM_NOMINAL_HASHRATE,
+		MaxTarget:        sv2.DifficultyToTarget(0),
+		MinExtranonceLen: UPSTREAM_MIN_EXTRANONCE,
+	})
+	if err != nil {
+		return lib.WrapError(ErrUpstreamChannel, err)
+	}
+
+	for {
+		msg, err := u.readPool()
+		if err != nil {
+			return lib.WrapError(ErrUpstreamChannel, err)
+		}
+
+		switch typed := msg.(type) {
+		case nil:
+			continue
+		case *sv2.OpenMiningChannelError:
+			return lib.WrapError(ErrUpstreamChannel, fmt.Errorf("pool error: %s", typed.ErrorCode))
+		case *sv2.OpenExtendedMiningChannelSuccess:
+			u.mu.Lock()
+			u.channelID = typed.ChannelID
+			u.channelOpen = true
+			u.extranonce1 = typed.ExtranoncePrefix
+			u.extranonce2Size = int(typed.ExtranonceSize)
+			u.target = typed.Target
+			u.mu.Unlock()
+
+			u.log.Infof("extended mining channel opened for %s", u.userIdentity)
+			return nil
+		default:
+			err = u.handlePoolMessage(msg)
+			if err != nil {
+				return lib.WrapError(ErrUpstreamChannel, err)
+			}
+		}
+	}
+}
+
+func (u *Upstream) runPool() error {
+	for {
+		msg, err := u.readPool()
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+
+		err = u.handlePoolMessage(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readPool reads the next message from the pool, returns nil message for the unknown message type
+func (u *Upstream) readPool() (sv2.Message, error) {
+	frame, err := u.pool.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := sv2.ParseStratumV2Message(frame)
+	if errors.Is(err, sv2.ErrStratumV2Unknown) {
+		u.log.Warnf("unknown stratum v2 message, ignoring: type 0x%02x", frame.Header.MsgType)
+		return nil, nil
+	}
+	return msg, err
+}
+
+func (u *Upstream) handlePoolMessage(msg sv2.Message) error {
+	switch typed := msg.(type) {
+	case *sv2.OpenExtendedMiningChannelSuccess, *sv2.OpenMiningChannelError:
+		u.log.Warnf("unexpected open channel response, ignoring")
+		return nil
+	case *sv2.NewExtendedMiningJob:
+		return u.onNewJob(typed)
+	case *sv2.SetNewPrevHash:
+		return u.onSetNewPrevHash(typed)
+	case *sv2.SetTarget:
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.target = typed.MaximumTarget
+		return u.writeV1Locked(m.NewMiningSetDifficulty(sv2.TargetToDifficulty(typed.MaximumTarget)))
+	case *sv2.SetExtranoncePrefix:
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.extranonce1 = typed.ExtranoncePrefix
+		return u.writeV1Locked(m.NewMiningSetExtranonce(hex.EncodeToString(typed.ExtranoncePrefix), u.extranonce2Size))
+	case *sv2.SubmitSharesSuccess:
+		return u.onSubmitSuccess(typed)
+	case *sv2.SubmitSharesError:
+		return u.onSubmitError(typed)
+	case *sv2.CloseChannel:
+		return lib.WrapError(ErrUpstreamClosed, fmt.Errorf("channel closed: %s", typed.ReasonCode))
+	case *sv2.Reconnect:
+		return lib.WrapError(ErrUpstreamClosed, fmt.Errorf("pool requested reconnect to %s:%d", typed.NewHost, typed.NewPort))
+	default:
+		u.log.Warnf("unexpected stratum v2 message from pool, ignoring: type 0x%02x", msg.MsgType())
+		return nil
+	}
+}
+
+func (u *Upstream) handleV1Message(msg i.MiningMessageGeneric) error {
+	switch typed := msg.(type) {
+	case *m.MiningConfigure:
+		return u.onConfigure(typed)
+	case *m.MiningSubscribe:
+		return u.onSubscribe(typed)
+	case *m.MiningAuthorize:
+		return u.onAuthorize(typed)
+	case *m.MiningSubmit:
+		return u.onSubmit(typed)
+	default:
+		u.log.Warnf("unexpected stratum v1 message from proxy: %s", string(msg.Serialize()))
+		if req, ok := msg.(i.MiningMessageWithID); ok {
+			return u.v1.write(m.NewMiningResultUnsupportedMethod(req.GetID()))
+		}
+		return nil
+	}
+}
+
+func (u *Upstream) onConfigure(msg *m.MiningConfigure) error {
+	maskStr, _ := msg.GetVersionRolling()
+	if maskStr == "" {
+		return u.v1.write(m.NewMiningConfigureResult(msg.GetID(), false, ""))
+	}
+
+	mask, err := parseHexUint32(maskStr)
+	if err != nil {
+		return fmt.Errorf("invalid version rolling mask %s", maskStr)
+	}
+
+	u.mu.Lock()
+	u.versionMask = mask & UPSTREAM_VERSION_ROLLING_MASK
+	u.mu.Unlock()
+
+	return u.v1.write(m.NewMiningConfigureResult(msg.GetID(), true, formatHexUint32(mask&UPSTREAM_VERSION_ROLLING_MASK)))
+}
+
+// onSubscribe answers with the extranonce of the channel opened during setup and flushes the
+// messages received before
+func (u *Upstream) onSubscribe(msg *m.MiningSubscribe) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	err := u.v1.write(m.NewMiningSubscribeResult(msg.GetID(), hex.EncodeToString(u.extranonce1), u.extranonce2Size))
+	if err != nil || u.subscribed {
+		return err
+	}
+	u.subscribed = true
+
+	// difficulty is sent first, so it applies to the jobs received during channel opening
+	err = u.v1.write(m.NewMiningSetDifficulty(sv2.TargetToDifficulty(u.target)))
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range u.pendingV1 {
+		err = u.v1.write(pending)
+		if err != nil {
+			return err
+		}
+	}
+	u.pendingV1 = nil
+
+	return nil
+}
+
+func (u *Upstream) onAuthorize(msg *m.MiningAuthorize) error {
+	u.mu.Lock()
+	isOpen := u.channelOpen
+	u.mu.Unlock()
+
+	if !isOpen {
+		return u.v1.write(m.NewMiningResultFalse(msg.GetID()))
+	}
+	if msg.GetUserName() != u.userIdentity {
+		u.log.Debugf("authorize as %s, channel is opened as %s", msg.GetUserName(), u.userIdentity)
+	}
+	return u.v1.write(m.NewMiningResultSuccess(msg.GetID()))
+}
+
+// onSubmit forwards the share to the pool, malformed share is rejected without affecting the connection
+func (u *Upstream) onSubmit(msg *m.MiningSubmit) error {
+	reject := func(reason string) error {
+		u.log.Debugf("share rejected: %s", reason)
+		return u.v1.write(m.NewMiningResultInvalidShare(msg.GetID(), reason))
+	}
+
+	if len(msg.Params) < 5 {
+		return reject("malformed submit params")
+	}
+	jobID, err := strconv.ParseUint(msg.GetJobId(), 16, 32)
+	if err != nil {
+		return u.v1.write(m.NewMiningResultJobNotFound(msg.GetID()))
+	}
+	nonce, err := parseHexUint32(msg.GetNonce())
+	if err != nil {
+		return reject(fmt.Sprintf("invalid nonce %s", msg.GetNonce()))
+	}
+	ntime, err := parseHexUint32(msg.GetNtime())
+	if err != nil {
+		return reject(fmt.Sprintf("invalid ntime %s", msg.GetNtime()))
+	}
+	xn2, err := hex.DecodeString(msg.GetExtraNonce2())
+	if err != nil {
+		return reject(fmt.Sprintf("invalid extranonce2 %s", msg.GetExtraNonce2()))
+	}
+	vbits, err := parseHexUint32(msg.GetVmask())
+	if err != nil {
+		return reject(fmt.Sprintf("invalid version bits %s", msg.GetVmask()))
+	}
+
+	u.mu.Lock()
+	job, ok := u.jobs[uint32(jobID)]
+	if !ok {
+		u.mu.Unlock()
+		return u.v1.write(m.NewMiningResultJobNotFound(msg.GetID()))
+	}
+	if len(xn2) != u.extranonce2Size {
+		u.mu.Unlock()
+		return reject(fmt.Sprintf("invalid extranonce2 size %d, expected %d", len(xn2), u.extranonce2Size))
+	}
+	if vbits&u.versionMask != 0 && !job.VersionRollingAllowed {
+		u.mu.Unlock()
+		return reject("version rolling is not allowed for the job")
+	}
+
+	u.lastSeqNum++
+	seqNum := u.lastSeqNum
+	u.pendingSubmits[seqNum] = msg.GetID()
+
+	submit := &sv2.SubmitSharesExtended{
+		SubmitSharesStandard: sv2.SubmitSharesStandard{
+			ChannelID:      u.channelID,
+			SequenceNumber: seqNum,
+			JobID:          uint32(jobID),
+			Nonce:          nonce,
+			Ntime:          ntime,
+			Version:        job.Version&^u.versionMask | vbits&u.versionMask,
+		},
+		Extranonce: xn2,
+	}
+	u.mu.Unlock()
+
+	return u.writePool(submit)
+}
+
+// onSubmitSuccess acknowledges all pending shares up to the last sequence number, cause pool may batch responses
+func (u *Upstream) onSubmitSuccess(msg *sv2.SubmitSharesSuccess) error {
+	u.mu.Lock()
+	var ids []int
+	for seqNum, id := range u.pendingSubmits {
+		if seqNum <= msg.LastSequenceNumber {
+			ids = append(ids, id)
+			delete(u.pendingSubmits, seqNum)
+		}
+	}
+	u.mu.Unlock()
+
+	for _, id := range ids {
+		err := u.v1.write(m.NewMiningResultSuccess(id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Upstream) onSubmitError(msg *sv2.SubmitSharesError) error {
+	u.mu.Lock()
+	id, ok := u.pendingSubmits[msg.SequenceNumber]
+	delete(u.pendingSubmits, msg.SequenceNumber)
+	u.mu.Unlock()
+
+	if !ok {
+		u.log.Warnf("submit error for unknown sequence number %d: %s", msg.SequenceNumber, msg.ErrorCode)
+		return nil
+	}
+
+	var res *m.MiningResult
+	switch msg.ErrorCode {
+	case sv2.ErrCodeInvalidJobID, sv2.ErrCodeStaleShare:
+		res = m.NewMiningResultJobNotFound(id)
+	case sv2.ErrCodeDifficultyTooLow:
+		res = m.NewMiningResultLowDifficulty(id)
+	case ErrCodeDuplicateShare:
+		res = m.NewMiningResultDuplicatedShare(id)
+	default:
+		res = m.NewMiningResultFalse(id)
+	}
+	return u.v1.write(res)
+}
+
+func (u *Upstream) onNewJob(msg *sv2.NewExtendedMiningJob) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	job := &upstreamJob{
+		Version:               msg.Version,
+		VersionRollingAllowed: msg.VersionRollingAllowed,
+		MerklePath:            msg.MerklePath,
+		CoinbaseTxPrefix:      msg.CoinbaseTxPrefix,
+		CoinbaseTxSuffix:      msg.CoinbaseTxSuffix,
+	}
+	u.jobs[msg.JobID] = job
+
+	// future job is sent to the proxy when it is activated by SetNewPrevHash
+	if msg.IsFutureJob() || !u.hasPrevHash {
+		return nil
+	}
+
+	return u.writeV1Locked(u.toNotify(msg.JobID, job, *msg.MinNtime, false))
+}
+
+func (u *Upstream) onSetNewPrevHash(msg *sv2.SetNewPrevHash) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.prevHash, u.nbits, u.hasPrevHash = msg.PrevHash, msg.Nbits, true
+
+	job, ok := u.jobs[msg.JobID]
+	if !ok {
+		return fmt.Errorf("SetNewPrevHash for unknown job %d", msg.JobID)
+	}
+
+	// jobs for the previous block are no longer valid
+	u.jobs = map[uint32]*upstreamJob{msg.JobID: job}
+
+	return u.writeV1Locked(u.toNotify(msg.JobID, job, msg.MinNtime, true))
+}
+
+// toNotify converts job to the mining.notify, should be called with lock held
+func (u *Upstream) toNotify(jobID uint32, job *upstreamJob, ntime uint32, cleanJobs bool) *m.MiningNotify {
+	merkel := make([]string, len(job.MerklePath))
+	for i, branch := range job.MerklePath {
+		merkel[i] = hex.EncodeToString(branch[:])
+	}
+
+	return m.NewMiningNotify(
+		strconv.FormatUint(uint64(jobID), 16),
+		prevHashToV1(u.prevHash),
+		hex.EncodeToString(job.CoinbaseTxPrefix),
+		hex.EncodeToString(job.CoinbaseTxSuffix),
+		merkel,
+		formatHexUint32(job.Version),
+		formatHexUint32(u.nbits),
+		formatHexUint32(ntime),
+		cleanJobs,
+	)
+}
+
+// writeV1Locked writes message to the proxy or queues it until subscribe result is sent,
+// should be called with lock held
+func (u *Upstream) writeV1Locked(msg i.MiningMessageGeneric) error {
+	if !u.subscribed {
+		u.pendingV1 = append(u.pendingV1, msg)
+		return nil
+	}
+	return u.v1.write(msg)
+}
+
+func (u *Upstream) writePool(msg sv2.Message) error {
+	return u.pool.WriteFrame(sv2.NewFrame(msg))
+}
@@ -0,0 +1,222 @@
+package stratumv2_translator
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	sv2 "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv2_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+)
+
+func TestUpstreamTranslatesJobsAndShares(t *testing.T) {
+	poolClient, poolServer := net.Pipe()
+	proxyClient, proxyServer := net.Pipe()
+	pool := sv2.NewPlainFrameConn(poolServer)
+	proxy := &testV1Peer{conn: proxyClient, reader: bufio.NewReader(proxyClient)}
+
+	endpoint, _ := url.Parse("stratum2+tcp://account.worker@localhost:3336")
+	us := NewUpstream(sv2.NewPlainFrameConn(poolClient), proxyServer, endpoint, lib.NewTestLogger())
+
+	notify, err := m.ParseMiningNotify([]byte(testNotify))
+	require.NoError(t, err)
+	v1job, err := decodeNotify(notify)
+	require.NoError(t, err)
+
+	// setup connection and open extended channel, the job received meanwhile is queued
+	setupErrCh := make(chan error, 1)
+	go func() {
+		setupErrCh <- us.Setup()
+	}()
+
+	setup := readMinerMsg(t, pool).(*sv2.SetupConnection)
+	require.Equal(t, sv2.ProtocolMining, setup.Protocol)
+	require.Equal(t, "localhost", setup.EndpointHost)
+	require.NoError(t, pool.WriteFrame(sv2.NewFrame(&sv2.SetupConnectionSuccess{UsedVersion: 2})))
+
+	open := readMinerMsg(t, pool).(*sv2.OpenExtendedMiningChannel)
+	require.Equal(t, "account.worker", open.UserIdentity)
+
+	require.NoError(t, pool.WriteFrame(sv2.NewFrame(&sv2.OpenExtendedMiningChannelSuccess{
+		RequestID:        open.RequestID,
+		ChannelID:        5,
+		Target:           sv2.DifficultyToTarget(699),
+		ExtranonceSize:   8,
+		ExtranoncePrefix: mustDecodeHex("11650804a6c84c"),
+	})))
+	require.NoError(t, <-setupErrCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneCh := make(chan struct{})
+	go func() {
+		_ = us.Run(ctx)
+		close(doneCh)
+	}()
+	defer func() {
+		cancel()
+		<-doneCh
+		_ = poolServer.Close()
+		_ = proxyClient.Close()
+	}()
+
+	go func() {
+		_ = pool.WriteFrame(sv2.NewFrame(&sv2.NewExtendedMiningJob{
+			ChannelID:             5,
+			JobID:                 10,
+			Version:               v1job.Version,
+			VersionRollingAllowed: true,
+			MerklePath:            v1job.MerklePath,
+			CoinbaseTxPrefix:      v1job.Gen1,
+			CoinbaseTxSuffix:      v1job.Gen2,
+		}))
+		_ = pool.WriteFrame(sv2.NewFrame(&sv2.SetNewPrevHash{
+			ChannelID: 5,
+			JobID:     10,
+			PrevHash:  v1job.PrevHash,
+			MinNtime:  v1job.Ntime,
+			Nbits:     v1job.Nbits,
+		}))
+	}()
+
+	// configure is answered locally
+	proxy.write(t, m.NewMiningConfigure(1, &m.MiningConfigureExtensionParams{VersionRollingMask: "ffffffff", VersionRollingMinBitCount: 2}))
+	configureRes, err := m.ToMiningConfigureResult(proxy.read(t).(*m.MiningResult))
+	require.NoError(t, err)
+	require.Equal(t, "1fffe000", configureRes.GetVersionRollingMask())
+
+	// subscribe is answered with the channel extranonce, queued messages follow
+	proxy.write(t, m.NewMiningSubscribe(2, "test", ""))
+	subscribeRes, err := m.ToMiningSubscribeResult(proxy.read(t).(*m.MiningResult))
+	require.NoError(t, err)
+	xn, xnSize := subscribeRes.GetExtranonce()
+	require.Equal(t, "11650804a6c84c", xn)
+	require.Equal(t, 8, xnSize)
+
+	setDiff := proxy.read(t).(*m.MiningSetDifficulty)
+	require.InDelta(t, 699, setDiff.GetDifficulty(), 0.001)
+
+	gotNotify := proxy.read(t).(*m.MiningNotify)
+	require.Equal(t, "a", gotNotify.GetJobID())
+	require.Equal(t, notify.GetPrevBlockHash(), gotNotify.GetPrevBlockHash())
+	require.Equal(t, notify.GetGen1(), gotNotify.GetGen1())
+	require.Equal(t, notify.GetMerkel(), gotNotify.GetMerkel())
+	require.Equal(t, notify.GetNbits(), gotNotify.GetNbits())
+	require.True(t, gotNotify.GetCleanJobs())
+
+	// share valid for the translated job is forwarded as extended share
+	proxy.write(t, m.NewMiningAuthorize(3, "account.worker", ""))
+	require.False(t, proxy.read(t).(*m.MiningResult).IsError())
+
+	submit := m.NewMiningSubmit("account.worker", "a", "0a00000000000000", "64c25820", "591d28da")
+	submit.Params = append(submit.Params, "00092000")
+	submit.SetID(4)
+
+	_, ok := validator.ValidateDiff(xn, uint(xnSize), 699, "1fffe000", gotNotify, submit)
+	require.True(t, ok)
+
+	proxy.write(t, submit)
+	share := readMinerMsg(t, pool).(*sv2.SubmitSharesExtended)
+	require.Equal(t, uint32(5), share.ChannelID)
+	require.Equal(t, uint32(10), share.JobID)
+	require.Equal(t, uint32(0x591d28da), share.Nonce)
+	require.Equal(t, v1job.Version&^0x1fffe000|0x00092000, share.Version)
+	require.Equal(t, mustDecodeHex("0a00000000000000"), share.Extranonce)
+
+	go func() {
+		_ = pool.WriteFrame(sv2.NewFrame(&sv2.SubmitSharesSuccess{
+			ChannelID:               5,
+			LastSequenceNumber:      share.SequenceNumber,
+			NewSubmitsAcceptedCount: 1,
+			NewSharesSum:            699,
+		}))
+	}()
+	res := proxy.read(t).(*m.MiningResult)
+	require.Equal(t, 4, res.GetID())
+	require.False(t, res.IsError())
+
+	// malformed share is rejected, the upstream keeps working
+	malformed := m.NewMiningSubmit("account.worker", "a", "0a00000000000000", "64c25820", "zz")
+	malformed.SetID(5)
+	proxy.write(t, malformed)
+	res = proxy.read(t).(*m.MiningResult)
+	require.Equal(t, 5, res.GetID())
+	require.Contains(t, res.GetError(), "invalid nonce")
+
+	short := m.NewMiningSubmit("account.worker", "a", "0a00000000000000", "64c25820", "591d28da")
+	short.Params = short.Params[:4]
+	short.SetID(6)
+	proxy.write(t, short)
+	require.True(t, proxy.read(t).(*m.MiningResult).IsError())
+
+	// unsupported request is answered right away
+	proxy.write(t, m.NewMiningExtranonceSubscribe(7))
+	res = proxy.read(t).(*m.MiningResult)
+	require.Equal(t, 7, res.GetID())
+	require.True(t, res.IsError())
+
+	// rolled version bits are rejected for the job that doesn't allow version rolling
+	go func() {
+		_ = pool.WriteFrame(sv2.NewFrame(&sv2.NewExtendedMiningJob{
+			ChannelID:             5,
+			JobID:                 11,
+			MinNtime:              &v1job.Ntime,
+			Version:               v1job.Version,
+			VersionRollingAllowed: false,
+			MerklePath:            v1job.MerklePath,
+			CoinbaseTxPrefix:      v1job.Gen1,
+			CoinbaseTxSuffix:      v1job.Gen2,
+		}))
+	}()
+	require.Equal(t, "b", proxy.read(t).(*m.MiningNotify).GetJobID())
+
+	rolled := m.NewMiningSubmit("account.worker", "b", "0a00000000000000", "64c25820", "591d28da")
+	rolled.Params = append(rolled.Params, "00092000")
+	rolled.SetID(8)
+	proxy.write(t, rolled)
+	res = proxy.read(t).(*m.MiningResult)
+	require.Equal(t, 8, res.GetID())
+	require.Contains(t, res.GetError(), "version rolling")
+
+	notRolled := m.NewMiningSubmit("account.worker", "b", "0a00000000000000", "64c25820", "591d28da")
+	notRolled.SetID(9)
+	proxy.write(t, notRolled)
+	share = readMinerMsg(t, pool).(*sv2.SubmitSharesExtended)
+	require.Equal(t, uint32(11), share.JobID)
+	require.Equal(t, v1job.Version, share.Version)
+}
+
+func TestUpstreamSetupChannelRejected(t *testing.T) {
+	poolClient, poolServer := net.Pipe()
+	proxyClient, proxyServer := net.Pipe()
+	defer func() {
+		_ = poolServer.Close()
+		_ = proxyClient.Close()
+	}()
+	pool := sv2.NewPlainFrameConn(poolServer)
+
+	endpoint, _ := url.Parse("stratum2+tcp://account.worker@localhost:3336")
+	us := NewUpstream(sv2.NewPlainFrameConn(poolClient), proxyServer, endpoint, lib.NewTestLogger())
+
+	setupErrCh := make(chan error, 1)
+	go func() {
+		setupErrCh <- us.Setup()
+	}()
+
+	_ = readMinerMsg(t, pool).(*sv2.SetupConnection)
+	require.NoError(t, pool.WriteFrame(sv2.NewFrame(&sv2.SetupConnectionSuccess{UsedVersion: 2})))
+
+	open := readMinerMsg(t, pool).(*sv2.OpenExtendedMiningChannel)
+	require.NoError(t, pool.WriteFrame(sv2.NewFrame(&sv2.OpenMiningChannelError{
+		RequestID: open.RequestID,
+		ErrorCode: "unknown-user",
+	})))
+
+	err := <-setupErrCh
+	require.ErrorIs(t, err, ErrUpstreamChannel)
+	require.Contains(t, err.Error(), "unknown-user")
+}
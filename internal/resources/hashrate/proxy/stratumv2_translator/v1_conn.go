@@ -0,0 +1,140 @@
+package stratumv2_translator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+var (
+	ErrV1ConnClosed = errors.New("stratum v1 connection closed")
+)
+
+type resultHandler = func(res *m.MiningResult)
+
+// v1Conn is a minimal stratum v1 endpoint used by translators, it matches results
+// to the requests and passes all other messages to the message handler
+type v1Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+
+	lastID    int
+	pending   map[int]resultHandler
+	pendingMu sync.Mutex
+	closedCh  chan struct{}
+
+	log gi.ILogger
+}
+
+func newV1Conn(conn net.Conn, log gi.ILogger) *v1Conn {
+	return &v1Conn{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		pending:  make(map[int]resultHandler),
+		closedCh: make(chan struct{}),
+		log:      log,
+	}
+}
+
+// run reads messages until connection is closed, results are dispatched to the
+// registered handlers, the rest of the messages are passed to onMessage
+func (c *v1Conn) run(onMessage func(msg i.MiningMessageGeneric) error) error {
+	defer close(c.closedCh)
+
+	for {
+		line, err := c.reader.ReadBytes(lib.CharNewLine)
+		if err != nil {
+			return lib.WrapError(ErrV1ConnClosed, err)
+		}
+
+		msg, err := m.ParseStratumMessage(line)
+		if errors.Is(err, m.ErrStratumV1Unknown) {
+			c.log.Warnf("unknown stratum v1 message: %s", string(line))
+			// requests are answered right away, so the sender doesn't wait for the timeout
+			if generic, err := m.ParseGenericMessage(line); err == nil && generic.ID != 0 {
+				if err := c.write(m.NewMiningResultUnsupportedMethod(generic.ID)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if res, ok := msg.(*m.MiningResult); ok {
+			c.pendingMu.Lock()
+			handler, ok := c.pending[res.GetID()]
+			delete(c.pending, res.GetID())
+			c.pendingMu.Unlock()
+
+			if !ok {
+				c.log.Warnf("unexpected result, ignoring: %s", string(line))
+				continue
+			}
+			handler(res)
+			continue
+		}
+
+		err = onMessage(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *v1Conn) write(msg i.MiningMessageGeneric) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err := c.conn.Write(append(msg.Serialize(), lib.CharNewLine))
+	return err
+}
+
+// send assigns message ID and calls handler when result is received
+func (c *v1Conn) send(msg i.MiningMessageWithID, handler resultHandler) error {
+	c.pendingMu.Lock()
+	c.lastID++
+	msg.SetID(c.lastID)
+	c.pending[c.lastID] = handler
+	c.pendingMu.Unlock()
+
+	return c.write(msg)
+}
+
+// request sends message and waits for the result
+func (c *v1Conn) request(ctx context.Context, msg i.MiningMessageWithID) (*m.MiningResult, error) {
+	resCh := make(chan *m.MiningResult, 1)
+	err := c.send(msg, func(res *m.MiningResult) {
+		resCh <- res
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-resCh:
+		return res, nil
+	case <-c.closedCh:
+		return nil, ErrV1ConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *v1Conn) close() error {
+	return c.conn.Close()
+}
+
+func resultError(res *m.MiningResult) error {
+	return fmt.Errorf("stratum v1 error: %s", res.GetError())
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gi "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	m "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+const (
+	SUBMIT_QUEUE_SIZE      = 256             // maximum number of shares waiting to be submitted per destination
+	SUBMIT_QUEUE_WORKERS   = 4               // number of submits awaiting pool response concurrently per destination
+	SUBMIT_ENQUEUE_TIMEOUT = 5 * time.Second // for how long reading from the miner is blocked when the queue is full
+	SUBMIT_MAX_AGE         = 2 * time.Minute // shares that weren't submitted within this time are dropped
+	SUBMIT_RETRY_INTERVAL  = 1 * time.Second // interval of checking if the destination has reconnected
+	SUBMIT_WORKER_IDLE     = 1 * time.Minute // workers exit after being idle, so queues of unused destinations don't hold goroutines
+	SUBMIT_DRAIN_TIMEOUT   = 5 * time.Second // for how long the destination change waits for the submitted shares to be answered
+)
+
+var (
+	ErrSubmitQueueFull   = errors.New("submit queue is full")
+	ErrSubmitQueueClosed = errors.New("submit queue is closed")
+	ErrSubmitExpired     = errors.New("share was not submitted in time")
+)
+
+// SubmitResultFunc is called once per share with either the pool response or the error
+type SubmitResultFunc func(dest *ConnDest, res *m.MiningResult, err error)
+
+type submitItem struct {
+	msg        *m.MiningSubmit
+	enqueuedAt time.Time
+	onResult   SubmitResultFunc
+}
+
+// SubmitQueue is a bounded queue of shares to be submitted to a single destination.
+// Shares that failed to be written because of the destination connection error
+// are retried when the destination reconnects
+type SubmitQueue struct {
+	// config
+	destID      string
+	workers     int
+	maxAge      time.Duration
+	enqueueWait time.Duration
+
+	// state
+	queue          chan *submitItem
+	runningWorkers int
+	workersMutex   sync.Mutex
+	ctx            context.Context
+	cancel         context.CancelFunc
+
+	// deps
+	getDest func(destID string) (*ConnDest, bool) // returns current connection to the destination
+	log     gi.ILogger
+}
+
+func NewSubmitQueue(destID string, getDest func(destID string) (*ConnDest, bool), size, workers int, maxAge, enqueueWait time.Duration, log gi.ILogger) *SubmitQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SubmitQueue{
+		destID:      destID,
+		workers:     workers,
+		maxAge:      maxAge,
+		enqueueWait: enqueueWait,
+		queue:       make(chan *submitItem, size),
+		ctx:         ctx,
+		cancel:      cancel,
+		getDest:     getDest,
+		log:         log,
+	}
+}
+
+func (q *SubmitQueue) ID() string {
+	return q.destID
+}
+
+// Close stops the workers, shares left in the queue are not submitted and reported with ErrSubmitQueueClosed
+func (q *SubmitQueue) Close() {
+	q.cancel()
+	for {
+		select {
+		case item := <-q.queue:
+			item.onResult(nil, nil, ErrSubmitQueueClosed)
+		default:
+			return
+		}
+	}
+}
+
+// Enqueue adds the share to the queue. If the queue is full it blocks applying backpressure
+// to the miner, and fails if there is no space after the enqueue timeout
+func (q *SubmitQueue) Enqueue(ctx context.Context, msg *m.MiningSubmit, onResult SubmitResultFunc) error {
+	if q.ctx.Err() != nil {
+		return ErrSubmitQueueClosed
+	}
+	item := &submitItem{msg: msg, enqueuedAt: time.Now(), onResult: onResult}
+	defer q.spawnWorker()
+
+	select {
+	case q.queue <- item:
+		return nil
+	default:
+	}
+
+	q.log.Warnf("submit queue is full (%d), waiting", cap(q.queue))
+	q.spawnWorker()
+
+	timer := time.NewTimer(q.enqueueWait)
+	defer timer.Stop()
+
+	select {
+	case q.queue <- item:
+		return nil
+	case <-timer.C:
+		return lib.WrapError(ErrSubmitQueueFull, fmt.Errorf("dest %s", q.destID))
+	case <-q.ctx.Done():
+		return ErrSubmitQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len returns number of shares waiting to be submitted
+func (q *SubmitQueue) Len() int {
+	return len(q.queue)
+}
+
+// spawnWorker starts a worker if there are pending shares and the limit is not reached
+func (q *SubmitQueue) spawnWorker() {
+	q.workersMutex.Lock()
+	defer q.workersMutex.Unlock()
+
+	if q.runningWorkers >= q.workers || len(q.queue) == 0 || q.ctx.Err() != nil {
+		return
+	}
+	q.runningWorkers++
+	go q.runWorker()
+}
+
+func (q *SubmitQueue) runWorker() {
+	idleTimer := time.NewTimer(SUBMIT_WORKER_IDLE)
+	defer idleTimer.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case item := <-q.queue:
+			q.submit(item)
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(SUBMIT_WORKER_IDLE)
+		case <-idleTimer.C:
+			q.workersMutex.Lock()
+			if len(q.queue) == 0 {
+				q.runningWorkers--
+				q.workersMutex.Unlock()
+				return
+			}
+			q.workersMutex.Unlock()
+			idleTimer.Reset(SUBMIT_WORKER_IDLE)
+		}
+	}
+}
+
+func (q *SubmitQueue) submit(item *submitItem) {
+	var failedDest *ConnDest
+
+	for {
+		dest, ok := q.getDest(q.destID)
+		if ok && dest != failedDest {
+			item.msg.SetUserName(dest.GetUserName())
+			res, err := dest.WriteAwaitRes(q.ctx, item.msg)
+			if err == nil {
+				item.onResult(dest, res.(*m.MiningResult), nil)
+				return
+			}
+
+			// only write errors are retried, if the share was sent but not answered in time
+			// resubmitting could result in a duplicate
+			if !errors.Is(err, ErrDest) || q.ctx.Err() != nil {
+				item.onResult(dest, nil, err)
+				return
+			}
+
+			dest.GetStats().IncSubmitRetried()
+			q.log.Debugf("submit to %s failed, retrying after reconnect: %s", q.destID, err)
+			failedDest = dest
+		}
+
+		if time.Since(item.enqueuedAt) > q.maxAge {
+			item.onResult(failedDest, nil, lib.WrapError(ErrSubmitExpired, fmt.Errorf("dest %s", q.destID)))
+			return
+		}
+
+		select {
+		case <-q.ctx.Done():
+			item.onResult(failedDest, nil, ErrSubmitQueueClosed)
+			return
+		case <-time.After(SUBMIT_RETRY_INTERVAL):
+		}
+	}
+}
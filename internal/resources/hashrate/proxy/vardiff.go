@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	VARDIFF_MAX_ADJUST_FACTOR = 4.0              // maximum multiplier (or divider) of the difficulty per retarget
+	VARDIFF_TOLERANCE         = 0.3              // relative deviation of the share rate that doesn't trigger retarget
+	VARDIFF_BURST_FACTOR      = 2.0              // retargets earlier if the miner submitted this many times more shares than expected per interval
+	VARDIFF_PREV_DIFF_GRACE   = 30 * time.Second // duration the previous difficulty is still accepted after retarget
+)
+
+// VardiffConfig configures proxy-side variable difficulty for the miner
+type VardiffConfig struct {
+	TargetSharesPerMin float64       // desired share rate from the miner, vardiff is disabled if zero
+	MinDiff            float64       // lower bound of the miner difficulty
+	MaxDiff            float64       // upper bound of the miner difficulty, unbounded if zero
+	RetargetInterval   time.Duration // minimal time between difficulty adjustments
+}
+
+func (c VardiffConfig) IsEnabled() bool {
+	return c.TargetSharesPerMin > 0
+}
+
+// Vardiff keeps local difficulty of the miner independent of the pool difficulty.
+// The miner is sent its own mining.set_difficulty that targets configured share rate,
+// shares are validated against local difficulty and forwarded only if they meet the pool difficulty
+type Vardiff struct {
+	cfg VardiffConfig
+
+	// state
+	diff          float64
+	prevDiff      float64
+	changedAt     time.Time
+	windowStart   time.Time
+	windowShares  int
+	isInitialized bool
+	mutex         sync.Mutex
+}
+
+func NewVardiff(cfg VardiffConfig) *Vardiff {
+	return &Vardiff{
+		cfg: cfg,
+	}
+}
+
+// Init sets the initial miner difficulty based on the pool difficulty
+// if it wasn't set before, and returns current miner difficulty
+func (v *Vardiff) Init(poolDiff float64, now time.Time) float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if !v.isInitialized {
+		v.diff = v.clamp(poolDiff)
+		v.prevDiff = v.diff
+		v.changedAt = now
+		v.windowStart = now
+		v.isInitialized = true
+	}
+
+	return v.diff
+}
+
+// GetDiff returns current miner difficulty
+func (v *Vardiff) GetDiff() float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.diff
+}
+
+// GetAcceptDiff returns minimal difficulty of the share to be accepted from the miner.
+// Right after retarget the miner may still be working on the job with the previous difficulty
+func (v *Vardiff) GetAcceptDiff(now time.Time) float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if now.Sub(v.changedAt) < VARDIFF_PREV_DIFF_GRACE {
+		return math.Min(v.diff, v.prevDiff)
+	}
+	return v.diff
+}
+
+// OnShare accounts the share accepted from the miner and adjusts the difficulty
+// if share rate deviates from the target. Returns new difficulty if it was changed
+func (v *Vardiff) OnShare(now time.Time) (newDiff float64, changed bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if !v.isInitialized {
+		return 0, false
+	}
+
+	v.windowShares++
+
+	elapsed := now.Sub(v.windowStart)
+	expectedShares := v.cfg.TargetSharesPerMin * v.cfg.RetargetInterval.Minutes()
+	if elapsed < v.cfg.RetargetInterval && float64(v.windowShares) < expectedShares*VARDIFF_BURST_FACTOR {
+		return v.diff, false
+	}
+
+	rate := float64(v.windowShares) / math.Max(elapsed.Minutes(), 1.0/60)
+	ratio := rate / v.cfg.TargetSharesPerMin
+	v.windowStart, v.windowShares = now, 0
+
+	if math.Abs(ratio-1) <= VARDIFF_TOLERANCE {
+		return v.diff, false
+	}
+
+	ratio = math.Max(math.Min(ratio, VARDIFF_MAX_ADJUST_FACTOR), 1/VARDIFF_MAX_ADJUST_FACTOR)
+	newDiff = v.clamp(v.diff * ratio)
+	if newDiff == v.diff {
+		return v.diff, false
+	}
+
+	v.prevDiff, v.diff, v.changedAt = v.diff, newDiff, now
+	return newDiff, true
+}
+
+func (v *Vardiff) clamp(diff float64) float64 {
+	diff = math.Max(math.Floor(diff), math.Max(v.cfg.MinDiff, 1))
+	if v.cfg.MaxDiff > 0 {
+		diff = math.Min(diff, v.cfg.MaxDiff)
+	}
+	return diff
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestVardiff(initDiff float64, now time.Time) *Vardiff {
+	v := NewVardiff(VardiffConfig{
+		TargetSharesPerMin: 10,
+		MinDiff:            100,
+		MaxDiff:            1_000_000,
+		RetargetInterval:   time.Minute,
+	})
+	v.Init(initDiff, now)
+	return v
+}
+
+// submitShares submits shares evenly distributed over the duration and returns the last retargeted diff
+func submitShares(v *Vardiff, start time.Time, count int, duration time.Duration) (diff float64, changed bool) {
+	for i := 1; i <= count; i++ {
+		d, ok := v.OnShare(start.Add(duration * time.Duration(i) / time.Duration(count)))
+		if ok {
+			diff, changed = d, true
+		}
+	}
+	return diff, changed
+}
+
+func TestVardiffInitClamp(t *testing.T) {
+	now := time.Now()
+
+	require.Equal(t, 100.0, newTestVardiff(1, now).GetDiff())
+	require.Equal(t, 1_000_000.0, newTestVardiff(1e9, now).GetDiff())
+	require.Equal(t, 5000.0, newTestVardiff(5000.7, now).GetDiff())
+
+	v := newTestVardiff(5000, now)
+	require.Equal(t, 5000.0, v.Init(8000, now), "init should apply only once")
+}
+
+func TestVardiffStableRate(t *testing.T) {
+	now := time.Now()
+	v := newTestVardiff(5000, now)
+
+	_, changed := submitShares(v, now, 10, time.Minute)
+	require.False(t, changed)
+	require.Equal(t, 5000.0, v.GetDiff())
+}
+
+func TestVardiffIncreaseOnBurst(t *testing.T) {
+	now := time.Now()
+	v := newTestVardiff(1000, now)
+
+	// 20 shares in 20 seconds is 6x more than expected, retarget happens before the interval
+	diff, changed := submitShares(v, now, 20, 20*time.Second)
+	require.True(t, changed)
+	require.Equal(t, 4000.0, diff, "adjustment should be limited by max factor")
+}
+
+func TestVardiffDecreaseOnSlowRate(t *testing.T) {
+	now := time.Now()
+	v := newTestVardiff(1000, now)
+
+	diff, changed := submitShares(v, now, 5, time.Minute)
+	require.True(t, changed)
+	require.Equal(t, 500.0, diff)
+}
+
+func TestVardiffAcceptPrevDiffDuringGrace(t *testing.T) {
+	now := time.Now()
+	v := newTestVardiff(1000, now)
+
+	_, changed := submitShares(v, now, 20, 20*time.Second)
+	require.True(t, changed)
+
+	changedAt := now.Add(20 * time.Second)
+	require.Equal(t, 1000.0, v.GetAcceptDiff(changedAt.Add(time.Second)))
+	require.Equal(t, 4000.0, v.GetAcceptDiff(changedAt.Add(VARDIFF_PREV_DIFF_GRACE)))
+}
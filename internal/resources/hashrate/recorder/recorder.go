@@ -0,0 +1,374 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+const (
+	// PENDING_LIMIT is the number of messages kept in memory until the session is selected,
+	// if the miner hasn't authorized by then the session is not recorded
+	PENDING_LIMIT = 100
+
+	FLUSH_INTERVAL = time.Second // records are written to the file in background with this interval
+	FLUSH_SIZE     = 64 << 10    // or earlier if this many bytes are buffered
+
+	// REDACTED_PASSWORD replaces passwords in the recording, it is the same as in url.URL.Redacted()
+	// so the pool credentials used in the replay match the recorded mining.authorize
+	REDACTED_PASSWORD = "xxxxx"
+)
+
+var (
+	ErrInvalidPattern = errors.New("invalid worker pattern")
+	ErrInvalidRecord  = errors.New("invalid record")
+)
+
+type Side string
+
+const (
+	SideSource Side = "source" // miner connection
+	SideDest   Side = "dest"   // pool connection
+)
+
+type Direction string
+
+const (
+	DirIn  Direction = "in"  // read by the proxy
+	DirOut Direction = "out" // written by the proxy
+)
+
+// Record is a single line of the recording
+type Record struct {
+	Time    time.Time       `json:"ts"`
+	Side    Side            `json:"side"`
+	Dir     Direction       `json:"dir"`
+	ConnNum int             `json:"conn_num"` // number of the connection in the session, 0 for the source, destinations start from 1
+	ConnID  string          `json:"conn"`     // miner address or pool url
+	Msg     json.RawMessage `json:"msg"`
+}
+
+type Config struct {
+	Dir       string   // directory to write recordings to
+	Workers   []string // glob patterns matched against the full miner username
+	Contracts []string // IDs of the incoming contracts
+}
+
+// Recorder creates sessions that record the stratum messages of the selected miners or contracts
+type Recorder struct {
+	cfg Config
+	log interfaces.ILogger
+}
+
+func NewRecorder(cfg Config, log interfaces.ILogger) (*Recorder, error) {
+	for _, pattern := range cfg.Workers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, lib.WrapError(ErrInvalidPattern, fmt.Errorf("%s: %w", pattern, err))
+		}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Recorder{cfg: cfg, log: log}, nil
+}
+
+// NewSession returns the session for the miner connection. Messages are kept in memory until the
+// miner authorizes, then the session is either written to a file or discarded
+func (r *Recorder) NewSession(srcAddr string) *Session {
+	return &Session{
+		srcAddr:   srcAddr,
+		startedAt: time.Now(),
+		recorder:  r,
+		log:       r.log.With("SrcAddr", srcAddr),
+	}
+}
+
+func (r *Recorder) isSelected(userName, contractID string) bool {
+	if contractID != "" {
+		for _, ID := range r.cfg.Contracts {
+			if strings.EqualFold(ID, contractID) {
+				return true
+			}
+		}
+	}
+	for _, pattern := range r.cfg.Workers {
+		if ok, _ := path.Match(pattern, userName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type sessionState int
+
+const (
+	statePending sessionState = iota
+	stateRecording
+	stateDiscarded
+)
+
+// Session records messages of a single miner connection and its destinations
+type Session struct {
+	srcAddr   string
+	startedAt time.Time
+
+	state      sessionState
+	destCount  int
+	pending    []Record
+	contractID string
+	buf        bytes.Buffer  // encoded records waiting to be written by the flusher
+	flushCh    chan struct{} // signals the flusher that the buffer is large
+	stopCh     chan struct{} // closed to stop the flusher, nil if the file is not open
+	flushDone  chan error    // receives the result of the flusher when the file is closed
+	mutex      sync.Mutex
+
+	recorder *Recorder
+	log      interfaces.ILogger
+}
+
+// Source returns the recorder for the miner connection
+func (s *Session) Source() *SideRecorder {
+	return &SideRecorder{session: s, side: SideSource, connID: s.srcAddr}
+}
+
+// Dest returns the recorder for the new pool connection
+func (s *Session) Dest(destURL *url.URL) *SideRecorder {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.destCount++
+	return &SideRecorder{session: s, side: SideDest, connNum: s.destCount, connID: destURL.Redacted()}
+}
+
+// Close writes the buffered records and closes the recording file
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	s.state = stateDiscarded
+	s.pending = nil
+	stopCh := s.stopCh
+	s.stopCh = nil
+	s.mutex.Unlock()
+
+	if stopCh == nil {
+		return nil
+	}
+	close(stopCh)
+	return <-s.flushDone
+}
+
+func (s *Session) record(side Side, dir Direction, connNum int, connID string, msg []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == stateDiscarded {
+		return
+	}
+
+	rec := Record{Time: time.Now(), Side: side, Dir: dir, ConnNum: connNum, ConnID: connID, Msg: toRawMessage(redactMessage(msg))}
+
+	if s.state == stateRecording {
+		s.write(rec)
+		return
+	}
+
+	s.pending = append(s.pending, rec)
+	if side == SideSource && dir == DirIn {
+		s.inspect(msg)
+	}
+	if s.state == statePending && len(s.pending) >= PENDING_LIMIT {
+		s.discard()
+	}
+}
+
+// inspect looks for the incoming contract ID and the username of the miner to decide if the session is recorded
+func (s *Session) inspect(msg []byte) {
+	parsed, err := sm.ParseStratumMessage(msg)
+	if err != nil {
+		return
+	}
+
+	switch typed := parsed.(type) {
+	case *sm.MiningConfigure:
+		s.contractID = typed.GetLMRContractAddress()
+	case *sm.MiningAuthorize:
+		if !s.recorder.isSelected(typed.GetUserName(), s.contractID) {
+			s.discard()
+			return
+		}
+		err := s.open(typed.GetUserName())
+		if err != nil {
+			s.log.Errorf("failed to start recording: %s", err)
+			s.discard()
+			return
+		}
+		s.state = stateRecording
+		for _, rec := range s.pending {
+			s.write(rec)
+		}
+		s.pending = nil
+	}
+}
+
+func (s *Session) open(userName string) error {
+	name := fmt.Sprintf("%s_%s_%s.jsonl", s.startedAt.UTC().Format("20060102T150405.000"), userName, s.srcAddr)
+	filePath := filepath.Join(s.recorder.cfg.Dir, lib.SanitizeFilename(name))
+
+	// recording contains miner and pool usernames and the contract details
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.flushCh = make(chan struct{}, 1)
+	s.stopCh = make(chan struct{})
+	s.flushDone = make(chan error, 1)
+	go s.runFlusher(file, s.stopCh)
+
+	s.log.Infof("recording session of %s to %s", userName, filePath)
+	return nil
+}
+
+// write buffers the record, so the file is not written in the stratum read/write path
+func (s *Session) write(rec Record) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		s.log.Warnf("failed to encode record: %s", err)
+		return
+	}
+	s.buf.Write(b)
+	s.buf.WriteByte('\n')
+
+	if s.buf.Len() >= FLUSH_SIZE {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// runFlusher periodically writes the buffered records to the file, so the recording
+// is usable while the session is running. Closes the file when stopCh is closed
+func (s *Session) runFlusher(file *os.File, stopCh chan struct{}) {
+	ticker := time.NewTicker(FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		stopped := false
+		select {
+		case <-stopCh:
+			stopped = true
+		case <-s.flushCh:
+		case <-ticker.C:
+		}
+
+		err := s.flush(file)
+		if err != nil {
+			s.log.Errorf("failed to write records, recording stopped: %s", err)
+			s.mutex.Lock()
+			s.discard()
+			s.mutex.Unlock()
+			_ = file.Close()
+			s.flushDone <- err
+			return
+		}
+		if stopped {
+			s.flushDone <- file.Close()
+			return
+		}
+	}
+}
+
+func (s *Session) flush(file *os.File) error {
+	s.mutex.Lock()
+	if s.buf.Len() == 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+	b := append([]byte{}, s.buf.Bytes()...)
+	s.buf.Reset()
+	s.mutex.Unlock()
+
+	_, err := file.Write(b)
+	return err
+}
+
+func (s *Session) discard() {
+	s.state = stateDiscarded
+	s.pending = nil
+}
+
+// SideRecorder records messages of one side of the session, implements proxy.MessageRecorder
+type SideRecorder struct {
+	session *Session
+	side    Side
+	connNum int
+	connID  string
+}
+
+func (r *SideRecorder) OnRead(msg []byte) {
+	r.session.record(r.side, DirIn, r.connNum, r.connID, msg)
+}
+
+func (r *SideRecorder) OnWrite(msg []byte) {
+	r.session.record(r.side, DirOut, r.connNum, r.connID, msg)
+}
+
+// ReadFile reads the recording
+func ReadFile(filePath string) ([]Record, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for i, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec Record
+		err := json.Unmarshal(line, &rec)
+		if err != nil {
+			return nil, lib.WrapError(ErrInvalidRecord, fmt.Errorf("line %d: %w", i+1, err))
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// redactMessage replaces the password of mining.authorize, other messages are returned as is
+func redactMessage(msg []byte) []byte {
+	if !bytes.Contains(msg, []byte(sm.MethodMiningAuthorize)) {
+		return msg
+	}
+	parsed, err := sm.ParseStratumMessage(bytes.TrimSpace(msg))
+	if err != nil {
+		return msg
+	}
+	auth, ok := parsed.(*sm.MiningAuthorize)
+	if !ok || auth.GetPassword() == "" {
+		return msg
+	}
+	auth.SetPassword(REDACTED_PASSWORD)
+	return auth.Serialize()
+}
+
+// toRawMessage copies the message, non-json lines are kept as json string
+func toRawMessage(msg []byte) json.RawMessage {
+	msg = bytes.TrimSpace(msg)
+	if json.Valid(msg) {
+		return append(json.RawMessage{}, msg...)
+	}
+	str, _ := json.Marshal(string(msg))
+	return str
+}
@@ -0,0 +1,200 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+var (
+	ErrInvalidRule   = errors.New("invalid routing rule")
+	ErrRuleNotFound  = errors.New("routing rule not found")
+	ErrDuplicateRule = errors.New("routing rule with this ID already exists")
+)
+
+// Rule routes miners to the destination if all of the set conditions match
+type Rule struct {
+	ID            string
+	WorkerPattern string `json:",omitempty"` // glob pattern matched against the full miner username, e.g. "customer1.*"
+	AccountPrefix string `json:",omitempty"` // prefix of the account part of the miner username
+	SourceCIDR    string `json:",omitempty"` // network of the miner address, e.g. "10.0.1.0/24"
+	Dest          string // destination pool url
+}
+
+type compiledRule struct {
+	Rule
+	network *net.IPNet
+	dest    *url.URL
+}
+
+// Router selects the default destination of the miner by the first matching rule
+type Router struct {
+	rules []*compiledRule
+	mutex sync.RWMutex
+}
+
+func NewRouter(rules []Rule) (*Router, error) {
+	r := &Router{}
+	return r, r.SetRules(rules)
+}
+
+// LoadRulesFile reads the list of rules from the json file
+func LoadRulesFile(filePath string) ([]Rule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidRule, err)
+	}
+	return rules, nil
+}
+
+// Match returns the copy of the destination of the first rule matching the miner, or false if none match
+func (r *Router) Match(userName string, srcAddr string) (dest *url.URL, ruleID string, ok bool) {
+	var ip net.IP
+	if host, _, err := net.SplitHostPort(srcAddr); err == nil {
+		ip = net.ParseIP(host)
+	} else {
+		ip = net.ParseIP(srcAddr)
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, rule := range r.rules {
+		if rule.matches(userName, ip) {
+			return lib.CopyURL(rule.dest), rule.ID, true
+		}
+	}
+	return nil, "", false
+}
+
+// GetRules returns rules in the order of evaluation
+func (r *Router) GetRules() []Rule {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	rules := make([]Rule, len(r.rules))
+	for i, rule := range r.rules {
+		rules[i] = rule.Rule
+	}
+	return rules
+}
+
+// SetRules replaces all of the rules, the list is left intact if any of the rules is invalid
+func (r *Router) SetRules(rules []Rule) error {
+	compiled := make([]*compiledRule, 0, len(rules))
+	ids := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			return err
+		}
+		if ids[rule.ID] {
+			return lib.WrapError(ErrDuplicateRule, fmt.Errorf("%s", rule.ID))
+		}
+		ids[rule.ID] = true
+		compiled = append(compiled, c)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rules = compiled
+	return nil
+}
+
+// AddRule appends the rule to the end of the list
+func (r *Router) AddRule(rule Rule) error {
+	c, err := compileRule(rule)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.rules {
+		if existing.ID == rule.ID {
+			return lib.WrapError(ErrDuplicateRule, fmt.Errorf("%s", rule.ID))
+		}
+	}
+	r.rules = append(r.rules, c)
+	return nil
+}
+
+func (r *Router) DeleteRule(ID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, rule := range r.rules {
+		if rule.ID == ID {
+			r.rules = append(r.rules[:i:i], r.rules[i+1:]...)
+			return nil
+		}
+	}
+	return lib.WrapError(ErrRuleNotFound, fmt.Errorf("%s", ID))
+}
+
+func compileRule(rule Rule) (*compiledRule, error) {
+	if rule.ID == "" {
+		return nil, lib.WrapError(ErrInvalidRule, errors.New("empty ID"))
+	}
+	if rule.WorkerPattern == "" && rule.AccountPrefix == "" && rule.SourceCIDR == "" {
+		return nil, lib.WrapError(ErrInvalidRule, fmt.Errorf("rule %s has no conditions", rule.ID))
+	}
+	if _, err := path.Match(rule.WorkerPattern, ""); err != nil {
+		return nil, lib.WrapError(ErrInvalidRule, fmt.Errorf("rule %s worker pattern: %w", rule.ID, err))
+	}
+
+	c := &compiledRule{Rule: rule}
+
+	if rule.SourceCIDR != "" {
+		_, network, err := net.ParseCIDR(rule.SourceCIDR)
+		if err != nil {
+			return nil, lib.WrapError(ErrInvalidRule, fmt.Errorf("rule %s source cidr: %w", rule.ID, err))
+		}
+		c.network = network
+	}
+
+	dest, err := url.Parse(rule.Dest)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidRule, fmt.Errorf("rule %s dest: %w", rule.ID, err))
+	}
+	if dest.Host == "" {
+		return nil, lib.WrapError(ErrInvalidRule, fmt.Errorf("rule %s dest: empty host", rule.ID))
+	}
+	c.dest = dest
+
+	return c, nil
+}
+
+func (c *compiledRule) matches(userName string, ip net.IP) bool {
+	if c.WorkerPattern != "" {
+		if ok, _ := path.Match(c.WorkerPattern, userName); !ok {
+			return false
+		}
+	}
+	if c.AccountPrefix != "" {
+		accountName, _, _ := lib.SplitUsername(userName)
+		if !strings.HasPrefix(accountName, c.AccountPrefix) {
+			return false
+		}
+	}
+	if c.network != nil {
+		if ip == nil || !c.network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
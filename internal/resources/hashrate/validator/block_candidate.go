@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/holiman/uint256"
+)
+
+// BlockCandidate is the share that meets the network target, so it would solve the block
+type BlockCandidate struct {
+	Header      [80]byte
+	PowHash     [32]byte // proof-of-work hash in the display (big-endian) byte order
+	BlockHash   [32]byte // sha256d of the header in the display byte order, the block ID
+	ShareDiff   uint64
+	NetworkDiff float64
+}
+
+func newBlockCandidate(header [80]byte, powHash *uint256.Int, shareDiff uint64, networkDiff float64) *BlockCandidate {
+	blockHash := sha256d(header[:])
+	reverse(blockHash[:])
+
+	return &BlockCandidate{
+		Header:      header,
+		PowHash:     powHash.Bytes32(),
+		BlockHash:   blockHash,
+		ShareDiff:   shareDiff,
+		NetworkDiff: networkDiff,
+	}
+}
+
+func (b *BlockCandidate) GetHeaderHex() string {
+	return hex.EncodeToString(b.Header[:])
+}
+
+func (b *BlockCandidate) GetPowHashHex() string {
+	return hex.EncodeToString(b.PowHash[:])
+}
+
+func (b *BlockCandidate) GetBlockHashHex() string {
+	return hex.EncodeToString(b.BlockHash[:])
+}
+
+// compactToTarget decodes the target from the compact nbits form, returns zero for negative or overflowing values
+func compactToTarget(nbits uint32) uint256.Int {
+	var target uint256.Int
+	exp := nbits >> 24
+	mantissa := nbits & 0x007fffff
+
+	if nbits&0x00800000 != 0 || exp > 32 {
+		return target
+	}
+
+	target.SetUint64(uint64(mantissa))
+	if exp <= 3 {
+		target.Rsh(&target, uint(8*(3-exp)))
+	} else {
+		target.Lsh(&target, uint(8*(exp-3)))
+	}
+	return target
+}
+
+// targetToDiff returns the difficulty of the target relative to the difficulty 1 target
+func targetToDiff(diffOne, target *uint256.Int) float64 {
+	if target.IsZero() {
+		return 0
+	}
+	diff, _ := new(big.Float).Quo(new(big.Float).SetInt(diffOne.ToBig()), new(big.Float).SetInt(target.ToBig())).Float64()
+	return diff
+}
@@ -0,0 +1,50 @@
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactToTarget(t *testing.T) {
+	var diffOne uint256.Int
+	diffOne.SetFromBig(PowSha256d.DiffOneTarget())
+
+	// bitcoin genesis block
+	target := compactToTarget(0x1d00ffff)
+	require.Equal(t, diffOne, target)
+	require.Equal(t, 1.0, targetToDiff(&diffOne, &target))
+
+	target = compactToTarget(0x17056102)
+	require.InDelta(t, 52328312063443.8, targetToDiff(&diffOne, &target), 1)
+
+	target = compactToTarget(0x01803456) // negative
+	require.True(t, target.IsZero())
+}
+
+func TestMiningJobBlockCandidate(t *testing.T) {
+	msg := GetTestMsg()
+
+	job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	require.NoError(t, err)
+	_, ok, candidate := job.ValidateShare(msg.submit1, msg.vmask)
+	require.True(t, ok)
+	require.Nil(t, candidate)
+
+	// regtest network target, any share solves the block
+	notify := msg.notify.Copy()
+	notify.Params[6] = json.RawMessage(`"207fffff"`)
+	job, err = NewMiningJob(notify, 0, msg.xnonce, msg.xnonce2size, PowSha256d)
+	require.NoError(t, err)
+
+	diff, ok, candidate := job.ValidateShare(msg.submit1, msg.vmask)
+	require.True(t, ok)
+	require.NotNil(t, candidate)
+	require.Equal(t, diff, candidate.ShareDiff)
+	require.Equal(t, candidate.GetPowHashHex(), candidate.GetBlockHashHex())
+	require.Len(t, candidate.GetHeaderHex(), 160)
+	require.Equal(t, "ffff7f20", candidate.GetHeaderHex()[144:152])
+	require.Less(t, candidate.NetworkDiff, 1.0)
+}
@@ -1,13 +1,22 @@
 package validator
 
 import (
-	"encoding/hex"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/holiman/uint256"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
 	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
 )
 
+const (
+	COINBASE_BUF_SIZE = 1024 // coinbase transactions up to this size are built without allocations
+	SUBMIT_MIN_PARAMS = 5    // worker_name, job_id, extranonce2, ntime and nonce are required in mining.submit
+)
+
 type shareBytes = [20]byte
 
 type MiningJob struct {
@@ -15,6 +24,8 @@ type MiningJob struct {
 	diff            float64
 	extraNonce1     string
 	extraNonce2Size int
+	pow             PowAlgorithm
+	header          *jobHeader
 	// TODO: a quick fix of race condition in CheckDuplicateAndAddShare.
 	// Sync map should not be needed here, because
 	// all methods should be called from single goroutine, but as
@@ -22,14 +33,211 @@ type MiningJob struct {
 	expirationTime time.Time
 }
 
-func NewMiningJob(msg *sm.MiningNotify, diff float64, extraNonce1 string, extraNonce2Size int) *MiningJob {
+// jobHeader contains the binary parts of the job decoded once when the job is added,
+// so validating a share hashes only its own parts. It is immutable and shared by the job copies
+type jobHeader struct {
+	coinbasePrefix []byte // coinb1 + extranonce1
+	coinbaseSuffix []byte // coinb2
+	merkleBranches [][32]byte
+	prevHash       [32]byte // in the block header byte order
+	version        uint32
+	nbits          [4]byte // in the block header byte order
+	ntime          uint32
+	networkTarget  uint256.Int // zero if nbits is invalid
+	networkDiff    float64
+	diffOne        uint256.Int
+}
+
+func NewMiningJob(msg *sm.MiningNotify, diff float64, extraNonce1 string, extraNonce2Size int, pow PowAlgorithm) (*MiningJob, error) {
+	header, err := newJobHeader(msg, extraNonce1, pow)
+	if err != nil {
+		return nil, lib.WrapError(ErrInvalidJob, fmt.Errorf("job %s: %w", msg.GetJobID(), err))
+	}
 	return &MiningJob{
 		notify:          msg,
 		diff:            diff,
 		extraNonce1:     extraNonce1,
 		extraNonce2Size: extraNonce2Size,
+		pow:             pow,
+		header:          header,
 		shares:          sync.Map{},
+	}, nil
+}
+
+func newJobHeader(msg *sm.MiningNotify, extraNonce1 string, pow PowAlgorithm) (*jobHeader, error) {
+	// hex params by index with the expected size in bytes, zero for variable size
+	var params [8]string
+	for _, p := range []struct{ i, size int }{{1, 32}, {2, 0}, {3, 0}, {5, 4}, {6, 4}, {7, 4}} {
+		param, err := notifyHexParam(msg, p.i, p.size)
+		if err != nil {
+			return nil, err
+		}
+		params[p.i] = param
+	}
+
+	var branches []string
+	if err := json.Unmarshal(msg.Params[4], &branches); err != nil {
+		return nil, fmt.Errorf("merkle branches: %w", err)
+	}
+
+	h := &jobHeader{
+		coinbasePrefix: appendHex(decode(params[2]), extraNonce1),
+		coinbaseSuffix: decode(params[3]),
+		version:        binary.BigEndian.Uint32(decodeFixed(4, params[5])),
+		merkleBranches: make([][32]byte, len(branches)),
+	}
+	for i, branch := range branches {
+		if len(branch) != 64 || decodeHexInto(h.merkleBranches[i][:], branch) != 32 {
+			return nil, lib.WrapError(ErrInvalidHex, fmt.Errorf("merkle branch %s", branch))
+		}
+	}
+
+	decodeHexInto(h.prevHash[:], params[1])
+	swapWords(h.prevHash[:])
+	decodeHexInto(h.nbits[:], params[6])
+	reverse(h.nbits[:])
+	h.ntime = binary.BigEndian.Uint32(decodeFixed(4, params[7]))
+	h.diffOne.SetFromBig(pow.DiffOneTarget())
+	h.networkTarget = compactToTarget(binary.LittleEndian.Uint32(h.nbits[:]))
+	h.networkDiff = targetToDiff(&h.diffOne, &h.networkTarget)
+
+	return h, nil
+}
+
+// notifyHexParam returns the hex string param of the notify, size is the expected number of bytes, any if zero
+func notifyHexParam(msg *sm.MiningNotify, i int, size int) (string, error) {
+	var res string
+	if err := json.Unmarshal(msg.Params[i], &res); err != nil {
+		return "", fmt.Errorf("param %d: %w", i, err)
+	}
+	if !isHex(res) || (size > 0 && len(res) != 2*size) {
+		return "", lib.WrapError(ErrInvalidHex, fmt.Errorf("param %d: %s", i, res))
+	}
+	return res, nil
+}
+
+// CheckShare validates the fields of the share that would make the pool reject it regardless of the difficulty
+func (m *MiningJob) CheckShare(submit *sm.MiningSubmit, versionMask string, now time.Time) error {
+	if len(submit.Params) < SUBMIT_MIN_PARAMS {
+		return lib.WrapError(ErrInvalidParams, fmt.Errorf("expected at least %d params, actual %d", SUBMIT_MIN_PARAMS, len(submit.Params)))
+	}
+	if !isHex(submit.GetExtraNonce2()) {
+		return lib.WrapError(ErrInvalidHex, fmt.Errorf("extranonce2 %s", submit.GetExtraNonce2()))
+	}
+	if len(submit.GetExtraNonce2()) != 2*m.extraNonce2Size {
+		return lib.WrapError(ErrInvalidExtraNonce2Size, fmt.Errorf("expected %d actual %d", m.extraNonce2Size, len(submit.GetExtraNonce2())/2))
+	}
+
+	var ntime, nonce, version [4]byte
+	if len(submit.GetNtime()) != 8 || decodeHexInto(ntime[:], submit.GetNtime()) != 4 {
+		return lib.WrapError(ErrInvalidHex, fmt.Errorf("ntime %s", submit.GetNtime()))
+	}
+	if len(submit.GetNonce()) != 8 || decodeHexInto(nonce[:], submit.GetNonce()) != 4 {
+		return lib.WrapError(ErrInvalidHex, fmt.Errorf("nonce %s", submit.GetNonce()))
+	}
+
+	// ntime can be rolled forward only, up to the limit from the job time or the wall clock, whichever is later
+	shareTime := int64(binary.BigEndian.Uint32(ntime[:]))
+	jobTime := int64(m.header.ntime)
+	maxTime := jobTime
+	if now.Unix() > maxTime {
+		maxTime = now.Unix()
+	}
+	maxTime += int64(NTIME_MAX_AHEAD / time.Second)
+	if shareTime < jobTime || shareTime > maxTime {
+		return lib.WrapError(ErrNtimeOutOfRange, fmt.Errorf("ntime %d, job ntime %d, max %d", shareTime, jobTime, maxTime))
+	}
+
+	if len(submit.Params) > 5 {
+		if len(submit.Params[5]) != 8 || decodeHexInto(version[:], submit.Params[5]) != 4 {
+			return lib.WrapError(ErrInvalidHex, fmt.Errorf("version bits %s", submit.Params[5]))
+		}
+		var mask [4]byte
+		decodeHexInto(mask[:], versionMask)
+		outOfMask := binary.BigEndian.Uint32(version[:]) &^ binary.BigEndian.Uint32(mask[:])
+		if outOfMask != 0 {
+			return lib.WrapError(ErrVersionOutOfMask, fmt.Errorf("version bits %s, mask %s", submit.Params[5], versionMask))
+		}
+	}
+
+	return nil
+}
+
+// ValidateDiff returns the difficulty of the share and whether it meets the job difficulty.
+// Only the parts of the share are decoded, no allocations are made for sha256d jobs
+func (m *MiningJob) ValidateDiff(submit *sm.MiningSubmit, versionMask string) (uint64, bool) {
+	res := m.hashShare(submit, versionMask)
+	return res.diff, res.diff >= uint64(m.diff)
+}
+
+// ValidateShare is ValidateDiff that also returns the block candidate if the share meets the network target
+func (m *MiningJob) ValidateShare(submit *sm.MiningSubmit, versionMask string) (uint64, bool, *BlockCandidate) {
+	res := m.hashShare(submit, versionMask)
+
+	var candidate *BlockCandidate
+	if !m.header.networkTarget.IsZero() && res.hash.Cmp(&m.header.networkTarget) <= 0 {
+		candidate = newBlockCandidate(res.header, &res.hash, res.diff, m.header.networkDiff)
 	}
+	return res.diff, res.diff >= uint64(m.diff), candidate
+}
+
+// shareHash is the block header built from the share and its proof-of-work hash
+type shareHash struct {
+	header [80]byte
+	hash   uint256.Int
+	diff   uint64
+}
+
+func (m *MiningJob) hashShare(submit *sm.MiningSubmit, versionMask string) shareHash {
+	var res shareHash
+	h := m.header
+
+	var coinbaseBuf [COINBASE_BUF_SIZE]byte
+	coinbase := append(coinbaseBuf[:0], h.coinbasePrefix...)
+	coinbase = appendHex(coinbase, submit.GetExtraNonce2())
+	coinbase = append(coinbase, h.coinbaseSuffix...)
+
+	merkleRoot := sha256d(coinbase)
+	var pair [64]byte
+	for _, branch := range h.merkleBranches {
+		copy(pair[:32], merkleRoot[:])
+		copy(pair[32:], branch[:])
+		merkleRoot = sha256d(pair[:])
+	}
+
+	version := h.version
+	if len(submit.Params) > 5 {
+		var sv, vm [4]byte
+		decodeHexInto(sv[:], submit.Params[5])
+		decodeHexInto(vm[:], versionMask)
+		mask := binary.BigEndian.Uint32(vm[:])
+		version = (version &^ mask) | (binary.BigEndian.Uint32(sv[:]) & mask)
+	}
+
+	header := &res.header
+	binary.LittleEndian.PutUint32(header[0:4], version)
+	copy(header[4:36], h.prevHash[:])
+	copy(header[36:68], merkleRoot[:])
+	decodeHexInto(header[68:72], submit.GetNtime())
+	reverse(header[68:72])
+	copy(header[72:76], h.nbits[:])
+	decodeHexInto(header[76:80], submit.GetNonce())
+	reverse(header[76:80])
+
+	var hash [32]byte
+	if _, ok := m.pow.(*sha256dPow); ok {
+		hash = sha256d(header[:])
+	} else {
+		// the slice passed to the interface escapes to heap, so the header is copied only here
+		headerCopy := *header
+		hash = m.pow.Hash(headerCopy[:])
+	}
+
+	var diff uint256.Int
+	res.hash.SetBytes32(reverse(hash[:]))
+	diff.Div(&h.diffOne, &res.hash)
+	res.diff = diff.Uint64()
+	return res
 }
 
 func (m *MiningJob) CheckDuplicateAndAddShare(s *sm.MiningSubmit) bool {
@@ -54,20 +262,20 @@ func (m *MiningJob) GetExtraNonce2Size() int {
 	return m.extraNonce2Size
 }
 
+func (m *MiningJob) GetPowAlgorithm() PowAlgorithm {
+	return m.pow
+}
+
 // SerializeShare serializes the share into a 20-byte array.
 // It includes only the fields that are unique for each share per job per destination
 func SerializeShare(enonce2, ntime, nonce, vmask string) shareBytes {
 	var hash shareBytes
 
-	enonce2Bytes, _ := hex.DecodeString(enonce2)
-	ntimeBytes, _ := hex.DecodeString(ntime)
-	nonceBytes, _ := hex.DecodeString(nonce)
-	vmaskBytes, _ := hex.DecodeString(vmask)
-
-	copy(hash[:8], enonce2Bytes[:8])
-	copy(hash[8:12], ntimeBytes[:4])
-	copy(hash[12:16], nonceBytes[:4])
-	copy(hash[16:20], vmaskBytes[:4])
+	// fields shorter than expected are zero-padded, e.g. 4-byte extranonce2
+	decodeHexInto(hash[:8], enonce2)
+	decodeHexInto(hash[8:12], ntime)
+	decodeHexInto(hash[12:16], nonce)
+	decodeHexInto(hash[16:20], vmask)
 
 	return hash
 }
@@ -78,5 +286,7 @@ func (m *MiningJob) Copy() *MiningJob {
 		diff:            m.diff,
 		extraNonce1:     m.extraNonce1,
 		extraNonce2Size: m.extraNonce2Size,
+		pow:             m.pow,
+		header:          m.header,
 	}
 }
@@ -2,9 +2,12 @@ package validator
 
 import (
 	"encoding/hex"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
 )
 
 func TestShareEncode(t *testing.T) {
@@ -17,10 +20,25 @@ func TestShareEncode(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestShareEncodeShortFields(t *testing.T) {
+	// pools may assign 4-byte extranonce2, shorter fields are zero-padded instead of panicking
+	bytes := SerializeShare("0a000001", "64c25820", "591d28da", "")
+	require.Equal(t, "0a0000010000000064c25820591d28da00000000", hex.EncodeToString(bytes[:]))
+
+	// shares that differ only in the short extranonce2 are not duplicates
+	msg := GetTestMsg()
+	job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, 4, PowSha256d)
+	require.NoError(t, err)
+	require.False(t, job.CheckDuplicateAndAddShare(sm.NewMiningSubmit("worker", "2dc3427c2e", "0a000001", "64c25820", "591d28da")))
+	require.False(t, job.CheckDuplicateAndAddShare(sm.NewMiningSubmit("worker", "2dc3427c2e", "0a000002", "64c25820", "591d28da")))
+	require.True(t, job.CheckDuplicateAndAddShare(sm.NewMiningSubmit("worker", "2dc3427c2e", "0a000001", "64c25820", "591d28da")))
+}
+
 func TestMiningJob(t *testing.T) {
 	msg := GetTestMsg()
 
-	job := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size)
+	job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	require.NoError(t, err)
 	isDuplicate := job.CheckDuplicateAndAddShare(msg.submit1)
 	require.False(t, isDuplicate)
 
@@ -30,3 +48,79 @@ func TestMiningJob(t *testing.T) {
 	isDuplicate = job.CheckDuplicateAndAddShare(msg.submit2)
 	require.False(t, isDuplicate)
 }
+
+func TestMiningJobValidateDiff(t *testing.T) {
+	msg := GetTestMsg()
+	noVersionSubmit := sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", "64c25820", "591d28da")
+	scryptSubmit := sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", "64c25820", "0000022c")
+
+	for _, pow := range []PowAlgorithm{PowSha256d, PowScrypt} {
+		job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, pow)
+		require.NoError(t, err)
+
+		for _, submit := range []*sm.MiningSubmit{msg.submit1, msg.submit2, noVersionSubmit, scryptSubmit} {
+			expDiff, expOk := ValidateDiffPow(pow, msg.xnonce, uint(msg.xnonce2size), uint64(msg.diff), msg.vmask, msg.notify, submit)
+			diff, ok := job.ValidateDiff(submit, msg.vmask)
+			require.Equal(t, expDiff, diff, "pow %s, nonce %s", pow.Name(), submit.GetNonce())
+			require.Equal(t, expOk, ok, "pow %s, nonce %s", pow.Name(), submit.GetNonce())
+		}
+	}
+}
+
+func TestMiningJobValidateDiffNoAllocs(t *testing.T) {
+	msg := GetTestMsg()
+	job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		job.ValidateDiff(msg.submit1, msg.vmask)
+		SerializeShare(msg.submit1.GetExtraNonce2(), msg.submit1.GetNtime(), msg.submit1.GetNonce(), msg.submit1.GetVmask())
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkMiningJobValidateDiff(b *testing.B) {
+	msg := GetTestMsg()
+	job, _ := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		job.ValidateDiff(msg.submit1, msg.vmask)
+	}
+}
+
+func BenchmarkNewMiningJob(b *testing.B) {
+	msg := GetTestMsg()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	}
+}
+
+func TestMiningJobMalformedNotify(t *testing.T) {
+	cases := []struct {
+		name   string
+		notify string
+	}{
+		{"short prevhash", `["1","0","01","02",[],"20000000","17056102","64c25820",false]`},
+		{"invalid hex coinbase", `["1","` + strings.Repeat("00", 32) + `","01","zz",[],"20000000","17056102","64c25820",false]`},
+		{"non-string version", `["1","` + strings.Repeat("00", 32) + `","01","02",[],1,"17056102","64c25820",false]`},
+		{"short merkle branch", `["1","` + strings.Repeat("00", 32) + `","01","02",["0a"],"20000000","17056102","64c25820",false]`},
+		{"missing params", `["1","` + strings.Repeat("00", 32) + `","01","02",[]]`},
+	}
+
+	for _, c := range cases {
+		notify, err := sm.ParseMiningNotify([]byte(`{"id":null,"method":"mining.notify","params":` + c.notify + `}`))
+		require.NoError(t, err, c.name)
+
+		_, err = NewMiningJob(notify, 1, "00", 4, PowSha256d)
+		require.ErrorIs(t, err, ErrInvalidJob, c.name)
+
+		validator := NewValidator(time.Minute)
+		require.ErrorIs(t, validator.AddNewJob(notify, 1, "00", 4), ErrInvalidJob, c.name)
+		require.False(t, validator.HasJob("1"), c.name)
+	}
+}
@@ -0,0 +1,117 @@
+package validator
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"golang.org/x/crypto/scrypt"
+)
+
+// POW_URL_PARAM is the query parameter of the destination URL that selects the proof-of-work algorithm,
+// e.g. stratum+tcp://user@pool:3333?pow=scrypt
+const POW_URL_PARAM = "pow"
+
+var (
+	ErrUnknownPowAlgorithm = errors.New("unknown proof-of-work algorithm")
+)
+
+// PowAlgorithm hashes the block header and defines the target of difficulty 1 shares
+type PowAlgorithm interface {
+	Name() string
+	// Hash returns the hash of the serialized block header in the internal (little-endian) byte order
+	Hash(header []byte) [32]byte
+	// DiffOneTarget returns the target of the share of difficulty 1, shouldn't be modified
+	DiffOneTarget() *big.Int
+	// HashesPerDiff returns the expected number of hashes to find the share of difficulty 1
+	HashesPerDiff() float64
+}
+
+var (
+	PowSha256d PowAlgorithm = &sha256dPow{diffOne: new(big.Int).Lsh(big.NewInt(0xffff), 208)}
+	PowScrypt  PowAlgorithm = &scryptPow{diffOne: new(big.Int).Lsh(big.NewInt(0xffff), 224)}
+
+	powAlgorithms = []PowAlgorithm{PowSha256d, PowScrypt}
+)
+
+// GetPowAlgorithm returns the algorithm by name
+func GetPowAlgorithm(name string) (PowAlgorithm, bool) {
+	for _, pow := range powAlgorithms {
+		if pow.Name() == name {
+			return pow, true
+		}
+	}
+	return nil, false
+}
+
+// GetPowAlgorithmByURL returns the algorithm set by the URL parameter, sha256d if not set
+func GetPowAlgorithmByURL(destURL *url.URL) (PowAlgorithm, error) {
+	name := destURL.Query().Get(POW_URL_PARAM)
+	if name == "" {
+		return PowSha256d, nil
+	}
+	pow, ok := GetPowAlgorithm(name)
+	if !ok {
+		return nil, lib.WrapError(ErrUnknownPowAlgorithm, fmt.Errorf("%s", name))
+	}
+	return pow, nil
+}
+
+// sha256dPow is the double SHA-256 used by Bitcoin and its forks
+type sha256dPow struct {
+	diffOne *big.Int
+}
+
+func (p *sha256dPow) Name() string {
+	return "sha256d"
+}
+
+func (p *sha256dPow) Hash(header []byte) [32]byte {
+	return sha256d(header)
+}
+
+func (p *sha256dPow) DiffOneTarget() *big.Int {
+	return p.diffOne
+}
+
+func (p *sha256dPow) HashesPerDiff() float64 {
+	return 1 << 32
+}
+
+// scryptPow is the scrypt(N=1024, r=1, p=1) used by Litecoin and Dogecoin. Difficulty 1 share
+// for scrypt pools has 2^16 times bigger target than for sha256d
+type scryptPow struct {
+	diffOne *big.Int
+}
+
+func (p *scryptPow) Name() string {
+	return "scrypt"
+}
+
+func (p *scryptPow) Hash(header []byte) [32]byte {
+	var hash [32]byte
+	// fails only on invalid parameters, which are constant here
+	key, _ := scrypt.Key(header, header, 1024, 1, 1, 32)
+	copy(hash[:], key)
+	return hash
+}
+
+func (p *scryptPow) DiffOneTarget() *big.Int {
+	return p.diffOne
+}
+
+func (p *scryptPow) HashesPerDiff() float64 {
+	return 1 << 16
+}
+
+var _ PowAlgorithm = new(sha256dPow)
+var _ PowAlgorithm = new(scryptPow)
+
+// sha256d is also used for the merkle root regardless of the algorithm of the block header
+func sha256d(data []byte) [32]byte {
+	sum := sha256.Sum256(data)
+	return sha256.Sum256(sum[:])
+}
@@ -0,0 +1,94 @@
+package validator
+
+import (
+	"encoding/hex"
+	"math"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+// litecoin genesis block header
+const ltcGenesisHeader = "01000000000000000000000000000000000000000000000000000000000000000000000" +
+	"0d9ced4ed1130f7b7faad9be25323ffafa33232a17c3edf6cfd97bee6bafbdd97b9aa8e4ef0ff0f1ecd513f7c"
+
+func TestPowHashVectors(t *testing.T) {
+	header, err := hex.DecodeString(ltcGenesisHeader)
+	require.NoError(t, err)
+
+	hash := PowSha256d.Hash(header)
+	require.Equal(t, "12a765e31ffd4059bada1e25190f6e98c99d9714d334efa41a195a7e7e04bfe2", hex.EncodeToString(reverse(hash[:])))
+
+	hash = PowScrypt.Hash(header)
+	require.Equal(t, "0000050c34a64b415b6b15b37f2216634b5b1669cb9a2e38d76f7213b0671e00", hex.EncodeToString(reverse(hash[:])))
+}
+
+func TestValidateDiffPowScrypt(t *testing.T) {
+	msg := GetTestMsg()
+	submit := sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", "64c25820", "0000022c")
+
+	diff, ok := ValidateDiffPow(PowScrypt, msg.xnonce, uint(msg.xnonce2size), 1, "00000000", msg.notify, submit)
+	require.True(t, ok)
+	require.EqualValues(t, 1, diff)
+
+	_, ok = ValidateDiffPow(PowSha256d, msg.xnonce, uint(msg.xnonce2size), 1, "00000000", msg.notify, submit)
+	require.False(t, ok)
+
+	// sha256d share doesn't meet the difficulty of the scrypt job
+	_, ok = ValidateDiffPow(PowScrypt, msg.xnonce, uint(msg.xnonce2size), uint64(msg.diff), msg.vmask, msg.notify, msg.submit1)
+	require.False(t, ok)
+}
+
+func TestValidatorPowAlgorithm(t *testing.T) {
+	msg := GetTestMsg()
+
+	validator := NewValidator(time.Minute)
+	validator.SetPowAlgorithm(PowScrypt)
+	require.NoError(t, validator.AddNewJob(msg.notify, 1, msg.xnonce, msg.xnonce2size))
+
+	job, ok := validator.GetLatestJob()
+	require.True(t, ok)
+	require.Equal(t, PowScrypt, job.GetPowAlgorithm())
+
+	_, _, err := validator.ValidateAndAddShare(sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", "64c25820", "0000022c"))
+	require.NoError(t, err)
+}
+
+func TestGetPowAlgorithmByURL(t *testing.T) {
+	u, _ := url.Parse("stratum+tcp://acc.worker@pool.example.com:3333")
+	pow, err := GetPowAlgorithmByURL(u)
+	require.NoError(t, err)
+	require.Equal(t, PowSha256d, pow)
+
+	u, _ = url.Parse("stratum+tcp://acc.worker@pool.example.com:3333?pow=scrypt")
+	pow, err = GetPowAlgorithmByURL(u)
+	require.NoError(t, err)
+	require.Equal(t, PowScrypt, pow)
+
+	u, _ = url.Parse("stratum+tcp://acc.worker@pool.example.com:3333?pow=x11")
+	_, err = GetPowAlgorithmByURL(u)
+	require.ErrorIs(t, err, ErrUnknownPowAlgorithm)
+}
+
+func TestPowHashesPerDiff(t *testing.T) {
+	// bigger diff 1 target means proportionally less hashes for the share
+	ratio, _ := new(big.Float).Quo(
+		new(big.Float).SetInt(PowScrypt.DiffOneTarget()),
+		new(big.Float).SetInt(PowSha256d.DiffOneTarget()),
+	).Float64()
+	require.Equal(t, ratio, PowSha256d.HashesPerDiff()/PowScrypt.HashesPerDiff())
+	require.Equal(t, math.Pow(2, 32), PowSha256d.HashesPerDiff())
+}
+
+func BenchmarkValidateDiffScrypt(b *testing.B) {
+	msg := GetTestMsg()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ValidateDiffPow(PowScrypt, msg.xnonce, uint(msg.xnonce2size), uint64(msg.diff), msg.vmask, msg.notify, msg.submit1)
+	}
+}
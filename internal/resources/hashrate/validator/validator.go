@@ -10,19 +10,28 @@ import (
 )
 
 const (
-	JOB_CACHE_SIZE = 30
+	JOB_CACHE_SIZE  = 30
+	NTIME_MAX_AHEAD = 7000 * time.Second // maximum ntime ahead of the job time or the wall clock, consensus limit is 2 hours
 )
 
 var (
 	ErrJobNotFound    = errors.New("job not found")
 	ErrDuplicateShare = errors.New("duplicate share")
 	ErrLowDifficulty  = errors.New("low difficulty")
+
+	ErrVersionOutOfMask       = errors.New("version bits outside of the negotiated mask")
+	ErrNtimeOutOfRange        = errors.New("ntime out of range")
+	ErrInvalidExtraNonce2Size = errors.New("invalid extranonce2 size")
+	ErrInvalidHex             = errors.New("invalid hex")
+	ErrInvalidJob             = errors.New("invalid job")
+	ErrInvalidParams          = errors.New("invalid params")
 )
 
 type Validator struct {
 	// state
 	jobs               *lib.BoundStackMap[*MiningJob]
 	versionRollingMask string
+	pow                PowAlgorithm
 	cleanJobTimeout    time.Duration // duration after which jobs are removed from the cache after calling ScheduleCleanJobs()
 }
 
@@ -30,6 +39,7 @@ func NewValidator(cleanJobTimeout time.Duration) *Validator {
 	return &Validator{
 		jobs:               lib.NewBoundStackMap[*MiningJob](JOB_CACHE_SIZE),
 		versionRollingMask: "00000000",
+		pow:                PowSha256d,
 		cleanJobTimeout:    cleanJobTimeout,
 	}
 }
@@ -38,12 +48,26 @@ func (v *Validator) SetVersionRollingMask(mask string) {
 	v.versionRollingMask = mask
 }
 
-func (v *Validator) AddNewJob(msg *sm.MiningNotify, diff float64, xn1 string, xn2size int) {
-	job := NewMiningJob(msg, diff, xn1, xn2size)
+// SetPowAlgorithm sets the algorithm of the jobs added afterwards
+func (v *Validator) SetPowAlgorithm(pow PowAlgorithm) {
+	v.pow = pow
+}
+
+func (v *Validator) GetPowAlgorithm() PowAlgorithm {
+	return v.pow
+}
+
+// AddNewJob caches the job to validate the shares, the malformed job is not added
+func (v *Validator) AddNewJob(msg *sm.MiningNotify, diff float64, xn1 string, xn2size int) error {
+	job, err := NewMiningJob(msg, diff, xn1, xn2size, v.pow)
+	if err != nil {
+		return err
+	}
 	if msg.GetCleanJobs() {
 		v.ScheduleCleanJobs()
 	}
 	v.jobs.Push(msg.GetJobID(), job)
+	return nil
 }
 
 func (v *Validator) HasJob(jobID string) bool {
@@ -60,32 +84,37 @@ func (v *Validator) ScheduleCleanJobs() {
 	})
 }
 
-func (v *Validator) ValidateAndAddShare(msg *sm.MiningSubmit) (float64, error) {
+// ValidateAndAddShare returns the difficulty of the share, and the block candidate if the share meets the network target
+func (v *Validator) ValidateAndAddShare(msg *sm.MiningSubmit) (float64, *BlockCandidate, error) {
 	var (
 		job *MiningJob
 		ok  bool
 	)
 
 	if job, ok = v.jobs.Get(msg.GetJobId()); !ok {
-		return 0, ErrJobNotFound
+		return 0, nil, ErrJobNotFound
 	}
 
 	if !job.expirationTime.IsZero() && job.expirationTime.Before(time.Now()) {
-		return 0, ErrJobNotFound
+		return 0, nil, ErrJobNotFound
+	}
+
+	if err := job.CheckShare(msg, v.versionRollingMask, time.Now()); err != nil {
+		return 0, nil, err
 	}
 
 	if job.CheckDuplicateAndAddShare(msg) {
-		return 0, ErrDuplicateShare
+		return 0, nil, ErrDuplicateShare
 	}
 
-	diff, ok := ValidateDiff(job.extraNonce1, uint(job.extraNonce2Size), uint64(job.diff), v.versionRollingMask, job.notify, msg)
+	diff, ok, candidate := job.ValidateShare(msg, v.versionRollingMask)
 	diffFloat := float64(diff)
 	if !ok {
-		err := lib.WrapError(ErrLowDifficulty, fmt.Errorf("expected %.2f actual %d xn=%s, xnsize=%d, diff=%d, vrmsk=%s", job.diff, diff, job.extraNonce1, uint(job.extraNonce2Size), uint64(job.diff), v.versionRollingMask))
-		return diffFloat, err
+		err := lib.WrapError(ErrLowDifficulty, fmt.Errorf("expected %.2f actual %d xn=%s, xnsize=%d, diff=%d, vrmsk=%s, pow=%s", job.diff, diff, job.extraNonce1, uint(job.extraNonce2Size), uint64(job.diff), v.versionRollingMask, job.pow.Name()))
+		return diffFloat, candidate, err
 	}
 
-	return diffFloat, nil
+	return diffFloat, candidate, nil
 }
 
 func (v *Validator) GetLatestJob() (*MiningJob, bool) {
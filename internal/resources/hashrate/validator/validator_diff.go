@@ -2,7 +2,6 @@ package validator
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -13,7 +12,15 @@ import (
 
 /* The meat... */
 
+// ValidateDiff validates the share of the sha256d job
 func ValidateDiff(en1 string, en2_size uint, job_diff uint64, version_mask string,
+	job *stratumv1_message.MiningNotify, submit *stratumv1_message.MiningSubmit) (uint64, bool) {
+	return ValidateDiffPow(PowSha256d, en1, en2_size, job_diff, version_mask, job, submit)
+}
+
+// ValidateDiffPow validates the share hashing the block header with the algorithm. It decodes
+// the whole job on every call, the cached jobs are validated with MiningJob.ValidateDiff
+func ValidateDiffPow(pow PowAlgorithm, en1 string, en2_size uint, job_diff uint64, version_mask string,
 	job *stratumv1_message.MiningNotify, submit *stratumv1_message.MiningSubmit) (uint64, bool) {
 	var prev_hash string
 	var gen1 string
@@ -62,16 +69,13 @@ func ValidateDiff(en1 string, en2_size uint, job_diff uint64, version_mask strin
 	header.Write(decode_swap(ntime))
 	header.Write(decode_swap(nbits))
 	header.Write(decode_swap(nonce))
-	hash := sha256d(header.Bytes())
+	hash := pow.Hash(header.Bytes())
 
 	/* check result */
 	h := new(big.Int)
-	b := new(big.Int)
 	t := new(big.Int)
 	h.SetBytes(reverse(hash[:]))
-	b.SetUint64(0xffff)
-	b.Lsh(b, 208)
-	t.Div(b, h)
+	t.Div(pow.DiffOneTarget(), h)
 	return t.Uint64(), t.Uint64() >= job_diff
 }
 
@@ -95,6 +99,66 @@ func decode_swap(s string) []byte {
 	return res
 }
 
+// decodeFixed decodes hex string into the slice of the exact size, zero-padded or truncated
+func decodeFixed(size int, s string) []byte {
+	res := make([]byte, size)
+	decodeHexInto(res, s)
+	return res
+}
+
+// decodeHexInto decodes hex string into dst without allocations. Decoding stops at the end of dst
+// or at the first invalid character, the rest of dst is left untouched
+func decodeHexInto(dst []byte, s string) int {
+	n := 0
+	for ; n < len(dst) && 2*n+1 < len(s); n++ {
+		hi, ok1 := fromHexChar(s[2*n])
+		lo, ok2 := fromHexChar(s[2*n+1])
+		if !ok1 || !ok2 {
+			break
+		}
+		dst[n] = hi<<4 | lo
+	}
+	return n
+}
+
+// appendHex appends decoded hex string to dst, stops at the first invalid character
+func appendHex(dst []byte, s string) []byte {
+	for i := 0; i+1 < len(s); i += 2 {
+		hi, ok1 := fromHexChar(s[i])
+		lo, ok2 := fromHexChar(s[i+1])
+		if !ok1 || !ok2 {
+			break
+		}
+		dst = append(dst, hi<<4|lo)
+	}
+	return dst
+}
+
+// isHex returns true if the string is a valid hex encoding of the whole number of bytes
+func isHex(s string) bool {
+	if len(s)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if _, ok := fromHexChar(s[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
 func decode_swap_words(s string) []byte {
 	res, _ := hex.DecodeString(s)
 	for w := 0; w < len(res); w += 4 {
@@ -105,7 +169,9 @@ func decode_swap_words(s string) []byte {
 	return res
 }
 
-func sha256d(data []byte) [32]byte {
-	sum := sha256.Sum256(data)
-	return sha256.Sum256(sum[:])
+// swapWords reverses the byte order of each 4-byte word, len(b) must be a multiple of 4
+func swapWords(b []byte) {
+	for w := 0; w+4 <= len(b); w += 4 {
+		reverse(b[w : w+4])
+	}
 }
@@ -22,6 +22,7 @@ func TestValidatorDiffMalformedMsg(t *testing.T) {}
 
 func BenchmarkValidateDiff(b *testing.B) {
 	msg := GetTestMsg()
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
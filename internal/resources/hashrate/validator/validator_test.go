@@ -1,10 +1,12 @@
 package validator
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
 )
 
 func TestValidatorValidateUniqueShare(t *testing.T) {
@@ -12,12 +14,12 @@ func TestValidatorValidateUniqueShare(t *testing.T) {
 
 	validator := NewValidator(time.Minute)
 	validator.SetVersionRollingMask(msg.vmask)
-	validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size)
+	require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
 
-	_, err := validator.ValidateAndAddShare(msg.submit1)
+	_, _, err := validator.ValidateAndAddShare(msg.submit1)
 	require.NoError(t, err)
 
-	_, err = validator.ValidateAndAddShare(msg.submit2)
+	_, _, err = validator.ValidateAndAddShare(msg.submit2)
 	require.NoError(t, err)
 }
 
@@ -26,12 +28,12 @@ func TestValidatorValidateDuplicateShare(t *testing.T) {
 
 	validator := NewValidator(time.Minute)
 	validator.SetVersionRollingMask(msg.vmask)
-	validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size)
+	require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
 
-	_, err := validator.ValidateAndAddShare(msg.submit1)
+	_, _, err := validator.ValidateAndAddShare(msg.submit1)
 	require.NoError(t, err)
 
-	_, err = validator.ValidateAndAddShare(msg.submit1)
+	_, _, err = validator.ValidateAndAddShare(msg.submit1)
 	require.ErrorIs(t, err, ErrDuplicateShare)
 }
 
@@ -41,15 +43,96 @@ func TestValidatorExpiredJobs(t *testing.T) {
 
 	validator := NewValidator(timeout)
 	validator.SetVersionRollingMask(msg.vmask)
-	validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size)
+	require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
 
-	_, err := validator.ValidateAndAddShare(msg.submit1)
+	_, _, err := validator.ValidateAndAddShare(msg.submit1)
 	require.NoError(t, err)
 
 	validator.ScheduleCleanJobs()
 
 	time.Sleep(2 * timeout)
 
-	_, err = validator.ValidateAndAddShare(msg.submit1)
+	_, _, err = validator.ValidateAndAddShare(msg.submit1)
+	require.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestValidatorShareSanityChecks(t *testing.T) {
+	msg := GetTestMsg()
+
+	cases := []struct {
+		name   string
+		params []string // extranonce2, ntime, nonce and optional version bits
+		err    error
+	}{
+		{"invalid hex extranonce2", []string{"0a0000000000000z", "64c25820", "591d28da", "00092000"}, ErrInvalidHex},
+		{"short extranonce2", []string{"0a000000", "64c25820", "591d28da", "00092000"}, ErrInvalidExtraNonce2Size},
+		{"invalid hex ntime", []string{"0a00000000000000", "64c2582", "591d28da", "00092000"}, ErrInvalidHex},
+		{"invalid hex nonce", []string{"0a00000000000000", "64c25820", "591d28dx", "00092000"}, ErrInvalidHex},
+		{"ntime before job", []string{"0a00000000000000", "64c2581f", "591d28da", "00092000"}, ErrNtimeOutOfRange},
+		{"ntime in future", []string{"0a00000000000000", "ffffffff", "591d28da", "00092000"}, ErrNtimeOutOfRange},
+		{"version out of mask", []string{"0a00000000000000", "64c25820", "591d28da", "20092000"}, ErrVersionOutOfMask},
+		{"invalid hex version", []string{"0a00000000000000", "64c25820", "591d28da", "0009200"}, ErrInvalidHex},
+	}
+
+	for _, c := range cases {
+		validator := NewValidator(time.Minute)
+		validator.SetVersionRollingMask(msg.vmask)
+		require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
+
+		submit := sm.NewMiningSubmit("worker", "2dc3427c2e", c.params[0], c.params[1], c.params[2])
+		if len(c.params) > 3 {
+			submit.Params = append(submit.Params, c.params[3])
+		}
+		_, _, err := validator.ValidateAndAddShare(submit)
+		require.ErrorIs(t, err, c.err, c.name)
+	}
+}
+
+func TestMiningJobNtimeWindow(t *testing.T) {
+	msg := GetTestMsg()
+	job, err := NewMiningJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size, PowSha256d)
+	require.NoError(t, err)
+	jobTime := time.Unix(0x64c25820, 0)
+
+	submit := func(ntime time.Time) *sm.MiningSubmit {
+		return sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", fmt.Sprintf("%08x", ntime.Unix()), "591d28da")
+	}
+
+	// rolled forward from the job time, when the wall clock is behind
+	require.NoError(t, job.CheckShare(submit(jobTime.Add(NTIME_MAX_AHEAD)), msg.vmask, jobTime.Add(-time.Hour)))
+	require.ErrorIs(t, job.CheckShare(submit(jobTime.Add(NTIME_MAX_AHEAD+time.Second)), msg.vmask, jobTime.Add(-time.Hour)), ErrNtimeOutOfRange)
+
+	// rolled forward from the wall clock
+	now := jobTime.Add(time.Hour)
+	require.NoError(t, job.CheckShare(submit(now.Add(NTIME_MAX_AHEAD)), msg.vmask, now))
+	require.ErrorIs(t, job.CheckShare(submit(now.Add(NTIME_MAX_AHEAD+time.Second)), msg.vmask, now), ErrNtimeOutOfRange)
+}
+
+func TestValidatorVersionWithoutMask(t *testing.T) {
+	msg := GetTestMsg()
+
+	// version rolling is not negotiated
+	validator := NewValidator(time.Minute)
+	require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
+
+	_, _, err := validator.ValidateAndAddShare(msg.submit1)
+	require.ErrorIs(t, err, ErrVersionOutOfMask)
+}
+
+func TestValidatorShortSubmit(t *testing.T) {
+	msg := GetTestMsg()
+
+	validator := NewValidator(time.Minute)
+	validator.SetVersionRollingMask(msg.vmask)
+	require.NoError(t, validator.AddNewJob(msg.notify, msg.diff, msg.xnonce, msg.xnonce2size))
+
+	for i := 2; i < SUBMIT_MIN_PARAMS; i++ {
+		submit := sm.NewMiningSubmit("worker", "2dc3427c2e", "0a00000000000000", "64c25820", "591d28da")
+		submit.Params = submit.Params[:i]
+		_, _, err := validator.ValidateAndAddShare(submit)
+		require.ErrorIs(t, err, ErrInvalidParams, "params %d", i)
+	}
+
+	_, _, err := validator.ValidateAndAddShare(&sm.MiningSubmit{Params: []string{"worker"}})
 	require.ErrorIs(t, err, ErrJobNotFound)
 }
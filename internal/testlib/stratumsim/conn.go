@@ -0,0 +1,54 @@
+package stratumsim
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+// lineConn is a minimal stratum v1 connection, it doesn't depend on the proxy package
+// so the simulators can be used in the proxy tests as well
+type lineConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+}
+
+func newLineConn(conn net.Conn) *lineConn {
+	return &lineConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// read returns the next message, unknown messages are skipped
+func (c *lineConn) read() (interfaces.MiningMessageGeneric, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		msg, err := sm.ParseStratumMessage(line)
+		if errors.Is(err, sm.ErrStratumV1Unknown) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+}
+
+func (c *lineConn) write(msg interfaces.MiningMessageGeneric) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err := c.conn.Write(append(msg.Serialize(), lib.CharNewLine))
+	return err
+}
+
+func (c *lineConn) close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,336 @@
+package stratumsim
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+)
+
+const (
+	MINER_VERSION_ROLLING_MASK = "1fffe000"
+	INVALID_JOB_ID             = "invalid-job"
+)
+
+var (
+	ErrMinerDisconnect    = errors.New("simulated miner disconnect")
+	ErrMinerNotAuthorized = errors.New("miner is not authorized")
+	ErrMinerHandshake     = errors.New("miner handshake failed")
+	ErrMinerReconnect     = errors.New("miner was asked to reconnect")
+)
+
+type MinerConfig struct {
+	UserName            string
+	Password            string
+	ContractID          string        // sent in mining.configure to connect to the incoming contract directly
+	VersionRolling      bool          // requests version rolling in mining.configure
+	ExtranonceSubscribe bool          // sends mining.extranonce.subscribe after mining.subscribe
+	IgnoreSetExtranonce bool          // ignores mining.set_extranonce if not subscribed, as some firmware does
+	SharesPerMin        float64       // rate of submitted shares, 0 disables submitting
+	InvalidShareRate    float64       // probability to submit the share for an unknown job, from 0 to 1
+	DisconnectAfter     time.Duration // closes the connection after this duration, 0 disables
+}
+
+type MinerStats struct {
+	Submitted int
+	Accepted  int
+	Rejected  int
+	Jobs      int
+}
+
+// Miner is an in-process stratum v1 miner simulator. Shares are not hashed, so they pass validation
+// only if the difficulty is below 1, see PoolConfig.Difficulty
+type Miner struct {
+	// config
+	cfg MinerConfig
+
+	// state
+	conn               *lineConn
+	requestID          int
+	requests           map[int]string // method of the pending request by its ID
+	versionRollingMask string
+	extraNonce1        string
+	extraNonce2Size    int
+	extraNonce2        uint64
+	difficulty         float64
+	job                *sm.MiningNotify
+	authorized         bool
+	authorizedCh       chan struct{}
+	stats              MinerStats
+	mutex              sync.Mutex
+
+	// deps
+	log interfaces.ILogger
+}
+
+func NewMiner(cfg MinerConfig, log interfaces.ILogger) *Miner {
+	return &Miner{
+		cfg:          cfg,
+		requests:     make(map[int]string),
+		authorizedCh: make(chan struct{}),
+		log:          log,
+	}
+}
+
+// Dial connects to the address and runs the miner
+func (m *Miner) Dial(ctx context.Context, addr string) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.Run(ctx, conn)
+}
+
+// Run performs the handshake and submits shares until the context is done or the connection is closed.
+// Returns ErrMinerReconnect with the requested address if the miner receives client.reconnect
+func (m *Miner) Run(ctx context.Context, conn net.Conn) error {
+	m.conn = newLineConn(conn)
+	defer m.conn.close()
+
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.readLoop()
+		cancel()
+	}()
+
+	err := m.handshake()
+	if err != nil {
+		return lib.WrapError(ErrMinerHandshake, err)
+	}
+
+	var disconnectCh <-chan time.Time
+	if m.cfg.DisconnectAfter > 0 {
+		timer := time.NewTimer(m.cfg.DisconnectAfter)
+		defer timer.Stop()
+		disconnectCh = timer.C
+	}
+
+	var submitCh <-chan time.Time
+	if m.cfg.SharesPerMin > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Minute) / m.cfg.SharesPerMin))
+		defer ticker.Stop()
+		submitCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-readCtx.Done():
+			_ = m.conn.close()
+			readErr := <-errCh
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return readErr
+		case <-disconnectCh:
+			return ErrMinerDisconnect
+		case <-submitCh:
+			err := m.Submit()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WaitAuthorized blocks until the miner is authorized
+func (m *Miner) WaitAuthorized(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.authorizedCh:
+		return nil
+	}
+}
+
+// Submit submits a single share for the latest job, does nothing if there is no job yet
+func (m *Miner) Submit() error {
+	m.mutex.Lock()
+	if m.job == nil || !m.authorized {
+		m.mutex.Unlock()
+		return nil
+	}
+
+	jobID := m.job.GetJobID()
+	if m.cfg.InvalidShareRate > 0 && mathrand.Float64() < m.cfg.InvalidShareRate {
+		jobID = INVALID_JOB_ID
+	}
+
+	m.extraNonce2++
+	extraNonce2 := fmt.Sprintf("%0*x", m.extraNonce2Size*2, m.extraNonce2)
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+
+	msg := sm.NewMiningSubmit(m.cfg.UserName, jobID, extraNonce2, m.job.GetNtime(), hex.EncodeToString(nonce))
+	if m.versionRollingMask != "" {
+		msg.Params = append(msg.Params, randomVersionBits(m.versionRollingMask))
+	}
+	msg.SetID(m.newRequest(sm.MethodMiningSubmit))
+	m.stats.Submitted++
+	m.mutex.Unlock()
+
+	return m.conn.write(msg)
+}
+
+func (m *Miner) GetStats() MinerStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.stats
+}
+
+func (m *Miner) GetDifficulty() float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.difficulty
+}
+
+func (m *Miner) GetExtraNonce() (extraNonce1 string, extraNonce2Size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.extraNonce1, m.extraNonce2Size
+}
+
+func (m *Miner) GetVersionRollingMask() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.versionRollingMask
+}
+
+func (m *Miner) handshake() error {
+	if m.cfg.VersionRolling || m.cfg.ContractID != "" {
+		ext := &sm.MiningConfigureExtensionParams{LMRContractAddress: m.cfg.ContractID}
+		if m.cfg.VersionRolling {
+			ext.VersionRollingMask = MINER_VERSION_ROLLING_MASK
+			ext.VersionRollingMinBitCount = 2
+		}
+		err := m.write(sm.NewMiningConfigure(0, ext), sm.MethodMiningConfigure)
+		if err != nil {
+			return err
+		}
+	}
+	err := m.write(sm.NewMiningSubscribe(0, "stratumsim", ""), sm.MethodMiningSubscribe)
+	if err != nil {
+		return err
+	}
+	if m.cfg.ExtranonceSubscribe {
+		err = m.write(sm.NewMiningExtranonceSubscribe(0), sm.MethodMiningExtranonceSubscribe)
+		if err != nil {
+			return err
+		}
+	}
+	return m.write(sm.NewMiningAuthorize(0, m.cfg.UserName, m.cfg.Password), sm.MethodMiningAuthorize)
+}
+
+func (m *Miner) write(msg i.MiningMessageWithID, method string) error {
+	m.mutex.Lock()
+	msg.SetID(m.newRequest(method))
+	m.mutex.Unlock()
+	return m.conn.write(msg)
+}
+
+// newRequest returns the ID of the new request, should be called with the lock held
+func (m *Miner) newRequest(method string) int {
+	m.requestID++
+	m.requests[m.requestID] = method
+	return m.requestID
+}
+
+func (m *Miner) readLoop() error {
+	for {
+		msg, err := m.conn.read()
+		if err != nil {
+			return err
+		}
+		err = m.handle(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Miner) handle(msg i.MiningMessageGeneric) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch typed := msg.(type) {
+	case *sm.MiningResult:
+		method := m.requests[typed.GetID()]
+		delete(m.requests, typed.GetID())
+		return m.onResult(method, typed)
+	case *sm.MiningSetDifficulty:
+		m.difficulty = typed.GetDifficulty()
+	case *sm.MiningNotify:
+		m.job = typed
+		m.stats.Jobs++
+	case *sm.MiningSetExtranonce:
+		if m.cfg.IgnoreSetExtranonce && !m.cfg.ExtranonceSubscribe {
+			return nil
+		}
+		m.extraNonce1, m.extraNonce2Size = typed.GetExtranonce()
+	case *sm.MiningSetVersionMask:
+		m.versionRollingMask = typed.GetVersionMask()
+	case *sm.ClientReconnect:
+		// the miner disconnects, it is up to the caller to dial the new address
+		return lib.WrapError(ErrMinerReconnect, fmt.Errorf("%s:%d", typed.GetHost(), typed.GetPort()))
+	}
+	return nil
+}
+
+func (m *Miner) onResult(method string, res *sm.MiningResult) error {
+	switch method {
+	case sm.MethodMiningConfigure:
+		configureRes, err := sm.ToMiningConfigureResult(res)
+		if err != nil {
+			return err
+		}
+		if configureRes.GetVersionRolling() {
+			m.versionRollingMask = configureRes.GetVersionRollingMask()
+		}
+	case sm.MethodMiningSubscribe:
+		subscribeRes, err := sm.ToMiningSubscribeResult(res)
+		if err != nil {
+			return err
+		}
+		m.extraNonce1, m.extraNonce2Size = subscribeRes.GetExtranonce()
+	case sm.MethodMiningAuthorize:
+		if res.IsError() {
+			return lib.WrapError(ErrMinerNotAuthorized, fmt.Errorf("%s", res.GetError()))
+		}
+		if !m.authorized {
+			m.authorized = true
+			close(m.authorizedCh)
+		}
+	case sm.MethodMiningSubmit:
+		if res.IsError() {
+			m.stats.Rejected++
+		} else {
+			m.stats.Accepted++
+		}
+	}
+	return nil
+}
+
+// randomVersionBits returns random version bits within the mask
+func randomVersionBits(mask string) string {
+	maskBytes, err := hex.DecodeString(mask)
+	if err != nil || len(maskBytes) != 4 {
+		return "00000000"
+	}
+	bits := make([]byte, 4)
+	binary.BigEndian.PutUint32(bits, mathrand.Uint32()&binary.BigEndian.Uint32(maskBytes))
+	return hex.EncodeToString(bits)
+}
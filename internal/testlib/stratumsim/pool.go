@@ -0,0 +1,464 @@
+package stratumsim
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/interfaces"
+	i "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/interfaces"
+	sm "gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/proxy/stratumv1_message"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/resources/hashrate/validator"
+	"go.uber.org/atomic"
+)
+
+const (
+	DEFAULT_EXTRANONCE1_SIZE = 4
+	DEFAULT_EXTRANONCE2_SIZE = 4
+	JOB_CLEAN_TIMEOUT        = 10 * time.Second
+
+	jobVersion = "20000000"
+	jobNbits   = "1705ae3a"
+	// coinbase of the jobs: gen1, script length, height push, extranonce, gen2
+	jobGen1   = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff"
+	jobHeight = "03e1360c"
+	jobGen2   = "ffffffff0100f2052a010000001976a9147c154ed1dc59609e3d26abb2df2ea3d587cd8c4188ac00000000"
+
+	JobPayoutAddress = "1CK6KHY6MHgYvmRQ4PAafKYDrg1ejbH1cE" // the only output of the coinbase of the jobs
+)
+
+var (
+	ErrPoolDisconnect = errors.New("simulated pool disconnect")
+)
+
+type PoolConfig struct {
+	Difficulty            float64       // share difficulty, the proxy validates shares below 1 as any share
+	JobInterval           time.Duration // interval of new jobs, 0 sends only the initial job
+	ExtraNonce1Size       int           // bytes of the extranonce1 assigned to each connection
+	ExtraNonce2Size       int           // bytes of the extranonce2 rolled by the miner
+	VersionRollingMask    string        // mask allowed for version rolling, empty disables it
+	RejectRate            float64       // probability to reject a valid share, from 0 to 1
+	DisconnectAfterShares int           // closes the connection after this number of shares, 0 disables
+	DisconnectAfter       time.Duration // closes the connection after it is open for this duration, 0 disables
+	SubmitResponseDelay   time.Duration // delay before answering a submit, the shares of the connection are answered in order
+
+	OnMessage func(msg i.MiningMessageGeneric) // called with the messages the pool doesn't handle, e.g. results of the requests sent with Send
+}
+
+type PoolStats struct {
+	Connections int // currently open connections
+	Accepted    int
+	Rejected    int
+}
+
+// Pool is an in-process stratum v1 pool simulator
+type Pool struct {
+	// config
+	cfg PoolConfig
+
+	// state
+	listener          net.Listener
+	sessions          map[*poolSession]struct{}
+	workerShares      map[string]*PoolStats
+	extraNonceCounter atomic.Uint32
+	jobCounter        atomic.Uint32
+	difficulty        atomic.Float64
+	stats             PoolStats
+	mutex             sync.Mutex
+
+	// deps
+	log interfaces.ILogger
+}
+
+func NewPool(cfg PoolConfig, log interfaces.ILogger) *Pool {
+	if cfg.ExtraNonce1Size == 0 {
+		cfg.ExtraNonce1Size = DEFAULT_EXTRANONCE1_SIZE
+	}
+	if cfg.ExtraNonce2Size == 0 {
+		cfg.ExtraNonce2Size = DEFAULT_EXTRANONCE2_SIZE
+	}
+	p := &Pool{
+		cfg:          cfg,
+		sessions:     make(map[*poolSession]struct{}),
+		workerShares: make(map[string]*PoolStats),
+		log:          log,
+	}
+	p.difficulty.Store(cfg.Difficulty)
+	return p
+}
+
+// Listen opens the tcp listener, use "127.0.0.1:0" to pick a free port
+func (p *Pool) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	p.listener = listener
+	return nil
+}
+
+// Addr returns the address of the listener
+func (p *Pool) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// URL returns the pool url with the given credentials
+func (p *Pool) URL(userName string) *url.URL {
+	return &url.URL{Scheme: "stratum+tcp", User: url.UserPassword(userName, "x"), Host: p.Addr()}
+}
+
+// Run accepts connections from the listener and sends new jobs every JobInterval until the context is done
+func (p *Pool) Run(ctx context.Context) error {
+	if p.listener == nil {
+		return fmt.Errorf("pool is not listening")
+	}
+	go func() {
+		<-ctx.Done()
+		_ = p.listener.Close()
+	}()
+
+	if p.cfg.JobInterval > 0 {
+		go p.runJobs(ctx)
+	}
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			err := p.ServeConn(ctx, conn)
+			if err != nil {
+				p.log.Debugf("pool connection closed: %s", err)
+			}
+		}()
+	}
+}
+
+// ServeConn serves a single miner connection, can be used with net.Pipe without listener.
+// Jobs are sent every JobInterval only when Run is called, otherwise use NewJob
+func (p *Pool) ServeConn(ctx context.Context, conn net.Conn) error {
+	s := &poolSession{
+		conn:            newLineConn(conn),
+		pool:            p,
+		extraNonce1:     p.newExtraNonce1(),
+		validator:       validator.NewValidator(JOB_CLEAN_TIMEOUT),
+		authorizedUsers: make(map[string]bool),
+	}
+	p.addSession(s)
+	defer p.removeSession(s)
+	defer s.conn.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		var disconnectCh <-chan time.Time
+		if p.cfg.DisconnectAfter > 0 {
+			timer := time.NewTimer(p.cfg.DisconnectAfter)
+			defer timer.Stop()
+			disconnectCh = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-disconnectCh:
+		}
+		_ = s.conn.close()
+	}()
+
+	return s.run()
+}
+
+// SetDifficulty changes the difficulty of all of the connections
+func (p *Pool) SetDifficulty(diff float64) {
+	p.difficulty.Store(diff)
+	for _, s := range p.getSessions() {
+		s.setDifficulty(diff)
+	}
+}
+
+// NewJob sends a new job to all of the connections
+func (p *Pool) NewJob(cleanJobs bool) {
+	job := p.newJob(cleanJobs)
+	for _, s := range p.getSessions() {
+		s.notify(job)
+	}
+}
+
+// Send writes the message to all of the authorized connections, e.g. client.reconnect or mining.ping
+func (p *Pool) Send(msg i.MiningMessageGeneric) {
+	for _, s := range p.getSessions() {
+		s.mutex.Lock()
+		authorized := s.authorized
+		s.mutex.Unlock()
+
+		if authorized {
+			_ = s.conn.write(msg)
+		}
+	}
+}
+
+// DisconnectAll closes all of the open connections
+func (p *Pool) DisconnectAll() {
+	for _, s := range p.getSessions() {
+		_ = s.conn.close()
+	}
+}
+
+func (p *Pool) GetStats() PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := p.stats
+	stats.Connections = len(p.sessions)
+	return stats
+}
+
+// GetWorkerStats returns share counters of the worker name used in submits
+func (p *Pool) GetWorkerStats(workerName string) PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if stats, ok := p.workerShares[workerName]; ok {
+		return *stats
+	}
+	return PoolStats{}
+}
+
+func (p *Pool) runJobs(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.JobInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.NewJob(false)
+		}
+	}
+}
+
+func (p *Pool) newJob(cleanJobs bool) *sm.MiningNotify {
+	prevHash := make([]byte, 32)
+	_, _ = rand.Read(prevHash)
+	ntime := make([]byte, 4)
+	binary.BigEndian.PutUint32(ntime, uint32(time.Now().Unix()))
+
+	return sm.NewMiningNotify(
+		fmt.Sprintf("%x", p.jobCounter.Inc()),
+		hex.EncodeToString(prevHash),
+		p.jobGen1(), jobGen2, []string{},
+		jobVersion, jobNbits, hex.EncodeToString(ntime),
+		cleanJobs,
+	)
+}
+
+// jobGen1 returns the first part of the coinbase, the script contains the height and the extranonce
+func (p *Pool) jobGen1() string {
+	scriptLen := len(jobHeight)/2 + p.cfg.ExtraNonce1Size + p.cfg.ExtraNonce2Size
+	return fmt.Sprintf("%s%02x%s", jobGen1, scriptLen, jobHeight)
+}
+
+func (p *Pool) newExtraNonce1() string {
+	return fmt.Sprintf("%0*x", p.cfg.ExtraNonce1Size*2, p.extraNonceCounter.Inc())
+}
+
+func (p *Pool) onShare(workerName string, accepted bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	worker, ok := p.workerShares[workerName]
+	if !ok {
+		worker = &PoolStats{}
+		p.workerShares[workerName] = worker
+	}
+	if accepted {
+		p.stats.Accepted++
+		worker.Accepted++
+	} else {
+		p.stats.Rejected++
+		worker.Rejected++
+	}
+}
+
+func (p *Pool) addSession(s *poolSession) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.sessions[s] = struct{}{}
+}
+
+func (p *Pool) removeSession(s *poolSession) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.sessions, s)
+}
+
+func (p *Pool) getSessions() []*poolSession {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	sessions := make([]*poolSession, 0, len(p.sessions))
+	for s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// poolSession is a single miner connection to the pool
+type poolSession struct {
+	conn            *lineConn
+	pool            *Pool
+	extraNonce1     string
+	validator       *validator.Validator
+	authorizedUsers map[string]bool
+	authorized      bool
+	difficulty      float64
+	shares          int
+	mutex           sync.Mutex
+}
+
+func (s *poolSession) run() error {
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			return err
+		}
+		err = s.handle(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *poolSession) handle(msg i.MiningMessageGeneric) error {
+	cfg := s.pool.cfg
+
+	switch typed := msg.(type) {
+	case *sm.MiningConfigure:
+		mask, _ := typed.GetVersionRolling()
+		if cfg.VersionRollingMask == "" || mask == "" {
+			return s.conn.write(sm.NewMiningConfigureResult(typed.GetID(), false, ""))
+		}
+		negotiated := negotiateMask(mask, cfg.VersionRollingMask)
+		s.mutex.Lock()
+		s.validator.SetVersionRollingMask(negotiated)
+		s.mutex.Unlock()
+		return s.conn.write(sm.NewMiningConfigureResult(typed.GetID(), true, negotiated))
+
+	case *sm.MiningSubscribe:
+		return s.conn.write(sm.NewMiningSubscribeResult(typed.GetID(), s.extraNonce1, cfg.ExtraNonce2Size))
+
+	case *sm.MiningExtranonceSubscribe:
+		return s.conn.write(sm.NewMiningResultSuccess(typed.GetID()))
+
+	case *sm.MiningAuthorize:
+		s.mutex.Lock()
+		s.authorizedUsers[typed.GetUserName()] = true
+		first := !s.authorized
+		s.authorized = true
+		s.mutex.Unlock()
+
+		err := s.conn.write(sm.NewMiningResultSuccess(typed.GetID()))
+		if err != nil || !first {
+			return err
+		}
+		s.setDifficulty(s.pool.difficulty.Load())
+		s.notify(s.pool.newJob(true))
+		return nil
+
+	case *sm.MiningSubmit:
+		return s.onSubmit(typed)
+
+	default:
+		if cfg.OnMessage != nil {
+			cfg.OnMessage(msg)
+		}
+	}
+	return nil
+}
+
+func (s *poolSession) onSubmit(msg *sm.MiningSubmit) error {
+	s.mutex.Lock()
+	var res *sm.MiningResult
+	if !s.authorizedUsers[msg.GetUserName()] {
+		res = sm.NewMiningResultFalse(msg.GetID())
+	} else {
+		_, _, err := s.validator.ValidateAndAddShare(msg)
+		switch {
+		case errors.Is(err, validator.ErrJobNotFound):
+			res = sm.NewMiningResultJobNotFound(msg.GetID())
+		case errors.Is(err, validator.ErrDuplicateShare):
+			res = sm.NewMiningResultDuplicatedShare(msg.GetID())
+		case errors.Is(err, validator.ErrLowDifficulty):
+			res = sm.NewMiningResultLowDifficulty(msg.GetID())
+		case s.pool.cfg.RejectRate > 0 && mathrand.Float64() < s.pool.cfg.RejectRate:
+			res = sm.NewMiningResultFalse(msg.GetID())
+		default:
+			res = sm.NewMiningResultSuccess(msg.GetID())
+		}
+	}
+	s.shares++
+	shares := s.shares
+	s.mutex.Unlock()
+
+	s.pool.onShare(msg.GetUserName(), !res.IsError())
+
+	if s.pool.cfg.SubmitResponseDelay > 0 {
+		time.Sleep(s.pool.cfg.SubmitResponseDelay)
+	}
+
+	err := s.conn.write(res)
+	if err != nil {
+		return err
+	}
+
+	if s.pool.cfg.DisconnectAfterShares > 0 && shares >= s.pool.cfg.DisconnectAfterShares {
+		return ErrPoolDisconnect
+	}
+	return nil
+}
+
+func (s *poolSession) setDifficulty(diff float64) {
+	s.mutex.Lock()
+	s.difficulty = diff
+	authorized := s.authorized
+	s.mutex.Unlock()
+
+	if authorized {
+		_ = s.conn.write(sm.NewMiningSetDifficulty(diff))
+	}
+}
+
+func (s *poolSession) notify(job *sm.MiningNotify) {
+	s.mutex.Lock()
+	if !s.authorized {
+		s.mutex.Unlock()
+		return
+	}
+	_ = s.validator.AddNewJob(job, s.difficulty, s.extraNonce1, s.pool.cfg.ExtraNonce2Size)
+	s.mutex.Unlock()
+
+	_ = s.conn.write(job)
+}
+
+// negotiateMask returns the bits allowed by both masks
+func negotiateMask(requested, allowed string) string {
+	r, err := hex.DecodeString(requested)
+	if err != nil || len(r) != 4 {
+		return allowed
+	}
+	a, err := hex.DecodeString(allowed)
+	if err != nil || len(a) != 4 {
+		return requested
+	}
+	res := make([]byte, 4)
+	binary.BigEndian.PutUint32(res, binary.BigEndian.Uint32(r)&binary.BigEndian.Uint32(a))
+	return hex.EncodeToString(res)
+}
@@ -0,0 +1,126 @@
+package stratumsim
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/TitanInd/proxy/proxy-router-v3/internal/lib"
+)
+
+func runPipe(t *testing.T, pool *Pool, miner *Miner) (cancel func(), minerErrCh chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	minerConn, poolConn := net.Pipe()
+	minerErrCh = make(chan error, 1)
+
+	go func() { _ = pool.ServeConn(ctx, poolConn) }()
+	go func() { minerErrCh <- miner.Run(ctx, minerConn) }()
+	t.Cleanup(cancel)
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	require.NoError(t, miner.WaitAuthorized(waitCtx))
+
+	return cancel, minerErrCh
+}
+
+func TestMinerSubmitsToPool(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001, ExtraNonce2Size: 8, VersionRollingMask: "1fffe000"}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", VersionRolling: true, SharesPerMin: 6000}, log)
+	runPipe(t, pool, miner)
+
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted >= 5 }, 5*time.Second, 10*time.Millisecond)
+	pool.NewJob(false)
+	require.Eventually(t, func() bool { return miner.GetStats().Jobs == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	stats := miner.GetStats()
+	require.Zero(t, stats.Rejected)
+	require.Equal(t, "1fffe000", miner.GetVersionRollingMask())
+	require.Equal(t, 0.001, miner.GetDifficulty())
+
+	xn1, xn2size := miner.GetExtraNonce()
+	require.Len(t, xn1, DEFAULT_EXTRANONCE1_SIZE*2)
+	require.Equal(t, 8, xn2size)
+
+	require.GreaterOrEqual(t, pool.GetWorkerStats("acc1.rig1").Accepted, 5)
+}
+
+func TestPoolRejects(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001, RejectRate: 1}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000}, log)
+	runPipe(t, pool, miner)
+
+	require.Eventually(t, func() bool { return miner.GetStats().Rejected >= 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Zero(t, miner.GetStats().Accepted)
+	require.Zero(t, pool.GetStats().Accepted)
+}
+
+func TestMinerInvalidShares(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000, InvalidShareRate: 1}, log)
+	runPipe(t, pool, miner)
+
+	require.Eventually(t, func() bool { return miner.GetStats().Rejected >= 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Zero(t, miner.GetStats().Accepted)
+}
+
+func TestPoolLowDifficulty(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 1e12}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1"}, log)
+	runPipe(t, pool, miner)
+
+	require.Eventually(t, func() bool { return miner.GetStats().Jobs == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, miner.Submit())
+	require.Eventually(t, func() bool { return miner.GetStats().Rejected == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPoolDisconnectAfterShares(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001, DisconnectAfterShares: 2}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000}, log)
+	_, errCh := runPipe(t, pool, miner)
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "miner is not disconnected")
+	}
+	require.Equal(t, 2, pool.GetStats().Accepted)
+	require.Eventually(t, func() bool { return pool.GetStats().Connections == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMinerDisconnectAfter(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001}, log)
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", DisconnectAfter: 50 * time.Millisecond}, log)
+	_, errCh := runPipe(t, pool, miner)
+
+	require.ErrorIs(t, <-errCh, ErrMinerDisconnect)
+}
+
+func TestPoolOverTCP(t *testing.T) {
+	log := lib.NewTestLogger()
+	pool := NewPool(PoolConfig{Difficulty: 0.001, JobInterval: 20 * time.Millisecond}, log)
+	require.NoError(t, pool.Listen("127.0.0.1:0"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = pool.Run(ctx) }()
+
+	miner := NewMiner(MinerConfig{UserName: "acc1.rig1", SharesPerMin: 6000}, log)
+	go func() { _ = miner.Dial(ctx, pool.Addr()) }()
+
+	require.Eventually(t, func() bool { return miner.GetStats().Accepted >= 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, pool.GetStats().Connections)
+	require.Eventually(t, func() bool { return miner.GetStats().Jobs >= 3 }, 5*time.Second, 10*time.Millisecond)
+
+	pool.SetDifficulty(0.002)
+	require.Eventually(t, func() bool { return miner.GetDifficulty() == 0.002 }, 5*time.Second, 10*time.Millisecond)
+}